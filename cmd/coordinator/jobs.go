@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// backgroundJobs are the coordinator's background goroutines, split into
+// two groups so they stop in order: the feeder (batch producer) first, then
+// periodic workers. Each group is waited for so the DB pool isn't closed
+// under in-flight queries.
+type backgroundJobs struct {
+	feeder      []func(context.Context)
+	workers     []func(context.Context)
+	stopTimeout time.Duration // Per group
+}
+
+// run starts every job and blocks until ctx is canceled and the jobs have
+// stopped, or stopTimeout has passed for a group.
+func (b *backgroundJobs) run(ctx context.Context) {
+	feederCtx, cancelFeeder := context.WithCancel(context.Background())
+	defer cancelFeeder()
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+
+	var feederWG, workersWG sync.WaitGroup
+	for _, job := range b.workers {
+		workersWG.Go(func() { job(workersCtx) })
+	}
+	for _, job := range b.feeder {
+		feederWG.Go(func() { job(feederCtx) })
+	}
+
+	<-ctx.Done()
+
+	// Batch inserts are transactional, so an interrupted insert rolls back
+	// and is redone from processed_lines on the next start
+	cancelFeeder()
+	if !waitTimeout(&feederWG, b.stopTimeout) {
+		slog.Warn("Shutdown: timed out waiting for feeder")
+	}
+
+	cancelWorkers()
+	if !waitTimeout(&workersWG, b.stopTimeout) {
+		slog.Warn("Shutdown: timed out waiting for background workers")
+	}
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,31 +21,80 @@ import (
 	"github.com/locplace/scanner/internal/coordinator"
 	"github.com/locplace/scanner/internal/coordinator/db"
 	"github.com/locplace/scanner/internal/coordinator/feeder"
+	"github.com/locplace/scanner/internal/coordinator/handlers"
+	"github.com/locplace/scanner/internal/coordinator/leader"
 	"github.com/locplace/scanner/internal/coordinator/metrics"
+	"github.com/locplace/scanner/internal/coordinator/middleware"
 	"github.com/locplace/scanner/internal/coordinator/reaper"
+	"github.com/locplace/scanner/internal/coordinator/rescanner"
+	"github.com/locplace/scanner/internal/coordinator/snapshotter"
+	"github.com/locplace/scanner/internal/httpserver"
+	"github.com/locplace/scanner/internal/logging"
 	"github.com/locplace/scanner/migrations"
+	"github.com/locplace/scanner/pkg/api"
 )
 
 func main() {
+	if err := logging.Setup(os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "error", err)
+	}
+
 	// Configuration from environment
 	databaseURL := getEnv("DATABASE_URL", "postgres://localhost:5432/locscanner?sslmode=disable")
-	dbMaxConns := parseInt("DB_MAX_CONNS", 0) // 0 = use pgxpool default
+	dbMaxConns := parseInt("DB_MAX_CONNS", 0) // 0 = from DATABASE_URL or pgxpool default
+	dbMinConns := parseInt("DB_MIN_CONNS", 0)
+	dbMaxConnLifetime := parseDuration("DB_MAX_CONN_LIFETIME", 0)
 	adminAPIKey := os.Getenv("ADMIN_API_KEY")
 	listenAddr := getEnv("LISTEN_ADDR", ":8080")
 	metricsAddr := getEnv("METRICS_ADDR", ":9090")
 	metricsInterval := parseDuration("METRICS_INTERVAL", 15*time.Second)
 	heartbeatTimeout := parseDuration("HEARTBEAT_TIMEOUT", 2*time.Minute)
 	reaperInterval := parseDuration("REAPER_INTERVAL", 60*time.Second)
+	reaperJitter := parseFloat("REAPER_JITTER", 0) // fraction of REAPER_INTERVAL
 	batchTimeout := parseDuration("BATCH_TIMEOUT", 10*time.Minute)
+	batchMaxAttempts := parseInt("BATCH_MAX_ATTEMPTS", 5)      // 0 = never quarantine
+	sessionTTL := parseDuration("SESSION_TTL", 7*24*time.Hour) // 0 = keep sessions
+	statsSnapshotInterval := parseDuration("STATS_SNAPSHOT_INTERVAL", time.Hour)
+	staleRescanAfter := parseDuration("STALE_RESCAN_AFTER", 0) // 0 = disabled
+	staleRescanInterval := parseDuration("STALE_RESCAN_INTERVAL", time.Hour)
+	staleRescanMaxPerRun := parseInt("STALE_RESCAN_MAX_PER_RUN", 10000)
+	missingPruneAfter := parseDuration("MISSING_PRUNE_AFTER", 0)         // 0 = keep missing records
+	shutdownTimeout := parseDuration("SHUTDOWN_TIMEOUT", 10*time.Second) // per stage
+	leaderElection := parseBool("LEADER_ELECTION", false)
+	leaderRetryInterval := parseDuration("LEADER_RETRY_INTERVAL", 15*time.Second)
+	leaderCheckInterval := parseDuration("LEADER_CHECK_INTERVAL", 5*time.Second)
+	maxRequestBodyBytes := parseInt("MAX_REQUEST_BODY_BYTES", handlers.DefaultMaxBodyBytes)
+	overwriteMismatchedCoords := parseBool("LOC_OVERWRITE_MISMATCHED", false)
+	timeouts := serverTimeouts()
+	streamWriteTimeout := parseDuration("STREAM_WRITE_TIMEOUT", 10*time.Minute) // 0 = none
+	publicRateLimit := parseInt("PUBLIC_RATE_LIMIT", 600)                       // per minute per IP; 0 = unlimited
+	corsAllowedOrigins := parseList("CORS_ALLOWED_ORIGINS")                     // empty = CORS disabled
+	corsAllowedMethods := parseListDefault("CORS_ALLOWED_METHODS", []string{"GET", "HEAD"})
+	corsAllowedHeaders := parseListDefault("CORS_ALLOWED_HEADERS", []string{"If-None-Match"})
+
+	// Settings recommended to scanners (0 = each scanner's own)
+	scannerConfig := api.ScannerConfigResponse{
+		BatchCount:             parseInt("SCANNER_BATCH_COUNT", 0),
+		EmptyQueueDelaySeconds: int(parseDuration("SCANNER_EMPTY_QUEUE_DELAY", 0).Seconds()),
+		MaxConcurrentLookups:   parseInt("SCANNER_MAX_CONCURRENT_LOOKUPS", 0),
+	}
 
 	// Feeder configuration
+	feederEnabled := parseBool("FEEDER_ENABLED", true) // false = manual scans only
 	batchSize := parseInt("BATCH_SIZE", 1000)
 	maxPendingBatches := parseInt("MAX_PENDING_BATCHES", 20)
 	feederPollInterval := parseDuration("FEEDER_POLL_INTERVAL", 5*time.Second)
+	feederRediscoverIdle := parseDuration("FEEDER_REDISCOVER_IDLE", 0) // 0 = disabled
+	feederRediscoverMinInterval := parseDuration("FEEDER_REDISCOVER_MIN_INTERVAL", 6*time.Hour)
+	feederShuffleWindow := parseInt("FEEDER_SHUFFLE_WINDOW", 0) // 0 = file order
+	feederFileInclude := parseList("FEEDER_FILE_INCLUDE")
+	feederFileExclude := parseList("FEEDER_FILE_EXCLUDE")
+	feederConcurrency := parseInt("FEEDER_CONCURRENCY", 1)
+	feederHTTPMaxRetries := parseInt("FEEDER_HTTP_MAX_RETRIES", feeder.DefaultRetryConfig().MaxRetries)
 	githubToken := os.Getenv("GITHUB_TOKEN") // Optional: for LFS downloads
 
 	if adminAPIKey == "" {
-		log.Fatal("ADMIN_API_KEY environment variable is required")
+		fatal("ADMIN_API_KEY environment variable is required")
 	}
 
 	// Register Prometheus metrics
@@ -52,120 +103,258 @@ func main() {
 	// Connect to database
 	ctx := context.Background()
 	database, err := db.New(ctx, db.Config{
-		URL:      databaseURL,
-		MaxConns: int32(dbMaxConns),
+		URL:             databaseURL,
+		MaxConns:        int32(dbMaxConns),
+		MinConns:        int32(dbMinConns),
+		MaxConnLifetime: dbMaxConnLifetime,
 	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", "error", err)
 	}
-	defer database.Close()
-	log.Println("Connected to database")
+	slog.Info("Connected to database")
 
 	// Run migrations
 	if err := runMigrations(databaseURL); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
-	}
-
-	// Create server
-	cfg := coordinator.Config{
-		AdminAPIKey:      adminAPIKey,
-		HeartbeatTimeout: heartbeatTimeout,
-	}
-	handler := coordinator.NewServer(database, cfg)
-
-	// Wrap with metrics middleware
-	server := &http.Server{
-		Addr:         listenAddr,
-		Handler:      metrics.Middleware(handler),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		fatal("Failed to run migrations", "error", err)
 	}
 
-	// Create background context for all goroutines
-	bgCtx, cancelBg := context.WithCancel(context.Background())
-	defer cancelBg()
+	// Background jobs run on every replica, or only the leader with leader election
+	jobs := &backgroundJobs{stopTimeout: shutdownTimeout}
 
-	// Start metrics updater
+	// Metrics updater
 	metricsUpdater := metrics.NewUpdater(database, metrics.UpdaterConfig{
 		Interval:         metricsInterval,
 		HeartbeatTimeout: heartbeatTimeout,
 	})
-	go metricsUpdater.Run(bgCtx)
+	jobs.workers = append(jobs.workers, metricsUpdater.Run)
+
+	// Stats snapshotter (for /api/public/stats/history)
+	statsSnapshotter := snapshotter.New(database, snapshotter.Config{
+		Interval:         statsSnapshotInterval,
+		HeartbeatTimeout: heartbeatTimeout,
+	})
+	jobs.workers = append(jobs.workers, statsSnapshotter.Run)
+
+	// Stale record rescanner (re-verifies records not seen recently and
+	// prunes ones that stay missing)
+	if staleRescanAfter > 0 || missingPruneAfter > 0 {
+		staleRescanner := rescanner.New(database, rescanner.Config{
+			Interval:   staleRescanInterval,
+			StaleAfter: staleRescanAfter,
+			BatchSize:  batchSize,
+			MaxPerRun:  staleRescanMaxPerRun,
+			PruneAfter: missingPruneAfter,
+		})
+		jobs.workers = append(jobs.workers, staleRescanner.Run)
+	}
 
 	// Start metrics HTTP server
 	metricsServer := &http.Server{
 		Addr:    metricsAddr,
 		Handler: promhttp.Handler(),
 	}
-	go func() {
-		log.Printf("Metrics server listening on %s", metricsAddr)
-		if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("Metrics server error: %v", err)
-		}
-	}()
+	metricsErrs, err := httpserver.Start(metricsServer)
+	if err != nil {
+		fatal("Failed to start metrics server (set METRICS_ADDR to use another address)", "addr", metricsAddr, "error", err)
+	}
+	slog.Info("Metrics server listening", "addr", metricsAddr)
 
-	// Start reaper (handles stale batches and dead clients)
+	// Reaper (handles stale batches and dead clients)
 	r := &reaper.Reaper{
 		DB:               database,
 		Interval:         reaperInterval,
 		BatchTimeout:     batchTimeout,
 		HeartbeatTimeout: heartbeatTimeout,
+		MaxAttempts:      batchMaxAttempts,
+		SessionTTL:       sessionTTL,
+		Jitter:           reaperJitter,
 	}
-	go r.Run(bgCtx)
+	jobs.workers = append(jobs.workers, r.Run)
 
-	// Start feeder (batch producer)
+	// Feeder (batch producer)
 	feederCfg := feeder.Config{
-		BatchSize:         batchSize,
-		MaxPendingBatches: maxPendingBatches,
-		PollInterval:      feederPollInterval,
-		GitHubToken:       githubToken,
+		BatchSize:             batchSize,
+		MaxPendingBatches:     maxPendingBatches,
+		PollInterval:          feederPollInterval,
+		GitHubToken:           githubToken,
+		RediscoverIdleTime:    feederRediscoverIdle,
+		RediscoverMinInterval: feederRediscoverMinInterval,
+		ShuffleWindow:         feederShuffleWindow,
+		FileIncludeGlobs:      feederFileInclude,
+		FileExcludeGlobs:      feederFileExclude,
+		HTTPMaxRetries:        feederHTTPMaxRetries,
+		FeederConcurrency:     feederConcurrency,
 	}
-	if githubToken != "" {
-		log.Println("Feeder: using authenticated GitHub LFS downloads")
+	var f *feeder.Feeder
+	var capacity *feeder.CapacitySignal
+	if feederEnabled {
+		if githubToken != "" {
+			slog.Info("Feeder: using authenticated GitHub LFS downloads")
+		} else {
+			slog.Warn("Feeder: no GITHUB_TOKEN set, LFS downloads may fail due to repo quota")
+		}
+		f = feeder.New(database, feederCfg)
+		capacity = f.Capacity
+		jobs.feeder = append(jobs.feeder, f.Run)
+
+		// Initial file discovery (non-blocking)
+		jobs.feeder = append(jobs.feeder, func(ctx context.Context) {
+			slog.Info("Starting initial file discovery")
+			count, err := feeder.DiscoverAndInsertFiles(ctx, database, githubToken)
+			if err != nil {
+				slog.Error("Initial file discovery failed", "error", err)
+				return
+			}
+			slog.Info("Initial file discovery complete", "files", count)
+		})
 	} else {
-		log.Println("Feeder: WARNING - no GITHUB_TOKEN set, LFS downloads may fail due to repo quota")
+		slog.Info("Feeder disabled: only manual scan and rescan batches will be queued")
 	}
-	f := feeder.New(database, feederCfg)
-	go f.Run(bgCtx)
 
-	// Initial file discovery (non-blocking)
-	go func() {
-		log.Println("Starting initial file discovery...")
-		count, err := feeder.DiscoverAndInsertFiles(bgCtx, database)
-		if err != nil {
-			log.Printf("Initial file discovery failed: %v", err)
-			return
+	// Start background jobs, campaigning for leadership first if enabled
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobsDone := make(chan struct{})
+	var elector *leader.Elector
+	if leaderElection {
+		elector = &leader.Elector{
+			Acquire: func(ctx context.Context) (leader.Lock, error) {
+				lock, err := database.AcquireLeadership(ctx, db.LeaderLockKey)
+				if lock == nil {
+					return nil, err // Avoid a non-nil interface holding a nil lock
+				}
+				return lock, nil
+			},
+			RetryInterval: leaderRetryInterval,
+			CheckInterval: leaderCheckInterval,
 		}
-		log.Printf("Initial file discovery complete: %d files", count)
-	}()
+		go func() {
+			defer close(jobsDone)
+			elector.Run(jobsCtx, jobs.run)
+		}()
+	} else {
+		metrics.Leader.Set(1)
+		go func() {
+			defer close(jobsDone)
+			jobs.run(jobsCtx)
+		}()
+	}
+
+	// Followers don't run the feeder or reaper, which doesn't make them unready
+	running := func(component func() bool) func() bool {
+		return func() bool { return (elector != nil && !elector.Leader()) || component() }
+	}
+	components := map[string]func() bool{"reaper": running(r.Running)}
+	if f != nil {
+		components["feeder"] = running(f.Running)
+	}
+
+	// Create server
+	recordHub := handlers.NewRecordHub()
+	cfg := coordinator.Config{
+		AdminAPIKey:               adminAPIKey,
+		HeartbeatTimeout:          heartbeatTimeout,
+		MaxRequestBodyBytes:       int64(maxRequestBodyBytes),
+		OverwriteMismatchedCoords: overwriteMismatchedCoords,
+		GitHubToken:               githubToken,
+		BatchSize:                 batchSize,
+		Capacity:                  capacity,
+		Feeder:                    f,
+		RecordHub:                 recordHub,
+		PublicRateLimit:           publicRateLimit,
+		StreamWriteTimeout:        streamWriteTimeout,
+		ScannerConfig:             scannerConfig,
+		CORS: middleware.CORSConfig{
+			AllowedOrigins: corsAllowedOrigins,
+			AllowedMethods: corsAllowedMethods,
+			AllowedHeaders: corsAllowedHeaders,
+			ExposedHeaders: []string{"ETag", "Retry-After"},
+			MaxAge:         time.Hour,
+		},
+		Components: components,
+	}
+	handler := coordinator.NewServer(database, cfg)
+
+	// Wrap with metrics middleware
+	server := &http.Server{
+		Addr:    listenAddr,
+		Handler: metrics.Middleware(handler),
+	}
+	timeouts.Apply(server)
+	// Shutdown waits for active connections, so end record streams promptly
+	server.RegisterOnShutdown(recordHub.Close)
 
 	// Start main server
-	go func() {
-		log.Printf("Coordinator listening on %s", listenAddr)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
-		}
-	}()
+	serverErrs, err := httpserver.Start(server)
+	if err != nil {
+		fatal("Failed to start server", "addr", listenAddr, "error", err)
+	}
+	slog.Info("Coordinator listening", "addr", listenAddr)
 
-	// Wait for shutdown signal
+	// Wait for shutdown signal; either server failing is fatal, since
+	// running without metrics would leave operators blind
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	<-stop
-
-	log.Println("Shutting down...")
-	cancelBg() // Stop all background goroutines
+	select {
+	case <-stop:
+	case err := <-serverErrs:
+		fatal("Server error", "error", err)
+	case err := <-metricsErrs:
+		fatal("Metrics server error", "error", err)
+	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	slog.Info("Shutting down")
 
-	// Shutdown both servers
+	// 1. Stop accepting HTTP requests and let in-flight ones finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		slog.Error("Server shutdown error", "error", err)
 	}
 	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Metrics server shutdown error: %v", err)
+		slog.Error("Metrics server shutdown error", "error", err)
+	}
+	cancel()
+
+	// 2. Stop the feeder, then the reaper, metrics updater, and other
+	// workers, and give up leadership
+	stopJobs()
+	<-jobsDone
+
+	// 3. Close the database once nothing is using it
+	database.Close()
+	slog.Info("Goodbye")
+}
+
+// fatal logs an error and exits, as log.Fatal would.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// waitTimeout waits for wg, giving up after d. Returns false on timeout.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// serverTimeouts reads the API server's timeouts from the environment.
+func serverTimeouts() httpserver.Timeouts {
+	def := httpserver.DefaultTimeouts()
+	return httpserver.Timeouts{
+		Read:       parseDuration("READ_TIMEOUT", def.Read),
+		ReadHeader: parseDuration("READ_HEADER_TIMEOUT", def.ReadHeader),
+		Write:      parseDuration("WRITE_TIMEOUT", def.Write),
+		Idle:       parseDuration("IDLE_TIMEOUT", def.Idle),
 	}
-	log.Println("Goodbye")
 }
 
 func getEnv(key, defaultVal string) string {
@@ -182,7 +371,7 @@ func parseDuration(key string, defaultVal time.Duration) time.Duration {
 	}
 	d, err := time.ParseDuration(s)
 	if err != nil {
-		log.Printf("Invalid duration for %s: %v, using default", key, err)
+		slog.Warn("Invalid duration, using default", "key", key, "error", err)
 		return defaultVal
 	}
 	return d
@@ -195,12 +384,57 @@ func parseInt(key string, defaultVal int) int {
 	}
 	v, err := strconv.Atoi(s)
 	if err != nil {
-		log.Printf("Invalid int for %s: %v, using default", key, err)
+		slog.Warn("Invalid int, using default", "key", key, "error", err)
+		return defaultVal
+	}
+	return v
+}
+
+func parseFloat(key string, defaultVal float64) float64 {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultVal
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		slog.Warn("Invalid float, using default", "key", key, "error", err)
+		return defaultVal
+	}
+	return v
+}
+
+func parseBool(key string, defaultVal bool) bool {
+	s := os.Getenv(key)
+	if s == "" {
+		return defaultVal
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		slog.Warn("Invalid bool, using default", "key", key, "error", err)
 		return defaultVal
 	}
 	return v
 }
 
+// parseList splits a comma-separated env var, dropping empty entries.
+func parseList(key string) []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// parseListDefault is parseList, returning def when the variable is unset or empty.
+func parseListDefault(key string, def []string) []string {
+	if list := parseList(key); len(list) > 0 {
+		return list
+	}
+	return def
+}
+
 func runMigrations(databaseURL string) error {
 	// Create migration source from embedded files
 	source, err := iofs.New(migrations.FS, ".")
@@ -220,6 +454,6 @@ func runMigrations(databaseURL string) error {
 		return err
 	}
 
-	log.Println("Migrations completed")
+	slog.Info("Migrations completed")
 	return nil
 }
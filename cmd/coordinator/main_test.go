@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/internal/httpserver"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"unset", "", time.Minute},
+		{"valid", "90s", 90 * time.Second},
+		{"zero", "0", 0},
+		{"invalid", "soon", time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_DURATION", tt.value)
+			if got := parseDuration("TEST_DURATION", time.Minute); got != tt.want {
+				t.Errorf("parseDuration = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "1m")
+	t.Setenv("READ_HEADER_TIMEOUT", "5s")
+	t.Setenv("WRITE_TIMEOUT", "0")
+	t.Setenv("IDLE_TIMEOUT", "") // Keeps the default
+
+	got := serverTimeouts()
+	want := httpserver.Timeouts{
+		Read:       time.Minute,
+		ReadHeader: 5 * time.Second,
+		Write:      0,
+		Idle:       httpserver.DefaultTimeouts().Idle,
+	}
+	if got != want {
+		t.Fatalf("serverTimeouts() = %+v, want %+v", got, want)
+	}
+
+	srv := &http.Server{}
+	got.Apply(srv)
+	if srv.ReadTimeout != want.Read || srv.ReadHeaderTimeout != want.ReadHeader ||
+		srv.WriteTimeout != want.Write || srv.IdleTimeout != want.Idle {
+		t.Errorf("server timeouts = read %s, header %s, write %s, idle %s",
+			srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestBackgroundJobs_StopsFeederFirst(t *testing.T) {
+	var mu sync.Mutex
+	var stopped []string
+	job := func(name string) func(context.Context) {
+		return func(ctx context.Context) {
+			<-ctx.Done()
+			mu.Lock()
+			stopped = append(stopped, name)
+			mu.Unlock()
+		}
+	}
+	jobs := &backgroundJobs{
+		feeder:      []func(context.Context){job("feeder")},
+		workers:     []func(context.Context){job("reaper"), job("updater")},
+		stopTimeout: 5 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+
+	if len(stopped) != 3 || stopped[0] != "feeder" {
+		t.Errorf("jobs stopped in order %v, want the feeder first, then both workers", stopped)
+	}
+}
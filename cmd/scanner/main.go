@@ -2,21 +2,39 @@ package main
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/locplace/scanner/internal/httpserver"
+	"github.com/locplace/scanner/internal/logging"
 	"github.com/locplace/scanner/internal/scanner"
 )
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "look up LOC records for the given domains (default: known LOC domains) and exit, without contacting the coordinator")
+	flag.Parse()
+
+	if err := logging.Setup(os.Getenv("LOG_LEVEL")); err != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "error", err)
+	}
+
+	if !*selfTest && flag.Arg(0) == "register" {
+		os.Exit(runRegister(flag.Args()[1:], os.Stdout))
+	}
+
 	// Configuration from environment
 	config := scanner.DefaultConfig()
 
@@ -24,9 +42,39 @@ func main() {
 		config.CoordinatorURL = url
 	}
 
-	config.Token = os.Getenv("SCANNER_TOKEN")
-	if config.Token == "" {
-		log.Fatal("SCANNER_TOKEN environment variable is required")
+	token, err := loadToken(os.Getenv("SCANNER_TOKEN_FILE"), os.Getenv("SCANNER_TOKEN"))
+	if err != nil {
+		slog.Error("Failed to read scanner token", "error", err)
+		os.Exit(1)
+	}
+	config.Token = token
+	if config.Token == "" && !*selfTest {
+		slog.Error("SCANNER_TOKEN or SCANNER_TOKEN_FILE environment variable is required")
+		os.Exit(1)
+	}
+
+	if v := os.Getenv("COORDINATOR_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.CoordinatorTimeout = d
+		}
+	}
+
+	if v := os.Getenv("COORDINATOR_MAX_IDLE_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			config.CoordinatorMaxIdleConns = n
+		}
+	}
+
+	if v := os.Getenv("CONFIG_REFRESH_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			config.ConfigRefreshInterval = d
+		}
+	}
+
+	if v := os.Getenv("COMPRESS_SUBMISSIONS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			config.CompressSubmissions = b
+		}
 	}
 
 	if v := os.Getenv("WORKER_COUNT"); v != "" {
@@ -41,7 +89,50 @@ func main() {
 		}
 	}
 
+	if v := os.Getenv("SUBMIT_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			config.SubmitMaxAttempts = n
+		}
+	}
+
+	if v := os.Getenv("SUBMIT_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.SubmitBackoff = d
+		}
+	}
+
+	config.SpoolDir = os.Getenv("SPOOL_DIR")
+
+	if v := os.Getenv("MAX_BATCH_DURATION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			config.MaxBatchDuration = d
+		}
+	}
+
+	if v := os.Getenv("BREAKER_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.BreakerThreshold = n
+		}
+	}
+
+	if v := os.Getenv("BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.BreakerCooldown = d
+		}
+	}
+
 	// DNS configuration
+	nameservers, err := loadNameservers(os.Getenv("DNS_NAMESERVERS"), os.Getenv("DNS_NAMESERVERS_FILE"))
+	if err != nil {
+		slog.Error("Invalid nameserver configuration", "error", err)
+		os.Exit(1)
+	}
+	if len(nameservers) > 0 {
+		config.DNSConfig.Nameservers = nameservers
+	}
+	config.DNSConfig.ClientSubnet = os.Getenv("DNS_CLIENT_SUBNET")
+	config.DNSConfig.IPVersion = os.Getenv("DNS_IP_VERSION")
+
 	if v := os.Getenv("DNS_WORKERS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			config.DNSConfig.Workers = n
@@ -54,9 +145,49 @@ func main() {
 		}
 	}
 
+	if v := os.Getenv("DNS_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.DNSConfig.CacheTTL = d
+		}
+	}
+
+	if v := os.Getenv("DNS_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			config.DNSConfig.CacheSize = n
+		}
+	}
+
+	if v := os.Getenv("MAX_CONCURRENT_LOOKUPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			config.MaxConcurrentLookups = n
+		}
+	}
+
+	if v := os.Getenv("ENUMERATE_SUBDOMAINS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			config.EnumerateSubdomains = b
+		}
+	}
+	config.SubdomainEnumerator = os.Getenv("SUBDOMAIN_ENUMERATOR")
+
+	if v := os.Getenv("DNS_MAX_CNAME_HOPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			config.DNSConfig.MaxCNAMEHops = n
+		}
+	}
+
+	if err := config.DNSConfig.Validate(); err != nil {
+		slog.Error("Invalid DNS configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Create scanner
 	s := scanner.New(config)
 
+	if *selfTest {
+		os.Exit(runSelfTest(s, flag.Args()))
+	}
+
 	// Set up Prometheus metrics
 	registry := prometheus.NewRegistry()
 	metrics := scanner.NewMetrics(registry)
@@ -67,14 +198,17 @@ func main() {
 	if metricsAddr == "" {
 		metricsAddr = ":9090"
 	}
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-		log.Printf("Metrics server listening on %s", metricsAddr)
-		if err := http.ListenAndServe(metricsAddr, mux); err != nil && err != http.ErrServerClosed {
-			log.Printf("Metrics server error: %v", err)
-		}
-	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.Handle("/debug/loc-parse-failures", metrics.RecentParseFailures)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/version", handleVersion)
+	metricsErrs, err := httpserver.Start(&http.Server{Addr: metricsAddr, Handler: mux})
+	if err != nil {
+		slog.Error("Failed to start metrics server (set METRICS_ADDR to use another address)", "addr", metricsAddr, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Metrics server listening", "addr", metricsAddr)
 
 	// Set up graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -92,24 +226,133 @@ func main() {
 	// Wait for signal or scanner completion
 	select {
 	case sig := <-sigChan:
-		log.Printf("Received %v signal, initiating graceful shutdown...", sig)
+		slog.Info("Received signal, initiating graceful shutdown", "signal", sig.String())
 		s.InitiateShutdown() // Signal workers to stop fetching new jobs
 
 		// Wait for scanner to finish with timeout
 		select {
 		case <-done:
-			log.Println("Scanner stopped gracefully")
+			slog.Info("Scanner stopped gracefully")
 		case <-time.After(30 * time.Second):
-			log.Println("Shutdown timeout exceeded, forcing exit")
+			slog.Warn("Shutdown timeout exceeded, forcing exit")
 			cancel() // Force cancel context
 		case sig := <-sigChan:
-			log.Printf("Received second %v signal, forcing exit", sig)
+			slog.Warn("Received second signal, forcing exit", "signal", sig.String())
 			cancel() // Force cancel context
 		}
 
+	case err := <-metricsErrs:
+		slog.Error("Metrics server error, shutting down", "error", err)
+		s.InitiateShutdown()
+		<-done
+		os.Exit(1)
+
 	case err := <-done:
 		if err != nil {
-			log.Fatalf("Scanner error: %v", err)
+			slog.Error("Scanner error", "error", err)
+			os.Exit(1)
 		}
 	}
 }
+
+// loadToken returns the scanner token from the file at path (e.g. a mounted
+// secret), if set, falling back to envToken. Surrounding whitespace is
+// trimmed either way.
+func loadToken(path, envToken string) (string, error) {
+	if path == "" {
+		return strings.TrimSpace(envToken), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("SCANNER_TOKEN_FILE: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("SCANNER_TOKEN_FILE: %s is empty", path)
+	}
+	return token, nil
+}
+
+// handleHealthz reports that the scanner process is alive.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok") //nolint:errcheck // Client may have gone away
+}
+
+// buildInfo is the /version response body.
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// handleVersion reports the scanner's build version and commit.
+func handleVersion(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildInfo{Version: scanner.Version, Commit: scanner.Commit}) //nolint:errcheck // Client may have gone away
+}
+
+// loadNameservers returns the resolvers listed in list (comma-separated)
+// followed by those in the file at path (one per line, with blank lines and
+// #-comments ignored). Either may be empty; nil means use the defaults.
+func loadNameservers(list, path string) ([]string, error) {
+	var nameservers []string
+	for entry := range strings.SplitSeq(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if err := validateNameserver(entry); err != nil {
+			return nil, fmt.Errorf("DNS_NAMESERVERS: %w", err)
+		}
+		nameservers = append(nameservers, entry)
+	}
+
+	if path == "" {
+		return nameservers, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("DNS_NAMESERVERS_FILE: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := validateNameserver(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		nameservers = append(nameservers, line)
+	}
+	return nameservers, nil
+}
+
+// validateNameserver checks that entry is a resolver's IP address. Whether
+// its IP version is in use is checked by DNSConfig.Validate.
+func validateNameserver(entry string) error {
+	if net.ParseIP(entry) == nil {
+		return fmt.Errorf("nameserver %q is not an IP address", entry)
+	}
+	return nil
+}
+
+// runSelfTest scans domains (or the default self-test list), prints any LOC
+// records found, and returns the process exit code.
+func runSelfTest(s *scanner.Scanner, domains []string) int {
+	if len(domains) == 0 {
+		domains = scanner.SelfTestDomains
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	records, err := s.SelfTest(ctx, domains)
+	for _, r := range records {
+		fmt.Printf("%s\t%s\t(%.6f, %.6f)\n", r.FQDN, r.RawRecord, r.Latitude, r.Longitude)
+	}
+	if err != nil {
+		slog.Error("Self-test failed", "error", err)
+		return 1
+	}
+	fmt.Printf("Self-test passed: %d of %d domains have LOC records\n", len(records), len(domains))
+	return 0
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/locplace/scanner/internal/scanner"
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestLoadNameservers_List(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"unset", "", nil, false},
+		{"single", "192.0.2.53", []string{"192.0.2.53"}, false},
+		{"spaces and empty entries", " 192.0.2.1, ,192.0.2.2,", []string{"192.0.2.1", "192.0.2.2"}, false},
+		{"hostname", "192.0.2.1,dns.example.com", nil, true},
+		{"with port", "192.0.2.1:53", nil, true},
+		{"IPv6", "192.0.2.1,2001:4860:4860::8888", []string{"192.0.2.1", "2001:4860:4860::8888"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadNameservers(tt.list, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadNameservers(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("loadNameservers(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNameservers_File(t *testing.T) {
+	writeFile := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "resolvers.txt")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		path := writeFile(t, "# Our resolvers\n192.0.2.1\n\n  192.0.2.2  # backup\r\n")
+		got, err := loadNameservers("198.51.100.1", path)
+		if err != nil {
+			t.Fatalf("loadNameservers: %v", err)
+		}
+		if want := []string{"198.51.100.1", "192.0.2.1", "192.0.2.2"}; !slices.Equal(got, want) {
+			t.Errorf("loadNameservers = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("malformed entry", func(t *testing.T) {
+		path := writeFile(t, "192.0.2.1\n192.0.2.300\n")
+		_, err := loadNameservers("", path)
+		if err == nil {
+			t.Fatal("loadNameservers accepted 192.0.2.300")
+		}
+		if want := path + ":2: "; !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("error = %q, want it to point at %s", err, want)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadNameservers("", filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+			t.Error("loadNameservers succeeded for a missing file")
+		}
+	})
+}
+
+func TestHandleHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Body.String(); got != "ok\n" {
+		t.Errorf("body = %q, want %q", got, "ok\n")
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	defer func(v, c string) { scanner.Version, scanner.Commit = v, c }(scanner.Version, scanner.Commit)
+	scanner.Version, scanner.Commit = "v1.2.3", "abc1234"
+
+	rec := httptest.NewRecorder()
+	handleVersion(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var got buildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := (buildInfo{Version: "v1.2.3", Commit: "abc1234"}); got != want {
+		t.Errorf("body = %+v, want %+v", got, want)
+	}
+}
+
+// mockAdminAPI serves POST /api/admin/clients, registering clients under
+// adminKey, and records the names requested.
+func mockAdminAPI(t *testing.T, adminKey string, names *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/admin/clients" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Admin-Key") != adminKey {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		var req api.RegisterClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+		*names = append(*names, req.Name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(api.RegisterClientResponse{ID: "c-1", Name: req.Name, Token: "tok-" + req.Name})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegisterClient(t *testing.T) {
+	var names []string
+	srv := mockAdminAPI(t, "admin-secret", &names)
+
+	resp, err := registerClient(context.Background(), srv.Client(), srv.URL+"/", "admin-secret", "scanner-1")
+	if err != nil {
+		t.Fatalf("registerClient: %v", err)
+	}
+	if want := (api.RegisterClientResponse{ID: "c-1", Name: "scanner-1", Token: "tok-scanner-1"}); *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+	if !slices.Equal(names, []string{"scanner-1"}) {
+		t.Errorf("registered %v, want [scanner-1]", names)
+	}
+
+	if _, err := registerClient(context.Background(), srv.Client(), srv.URL, "wrong-key", "scanner-2"); err == nil ||
+		!strings.Contains(err.Error(), "401") {
+		t.Errorf("registerClient with a bad admin key = %v, want a 401 error", err)
+	}
+}
+
+func TestRunRegister(t *testing.T) {
+	var names []string
+	srv := mockAdminAPI(t, "admin-secret", &names)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+
+	var stdout strings.Builder
+	code := runRegister([]string{"--name", "scanner-1", "--admin-key", "admin-secret",
+		"--coordinator", srv.URL, "--token-file", tokenFile}, &stdout)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if got := stdout.String(); got != "tok-scanner-1\n" {
+		t.Errorf("stdout = %q, want the token", got)
+	}
+
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatalf("read token file: %v", err)
+	}
+	if string(data) != "tok-scanner-1\n" {
+		t.Errorf("token file = %q, want the token", data)
+	}
+	if info, err := os.Stat(tokenFile); err == nil && info.Mode().Perm() != 0o600 {
+		t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestRunRegister_Defaults(t *testing.T) {
+	var names []string
+	srv := mockAdminAPI(t, "admin-secret", &names)
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	t.Setenv("COORDINATOR_URL", srv.URL)
+
+	var stdout strings.Builder
+	if code := runRegister([]string{"--name", "scanner-1"}, &stdout); code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if got := stdout.String(); got != "tok-scanner-1\n" {
+		t.Errorf("stdout = %q, want the token", got)
+	}
+}
+
+func TestRunRegister_Failures(t *testing.T) {
+	var names []string
+	srv := mockAdminAPI(t, "admin-secret", &names)
+	t.Setenv("ADMIN_API_KEY", "")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"missing name", []string{"--admin-key", "admin-secret", "--coordinator", srv.URL}, 2},
+		{"missing admin key", []string{"--name", "scanner-1", "--coordinator", srv.URL}, 2},
+		{"unknown flag", []string{"--name", "scanner-1", "--admin-key", "admin-secret", "--bogus"}, 2},
+		{"rejected", []string{"--name", "scanner-1", "--admin-key", "wrong", "--coordinator", srv.URL}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout strings.Builder
+			if code := runRegister(tt.args, &stdout); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("stdout = %q, want nothing", stdout.String())
+			}
+		})
+	}
+	if len(names) != 0 {
+		t.Errorf("registered %v, want nothing", names)
+	}
+}
+
+func TestLoadToken(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("  file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"file over env", tokenFile, "env-token", "file-token", false},
+		{"file only", tokenFile, "", "file-token", false},
+		{"env fallback", "", "env-token\n", "env-token", false},
+		{"neither", "", "", "", false},
+		{"missing file", filepath.Join(dir, "missing"), "env-token", "", true},
+		{"empty file", emptyFile, "env-token", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadToken(tt.path, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadToken error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("loadToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/locplace/scanner/internal/scanner"
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// runRegister implements `scanner register`: it registers a scanner client
+// with the coordinator's admin API, prints the new client's token to stdout
+// and optionally saves it to a file. It returns the process exit code.
+func runRegister(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the scanner client to register (required)")
+	adminKey := fs.String("admin-key", os.Getenv("ADMIN_API_KEY"), "coordinator admin API key (default $ADMIN_API_KEY)")
+	coordinatorURL := fs.String("coordinator", os.Getenv("COORDINATOR_URL"), "coordinator URL (default $COORDINATOR_URL, or "+scanner.DefaultConfig().CoordinatorURL+")")
+	tokenFile := fs.String("token-file", "", "also write the token to this file, readable only by its owner")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" || *adminKey == "" {
+		fmt.Fprintln(fs.Output(), "register: --name and --admin-key (or ADMIN_API_KEY) are required") //nolint:errcheck // Nothing to do if stderr fails
+		fs.Usage()
+		return 2
+	}
+	if *coordinatorURL == "" {
+		*coordinatorURL = scanner.DefaultConfig().CoordinatorURL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := registerClient(ctx, http.DefaultClient, *coordinatorURL, *adminKey, *name)
+	if err != nil {
+		slog.Error("Failed to register scanner client", "coordinator", *coordinatorURL, "name", *name, "error", err)
+		return 1
+	}
+	slog.Info("Registered scanner client", "id", resp.ID, "name", resp.Name)
+
+	if *tokenFile != "" {
+		if err := os.WriteFile(*tokenFile, []byte(resp.Token+"\n"), 0o600); err != nil {
+			slog.Error("Failed to write token file, keep the printed token", "path", *tokenFile, "error", err)
+			fmt.Fprintln(stdout, resp.Token) //nolint:errcheck // Nothing to do if stdout fails
+			return 1
+		}
+		slog.Info("Wrote token file", "path", *tokenFile)
+	}
+	fmt.Fprintln(stdout, resp.Token) //nolint:errcheck // Nothing to do if stdout fails
+	return 0
+}
+
+// registerClient calls POST /api/admin/clients to create a scanner client.
+func registerClient(ctx context.Context, client *http.Client, baseURL, adminKey, name string) (*api.RegisterClientResponse, error) {
+	body, err := json.Marshal(api.RegisterClientRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/api/admin/clients", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Key", adminKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body) //nolint:errcheck // Best effort to get error details
+		return nil, fmt.Errorf("register client failed: %d %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+	}
+
+	var result api.RegisterClientResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Token == "" {
+		return nil, errors.New("register client failed: no token in response")
+	}
+	return &result, nil
+}
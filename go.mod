@@ -10,6 +10,7 @@ require (
 	github.com/miekg/dns v1.1.68
 	github.com/prometheus/client_golang v1.23.2
 	github.com/ulikunitz/xz v0.5.15
+	github.com/zmap/dns v1.1.67
 	github.com/zmap/zdns/v2 v2.0.5
 	golang.org/x/net v0.47.0
 )
@@ -31,7 +32,6 @@ require (
 	github.com/rogpeppe/go-internal v1.12.0 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/weppos/publicsuffix-go v0.40.3-0.20250311103038-7794c8c0723b // indirect
-	github.com/zmap/dns v1.1.67 // indirect
 	github.com/zmap/go-dns-root-anchors v0.0.0-20250415191259-6d65fb878756 // indirect
 	github.com/zmap/go-iptree v0.0.0-20210731043055-d4e632617837 // indirect
 	github.com/zmap/zcrypto v0.0.0-20250416162916-8ff8dfaa718d // indirect
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fileLockNamespace is the high half of advisory lock keys for domain files,
+// keeping them apart from any other advisory locks on the database.
+const fileLockNamespace = 0x4c4f4346 // "LOCF"
+
+// LeaderLockKey is the advisory lock key held by the leading coordinator.
+const LeaderLockKey int64 = 0x4c4f434c << 32 // "LOCL"
+
+// FileLockKey returns the advisory lock key for a domain file.
+func FileLockKey(fileID int) int64 {
+	return fileLockNamespace<<32 | int64(uint32(fileID))
+}
+
+// AdvisoryLock is a held session-level Postgres advisory lock. It pins one
+// pool connection until Unlock, since the lock belongs to that session.
+type AdvisoryLock struct {
+	conn *pgxpool.Conn
+	key  int64
+}
+
+// TryAdvisoryLock takes the advisory lock key without waiting. It returns
+// nil if another session holds it. Locks are released on Unlock, or by
+// Postgres if the connection is lost, e.g. when a coordinator dies.
+func (db *DB) TryAdvisoryLock(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	if !ok {
+		conn.Release()
+		return nil, nil
+	}
+	return &AdvisoryLock{conn: conn, key: key}, nil
+}
+
+// AcquireLeadership tries to become leader by taking the advisory lock key
+// without waiting. It returns nil if another replica leads. Leadership lasts
+// until Unlock, or until the connection holding it is lost, which Check detects.
+func (db *DB) AcquireLeadership(ctx context.Context, key int64) (*AdvisoryLock, error) {
+	return db.TryAdvisoryLock(ctx, key)
+}
+
+// Check verifies the lock's connection is alive. The lock is held for as
+// long as the session is, so an error means it may have been lost.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	return l.conn.Ping(ctx)
+}
+
+// Unlock releases the lock and its connection. If the unlock query fails the
+// connection is closed instead of returned to the pool, which releases the
+// lock server-side, so the lock never outlives a call to Unlock.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	var ok bool
+	err := l.conn.QueryRow(ctx, `SELECT pg_advisory_unlock($1)`, l.key).Scan(&ok)
+	if err == nil && !ok {
+		err = fmt.Errorf("advisory lock %d was not held", l.key)
+	}
+	if err != nil {
+		l.conn.Hijack().Close(context.Background()) //nolint:errcheck // Closing is the cleanup
+		return err
+	}
+	l.conn.Release()
+	return nil
+}
@@ -0,0 +1,17 @@
+package db
+
+import "testing"
+
+func TestFileLockKey(t *testing.T) {
+	seen := make(map[int64]int)
+	for _, id := range []int{0, 1, 2, 1 << 20, 1<<31 - 1} {
+		key := FileLockKey(id)
+		if key>>32 != fileLockNamespace {
+			t.Errorf("FileLockKey(%d) = %#x, want namespace %#x in the high half", id, key, fileLockNamespace)
+		}
+		if prev, dup := seen[key]; dup {
+			t.Errorf("FileLockKey(%d) = FileLockKey(%d) = %#x", id, prev, key)
+		}
+		seen[key] = id
+	}
+}
@@ -1,8 +1,14 @@
 package db
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // ScanBatch represents a batch of domains to scan.
@@ -13,15 +19,54 @@ type ScanBatch struct {
 	LineEnd    int64
 	Domains    string // Newline-separated FQDNs
 	Status     string
+	Priority   int // Higher is claimed first
+	Attempts   int // Number of times the batch has been claimed
 	AssignedAt *time.Time
+	CreatedAt  time.Time
 	ScannerID  *string // Client ID (for backwards compat)
 	SessionID  *string // Session ID (for multi-scanner support)
 }
 
+// ManualSubmissionsFile is the pseudo domain file that manually submitted
+// batches belong to.
+const ManualSubmissionsFile = "__manual_submissions__"
+
+// StaleRescanFile is the pseudo domain file that stale record rescan
+// batches belong to.
+const StaleRescanFile = "__stale_rescans__"
+
+// pseudoFiles are the domain files that only group batches and have nothing
+// to download. The feeder never processes them, and records found by their
+// batches aren't attributed to them.
+var pseudoFiles = []string{ManualSubmissionsFile, StaleRescanFile}
+
+// ManualBatchPriority is the priority given to manually submitted batches so
+// they are claimed ahead of the feeder backlog (which uses the default of 0).
+const ManualBatchPriority = 100
+
+// compareClaimOrder orders batches the way ClaimBatches claims them:
+// highest priority first, then oldest.
+func compareClaimOrder(a, b ScanBatch) int {
+	if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// QueueWait returns how long the batch waited between creation and its
+// claim, or zero if it hasn't been claimed.
+func (b ScanBatch) QueueWait() time.Duration {
+	if b.AssignedAt == nil {
+		return 0
+	}
+	return max(b.AssignedAt.Sub(b.CreatedAt), 0)
+}
+
 // BatchStats holds aggregate statistics for batches.
 type BatchStats struct {
-	Pending  int
-	InFlight int
+	Pending     int
+	InFlight    int
+	Quarantined int
 }
 
 // GetPendingBatchCount returns the number of pending batches.
@@ -37,12 +82,66 @@ func (db *DB) GetBatchStats(ctx context.Context) (*BatchStats, error) {
 	err := db.Pool.QueryRow(ctx, `
 		SELECT
 			COUNT(*) FILTER (WHERE status = 'pending') as pending,
-			COUNT(*) FILTER (WHERE status = 'in_flight') as in_flight
+			COUNT(*) FILTER (WHERE status = 'in_flight') as in_flight,
+			COUNT(*) FILTER (WHERE status = 'quarantined') as quarantined
 		FROM scan_batches
-	`).Scan(&stats.Pending, &stats.InFlight)
+	`).Scan(&stats.Pending, &stats.InFlight, &stats.Quarantined)
 	return &stats, err
 }
 
+// FileQueueDepth counts one domain file's batches that are waiting for or
+// being scanned.
+type FileQueueDepth struct {
+	FileID         int
+	Filename       string
+	Pending        int
+	InFlight       int
+	OldestPending  *time.Time // created_at of the oldest pending batch
+	OldestInFlight *time.Time // assigned_at of the longest-held in_flight batch
+}
+
+// QueueDepth is a snapshot of the batch queue, broken down by file.
+type QueueDepth struct {
+	Now   time.Time // Database time of the snapshot, to measure ages against
+	Files []FileQueueDepth
+}
+
+// GetQueueDepth returns pending and in_flight batch counts and the oldest
+// batch timestamps for each file that has any.
+func (db *DB) GetQueueDepth(ctx context.Context) (QueueDepth, error) {
+	var q QueueDepth
+	err := db.Pool.QueryRow(ctx, `SELECT NOW()`).Scan(&q.Now)
+	if err != nil {
+		return q, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT b.file_id, f.filename,
+		       COUNT(*) FILTER (WHERE b.status = 'pending'),
+		       COUNT(*) FILTER (WHERE b.status = 'in_flight'),
+		       MIN(b.created_at) FILTER (WHERE b.status = 'pending'),
+		       MIN(b.assigned_at) FILTER (WHERE b.status = 'in_flight')
+		FROM scan_batches b
+		JOIN domain_files f ON f.id = b.file_id
+		WHERE b.status IN ('pending', 'in_flight')
+		GROUP BY b.file_id, f.filename
+		ORDER BY f.filename
+	`)
+	if err != nil {
+		return q, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f FileQueueDepth
+		if err := rows.Scan(&f.FileID, &f.Filename, &f.Pending, &f.InFlight, &f.OldestPending, &f.OldestInFlight); err != nil {
+			return q, err
+		}
+		q.Files = append(q.Files, f)
+	}
+	return q, rows.Err()
+}
+
 // CreateBatch creates a new batch of domains to scan.
 func (db *DB) CreateBatch(ctx context.Context, fileID int, lineStart, lineEnd int64, domains string) error {
 	_, err := db.Pool.Exec(ctx, `
@@ -53,7 +152,12 @@ func (db *DB) CreateBatch(ctx context.Context, fileID int, lineStart, lineEnd in
 }
 
 // CreateBatchAndUpdateProgress creates a batch and updates file progress atomically.
-func (db *DB) CreateBatchAndUpdateProgress(ctx context.Context, fileID int, lineStart, lineEnd int64, domains string) error {
+// processedLines is the line the feeder can safely resume after; it equals
+// lineEnd unless the feeder is still holding earlier lines (e.g. when shuffling).
+// processedBytes is the decompressed offset just past line processedLines, or
+// nil if that isn't a safe resume point. The batch's domains (newline-separated)
+// are added to the file's lines_fed count.
+func (db *DB) CreateBatchAndUpdateProgress(ctx context.Context, fileID int, lineStart, lineEnd, processedLines int64, processedBytes *int64, domains string) error {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -72,9 +176,10 @@ func (db *DB) CreateBatchAndUpdateProgress(ctx context.Context, fileID int, line
 	// Update file progress
 	_, err = tx.Exec(ctx, `
 		UPDATE domain_files
-		SET processed_lines = $2, batches_created = batches_created + 1
+		SET processed_lines = $2, processed_bytes = $3, batches_created = batches_created + 1,
+		    lines_fed = lines_fed + $4
 		WHERE id = $1
-	`, fileID, lineEnd)
+	`, fileID, processedLines, processedBytes, strings.Count(domains, "\n")+1)
 	if err != nil {
 		return err
 	}
@@ -86,82 +191,122 @@ func (db *DB) CreateBatchAndUpdateProgress(ctx context.Context, fileID int, line
 // scannerID is the client ID (for backwards compat), sessionID is the unique session.
 // Returns nil if no batches are available.
 func (db *DB) ClaimBatch(ctx context.Context, scannerID, sessionID string) (*ScanBatch, error) {
-	tx, err := db.Pool.Begin(ctx)
-	if err != nil {
+	batches, err := db.ClaimBatches(ctx, scannerID, sessionID, 1)
+	if err != nil || len(batches) == 0 {
 		return nil, err
 	}
-	defer tx.Rollback(ctx) //nolint:errcheck
-
-	var b ScanBatch
-	err = tx.QueryRow(ctx, `
-		SELECT id, file_id, line_start, line_end, domains
-		FROM scan_batches
-		WHERE status = 'pending'
-		ORDER BY id
-		LIMIT 1
-		FOR UPDATE SKIP LOCKED
-	`).Scan(&b.ID, &b.FileID, &b.LineStart, &b.LineEnd, &b.Domains)
+	return &batches[0], nil
+}
 
+// ClaimBatches claims up to n pending batches for a scanner session in a single
+// statement. Fewer than n (possibly none) are returned if the queue is short.
+// Batches are returned in claim order (highest priority, then oldest, first).
+func (db *DB) ClaimBatches(ctx context.Context, scannerID, sessionID string, n int) ([]ScanBatch, error) {
+	// Update to in_flight with both scanner_id (backwards compat) and session_id
+	rows, err := db.Pool.Query(ctx, `
+		WITH claimed AS (
+			SELECT id
+			FROM scan_batches
+			WHERE status = 'pending'
+			ORDER BY priority DESC, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE scan_batches b
+		SET status = 'in_flight', assigned_at = NOW(), scanner_id = $1, session_id = $2, attempts = b.attempts + 1
+		FROM claimed
+		WHERE b.id = claimed.id
+		RETURNING b.id, b.file_id, b.line_start, b.line_end, b.domains, b.priority, b.attempts,
+		          b.created_at, b.assigned_at
+	`, scannerID, sessionID, n)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return nil, nil
-		}
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Update to in_flight with both scanner_id (backwards compat) and session_id
-	_, err = tx.Exec(ctx, `
-		UPDATE scan_batches
-		SET status = 'in_flight', assigned_at = NOW(), scanner_id = $2, session_id = $3
-		WHERE id = $1
-	`, b.ID, scannerID, sessionID)
-	if err != nil {
+	var batches []ScanBatch
+	for rows.Next() {
+		var b ScanBatch
+		if err := rows.Scan(&b.ID, &b.FileID, &b.LineStart, &b.LineEnd, &b.Domains, &b.Priority, &b.Attempts,
+			&b.CreatedAt, &b.AssignedAt); err != nil {
+			return nil, err
+		}
+		b.Status = "in_flight"
+		batches = append(batches, b)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
+	// RETURNING order is unspecified
+	slices.SortFunc(batches, compareClaimOrder)
+	return batches, nil
+}
+
+// GetBatchFileID returns the ID of the domain file a batch was read from, or
+// nil if the batch doesn't exist or belongs to a pseudo file (manual
+// submissions or stale rescans), which isn't a real source file.
+func (db *DB) GetBatchFileID(ctx context.Context, batchID int64) (*int, error) {
+	var fileID int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT b.file_id FROM scan_batches b
+		JOIN domain_files f ON f.id = b.file_id
+		WHERE b.id = $1 AND f.filename <> ALL($2::text[])
+	`, batchID, pseudoFiles).Scan(&fileID)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
-
-	b.Status = "in_flight"
-	return &b, nil
+	return &fileID, nil
 }
 
 // CompleteBatch marks a batch as complete (deletes it) and increments file counter.
 // Returns the file ID and the time the batch was assigned (for duration tracking).
-func (db *DB) CompleteBatch(ctx context.Context, batchID int64) (int, *time.Time, error) {
+// Returns pgx.ErrNoRows if the batch doesn't exist, e.g. it was already completed.
+// If key is non-nil it is stored in the same transaction, so a retry of the
+// submission is recognized by GetSubmission once the batch is complete.
+func (db *DB) CompleteBatch(ctx context.Context, batchID int64, key *SubmissionKey) (int, *time.Time, error) {
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return 0, nil, err
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck
 
-	// Get file_id and assigned_at before deleting
+	// Delete the batch, capturing file_id and assigned_at. Deleting and reading
+	// in one statement means a duplicate submission (a retry, or two racing
+	// requests) finds no row and can't count the batch twice.
 	var fileID int
 	var assignedAt *time.Time
 	err = tx.QueryRow(ctx, `
-		SELECT file_id, assigned_at FROM scan_batches WHERE id = $1
+		DELETE FROM scan_batches WHERE id = $1
+		RETURNING file_id, assigned_at
 	`, batchID).Scan(&fileID, &assignedAt)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	// Delete batch
-	_, err = tx.Exec(ctx, `DELETE FROM scan_batches WHERE id = $1`, batchID)
-	if err != nil {
-		return 0, nil, err
-	}
-
 	// Increment file counter
 	_, err = tx.Exec(ctx, `
 		UPDATE domain_files
-		SET batches_completed = batches_completed + 1
+		SET batches_completed = LEAST(batches_completed + 1, batches_created)
 		WHERE id = $1
 	`, fileID)
 	if err != nil {
 		return 0, nil, err
 	}
 
+	if key != nil {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO submission_keys (client_id, key, accepted) VALUES ($1, $2, $3)
+			ON CONFLICT (client_id, key) DO NOTHING
+		`, key.ClientID, key.Key, key.Accepted)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return 0, nil, err
 	}
@@ -169,38 +314,170 @@ func (db *DB) CompleteBatch(ctx context.Context, batchID int64) (int, *time.Time
 	return fileID, assignedAt, nil
 }
 
+// releaseStatusExpr returns the SQL expression for the status a released
+// in_flight batch moves to: 'quarantined' once it has been claimed maxAttempts
+// times, otherwise back to 'pending'. maxAttempts <= 0 disables quarantine.
+func releaseStatusExpr(maxAttempts int) string {
+	if maxAttempts <= 0 {
+		return "'pending'"
+	}
+	return fmt.Sprintf("CASE WHEN attempts >= %d THEN 'quarantined' ELSE 'pending' END", maxAttempts)
+}
+
+// ReleasedBatches summarizes in_flight batches taken back from scanners.
+type ReleasedBatches struct {
+	Released    int             // Returned to pending
+	Quarantined int             // Out of attempts
+	Held        []time.Duration // How long each batch was in_flight, released or quarantined
+}
+
+// collectReleased tallies the RETURNING status and held seconds of released
+// batches.
+func collectReleased(rows pgx.Rows) (ReleasedBatches, error) {
+	defer rows.Close()
+	var res ReleasedBatches
+	for rows.Next() {
+		var status string
+		var heldSeconds *float64 // NULL if the batch had no assigned_at
+		if err := rows.Scan(&status, &heldSeconds); err != nil {
+			return ReleasedBatches{}, err
+		}
+		if status == "quarantined" {
+			res.Quarantined++
+		} else {
+			res.Released++
+		}
+		if heldSeconds != nil {
+			res.Held = append(res.Held, time.Duration(*heldSeconds*float64(time.Second)))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return ReleasedBatches{}, err
+	}
+	return res, nil
+}
+
 // ResetStaleBatches resets batches that have been in_flight too long.
 // This is for backwards compatibility with batches that don't have session_id.
-func (db *DB) ResetStaleBatches(ctx context.Context, timeout time.Duration) (int, error) {
-	result, err := db.Pool.Exec(ctx, `
-		UPDATE scan_batches
-		SET status = 'pending', assigned_at = NULL, scanner_id = NULL, session_id = NULL
-		WHERE status = 'in_flight'
-		AND session_id IS NULL
-		AND assigned_at < NOW() - $1::interval
+// Batches that have used up maxAttempts are quarantined instead of reset.
+func (db *DB) ResetStaleBatches(ctx context.Context, timeout time.Duration, maxAttempts int) (ReleasedBatches, error) {
+	// Joining the table to itself exposes the pre-update assigned_at
+	rows, err := db.Pool.Query(ctx, `
+		UPDATE scan_batches b
+		SET status = `+releaseStatusExpr(maxAttempts)+`, assigned_at = NULL, scanner_id = NULL, session_id = NULL
+		FROM scan_batches old
+		WHERE old.id = b.id
+		AND b.status = 'in_flight'
+		AND b.session_id IS NULL
+		AND b.assigned_at < NOW() - $1::interval
+		RETURNING b.status, EXTRACT(EPOCH FROM NOW() - old.assigned_at)::float8
 	`, timeout.String())
 	if err != nil {
-		return 0, err
+		return ReleasedBatches{}, err
 	}
-	return int(result.RowsAffected()), nil
+	return collectReleased(rows)
 }
 
 // ResetBatchesFromDeadSessions resets batches from sessions that haven't heartbeated.
 // This is more accurate than time-based reset because it only releases batches
 // from scanners that are actually dead (not heartbeating), not just slow.
-func (db *DB) ResetBatchesFromDeadSessions(ctx context.Context, heartbeatTimeout time.Duration) (int, error) {
-	result, err := db.Pool.Exec(ctx, `
+// Batches that have used up maxAttempts are quarantined instead of reset.
+func (db *DB) ResetBatchesFromDeadSessions(ctx context.Context, heartbeatTimeout time.Duration, maxAttempts int) (ReleasedBatches, error) {
+	rows, err := db.Pool.Query(ctx, `
 		UPDATE scan_batches b
-		SET status = 'pending', assigned_at = NULL, scanner_id = NULL, session_id = NULL
-		FROM scanner_sessions s
+		SET status = `+releaseStatusExpr(maxAttempts)+`, assigned_at = NULL, scanner_id = NULL, session_id = NULL
+		FROM scanner_sessions s, scan_batches old
 		WHERE b.session_id = s.id
+		AND old.id = b.id
 		AND b.status = 'in_flight'
 		AND s.last_heartbeat < NOW() - $1::interval
+		RETURNING b.status, EXTRACT(EPOCH FROM NOW() - old.assigned_at)::float8
 	`, heartbeatTimeout.String())
 	if err != nil {
-		return 0, err
+		return ReleasedBatches{}, err
+	}
+	return collectReleased(rows)
+}
+
+// ReturnBatch puts an in-flight batch back in the queue at a scanner's request,
+// e.g. when it claimed the batch but is shutting down before scanning it.
+// The claim doesn't count towards the batch's attempts. Only the session that
+// holds the batch can return it; otherwise pgx.ErrNoRows is returned.
+func (db *DB) ReturnBatch(ctx context.Context, batchID int64, scannerID, sessionID string) error {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scan_batches
+		SET status = 'pending', assigned_at = NULL, scanner_id = NULL, session_id = NULL,
+		    attempts = GREATEST(attempts - 1, 0)
+		WHERE id = $1
+		AND status = 'in_flight'
+		AND scanner_id = $2
+		AND session_id = $3
+	`, batchID, scannerID, sessionID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// FailedBatch is a quarantined batch along with the file it came from.
+type FailedBatch struct {
+	ScanBatch
+	Filename string
+}
+
+// ListQuarantinedBatches returns quarantined batches (oldest first) and the total count.
+func (db *DB) ListQuarantinedBatches(ctx context.Context, limit, offset int) ([]FailedBatch, int, error) {
+	var total int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM scan_batches WHERE status = 'quarantined'
+	`).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT b.id, b.file_id, f.filename, b.line_start, b.line_end, b.domains, b.status, b.priority, b.attempts
+		FROM scan_batches b
+		JOIN domain_files f ON f.id = b.file_id
+		WHERE b.status = 'quarantined'
+		ORDER BY b.id
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
-	return int(result.RowsAffected()), nil
+	defer rows.Close()
+
+	var batches []FailedBatch
+	for rows.Next() {
+		var b FailedBatch
+		if err := rows.Scan(&b.ID, &b.FileID, &b.Filename, &b.LineStart, &b.LineEnd, &b.Domains,
+			&b.Status, &b.Priority, &b.Attempts); err != nil {
+			return nil, 0, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, total, rows.Err()
+}
+
+// RequeueBatch moves a quarantined batch back to pending with its attempt count reset.
+// Returns pgx.ErrNoRows if the batch does not exist or is not quarantined.
+func (db *DB) RequeueBatch(ctx context.Context, batchID int64) error {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scan_batches
+		SET status = 'pending', attempts = 0
+		WHERE id = $1 AND status = 'quarantined'
+	`, batchID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
 }
 
 // DeleteBatchesForFile deletes all batches for a file.
@@ -209,9 +486,14 @@ func (db *DB) DeleteBatchesForFile(ctx context.Context, fileID int) error {
 	return err
 }
 
-// CreateManualBatch creates a batch from manually submitted domains.
-// Uses the special "__manual_submissions__" pseudo-file for tracking.
-func (db *DB) CreateManualBatch(ctx context.Context, domains string) error {
+// CreateManualBatches creates batches from manually submitted domains in one
+// transaction. Uses the ManualSubmissionsFile pseudo-file for tracking.
+// Manual batches get ManualBatchPriority so they jump the feeder backlog.
+func (db *DB) CreateManualBatches(ctx context.Context, batches [][]string) error {
+	if len(batches) == 0 {
+		return nil
+	}
+
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -220,29 +502,91 @@ func (db *DB) CreateManualBatch(ctx context.Context, domains string) error {
 
 	// Get the manual submissions file ID
 	var fileID int
-	err = tx.QueryRow(ctx, `
-		SELECT id FROM domain_files WHERE filename = '__manual_submissions__'
-	`).Scan(&fileID)
+	err = tx.QueryRow(ctx, `SELECT id FROM domain_files WHERE filename = $1`, ManualSubmissionsFile).Scan(&fileID)
 	if err != nil {
 		return err
 	}
 
-	// Insert the batch
+	for _, domains := range batches {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO scan_batches (file_id, line_start, line_end, domains, priority)
+			VALUES ($1, 0, 0, $2, $3)
+		`, fileID, strings.Join(domains, "\n"), ManualBatchPriority)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Increment batches_created on the pseudo-file for tracking
 	_, err = tx.Exec(ctx, `
-		INSERT INTO scan_batches (file_id, line_start, line_end, domains)
-		VALUES ($1, 0, 0, $2)
-	`, fileID, domains)
+		UPDATE domain_files SET batches_created = batches_created + $2 WHERE id = $1
+	`, fileID, len(batches))
 	if err != nil {
 		return err
 	}
 
-	// Increment batches_created on the pseudo-file for tracking
+	return tx.Commit(ctx)
+}
+
+// CreateRescanBatches queues batches of known FQDNs for re-verification under
+// the StaleRescanFile pseudo-file, and marks their records as queued so
+// GetStaleLOCRecords doesn't return them again while they're pending.
+func (db *DB) CreateRescanBatches(ctx context.Context, batches [][]string) error {
+	if len(batches) == 0 {
+		return nil
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var fileID int
+	err = tx.QueryRow(ctx, `SELECT id FROM domain_files WHERE filename = $1`, StaleRescanFile).Scan(&fileID)
+	if err != nil {
+		return err
+	}
+
+	for _, fqdns := range batches {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO scan_batches (file_id, line_start, line_end, domains)
+			VALUES ($1, 0, 0, $2)
+		`, fileID, strings.Join(fqdns, "\n"))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE loc_records SET rescan_queued_at = NOW() WHERE fqdn = ANY($1)`, fqdns)
+		if err != nil {
+			return err
+		}
+	}
+
 	_, err = tx.Exec(ctx, `
-		UPDATE domain_files SET batches_created = batches_created + 1 WHERE id = $1
-	`, fileID)
+		UPDATE domain_files SET batches_created = batches_created + $2 WHERE id = $1
+	`, fileID, len(batches))
 	if err != nil {
 		return err
 	}
 
 	return tx.Commit(ctx)
 }
+
+// GetBatchDomains returns the FQDNs of a batch and whether it is a stale
+// rescan batch created by CreateRescanBatches. domains is nil if the batch
+// doesn't exist.
+func (db *DB) GetBatchDomains(ctx context.Context, batchID int64) (domains []string, rescan bool, err error) {
+	var list string
+	err = db.Pool.QueryRow(ctx, `
+		SELECT b.domains, f.filename = $2 FROM scan_batches b
+		JOIN domain_files f ON f.id = b.file_id
+		WHERE b.id = $1
+	`, batchID, StaleRescanFile).Scan(&list, &rescan)
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return strings.Fields(list), rescan, nil
+}
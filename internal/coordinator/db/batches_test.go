@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestCompareClaimOrder(t *testing.T) {
+	batches := []ScanBatch{
+		{ID: 1},
+		{ID: 2},
+		{ID: 9, Priority: ManualBatchPriority},
+		{ID: 3},
+		{ID: 8, Priority: ManualBatchPriority},
+	}
+
+	slices.SortFunc(batches, compareClaimOrder)
+
+	var got []int64
+	for _, b := range batches {
+		got = append(got, b.ID)
+	}
+	// High-priority batches come first even though they are newer, oldest first within a priority
+	want := []int64{8, 9, 1, 2, 3}
+	if !slices.Equal(got, want) {
+		t.Errorf("claim order = %v, want %v", got, want)
+	}
+}
+
+func TestScanBatch_QueueWait(t *testing.T) {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := created.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name       string
+		assignedAt *time.Time
+		want       time.Duration
+	}{
+		{"unclaimed", nil, 0},
+		{"claimed later", at(90 * time.Second), 90 * time.Second},
+		{"claimed at creation", at(0), 0},
+		{"clock skew", at(-time.Second), 0},
+	}
+	for _, tt := range tests {
+		b := ScanBatch{CreatedAt: created, AssignedAt: tt.assignedAt}
+		if got := b.QueueWait(); got != tt.want {
+			t.Errorf("%s: QueueWait = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReleaseStatusExpr(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		want        string
+	}{
+		{"quarantine disabled", 0, "'pending'"},
+		{"negative disables", -1, "'pending'"},
+		{"quarantine after 5 claims", 5, "CASE WHEN attempts >= 5 THEN 'quarantined' ELSE 'pending' END"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := releaseStatusExpr(tt.maxAttempts); got != tt.want {
+				t.Errorf("releaseStatusExpr(%d) = %q, want %q", tt.maxAttempts, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRows serves fixed rows through the pgx.Rows interface.
+type fakeRows struct {
+	pgx.Rows // Unimplemented methods panic
+	rows     [][]any
+	i        int
+	err      error
+	closed   bool
+}
+
+func (r *fakeRows) Next() bool {
+	if r.i >= len(r.rows) {
+		return false
+	}
+	r.i++
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.rows[r.i-1]
+	if len(dest) != len(row) {
+		return fmt.Errorf("scan %d values into %d destinations", len(row), len(dest))
+	}
+	for i, v := range row {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return r.err }
+func (r *fakeRows) Close()     { r.closed = true }
+
+func TestCollectReleased(t *testing.T) {
+	held := func(s float64) *float64 { return &s }
+	rows := &fakeRows{rows: [][]any{
+		{"pending", held(150)},
+		{"quarantined", held(3600.5)},
+		{"pending", (*float64)(nil)}, // No assigned_at
+	}}
+
+	got, err := collectReleased(rows)
+	if err != nil {
+		t.Fatalf("collectReleased: %v", err)
+	}
+	if got.Released != 2 || got.Quarantined != 1 {
+		t.Errorf("released, quarantined = %d, %d; want 2, 1", got.Released, got.Quarantined)
+	}
+	want := []time.Duration{150 * time.Second, time.Hour + 500*time.Millisecond}
+	if !slices.Equal(got.Held, want) {
+		t.Errorf("Held = %v, want %v", got.Held, want)
+	}
+	if !rows.closed {
+		t.Error("rows not closed")
+	}
+}
+
+func TestCollectReleased_Error(t *testing.T) {
+	rows := &fakeRows{rows: [][]any{{"pending", (*float64)(nil)}}, err: errors.New("connection lost")}
+	if got, err := collectReleased(rows); err == nil {
+		t.Errorf("collectReleased = %+v, want the rows error", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -17,6 +18,7 @@ type ScannerClient struct {
 	TokenHash     string
 	CreatedAt     time.Time
 	LastHeartbeat *time.Time
+	Disabled      bool
 }
 
 // generateToken creates a secure random token.
@@ -34,14 +36,21 @@ func hashToken(token string) string {
 	return hex.EncodeToString(h[:])
 }
 
-// CreateClient creates a new scanner client and returns the plaintext token.
-func (db *DB) CreateClient(ctx context.Context, name string) (id, token string, err error) {
+// newToken generates a plaintext token and the hash stored for it.
+func newToken() (token, tokenHash string, err error) {
 	token, err = generateToken()
 	if err != nil {
 		return "", "", err
 	}
+	return token, hashToken(token), nil
+}
 
-	tokenHash := hashToken(token)
+// CreateClient creates a new scanner client and returns the plaintext token.
+func (db *DB) CreateClient(ctx context.Context, name string) (id, token string, err error) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
 
 	err = db.Pool.QueryRow(ctx, `
 		INSERT INTO scanner_clients (name, token_hash)
@@ -61,9 +70,9 @@ func (db *DB) GetClientByToken(ctx context.Context, token string) (*ScannerClien
 
 	var client ScannerClient
 	err := db.Pool.QueryRow(ctx, `
-		SELECT id, name, token_hash, created_at, last_heartbeat
+		SELECT id, name, token_hash, created_at, last_heartbeat, disabled
 		FROM scanner_clients WHERE token_hash = $1
-	`, tokenHash).Scan(&client.ID, &client.Name, &client.TokenHash, &client.CreatedAt, &client.LastHeartbeat)
+	`, tokenHash).Scan(&client.ID, &client.Name, &client.TokenHash, &client.CreatedAt, &client.LastHeartbeat, &client.Disabled)
 
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -78,9 +87,9 @@ func (db *DB) GetClientByToken(ctx context.Context, token string) (*ScannerClien
 func (db *DB) GetClientByID(ctx context.Context, id string) (*ScannerClient, error) {
 	var client ScannerClient
 	err := db.Pool.QueryRow(ctx, `
-		SELECT id, name, token_hash, created_at, last_heartbeat
+		SELECT id, name, token_hash, created_at, last_heartbeat, disabled
 		FROM scanner_clients WHERE id = $1
-	`, id).Scan(&client.ID, &client.Name, &client.TokenHash, &client.CreatedAt, &client.LastHeartbeat)
+	`, id).Scan(&client.ID, &client.Name, &client.TokenHash, &client.CreatedAt, &client.LastHeartbeat, &client.Disabled)
 
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -101,7 +110,7 @@ type ClientWithStats struct {
 func (db *DB) ListClients(ctx context.Context) ([]ClientWithStats, error) {
 	rows, err := db.Pool.Query(ctx, `
 		SELECT
-			c.id, c.name, c.token_hash, c.created_at, c.last_heartbeat,
+			c.id, c.name, c.token_hash, c.created_at, c.last_heartbeat, c.disabled,
 			COUNT(b.id) as active_batches
 		FROM scanner_clients c
 		LEFT JOIN scan_batches b ON b.scanner_id = c.id AND b.status = 'in_flight'
@@ -116,7 +125,7 @@ func (db *DB) ListClients(ctx context.Context) ([]ClientWithStats, error) {
 	var clients []ClientWithStats
 	for rows.Next() {
 		var c ClientWithStats
-		if err := rows.Scan(&c.ID, &c.Name, &c.TokenHash, &c.CreatedAt, &c.LastHeartbeat, &c.ActiveBatches); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.TokenHash, &c.CreatedAt, &c.LastHeartbeat, &c.Disabled, &c.ActiveBatches); err != nil {
 			return nil, err
 		}
 		clients = append(clients, c)
@@ -136,6 +145,43 @@ func (db *DB) DeleteClient(ctx context.Context, id string) error {
 	return nil
 }
 
+// RotateClientToken replaces a client's token and returns the new plaintext token.
+// The client keeps its ID, so in-flight batch assignments are preserved.
+// The old token stops working immediately since only the new hash is stored.
+// Returns pgx.ErrNoRows if the client does not exist.
+func (db *DB) RotateClientToken(ctx context.Context, id string) (string, error) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scanner_clients SET token_hash = $2 WHERE id = $1
+	`, id, tokenHash)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", pgx.ErrNoRows
+	}
+	return token, nil
+}
+
+// SetClientDisabled disables or re-enables a client.
+// Returns pgx.ErrNoRows if the client does not exist.
+func (db *DB) SetClientDisabled(ctx context.Context, id string, disabled bool) error {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE scanner_clients SET disabled = $2 WHERE id = $1
+	`, id, disabled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
 // UpdateHeartbeat updates the client's last_heartbeat timestamp and session_id.
 func (db *DB) UpdateHeartbeat(ctx context.Context, clientID, sessionID string) error {
 	_, err := db.Pool.Exec(ctx, `
@@ -169,6 +215,19 @@ type ScannerSession struct {
 	ClientID      string
 	CreatedAt     time.Time
 	LastHeartbeat time.Time
+	ActiveDomains []string // As of the last heartbeat
+}
+
+// maxSessionActiveDomains bounds how many active domains are stored per session.
+const maxSessionActiveDomains = 10000
+
+// sessionActiveDomains prepares a heartbeat's active domains for storage:
+// never nil (the column is NOT NULL) and at most maxSessionActiveDomains long.
+func sessionActiveDomains(domains []string) []string {
+	if domains == nil {
+		return []string{}
+	}
+	return domains[:min(len(domains), maxSessionActiveDomains)]
 }
 
 // UpsertSession creates or updates a scanner session.
@@ -183,6 +242,38 @@ func (db *DB) UpsertSession(ctx context.Context, clientID, sessionID string) err
 	return err
 }
 
+// UpdateSessionActiveDomains replaces the domains a session reports it is scanning.
+func (db *DB) UpdateSessionActiveDomains(ctx context.Context, sessionID string, domains []string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE scanner_sessions SET active_domains = $2 WHERE id = $1
+	`, sessionID, sessionActiveDomains(domains))
+	return err
+}
+
+// ListActiveSessions returns sessions with recent heartbeats, oldest first.
+func (db *DB) ListActiveSessions(ctx context.Context, timeout time.Duration) ([]ScannerSession, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, client_id, created_at, last_heartbeat, active_domains
+		FROM scanner_sessions
+		WHERE last_heartbeat > NOW() - $1::interval
+		ORDER BY created_at
+	`, timeout.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []ScannerSession
+	for rows.Next() {
+		var s ScannerSession
+		if err := rows.Scan(&s.ID, &s.ClientID, &s.CreatedAt, &s.LastHeartbeat, &s.ActiveDomains); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
 // UpdateSessionHeartbeat updates a session's last_heartbeat timestamp.
 func (db *DB) UpdateSessionHeartbeat(ctx context.Context, sessionID string) error {
 	_, err := db.Pool.Exec(ctx, `
@@ -191,6 +282,28 @@ func (db *DB) UpdateSessionHeartbeat(ctx context.Context, sessionID string) erro
 	return err
 }
 
+// DeleteExpiredSessions removes sessions whose last heartbeat is more than
+// ttl ago, returning how many were removed. Sessions still holding in-flight
+// batches are kept until the reaper has released those batches.
+func (db *DB) DeleteExpiredSessions(ctx context.Context, ttl time.Duration) (int, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("session TTL must be positive, got %s", ttl)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM scanner_sessions s
+		WHERE s.last_heartbeat < NOW() - $1::interval
+		AND NOT EXISTS (
+			SELECT 1 FROM scan_batches b
+			WHERE b.session_id = s.id AND b.status = 'in_flight'
+		)
+	`, ttl.String())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
 // CountActiveSessions returns the number of sessions with recent heartbeats.
 func (db *DB) CountActiveSessions(ctx context.Context, timeout time.Duration) (int, error) {
 	var count int
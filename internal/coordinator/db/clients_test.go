@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestHashToken(t *testing.T) {
@@ -114,6 +116,38 @@ func TestGenerateToken_Uniqueness(t *testing.T) {
 	}
 }
 
+func TestNewToken(t *testing.T) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		t.Fatalf("newToken() error: %v", err)
+	}
+	if tokenHash != hashToken(token) {
+		t.Errorf("hash %q does not match token", tokenHash)
+	}
+}
+
+func TestNewToken_Rotation(t *testing.T) {
+	// Rotation stores the hash of a fresh token; the old token must no longer match
+	oldToken, oldHash, err := newToken()
+	if err != nil {
+		t.Fatalf("newToken() error: %v", err)
+	}
+	newTok, newHash, err := newToken()
+	if err != nil {
+		t.Fatalf("newToken() error: %v", err)
+	}
+
+	if hashToken(oldToken) == newHash {
+		t.Error("old token still matches the rotated hash")
+	}
+	if hashToken(newTok) != newHash {
+		t.Error("new token does not match the rotated hash")
+	}
+	if oldHash == newHash {
+		t.Error("rotation produced the same hash")
+	}
+}
+
 func TestScannerClient_Fields(t *testing.T) {
 	// Test that ScannerClient struct can hold all expected data
 	client := ScannerClient{
@@ -157,3 +191,39 @@ func TestClientWithStats_Embedding(t *testing.T) {
 		t.Errorf("ActiveBatches = %d, want %d", client.ActiveBatches, 5)
 	}
 }
+
+func TestSessionActiveDomains(t *testing.T) {
+	if got := sessionActiveDomains(nil); got == nil || len(got) != 0 {
+		t.Errorf("sessionActiveDomains(nil) = %#v, want empty non-nil slice", got)
+	}
+
+	domains := []string{"a.example.com", "b.example.com"}
+	if got := sessionActiveDomains(domains); len(got) != 2 || got[0] != "a.example.com" {
+		t.Errorf("sessionActiveDomains(%v) = %v, want unchanged", domains, got)
+	}
+
+	many := make([]string, maxSessionActiveDomains+10)
+	if got := len(sessionActiveDomains(many)); got != maxSessionActiveDomains {
+		t.Errorf("len(sessionActiveDomains(%d domains)) = %d, want %d", len(many), got, maxSessionActiveDomains)
+	}
+}
+
+func TestDeleteExpiredSubmissionKeys_Validation(t *testing.T) {
+	db := &DB{} // nil pool: a non-positive TTL is rejected before any query
+
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		if _, err := db.DeleteExpiredSubmissionKeys(context.Background(), ttl); err == nil {
+			t.Errorf("DeleteExpiredSubmissionKeys(%s) succeeded; it would forget every key", ttl)
+		}
+	}
+}
+
+func TestDeleteExpiredSessions_Validation(t *testing.T) {
+	db := &DB{} // nil pool: a non-positive TTL is rejected before any query
+
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		if _, err := db.DeleteExpiredSessions(context.Background(), ttl); err == nil {
+			t.Errorf("DeleteExpiredSessions(%s) succeeded; it would delete every session", ttl)
+		}
+	}
+}
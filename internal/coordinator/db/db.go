@@ -4,6 +4,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -14,13 +15,17 @@ type DB struct {
 }
 
 // Config holds database configuration options.
+// Pool settings left at zero keep the value from URL (pool_max_conns,
+// pool_min_conns, pool_max_conn_lifetime) or pgxpool's default.
 type Config struct {
-	URL      string
-	MaxConns int32 // Maximum number of connections in the pool (0 = use default)
+	URL             string
+	MaxConns        int32         // Maximum number of connections in the pool
+	MinConns        int32         // Connections kept open even when idle
+	MaxConnLifetime time.Duration // Connections older than this are closed once released
 }
 
-// New creates a new database connection pool.
-func New(ctx context.Context, cfg Config) (*DB, error) {
+// poolConfig parses cfg.URL and applies cfg's overrides.
+func poolConfig(cfg Config) (*pgxpool.Config, error) {
 	poolCfg, err := pgxpool.ParseConfig(cfg.URL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
@@ -29,6 +34,24 @@ func New(ctx context.Context, cfg Config) (*DB, error) {
 	if cfg.MaxConns > 0 {
 		poolCfg.MaxConns = cfg.MaxConns
 	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if poolCfg.MinConns > poolCfg.MaxConns {
+		return nil, fmt.Errorf("min connections (%d) exceeds max connections (%d)", poolCfg.MinConns, poolCfg.MaxConns)
+	}
+	return poolCfg, nil
+}
+
+// New creates a new database connection pool.
+func New(ctx context.Context, cfg Config) (*DB, error) {
+	poolCfg, err := poolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
@@ -47,3 +70,8 @@ func New(ctx context.Context, cfg Config) (*DB, error) {
 func (db *DB) Close() {
 	db.Pool.Close()
 }
+
+// Ping checks that the database is reachable.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Pool.Ping(ctx)
+}
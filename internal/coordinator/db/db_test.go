@@ -0,0 +1,68 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoolConfig(t *testing.T) {
+	const url = "postgres://localhost:5432/locscanner?sslmode=disable"
+
+	tests := []struct {
+		name         string
+		cfg          Config
+		wantMax      int32
+		wantMin      int32
+		wantLifetime time.Duration
+		wantErr      bool
+	}{
+		{
+			name:         "overrides",
+			cfg:          Config{URL: url, MaxConns: 40, MinConns: 5, MaxConnLifetime: 15 * time.Minute},
+			wantMax:      40,
+			wantMin:      5,
+			wantLifetime: 15 * time.Minute,
+		},
+		{
+			name:         "from URL",
+			cfg:          Config{URL: url + "&pool_max_conns=12&pool_min_conns=2&pool_max_conn_lifetime=30m"},
+			wantMax:      12,
+			wantMin:      2,
+			wantLifetime: 30 * time.Minute,
+		},
+		{
+			name:         "overrides win over URL",
+			cfg:          Config{URL: url + "&pool_max_conns=12", MaxConns: 20},
+			wantMax:      20,
+			wantLifetime: time.Hour, // pgxpool default
+		},
+		{
+			name:    "min above max",
+			cfg:     Config{URL: url, MaxConns: 4, MinConns: 8},
+			wantErr: true,
+		},
+		{
+			name:    "invalid URL",
+			cfg:     Config{URL: "postgres://localhost:5432/db?pool_max_conns=lots"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := poolConfig(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("poolConfig succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("poolConfig: %v", err)
+			}
+			if got.MaxConns != tt.wantMax || got.MinConns != tt.wantMin || got.MaxConnLifetime != tt.wantLifetime {
+				t.Errorf("pool config = max %d, min %d, lifetime %s; want max %d, min %d, lifetime %s",
+					got.MaxConns, got.MinConns, got.MaxConnLifetime, tt.wantMax, tt.wantMin, tt.wantLifetime)
+			}
+		})
+	}
+}
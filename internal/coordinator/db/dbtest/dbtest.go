@@ -0,0 +1,67 @@
+// Package dbtest provides database helpers for coordinator tests.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/migrations"
+)
+
+// Open connects to the PostgreSQL database named by TEST_DATABASE_URL and
+// migrates it to the latest schema, skipping the test if the variable isn't
+// set. The database is shared between tests, so tests should create the rows
+// they need and clean them up. The pool is closed when the test finishes.
+func Open(t testing.TB) *db.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", source, url)
+	if err != nil {
+		t.Fatalf("create migrator: %v", err)
+	}
+	defer m.Close() //nolint:errcheck // Close error not actionable
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	database, err := db.New(context.Background(), db.Config{URL: url})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(database.Close)
+	return database
+}
+
+// unreachableURL points at a port nothing listens on, so connecting is
+// refused immediately.
+const unreachableURL = "postgres://127.0.0.1:1/locscanner?sslmode=disable&connect_timeout=1"
+
+// Unreachable returns a DB whose queries all fail with a connection error,
+// for tests that run without PostgreSQL. Pools connect lazily, so creating
+// it needs no server. It's closed when the test ends.
+func Unreachable(t testing.TB) *db.DB {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), unreachableURL)
+	if err != nil {
+		t.Fatalf("create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return &db.DB{Pool: pool}
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DenylistEntry is a denylisted domain pattern.
+type DenylistEntry struct {
+	Pattern   string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// NormalizeDenyPattern lowercases a pattern and strips any trailing dot.
+// It returns an error unless the pattern is an exact domain or a "*."
+// suffix wildcard.
+func NormalizeDenyPattern(pattern string) (string, error) {
+	p := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	name := strings.TrimPrefix(p, "*.")
+	if name == "" || strings.Contains(name, "*") || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return "", errors.New(`pattern must be a domain ("host.example.com") or suffix wildcard ("*.example.com")`)
+	}
+	return p, nil
+}
+
+// denyCandidates returns every pattern that would deny fqdn: the FQDN itself
+// and a wildcard for each of its parent domains. "a.b.example.com" yields
+// "a.b.example.com", "*.b.example.com", "*.example.com" and "*.com".
+func denyCandidates(fqdn string) []string {
+	name := strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	if name == "" {
+		return nil
+	}
+	candidates := []string{name}
+	for i := strings.IndexByte(name, '.'); i >= 0; {
+		parent := name[i+1:]
+		candidates = append(candidates, "*."+parent)
+		next := strings.IndexByte(parent, '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return candidates
+}
+
+// Denylist is an in-memory snapshot of the denylist for matching many FQDNs.
+type Denylist struct {
+	patterns map[string]struct{}
+}
+
+// NewDenylist builds a Denylist from normalized patterns.
+func NewDenylist(patterns []string) *Denylist {
+	d := &Denylist{patterns: make(map[string]struct{}, len(patterns))}
+	for _, p := range patterns {
+		d.patterns[p] = struct{}{}
+	}
+	return d
+}
+
+// Denied reports whether fqdn matches any pattern. A nil or empty Denylist denies nothing.
+func (d *Denylist) Denied(fqdn string) bool {
+	if d == nil || len(d.patterns) == 0 {
+		return false
+	}
+	for _, c := range denyCandidates(fqdn) {
+		if _, ok := d.patterns[c]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of patterns.
+func (d *Denylist) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.patterns)
+}
+
+// IsDenied reports whether a single FQDN is denylisted.
+func (db *DB) IsDenied(ctx context.Context, fqdn string) (bool, error) {
+	candidates := denyCandidates(fqdn)
+	if len(candidates) == 0 {
+		return false, nil
+	}
+	var denied bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM domain_denylist WHERE pattern = ANY($1))
+	`, candidates).Scan(&denied)
+	return denied, err
+}
+
+// LoadDenylist returns a snapshot of the denylist for bulk matching.
+func (db *DB) LoadDenylist(ctx context.Context) (*Denylist, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT pattern FROM domain_denylist`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return NewDenylist(patterns), nil
+}
+
+// ListDenylist returns all denylist entries, newest first.
+func (db *DB) ListDenylist(ctx context.Context) ([]DenylistEntry, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT pattern, reason, created_at FROM domain_denylist ORDER BY created_at DESC, pattern
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []DenylistEntry
+	for rows.Next() {
+		var e DenylistEntry
+		if err := rows.Scan(&e.Pattern, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// AddDenylistEntry adds a normalized pattern, updating the reason if it already exists.
+func (db *DB) AddDenylistEntry(ctx context.Context, pattern, reason string) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO domain_denylist (pattern, reason) VALUES ($1, $2)
+		ON CONFLICT (pattern) DO UPDATE SET reason = EXCLUDED.reason
+	`, pattern, reason)
+	return err
+}
+
+// RemoveDenylistEntry deletes a pattern. Returns pgx.ErrNoRows if it isn't listed.
+func (db *DB) RemoveDenylistEntry(ctx context.Context, pattern string) error {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM domain_denylist WHERE pattern = $1`, pattern)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeDenyPattern(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"parked.example.com", "parked.example.com", false},
+		{"Parked.Example.COM.", "parked.example.com", false},
+		{"*.example.com", "*.example.com", false},
+		{" *.Example.com ", "*.example.com", false},
+		{"", "", true},
+		{"*.", "", true},
+		{"*", "", true},
+		{"parked*.com", "", true},
+		{"*.*.example.com", "", true},
+		{".example.com", "", true},
+		{"a..example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeDenyPattern(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeDenyPattern(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDenyPattern(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyCandidates(t *testing.T) {
+	got := denyCandidates("A.b.Example.com.")
+	want := []string{"a.b.example.com", "*.b.example.com", "*.example.com", "*.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("denyCandidates() = %v, want %v", got, want)
+	}
+
+	if got := denyCandidates("localhost"); !reflect.DeepEqual(got, []string{"localhost"}) {
+		t.Errorf("denyCandidates(localhost) = %v", got)
+	}
+	if got := denyCandidates(""); got != nil {
+		t.Errorf("denyCandidates(\"\") = %v, want nil", got)
+	}
+}
+
+func TestDenylist_Denied(t *testing.T) {
+	d := NewDenylist([]string{"parked.example.org", "*.example.com"})
+
+	tests := []struct {
+		fqdn string
+		want bool
+	}{
+		// Exact matches
+		{"parked.example.org", true},
+		{"PARKED.example.org.", true},
+		{"www.parked.example.org", false},
+		{"example.org", false},
+		// Suffix matches cover subdomains at any depth, but not the apex
+		{"www.example.com", true},
+		{"a.b.c.example.com", true},
+		{"example.com", false},
+		{"notexample.com", false},
+		{"example.com.evil.net", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fqdn, func(t *testing.T) {
+			if got := d.Denied(tt.fqdn); got != tt.want {
+				t.Errorf("Denied(%q) = %v, want %v", tt.fqdn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenylist_Empty(t *testing.T) {
+	var nilList *Denylist
+	if nilList.Denied("example.com") || nilList.Len() != 0 {
+		t.Error("nil Denylist should deny nothing")
+	}
+	if NewDenylist(nil).Denied("example.com") {
+		t.Error("empty Denylist should deny nothing")
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"strings"
 	"time"
 )
 
@@ -12,9 +13,12 @@ type DomainFile struct {
 	URL              string
 	SizeBytes        *int64
 	ProcessedLines   int64
+	ProcessedBytes   *int64 // Decompressed bytes through ProcessedLines (nil if unknown)
+	LinesFed         int64  // Domains put into batches so far
 	BatchesCreated   int
 	BatchesCompleted int
 	FeedingComplete  bool
+	TotalLines       *int64 // Lines read on the last completed feed (nil if never completed)
 	Status           string
 	StartedAt        *time.Time
 	CompletedAt      *time.Time
@@ -49,23 +53,80 @@ func (db *DB) GetDomainFileStats(ctx context.Context) (*DomainFileStats, error)
 	return &stats, err
 }
 
-// GetNextFileToProcess returns the next file to process.
+// FileFilter restricts which domain files are selected for processing by
+// globs on the filename, e.g. "data/france/*". In a glob, "*" matches any run
+// of characters (including "/") and "?" matches exactly one.
+type FileFilter struct {
+	Include []string // If non-empty, a file must match at least one
+	Exclude []string // A file matching any of these is skipped
+	SkipIDs []int    // Files to pass over, e.g. ones other feeder workers hold
+}
+
+// skipArgs returns SkipIDs, non-nil so it encodes as an empty array rather than NULL.
+func (f FileFilter) skipArgs() []int {
+	if f.SkipIDs == nil {
+		return []int{}
+	}
+	return f.SkipIDs
+}
+
+// likeArgs returns the include and exclude globs as SQL LIKE patterns.
+// Both are non-nil so they encode as empty arrays rather than NULL.
+func (f FileFilter) likeArgs() (include, exclude []string) {
+	include = make([]string, 0, len(f.Include))
+	for _, g := range f.Include {
+		include = append(include, globToLike(g))
+	}
+	exclude = make([]string, 0, len(f.Exclude))
+	for _, g := range f.Exclude {
+		exclude = append(exclude, globToLike(g))
+	}
+	return include, exclude
+}
+
+// globToLike converts a glob to a LIKE pattern, escaping LIKE's own wildcards.
+func globToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// GetNextFileToProcess returns the next file to process that passes filter.
 // Prefers files already in 'processing' status (resume), then 'pending'.
 // Excludes files that are fully fed but waiting for batches to complete.
-func (db *DB) GetNextFileToProcess(ctx context.Context) (*DomainFile, error) {
+func (db *DB) GetNextFileToProcess(ctx context.Context, filter FileFilter) (*DomainFile, error) {
+	include, exclude := filter.likeArgs()
 	var f DomainFile
 	err := db.Pool.QueryRow(ctx, `
-		SELECT id, filename, url, size_bytes, processed_lines, batches_created, batches_completed, feeding_complete, status, started_at, completed_at
+		SELECT id, filename, url, size_bytes, processed_lines, processed_bytes, lines_fed, batches_created, batches_completed, feeding_complete, total_lines, status, started_at, completed_at
 		FROM domain_files
 		WHERE status IN ('processing', 'pending')
-		-- Exclude files that are done feeding but still have pending batches
-		AND NOT (feeding_complete = true AND batches_completed < batches_created)
+		-- Exclude files that are done feeding but still have outstanding batches
+		AND NOT (feeding_complete = true AND EXISTS (
+			SELECT 1 FROM scan_batches b WHERE b.file_id = domain_files.id
+		))
+		AND (cardinality($1::text[]) = 0 OR filename LIKE ANY($1::text[]))
+		AND NOT filename LIKE ANY($2::text[])
+		AND id <> ALL($3::int[])
+		AND filename <> ALL($4::text[])
 		ORDER BY
 			CASE status WHEN 'processing' THEN 0 ELSE 1 END,
 			filename
 		LIMIT 1
 		FOR UPDATE SKIP LOCKED
-	`).Scan(&f.ID, &f.Filename, &f.URL, &f.SizeBytes, &f.ProcessedLines, &f.BatchesCreated, &f.BatchesCompleted, &f.FeedingComplete, &f.Status, &f.StartedAt, &f.CompletedAt)
+	`, include, exclude, filter.skipArgs(), pseudoFiles).Scan(&f.ID, &f.Filename, &f.URL, &f.SizeBytes, &f.ProcessedLines, &f.ProcessedBytes, &f.LinesFed, &f.BatchesCreated, &f.BatchesCompleted, &f.FeedingComplete, &f.TotalLines, &f.Status, &f.StartedAt, &f.CompletedAt)
 
 	if err != nil {
 		if err.Error() == "no rows in result set" {
@@ -93,12 +154,12 @@ func (db *DB) GetNextFileToProcess(ctx context.Context) (*DomainFile, error) {
 func (db *DB) GetCurrentProcessingFile(ctx context.Context) (*DomainFile, error) {
 	var f DomainFile
 	err := db.Pool.QueryRow(ctx, `
-		SELECT id, filename, url, size_bytes, processed_lines, batches_created, batches_completed, feeding_complete, status, started_at, completed_at
+		SELECT id, filename, url, size_bytes, processed_lines, processed_bytes, lines_fed, batches_created, batches_completed, feeding_complete, total_lines, status, started_at, completed_at
 		FROM domain_files
 		WHERE status = 'processing'
 		ORDER BY started_at
 		LIMIT 1
-	`).Scan(&f.ID, &f.Filename, &f.URL, &f.SizeBytes, &f.ProcessedLines, &f.BatchesCreated, &f.BatchesCompleted, &f.FeedingComplete, &f.Status, &f.StartedAt, &f.CompletedAt)
+	`).Scan(&f.ID, &f.Filename, &f.URL, &f.SizeBytes, &f.ProcessedLines, &f.ProcessedBytes, &f.LinesFed, &f.BatchesCreated, &f.BatchesCompleted, &f.FeedingComplete, &f.TotalLines, &f.Status, &f.StartedAt, &f.CompletedAt)
 
 	if err != nil {
 		if err.Error() == "no rows in result set" {
@@ -113,30 +174,32 @@ func (db *DB) GetCurrentProcessingFile(ctx context.Context) (*DomainFile, error)
 func (db *DB) UpdateFileProgress(ctx context.Context, fileID int, processedLines int64, batchesCreated int) error {
 	_, err := db.Pool.Exec(ctx, `
 		UPDATE domain_files
-		SET processed_lines = $2, batches_created = $3
+		SET processed_lines = $2, processed_bytes = NULL, batches_created = $3
 		WHERE id = $1
 	`, fileID, processedLines, batchesCreated)
 	return err
 }
 
-// IncrementBatchesCompleted increments the batches_completed counter for a file.
+// IncrementBatchesCompleted increments the batches_completed counter for a file,
+// never past batches_created.
 func (db *DB) IncrementBatchesCompleted(ctx context.Context, fileID int) error {
 	_, err := db.Pool.Exec(ctx, `
 		UPDATE domain_files
-		SET batches_completed = batches_completed + 1
+		SET batches_completed = LEAST(batches_completed + 1, batches_created)
 		WHERE id = $1
 	`, fileID)
 	return err
 }
 
-// MarkFeedingComplete marks a file as done reading all lines.
+// MarkFeedingComplete marks a file as done reading all lines and records
+// how many lines were read in total.
 // The file stays in 'processing' status until all batches complete.
-func (db *DB) MarkFeedingComplete(ctx context.Context, fileID int) error {
+func (db *DB) MarkFeedingComplete(ctx context.Context, fileID int, totalLines int64) error {
 	_, err := db.Pool.Exec(ctx, `
 		UPDATE domain_files
-		SET feeding_complete = true
+		SET feeding_complete = true, total_lines = $2
 		WHERE id = $1
-	`, fileID)
+	`, fileID, totalLines)
 	return err
 }
 
@@ -150,16 +213,36 @@ func (db *DB) MarkFileComplete(ctx context.Context, fileID int) error {
 	return err
 }
 
-// CheckAndMarkFileComplete checks if all batches are completed and marks the file complete.
-// Returns true if the file was marked complete.
-// Note: batches_created = 0 is valid for empty files (all comments/blank lines).
+// CountRemainingBatchesForFile returns how many batches (pending, in flight,
+// or quarantined) still exist for a file.
+func (db *DB) CountRemainingBatchesForFile(ctx context.Context, fileID int) (int, error) {
+	var count int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM scan_batches WHERE file_id = $1
+	`, fileID).Scan(&count)
+	return count, err
+}
+
+// CheckAndMarkFileComplete marks the file complete once feeding is done and no
+// batches remain for it. Returns true if the file was marked complete.
+// Completion is derived from the batches table rather than the
+// batches_created/batches_completed counters, which can drift when batches are
+// requeued or the feeder restarts mid-file.
+// Note: a file with no batches at all is valid (all comments/blank lines).
 func (db *DB) CheckAndMarkFileComplete(ctx context.Context, fileID int) (bool, error) {
+	remaining, err := db.CountRemainingBatchesForFile(ctx, fileID)
+	if err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+
 	result, err := db.Pool.Exec(ctx, `
 		UPDATE domain_files
 		SET status = 'complete', completed_at = NOW()
 		WHERE id = $1
 		AND feeding_complete = true
-		AND batches_created = batches_completed
 		AND status = 'processing'
 	`, fileID)
 	if err != nil {
@@ -169,28 +252,118 @@ func (db *DB) CheckAndMarkFileComplete(ctx context.Context, fileID int) (bool, e
 }
 
 // UpsertDomainFile inserts or updates a domain file record.
-func (db *DB) UpsertDomainFile(ctx context.Context, filename, url string, sizeBytes int64) error {
-	_, err := db.Pool.Exec(ctx, `
-		INSERT INTO domain_files (filename, url, size_bytes)
-		VALUES ($1, $2, $3)
+// If the file already exists with a different SHA, its progress is reset to
+// pending and its outstanding batches are deleted so the new content is scanned.
+// Returns whether the file is new and whether it was reset due to a content change.
+func (db *DB) UpsertDomainFile(ctx context.Context, filename, url, sha string, sizeBytes int64) (inserted, changed bool, err error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var fileID int
+	err = tx.QueryRow(ctx, `
+		WITH old AS (
+			SELECT id, sha FROM domain_files WHERE filename = $1
+		)
+		INSERT INTO domain_files (filename, url, size_bytes, sha)
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (filename) DO UPDATE SET
 			url = EXCLUDED.url,
-			size_bytes = EXCLUDED.size_bytes
-	`, filename, url, sizeBytes)
-	return err
+			size_bytes = EXCLUDED.size_bytes,
+			sha = EXCLUDED.sha
+		RETURNING id,
+			(SELECT id FROM old) IS NULL,
+			(SELECT sha FROM old) IS NOT NULL AND (SELECT sha FROM old) <> $4
+	`, filename, url, sizeBytes, sha).Scan(&fileID, &inserted, &changed)
+	if err != nil {
+		return false, false, err
+	}
+
+	if changed {
+		if _, err := tx.Exec(ctx, `DELETE FROM scan_batches WHERE file_id = $1`, fileID); err != nil {
+			return false, false, err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE domain_files
+			SET status = 'pending',
+			    processed_lines = 0,
+			    processed_bytes = NULL,
+			    lines_fed = 0,
+			    batches_created = 0,
+			    batches_completed = 0,
+			    feeding_complete = false,
+			    started_at = NULL,
+			    completed_at = NULL
+			WHERE id = $1
+		`, fileID); err != nil {
+			return false, false, err
+		}
+	}
+
+	return inserted, changed, tx.Commit(ctx)
 }
 
 // ResetAllFiles resets all files to pending status (for re-scanning).
+// Pseudo files are left alone, since there is nothing to download for them.
 func (db *DB) ResetAllFiles(ctx context.Context) error {
 	_, err := db.Pool.Exec(ctx, `
 		UPDATE domain_files
 		SET status = 'pending',
 		    processed_lines = 0,
+		    processed_bytes = NULL,
+		    lines_fed = 0,
 		    batches_created = 0,
 		    batches_completed = 0,
 		    feeding_complete = false,
 		    started_at = NULL,
 		    completed_at = NULL
-	`)
+		WHERE filename <> ALL($1::text[])
+	`, pseudoFiles)
 	return err
 }
+
+// FileCoverage summarizes the outcome of scanning a single domain file.
+type FileCoverage struct {
+	ID               int
+	Filename         string
+	Status           string
+	SizeBytes        *int64
+	ProcessedLines   int64 // Lines read, including blank, comment and invalid ones
+	LinesFed         int64 // Domains put into batches
+	BatchesCreated   int
+	BatchesCompleted int
+	LOCRecords       int
+	StartedAt        *time.Time
+	CompletedAt      *time.Time
+}
+
+// GetCoverageReport returns per-file progress with the number of LOC records
+// attributed to each file.
+func (db *DB) GetCoverageReport(ctx context.Context) ([]FileCoverage, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT f.id, f.filename, f.status, f.size_bytes, f.processed_lines, f.lines_fed,
+		       f.batches_created, f.batches_completed, COUNT(l.id) as loc_records,
+		       f.started_at, f.completed_at
+		FROM domain_files f
+		LEFT JOIN loc_records l ON l.file_id = f.id
+		GROUP BY f.id
+		ORDER BY f.filename
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []FileCoverage
+	for rows.Next() {
+		var c FileCoverage
+		if err := rows.Scan(&c.ID, &c.Filename, &c.Status, &c.SizeBytes, &c.ProcessedLines, &c.LinesFed,
+			&c.BatchesCreated, &c.BatchesCompleted, &c.LOCRecords, &c.StartedAt, &c.CompletedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, c)
+	}
+	return files, rows.Err()
+}
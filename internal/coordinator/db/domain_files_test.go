@@ -0,0 +1,76 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGlobToLike(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"data/france/*", "data/france/%"},
+		{"data/*/domain2multi-??00.txt.xz", "data/%/domain2multi-__00.txt.xz"},
+		{"data/100%_real/*", `data/100\%\_real/%`},
+		{`data\x`, `data\\x`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := globToLike(tt.glob); got != tt.want {
+			t.Errorf("globToLike(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestFileFilter_LikeArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      FileFilter
+		wantInclude []string
+		wantExclude []string
+	}{
+		{
+			name:        "no filter",
+			filter:      FileFilter{},
+			wantInclude: []string{},
+			wantExclude: []string{},
+		},
+		{
+			name:        "include only",
+			filter:      FileFilter{Include: []string{"data/france/*", "data/belgium/*"}},
+			wantInclude: []string{"data/france/%", "data/belgium/%"},
+			wantExclude: []string{},
+		},
+		{
+			name:        "exclude only",
+			filter:      FileFilter{Exclude: []string{"data/russia/*"}},
+			wantInclude: []string{},
+			wantExclude: []string{"data/russia/%"},
+		},
+		{
+			name: "include and exclude",
+			filter: FileFilter{
+				Include: []string{"data/france/*"},
+				Exclude: []string{"data/france/*-fr00.txt.xz"},
+			},
+			wantInclude: []string{"data/france/%"},
+			wantExclude: []string{"data/france/%-fr00.txt.xz"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			include, exclude := tt.filter.likeArgs()
+			// nil would be sent as NULL and make the query match nothing
+			if include == nil || exclude == nil {
+				t.Fatalf("likeArgs() returned nil slice: include=%v exclude=%v", include, exclude)
+			}
+			if !slices.Equal(include, tt.wantInclude) {
+				t.Errorf("include = %q, want %q", include, tt.wantInclude)
+			}
+			if !slices.Equal(exclude, tt.wantExclude) {
+				t.Errorf("exclude = %q, want %q", exclude, tt.wantExclude)
+			}
+		})
+	}
+}
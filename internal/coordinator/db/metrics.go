@@ -14,8 +14,9 @@ type MetricsSnapshot struct {
 	FilesComplete   int
 
 	// Batch stats
-	BatchesPending  int
-	BatchesInFlight int
+	BatchesPending     int
+	BatchesInFlight    int
+	BatchesQuarantined int
 
 	// LOC stats
 	LOCRecordsTotal int
@@ -41,6 +42,7 @@ func (db *DB) GetMetricsSnapshot(ctx context.Context, heartbeatTimeout time.Dura
 			-- Batch stats
 			(SELECT COUNT(*) FROM scan_batches WHERE status = 'pending') as batches_pending,
 			(SELECT COUNT(*) FROM scan_batches WHERE status = 'in_flight') as batches_in_flight,
+			(SELECT COUNT(*) FROM scan_batches WHERE status = 'quarantined') as batches_quarantined,
 			-- LOC stats
 			(SELECT COUNT(*) FROM loc_records) as loc_records_total,
 			(SELECT COUNT(DISTINCT root_domain) FROM loc_records) as domains_with_loc,
@@ -54,6 +56,7 @@ func (db *DB) GetMetricsSnapshot(ctx context.Context, heartbeatTimeout time.Dura
 		&m.FilesComplete,
 		&m.BatchesPending,
 		&m.BatchesInFlight,
+		&m.BatchesQuarantined,
 		&m.LOCRecordsTotal,
 		&m.DomainsWithLOC,
 		&m.ScannersTotal,
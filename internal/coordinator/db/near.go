@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"math"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// EarthRadiusKm is the mean Earth radius used for distances.
+const EarthRadiusKm = 6371.0
+
+// haversineKm returns the great-circle distance between two points in
+// decimal degrees. It mirrors the SQL in ListLOCRecordsNear.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(min(a, 1)))
+}
+
+// radiusBBox returns a bounding box containing every point within radiusKm
+// of lat, lon, for cheap pre-filtering before the exact distance check.
+// Longitude spans the whole globe when the circle reaches a pole.
+func radiusBBox(lat, lon, radiusKm float64) BoundingBox {
+	dLat := radiusKm / EarthRadiusKm * 180 / math.Pi
+	b := BoundingBox{MinLat: max(lat-dLat, -90), MaxLat: min(lat+dLat, 90), MinLon: -180, MaxLon: 180}
+	if b.MinLat == -90 || b.MaxLat == 90 {
+		return b
+	}
+
+	// Widest longitude span of the circle; asin's argument is below 1
+	// because the circle doesn't reach a pole
+	dLon := math.Asin(math.Sin(radiusKm/EarthRadiusKm)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+	if dLon >= 180 {
+		return b
+	}
+	b.MinLon, b.MaxLon = wrapLon(lon-dLon), wrapLon(lon+dLon)
+	return b
+}
+
+// wrapLon normalizes a longitude into [-180, 180].
+func wrapLon(lon float64) float64 {
+	switch {
+	case lon < -180:
+		return lon + 360
+	case lon > 180:
+		return lon - 360
+	}
+	return lon
+}
+
+// ListLOCRecordsNear returns up to limit records within radiusKm of lat,
+// lon, nearest first, with their distances in km.
+func (db *DB) ListLOCRecordsNear(ctx context.Context, lat, lon, radiusKm float64, limit int) ([]api.NearbyLOCRecord, error) {
+	bbox := radiusBBox(lat, lon, radiusKm)
+	where, args := buildRecordWhere(LOCRecordFilter{BBox: &bbox}, []any{lat, lon, radiusKm, limit, EarthRadiusKm})
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT * FROM (
+			SELECT fqdn, root_domain, raw_record, latitude, longitude,
+			       altitude_m, size_m, horiz_prec_m, vert_prec_m,
+			       first_seen_at, last_seen_at,
+			       2 * $5::float8 * ASIN(SQRT(LEAST(1,
+			           POWER(SIN(RADIANS(latitude - $1) / 2), 2) +
+			           COS(RADIANS($1)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - $2) / 2), 2)
+			       ))) AS distance_km
+			FROM loc_records`+where+`
+		) near
+		WHERE distance_km <= $3
+		ORDER BY distance_km, fqdn
+		LIMIT $4
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []api.NearbyLOCRecord
+	for rows.Next() {
+		var r api.NearbyLOCRecord
+		if err := rows.Scan(&r.FQDN, &r.RootDomain, &r.RawRecord, &r.Latitude, &r.Longitude,
+			&r.AltitudeM, &r.SizeM, &r.HorizPrecM, &r.VertPrecM, &r.FirstSeenAt, &r.LastSeenAt, &r.DistanceKm); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 52.37, 4.89, 52.37, 4.89, 0},
+		{"Amsterdam to London", 52.3676, 4.9041, 51.5074, -0.1278, 357.5},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111.19},
+		{"across the anti-meridian", 0, 179.5, 0, -179.5, 111.19},
+		{"antipodes", 0, 0, 0, 180, math.Pi * EarthRadiusKm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("haversineKm = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+// inBBox reports whether a point passes buildRecordWhere's bbox filter.
+func inBBox(b BoundingBox, lat, lon float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
+
+func TestRadiusBBox_PreFilter(t *testing.T) {
+	// Records around a query point, some inside the radius and some outside.
+	// Everything inside must survive the bbox pre-filter; the haversine check
+	// then separates inside from outside.
+	tests := []struct {
+		name      string
+		lat, lon  float64
+		radiusKm  float64
+		records   [][2]float64
+		wantNear  []bool
+		wantWraps bool
+	}{
+		{
+			name: "Amsterdam, 55 km", lat: 52.3676, lon: 4.9041, radiusKm: 55,
+			records:  [][2]float64{{52.3676, 4.9041}, {52.0907, 5.1214}, {52.0705, 4.3007}, {51.9244, 4.4777}, {51.5074, -0.1278}},
+			wantNear: []bool{true, true, true, false, false}, // Amsterdam, Utrecht, The Hague in; Rotterdam, London out
+		},
+		{
+			name: "Fiji, straddling the anti-meridian", lat: -17.7, lon: 179.9, radiusKm: 100,
+			records:   [][2]float64{{-17.7, -179.8}, {-17.7, 179.0}, {-17.7, -178.0}},
+			wantNear:  []bool{true, true, false},
+			wantWraps: true,
+		},
+		{
+			name: "near the north pole", lat: 89.5, lon: 0, radiusKm: 200,
+			records:  [][2]float64{{89.5, 180}, {88.5, 90}, {87, 0}},
+			wantNear: []bool{true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := radiusBBox(tt.lat, tt.lon, tt.radiusKm)
+			if wraps := b.MinLon > b.MaxLon; wraps != tt.wantWraps {
+				t.Errorf("bbox %+v crosses the anti-meridian = %v, want %v", b, wraps, tt.wantWraps)
+			}
+			for i, rec := range tt.records {
+				d := haversineKm(tt.lat, tt.lon, rec[0], rec[1])
+				if near := d <= tt.radiusKm; near != tt.wantNear[i] {
+					t.Errorf("record %v at %.1f km: within radius = %v, want %v", rec, d, near, tt.wantNear[i])
+				}
+				if tt.wantNear[i] && !inBBox(b, rec[0], rec[1]) {
+					t.Errorf("record %v within the radius is outside the pre-filter bbox %+v", rec, b)
+				}
+			}
+		})
+	}
+}
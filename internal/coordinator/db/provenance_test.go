@@ -0,0 +1,106 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestLOCRecordProvenance(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+	const fqdn = "provenance-test.example.com"
+
+	// Complete, so a feeder sharing the database leaves it alone
+	var fileID int
+	err := database.Pool.QueryRow(ctx, `
+		INSERT INTO domain_files (filename, url, status, feeding_complete)
+		VALUES ('provenance-test.txt', '', 'complete', true)
+		RETURNING id
+	`).Scan(&fileID)
+	if err != nil {
+		t.Fatalf("create domain file: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		_, _ = database.Pool.Exec(ctx, `DELETE FROM loc_records WHERE fqdn = $1`, fqdn)
+		_, _ = database.Pool.Exec(ctx, `DELETE FROM scan_batches WHERE domains = $1`, fqdn)
+		_, _ = database.Pool.Exec(ctx, `DELETE FROM domain_files WHERE id = $1`, fileID) // Cascades to its batches
+	})
+
+	storedFileID := func() *int {
+		t.Helper()
+		var id *int
+		if err := database.Pool.QueryRow(ctx, `SELECT file_id FROM loc_records WHERE fqdn = $1`, fqdn).Scan(&id); err != nil {
+			t.Fatalf("read file_id: %v", err)
+		}
+		return id
+	}
+
+	// A batch read from a real file is attributed to it
+	var fileBatchID int64
+	err = database.Pool.QueryRow(ctx, `
+		INSERT INTO scan_batches (file_id, line_start, line_end, domains) VALUES ($1, 1, 1, $2) RETURNING id
+	`, fileID, fqdn).Scan(&fileBatchID)
+	if err != nil {
+		t.Fatalf("create file batch: %v", err)
+	}
+	source, err := database.GetBatchFileID(ctx, fileBatchID)
+	if err != nil {
+		t.Fatalf("GetBatchFileID(file batch): %v", err)
+	}
+	if source == nil || *source != fileID {
+		t.Fatalf("GetBatchFileID(file batch) = %v, want %d", source, fileID)
+	}
+
+	rec := api.LOCRecord{FQDN: fqdn, RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m", Latitude: 52.37, Longitude: 4.89}
+	if _, err := database.UpsertLOCRecord(ctx, "example.com", source, rec); err != nil {
+		t.Fatalf("UpsertLOCRecord: %v", err)
+	}
+	if got := storedFileID(); got == nil || *got != fileID {
+		t.Errorf("file_id after discovery = %v, want %d", got, fileID)
+	}
+
+	// A manual batch has no source file, so a rescan through one keeps the
+	// record's existing provenance
+	if err := database.CreateManualBatches(ctx, [][]string{{fqdn}}); err != nil {
+		t.Fatalf("CreateManualBatches: %v", err)
+	}
+	var manualBatchID int64
+	err = database.Pool.QueryRow(ctx, `
+		SELECT b.id FROM scan_batches b
+		JOIN domain_files f ON f.id = b.file_id
+		WHERE f.filename = $1 AND b.domains = $2
+	`, db.ManualSubmissionsFile, fqdn).Scan(&manualBatchID)
+	if err != nil {
+		t.Fatalf("find manual batch: %v", err)
+	}
+	source, err = database.GetBatchFileID(ctx, manualBatchID)
+	if err != nil {
+		t.Fatalf("GetBatchFileID(manual batch): %v", err)
+	}
+	if source != nil {
+		t.Fatalf("GetBatchFileID(manual batch) = %d, want nil", *source)
+	}
+
+	if _, err := database.UpsertLOCRecord(ctx, "example.com", source, rec); err != nil {
+		t.Fatalf("UpsertLOCRecord (re-upsert): %v", err)
+	}
+	if got := storedFileID(); got == nil || *got != fileID {
+		t.Errorf("file_id after manual rescan = %v, want %d kept", got, fileID)
+	}
+
+	// A record first found by a manual scan has none
+	if _, err := database.Pool.Exec(ctx, `DELETE FROM loc_records WHERE fqdn = $1`, fqdn); err != nil {
+		t.Fatalf("delete record: %v", err)
+	}
+	if _, err := database.UpsertLOCRecord(ctx, "example.com", source, rec); err != nil {
+		t.Fatalf("UpsertLOCRecord (manual): %v", err)
+	}
+	if got := storedFileID(); got != nil {
+		t.Errorf("file_id for a manual discovery = %d, want NULL", *got)
+	}
+}
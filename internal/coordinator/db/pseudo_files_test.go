@@ -0,0 +1,51 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+)
+
+func TestPseudoFilesAreNeverFed(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+	pseudo := []string{db.ManualSubmissionsFile, db.StaleRescanFile}
+
+	// A full reset leaves them complete
+	if err := database.ResetAllFiles(ctx); err != nil {
+		t.Fatalf("ResetAllFiles: %v", err)
+	}
+	var complete int
+	err := database.Pool.QueryRow(ctx, `
+		SELECT count(*) FROM domain_files
+		WHERE filename = ANY($1) AND status = 'complete' AND feeding_complete
+	`, pseudo).Scan(&complete)
+	if err != nil {
+		t.Fatalf("count pseudo files: %v", err)
+	}
+	if complete != len(pseudo) {
+		t.Errorf("%d of %d pseudo files complete after reset", complete, len(pseudo))
+	}
+
+	// Even marked pending, the feeder doesn't pick them up
+	t.Cleanup(func() {
+		_, _ = database.Pool.Exec(context.Background(), `
+			UPDATE domain_files SET status = 'complete', feeding_complete = true WHERE filename = ANY($1)
+		`, pseudo)
+	})
+	_, err = database.Pool.Exec(ctx, `
+		UPDATE domain_files SET status = 'pending', feeding_complete = false WHERE filename = ANY($1)
+	`, pseudo)
+	if err != nil {
+		t.Fatalf("mark pseudo files pending: %v", err)
+	}
+	f, err := database.GetNextFileToProcess(ctx, db.FileFilter{Include: pseudo})
+	if err != nil {
+		t.Fatalf("GetNextFileToProcess: %v", err)
+	}
+	if f != nil {
+		t.Errorf("GetNextFileToProcess = %q, want no file", f.Filename)
+	}
+}
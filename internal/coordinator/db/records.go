@@ -2,6 +2,9 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -25,12 +28,16 @@ type StoredLOCRecord struct {
 	LastSeenAt  time.Time
 }
 
-// UpsertLOCRecord inserts or updates a LOC record.
-// If the FQDN already exists, updates last_seen_at.
-func (db *DB) UpsertLOCRecord(ctx context.Context, rootDomain string, rec api.LOCRecord) error {
-	_, err := db.Pool.Exec(ctx, `
-		INSERT INTO loc_records (root_domain, fqdn, raw_record, latitude, longitude, altitude_m, size_m, horiz_prec_m, vert_prec_m)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+// UpsertLOCRecord inserts or updates a LOC record and returns it as stored.
+// If the FQDN already exists, updates last_seen_at and clears any pending
+// rescan or missing mark.
+// fileID is the domain file the record was discovered from (nil if unknown,
+// which keeps any source already recorded).
+func (db *DB) UpsertLOCRecord(ctx context.Context, rootDomain string, fileID *int, rec api.LOCRecord) (*api.PublicLOCRecord, error) {
+	var r api.PublicLOCRecord
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO loc_records (root_domain, fqdn, raw_record, latitude, longitude, altitude_m, size_m, horiz_prec_m, vert_prec_m, file_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		ON CONFLICT (fqdn) DO UPDATE SET
 			raw_record = EXCLUDED.raw_record,
 			latitude = EXCLUDED.latitude,
@@ -39,50 +46,235 @@ func (db *DB) UpsertLOCRecord(ctx context.Context, rootDomain string, rec api.LO
 			size_m = EXCLUDED.size_m,
 			horiz_prec_m = EXCLUDED.horiz_prec_m,
 			vert_prec_m = EXCLUDED.vert_prec_m,
-			last_seen_at = NOW()
-	`, rootDomain, rec.FQDN, rec.RawRecord, rec.Latitude, rec.Longitude, rec.AltitudeM, rec.SizeM, rec.HorizPrecM, rec.VertPrecM)
-	return err
+			-- Keep existing provenance when rescanned without a source file
+			file_id = COALESCE(EXCLUDED.file_id, loc_records.file_id),
+			last_seen_at = NOW(),
+			rescan_queued_at = NULL,
+			missing_since = NULL
+		RETURNING fqdn, root_domain, raw_record, latitude, longitude,
+		          altitude_m, size_m, horiz_prec_m, vert_prec_m,
+		          first_seen_at, last_seen_at
+	`, rootDomain, rec.FQDN, rec.RawRecord, rec.Latitude, rec.Longitude, rec.AltitudeM, rec.SizeM, rec.HorizPrecM, rec.VertPrecM, fileID).Scan(
+		&r.FQDN, &r.RootDomain, &r.RawRecord, &r.Latitude, &r.Longitude,
+		&r.AltitudeM, &r.SizeM, &r.HorizPrecM, &r.VertPrecM, &r.FirstSeenAt, &r.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
 }
 
-// ListLOCRecords returns paginated LOC records with optional domain filter.
-func (db *DB) ListLOCRecords(ctx context.Context, limit, offset int, domainFilter string) ([]api.PublicLOCRecord, int, error) {
-	// Count total
-	var total int
-	countQuery := `SELECT COUNT(*) FROM loc_records`
-	countArgs := []any{}
+// GetStaleLOCRecords returns up to limit FQDNs of records last seen more
+// than olderThan ago, oldest first. Records already queued for a rescan
+// within that period are skipped, so a pending rescan isn't queued twice.
+func (db *DB) GetStaleLOCRecords(ctx context.Context, olderThan time.Duration, limit int) ([]string, error) {
+	if olderThan <= 0 {
+		return nil, fmt.Errorf("stale interval must be positive, got %s", olderThan)
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT fqdn FROM loc_records
+		WHERE last_seen_at < NOW() - $1::interval
+		AND (rescan_queued_at IS NULL OR rescan_queued_at < NOW() - $1::interval)
+		ORDER BY last_seen_at
+		LIMIT $2
+	`, olderThan.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	if domainFilter != "" {
-		countQuery += ` WHERE root_domain = $1`
-		countArgs = append(countArgs, domainFilter)
+	var fqdns []string
+	for rows.Next() {
+		var fqdn string
+		if err := rows.Scan(&fqdn); err != nil {
+			return nil, err
+		}
+		fqdns = append(fqdns, fqdn)
 	}
+	return fqdns, rows.Err()
+}
+
+// MarkLOCRecordsMissing sets missing_since on the records for fqdns that
+// aren't already marked, returning how many were newly marked. FQDNs
+// without a stored record are ignored.
+func (db *DB) MarkLOCRecordsMissing(ctx context.Context, fqdns []string) (int, error) {
+	if len(fqdns) == 0 {
+		return 0, nil
+	}
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE loc_records SET missing_since = NOW()
+		WHERE fqdn = ANY($1) AND missing_since IS NULL
+	`, fqdns)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// PruneMissingLOCRecords deletes records that have been missing for longer
+// than olderThan, returning how many were deleted.
+func (db *DB) PruneMissingLOCRecords(ctx context.Context, olderThan time.Duration) (int, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("prune grace period must be positive, got %s", olderThan)
+	}
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM loc_records WHERE missing_since < NOW() - $1::interval
+	`, olderThan.String())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// CountMissingLOCRecords returns the number of records marked missing.
+func (db *DB) CountMissingLOCRecords(ctx context.Context) (int, error) {
+	var count int
+	err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM loc_records WHERE missing_since IS NOT NULL`).Scan(&count)
+	return count, err
+}
 
-	if err := db.Pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+// DeleteLOCRecordByFQDN removes the LOC record for fqdn.
+// Returns pgx.ErrNoRows if there is no such record.
+func (db *DB) DeleteLOCRecordByFQDN(ctx context.Context, fqdn string) error {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM loc_records WHERE fqdn = $1`, fqdn)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// CorrectLOCRecord overwrites the coordinates set in patch on the record for
+// fqdn and returns the updated record. last_seen_at is bumped so GeoJSON
+// caches keyed on GetLOCRecordsVersion are invalidated. A later scan that
+// finds the record again will replace the correction.
+// Returns pgx.ErrNoRows if there is no such record.
+func (db *DB) CorrectLOCRecord(ctx context.Context, fqdn string, patch api.PatchLOCRecordRequest) (*api.PublicLOCRecord, error) {
+	var r api.PublicLOCRecord
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE loc_records
+		SET latitude = COALESCE($2, latitude),
+		    longitude = COALESCE($3, longitude),
+		    altitude_m = COALESCE($4, altitude_m),
+		    last_seen_at = NOW()
+		WHERE fqdn = $1
+		RETURNING fqdn, root_domain, raw_record, latitude, longitude,
+		          altitude_m, size_m, horiz_prec_m, vert_prec_m,
+		          first_seen_at, last_seen_at
+	`, fqdn, patch.Latitude, patch.Longitude, patch.AltitudeM).Scan(
+		&r.FQDN, &r.RootDomain, &r.RawRecord, &r.Latitude, &r.Longitude,
+		&r.AltitudeM, &r.SizeM, &r.HorizPrecM, &r.VertPrecM, &r.FirstSeenAt, &r.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// BoundingBox is a geographic filter in decimal degrees.
+// If MinLon > MaxLon the box crosses the anti-meridian.
+type BoundingBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// LOCRecordFilter holds optional filters for listing LOC records.
+type LOCRecordFilter struct {
+	RootDomain string
+	BBox       *BoundingBox
+	// Search matches FQDNs containing it, case-insensitively. It is matched
+	// literally: LIKE wildcards in it are escaped.
+	Search string
+	// MinAltitudeM and MaxAltitudeM bound altitude_m inclusively; either
+	// may be nil for an open-ended range.
+	MinAltitudeM *float64
+	MaxAltitudeM *float64
+}
+
+// MaxSearchLength caps LOCRecordFilter.Search; no FQDN is longer.
+const MaxSearchLength = 253
+
+// escapeLike escapes LIKE's wildcards and escape character so s matches
+// only itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// buildRecordWhere builds a WHERE clause for the given filter.
+// Placeholders are numbered after any args already present.
+func buildRecordWhere(filter LOCRecordFilter, args []any) (string, []any) {
+	var conds []string
+
+	if filter.RootDomain != "" {
+		args = append(args, filter.RootDomain)
+		conds = append(conds, fmt.Sprintf("root_domain = $%d", len(args)))
+	}
+
+	// A substring ILIKE can't use a btree index; on large tables add a
+	// trigram index: CREATE INDEX ON loc_records USING gin (fqdn gin_trgm_ops)
+	if filter.Search != "" {
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+		conds = append(conds, fmt.Sprintf(`fqdn ILIKE $%d ESCAPE '\'`, len(args)))
+	}
+
+	switch lo, hi := filter.MinAltitudeM, filter.MaxAltitudeM; {
+	case lo != nil && hi != nil:
+		args = append(args, *lo, *hi)
+		conds = append(conds, fmt.Sprintf("altitude_m BETWEEN $%d AND $%d", len(args)-1, len(args)))
+	case lo != nil:
+		args = append(args, *lo)
+		conds = append(conds, fmt.Sprintf("altitude_m >= $%d", len(args)))
+	case hi != nil:
+		args = append(args, *hi)
+		conds = append(conds, fmt.Sprintf("altitude_m <= $%d", len(args)))
+	}
+
+	if b := filter.BBox; b != nil {
+		args = append(args, b.MinLat, b.MaxLat)
+		conds = append(conds, fmt.Sprintf("latitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+
+		if b.MinLon <= b.MaxLon {
+			args = append(args, b.MinLon, b.MaxLon)
+			conds = append(conds, fmt.Sprintf("longitude BETWEEN $%d AND $%d", len(args)-1, len(args)))
+		} else {
+			// Box crosses the anti-meridian: split into [minLon, 180] and [-180, maxLon]
+			args = append(args, b.MinLon, b.MaxLon)
+			conds = append(conds, fmt.Sprintf("(longitude BETWEEN $%d AND 180 OR longitude BETWEEN -180 AND $%d)", len(args)-1, len(args)))
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListLOCRecords returns paginated LOC records matching the filter.
+func (db *DB) ListLOCRecords(ctx context.Context, limit, offset int, filter LOCRecordFilter) ([]api.PublicLOCRecord, int, error) {
+	where, args := buildRecordWhere(filter, nil)
+
+	// Count total
+	var total int
+	if err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM loc_records`+where, args...).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	// Get records
-	var rows pgx.Rows
-	var err error
-	if domainFilter != "" {
-		rows, err = db.Pool.Query(ctx, `
-			SELECT fqdn, root_domain, raw_record, latitude, longitude,
-			       altitude_m, size_m, horiz_prec_m, vert_prec_m,
-			       first_seen_at, last_seen_at
-			FROM loc_records
-			WHERE root_domain = $1
-			ORDER BY last_seen_at DESC
-			LIMIT $2 OFFSET $3
-		`, domainFilter, limit, offset)
-	} else {
-		rows, err = db.Pool.Query(ctx, `
-			SELECT fqdn, root_domain, raw_record, latitude, longitude,
-			       altitude_m, size_m, horiz_prec_m, vert_prec_m,
-			       first_seen_at, last_seen_at
-			FROM loc_records
-			ORDER BY last_seen_at DESC
-			LIMIT $1 OFFSET $2
-		`, limit, offset)
-	}
+	args = append(args, limit, offset)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT fqdn, root_domain, raw_record, latitude, longitude,
+		       altitude_m, size_m, horiz_prec_m, vert_prec_m,
+		       first_seen_at, last_seen_at
+		FROM loc_records`+where+fmt.Sprintf(`
+		ORDER BY last_seen_at DESC
+		LIMIT $%d OFFSET $%d
+	`, len(args)-1, len(args)), args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -101,6 +293,67 @@ func (db *DB) ListLOCRecords(ctx context.Context, limit, offset int, domainFilte
 	return records, total, rows.Err()
 }
 
+// ListRootDomainSummaries returns one summary per root domain with LOC
+// records, most FQDNs first, and the total number of root domains.
+func (db *DB) ListRootDomainSummaries(ctx context.Context, limit, offset int) ([]api.RootDomainSummary, int, error) {
+	var total int
+	if err := db.Pool.QueryRow(ctx, `SELECT COUNT(DISTINCT root_domain) FROM loc_records`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Positions are averaged as unit vectors so domains spanning the
+	// anti-meridian don't get a centroid on the other side of the world
+	rows, err := db.Pool.Query(ctx, `
+		SELECT root_domain, COUNT(*),
+		       AVG(COS(RADIANS(latitude)) * COS(RADIANS(longitude))),
+		       AVG(COS(RADIANS(latitude)) * SIN(RADIANS(longitude))),
+		       AVG(SIN(RADIANS(latitude))),
+		       MIN(first_seen_at), MAX(last_seen_at)
+		FROM loc_records
+		GROUP BY root_domain
+		ORDER BY COUNT(*) DESC, root_domain
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var summaries []api.RootDomainSummary
+	for rows.Next() {
+		var s api.RootDomainSummary
+		var v unitVector
+		if err := rows.Scan(&s.RootDomain, &s.FQDNCount, &v.X, &v.Y, &v.Z, &s.FirstSeen, &s.LastSeen); err != nil {
+			return nil, 0, err
+		}
+		s.CentroidLat, s.CentroidLon = v.latLon()
+		summaries = append(summaries, s)
+	}
+
+	return summaries, total, rows.Err()
+}
+
+// unitVector is a position on the unit sphere, used to average coordinates.
+type unitVector struct{ X, Y, Z float64 }
+
+// toUnitVector converts decimal degrees to a unit vector.
+func toUnitVector(lat, lon float64) unitVector {
+	latR, lonR := lat*math.Pi/180, lon*math.Pi/180
+	return unitVector{
+		X: math.Cos(latR) * math.Cos(lonR),
+		Y: math.Cos(latR) * math.Sin(lonR),
+		Z: math.Sin(latR),
+	}
+}
+
+// latLon converts a (not necessarily unit) vector back to decimal degrees.
+// The mean of antipodal points is the zero vector, which maps to 0,0.
+func (v unitVector) latLon() (lat, lon float64) {
+	lat = math.Atan2(v.Z, math.Hypot(v.X, v.Y)) * 180 / math.Pi
+	lon = math.Atan2(v.Y, v.X) * 180 / math.Pi
+	return lat, lon
+}
+
 // CountLOCRecords returns total LOC record count.
 func (db *DB) CountLOCRecords(ctx context.Context) (int, error) {
 	var count int
@@ -122,6 +375,49 @@ func (db *DB) CountUniqueLocations(ctx context.Context) (int, error) {
 	return count, err
 }
 
+// GetLOCRecordsVersion returns the record count and latest last_seen_at.
+// Together they change whenever a record is inserted or re-seen, so they
+// can be used to derive a cache validator for the dataset.
+func (db *DB) GetLOCRecordsVersion(ctx context.Context) (int, *time.Time, error) {
+	var count int
+	var lastSeen *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), MAX(last_seen_at) FROM loc_records
+	`).Scan(&count, &lastSeen)
+	return count, lastSeen, err
+}
+
+// StreamLOCRecords calls fn for each record matching filter, oldest first,
+// reading from a cursor so the full set is never held in memory. An error
+// from fn stops the stream and is returned.
+func (db *DB) StreamLOCRecords(ctx context.Context, filter LOCRecordFilter, fn func(api.PublicLOCRecord) error) error {
+	where, args := buildRecordWhere(filter, nil)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT fqdn, root_domain, raw_record, latitude, longitude,
+		       altitude_m, size_m, horiz_prec_m, vert_prec_m,
+		       first_seen_at, last_seen_at
+		FROM loc_records`+where+`
+		ORDER BY first_seen_at, fqdn
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r api.PublicLOCRecord
+		if err := rows.Scan(&r.FQDN, &r.RootDomain, &r.RawRecord, &r.Latitude, &r.Longitude,
+			&r.AltitudeM, &r.SizeM, &r.HorizPrecM, &r.VertPrecM, &r.FirstSeenAt, &r.LastSeenAt); err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
 // GetAllLOCRecordsForGeoJSON returns all LOC records for GeoJSON export.
 // Returns records without pagination for map rendering.
 func (db *DB) GetAllLOCRecordsForGeoJSON(ctx context.Context) ([]api.PublicLOCRecord, error) {
@@ -150,9 +446,13 @@ func (db *DB) GetAllLOCRecordsForGeoJSON(ctx context.Context) ([]api.PublicLOCRe
 	return records, rows.Err()
 }
 
-// GetAggregatedLocationsForGeoJSON returns LOC records aggregated by coordinates.
-// Multiple FQDNs at the same location are combined into a single feature.
-func (db *DB) GetAggregatedLocationsForGeoJSON(ctx context.Context) ([]api.AggregatedLocation, error) {
+// StreamAggregatedLocations calls fn for each group of LOC records sharing the
+// same coordinates, reading rows from the database as it goes rather than
+// loading them all into memory. Multiple FQDNs at the same location are combined
+// into a single entry. If bbox is non-nil, only records inside the box are
+// included. Iteration stops at the first error returned by fn.
+func (db *DB) StreamAggregatedLocations(ctx context.Context, bbox *BoundingBox, fn func(api.AggregatedLocation) error) error {
+	where, args := buildRecordWhere(LOCRecordFilter{BBox: bbox}, nil)
 	rows, err := db.Pool.Query(ctx, `
 		SELECT
 			array_agg(fqdn ORDER BY fqdn) as fqdns,
@@ -164,24 +464,25 @@ func (db *DB) GetAggregatedLocationsForGeoJSON(ctx context.Context) ([]api.Aggre
 			COUNT(*) as count,
 			MIN(first_seen_at) as first_seen_at,
 			MAX(last_seen_at) as last_seen_at
-		FROM loc_records
+		FROM loc_records`+where+`
 		GROUP BY latitude, longitude, altitude_m, raw_record
 		ORDER BY MAX(last_seen_at) DESC
-	`)
+	`, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var locations []api.AggregatedLocation
 	for rows.Next() {
 		var loc api.AggregatedLocation
 		if err := rows.Scan(&loc.FQDNs, &loc.RootDomains, &loc.RawRecord, &loc.Latitude, &loc.Longitude,
 			&loc.AltitudeM, &loc.Count, &loc.FirstSeenAt, &loc.LastSeenAt); err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(loc); err != nil {
+			return err
 		}
-		locations = append(locations, loc)
 	}
 
-	return locations, rows.Err()
+	return rows.Err()
 }
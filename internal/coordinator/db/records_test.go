@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildRecordWhere(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    LOCRecordFilter
+		wantWhere string
+		wantArgs  []any
+	}{
+		{
+			name:      "no filter",
+			filter:    LOCRecordFilter{},
+			wantWhere: "",
+			wantArgs:  nil,
+		},
+		{
+			name:      "domain only",
+			filter:    LOCRecordFilter{RootDomain: "example.com"},
+			wantWhere: " WHERE root_domain = $1",
+			wantArgs:  []any{"example.com"},
+		},
+		{
+			name:      "normal bbox",
+			filter:    LOCRecordFilter{BBox: &BoundingBox{MinLon: 4, MinLat: 52, MaxLon: 5, MaxLat: 53}},
+			wantWhere: " WHERE latitude BETWEEN $1 AND $2 AND longitude BETWEEN $3 AND $4",
+			wantArgs:  []any{52.0, 53.0, 4.0, 5.0},
+		},
+		{
+			name:      "anti-meridian bbox",
+			filter:    LOCRecordFilter{BBox: &BoundingBox{MinLon: 170, MinLat: -20, MaxLon: -170, MaxLat: 20}},
+			wantWhere: " WHERE latitude BETWEEN $1 AND $2 AND (longitude BETWEEN $3 AND 180 OR longitude BETWEEN -180 AND $4)",
+			wantArgs:  []any{-20.0, 20.0, 170.0, -170.0},
+		},
+		{
+			name: "domain and bbox",
+			filter: LOCRecordFilter{
+				RootDomain: "example.com",
+				BBox:       &BoundingBox{MinLon: -1, MinLat: -1, MaxLon: 1, MaxLat: 1},
+			},
+			wantWhere: " WHERE root_domain = $1 AND latitude BETWEEN $2 AND $3 AND longitude BETWEEN $4 AND $5",
+			wantArgs:  []any{"example.com", -1.0, 1.0, -1.0, 1.0},
+		},
+		{
+			name:      "altitude band",
+			filter:    LOCRecordFilter{MinAltitudeM: ptr(-100.0), MaxAltitudeM: ptr(8848.0)},
+			wantWhere: " WHERE altitude_m BETWEEN $1 AND $2",
+			wantArgs:  []any{-100.0, 8848.0},
+		},
+		{
+			name:      "below sea level only",
+			filter:    LOCRecordFilter{MaxAltitudeM: ptr(0.0)},
+			wantWhere: " WHERE altitude_m <= $1",
+			wantArgs:  []any{0.0},
+		},
+		{
+			name:      "high altitude only, with domain",
+			filter:    LOCRecordFilter{RootDomain: "example.com", MinAltitudeM: ptr(3000.0)},
+			wantWhere: " WHERE root_domain = $1 AND altitude_m >= $2",
+			wantArgs:  []any{"example.com", 3000.0},
+		},
+		{
+			name:      "search",
+			filter:    LOCRecordFilter{Search: "Mail"},
+			wantWhere: ` WHERE fqdn ILIKE $1 ESCAPE '\'`,
+			wantArgs:  []any{"%Mail%"},
+		},
+		{
+			name:      "search with LIKE wildcards",
+			filter:    LOCRecordFilter{RootDomain: "example.com", Search: `100%_a\b`},
+			wantWhere: ` WHERE root_domain = $1 AND fqdn ILIKE $2 ESCAPE '\'`,
+			wantArgs:  []any{"example.com", `%100\%\_a\\b%`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWhere, gotArgs := buildRecordWhere(tt.filter, nil)
+			if gotWhere != tt.wantWhere {
+				t.Errorf("where = %q, want %q", gotWhere, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestGetStaleLOCRecords_Validation(t *testing.T) {
+	db := &DB{} // nil pool: invalid arguments return before any query
+
+	if _, err := db.GetStaleLOCRecords(context.Background(), 0, 100); err == nil {
+		t.Error("GetStaleLOCRecords with a zero interval succeeded")
+	}
+	if _, err := db.GetStaleLOCRecords(context.Background(), -time.Hour, 100); err == nil {
+		t.Error("GetStaleLOCRecords with a negative interval succeeded")
+	}
+	fqdns, err := db.GetStaleLOCRecords(context.Background(), time.Hour, 0)
+	if err != nil || fqdns != nil {
+		t.Errorf("GetStaleLOCRecords with no limit = %v, %v; want nothing", fqdns, err)
+	}
+}
+
+func TestPruneMissingLOCRecords_Validation(t *testing.T) {
+	db := &DB{} // nil pool: a non-positive grace period is rejected before any query
+
+	for _, d := range []time.Duration{0, -time.Hour} {
+		if _, err := db.PruneMissingLOCRecords(context.Background(), d); err == nil {
+			t.Errorf("PruneMissingLOCRecords(%s) succeeded; it would delete every missing record", d)
+		}
+	}
+}
+
+func TestMarkLOCRecordsMissing_Empty(t *testing.T) {
+	db := &DB{} // nil pool: nothing to mark means no query
+	if n, err := db.MarkLOCRecordsMissing(context.Background(), nil); n != 0 || err != nil {
+		t.Errorf("MarkLOCRecordsMissing(nil) = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestUnitVectorCentroid(t *testing.T) {
+	// meanCentroid averages positions the way ListRootDomainSummaries' AVG()s do
+	meanCentroid := func(points [][2]float64) (float64, float64) {
+		var sum unitVector
+		for _, p := range points {
+			v := toUnitVector(p[0], p[1])
+			sum.X += v.X
+			sum.Y += v.Y
+			sum.Z += v.Z
+		}
+		n := float64(len(points))
+		return unitVector{sum.X / n, sum.Y / n, sum.Z / n}.latLon()
+	}
+
+	tests := []struct {
+		name    string
+		points  [][2]float64 // lat, lon per FQDN
+		wantLat float64
+		wantLon float64
+		anyLon  bool // Longitude is meaningless at the poles
+	}{
+		{"single FQDN", [][2]float64{{52.37, 4.89}}, 52.37, 4.89, false},
+		{"FQDNs at one site", [][2]float64{{-33.86, 151.21}, {-33.86, 151.21}, {-33.86, 151.21}}, -33.86, 151.21, false},
+		{"symmetric about the equator", [][2]float64{{10, 20}, {-10, 20}}, 0, 20, false},
+		{"across the anti-meridian", [][2]float64{{0, 179}, {0, -179}}, 0, 180, false},
+		{"poles", [][2]float64{{90, 0}, {90, 120}}, 90, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon := meanCentroid(tt.points)
+			if math.Abs(lat-tt.wantLat) > 1e-9 {
+				t.Errorf("lat = %v, want %v", lat, tt.wantLat)
+			}
+			// 180 and -180 are the same meridian
+			if d := math.Mod(math.Abs(lon-tt.wantLon), 360); !tt.anyLon && d > 1e-9 && math.Abs(d-360) > 1e-9 {
+				t.Errorf("lon = %v, want %v", lon, tt.wantLon)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example.com", "example.com"},
+		{"50%", `50\%`},
+		{"_dmarc", `\_dmarc`},
+		{`a\b`, `a\\b`},
+		{`%_\`, `\%\_\\`},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.in); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// StatsSnapshot is a point-in-time capture of public stats.
+type StatsSnapshot struct {
+	CapturedAt      time.Time
+	TotalLOCRecords int
+	DomainsWithLOC  int
+	ActiveScanners  int
+}
+
+// InsertStatsSnapshot captures the current counts into stats_snapshots.
+// Active scanners are counted from sessions with a recent heartbeat.
+func (db *DB) InsertStatsSnapshot(ctx context.Context, heartbeatTimeout time.Duration) (*StatsSnapshot, error) {
+	var s StatsSnapshot
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO stats_snapshots (total_loc_records, domains_with_loc, active_scanners)
+		SELECT
+			(SELECT COUNT(*) FROM loc_records),
+			(SELECT COUNT(DISTINCT root_domain) FROM loc_records),
+			(SELECT COUNT(*) FROM scanner_sessions WHERE last_heartbeat > NOW() - $1::interval)
+		RETURNING captured_at, total_loc_records, domains_with_loc, active_scanners
+	`, heartbeatTimeout.String()).Scan(&s.CapturedAt, &s.TotalLOCRecords, &s.DomainsWithLOC, &s.ActiveScanners)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetStatsSnapshots returns snapshots captured at or after since, oldest first.
+func (db *DB) GetStatsSnapshots(ctx context.Context, since time.Time) ([]StatsSnapshot, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT captured_at, total_loc_records, domains_with_loc, active_scanners
+		FROM stats_snapshots
+		WHERE captured_at >= $1
+		ORDER BY captured_at
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []StatsSnapshot
+	for rows.Next() {
+		var s StatsSnapshot
+		if err := rows.Scan(&s.CapturedAt, &s.TotalLOCRecords, &s.DomainsWithLOC, &s.ActiveScanners); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SubmissionKeyTTL is how long a completed submission's idempotency key is
+// remembered. Scanners retry within seconds, so a day is plenty.
+const SubmissionKeyTTL = 24 * time.Hour
+
+// SubmissionKey identifies a client's result submission so a retry of it can
+// be recognized, along with the response it got.
+type SubmissionKey struct {
+	ClientID string
+	Key      string
+	Accepted int // LOC records accepted, replayed to retries
+}
+
+// GetSubmission looks up a completed submission by its idempotency key,
+// returning the number of LOC records it accepted. found is false if the key
+// hasn't been seen (or has expired).
+func (db *DB) GetSubmission(ctx context.Context, clientID, key string) (accepted int, found bool, err error) {
+	err = db.Pool.QueryRow(ctx, `
+		SELECT accepted FROM submission_keys WHERE client_id = $1 AND key = $2
+	`, clientID, key).Scan(&accepted)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return accepted, true, nil
+}
+
+// DeleteExpiredSubmissionKeys removes idempotency keys older than ttl,
+// returning how many were removed.
+func (db *DB) DeleteExpiredSubmissionKeys(ctx context.Context, ttl time.Duration) (int, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("submission key TTL must be positive, got %s", ttl)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM submission_keys WHERE created_at < NOW() - $1::interval
+	`, ttl.String())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,89 @@
+package feeder
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+)
+
+// maxLockedFileSkips bounds how many files held by other coordinators one
+// Claim passes over before reporting none available.
+const maxLockedFileSkips = 10
+
+// fileLockFunc takes a cross-replica lock on a file. It returns ok false if
+// another coordinator holds the file; otherwise unlock releases the lock.
+type fileLockFunc func(fileID int) (unlock func(), ok bool, err error)
+
+// fileClaims tracks which files this feeder's workers are processing, so
+// concurrent workers never pick the same file. The database's row lock is
+// released as soon as the file is selected, so it can't do this alone.
+type fileClaims struct {
+	// lock, if set, also locks each claimed file against other coordinator
+	// replicas, whose in-process claims this one can't see.
+	lock fileLockFunc
+
+	mu     sync.Mutex
+	active map[int]func() // Claimed file ID to its unlock func (nil without lock)
+}
+
+// Claim selects a file with next, which is given the IDs already claimed
+// to skip, and records it as claimed. Selection is serialized so two
+// workers can't both pick the same file. Files locked by another replica
+// are skipped. Returns nil if next finds none.
+func (c *fileClaims) Claim(next func(skip []int) (*db.DomainFile, error)) (*db.DomainFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	skip := make([]int, 0, len(c.active))
+	for id := range c.active {
+		skip = append(skip, id)
+	}
+	slices.Sort(skip)
+
+	for range maxLockedFileSkips {
+		file, err := next(skip)
+		if err != nil || file == nil {
+			return nil, err
+		}
+
+		var unlock func()
+		if c.lock != nil {
+			var ok bool
+			unlock, ok, err = c.lock(file.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				skip = append(skip, file.ID)
+				continue
+			}
+		}
+
+		if c.active == nil {
+			c.active = make(map[int]func())
+		}
+		c.active[file.ID] = unlock
+		return file, nil
+	}
+	return nil, nil
+}
+
+// Release marks a file as no longer being processed.
+func (c *fileClaims) Release(id int) {
+	c.mu.Lock()
+	unlock := c.active[id]
+	delete(c.active, id)
+	c.mu.Unlock()
+
+	if unlock != nil {
+		unlock()
+	}
+}
+
+// Len returns the number of files being processed.
+func (c *fileClaims) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.active)
+}
@@ -0,0 +1,210 @@
+package feeder
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+)
+
+// fakeFiles mimics GetNextFileToProcess over an in-memory file list: it
+// prefers files already processing, then pending ones, in ID order.
+type fakeFiles struct {
+	mu     sync.Mutex
+	status map[int]string
+}
+
+func (f *fakeFiles) next(skip []int) (*db.DomainFile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := make([]int, 0, len(f.status))
+	for id := range f.status {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, want := range []string{"processing", "pending"} {
+		for _, id := range ids {
+			if f.status[id] == want && !slices.Contains(skip, id) {
+				f.status[id] = "processing"
+				return &db.DomainFile{ID: id, Status: "processing"}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeFiles) processing() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, s := range f.status {
+		if s == "processing" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFileClaims_ConcurrentWorkersProcessDistinctFiles(t *testing.T) {
+	// File 1 was left processing by a previous run; every worker would pick
+	// it first if claims didn't skip files another worker holds
+	files := &fakeFiles{status: map[int]string{1: "processing", 2: "pending", 3: "pending"}}
+	var claims fileClaims
+
+	const workers = 2
+	var (
+		wg      sync.WaitGroup
+		holding sync.WaitGroup
+		mu      sync.Mutex
+		got     []int
+	)
+	holding.Add(workers)
+	for range workers {
+		wg.Go(func() {
+			file, err := claims.Claim(files.next)
+			if err != nil || file == nil {
+				t.Errorf("Claim() = %v, %v", file, err)
+				holding.Done()
+				return
+			}
+			mu.Lock()
+			got = append(got, file.ID)
+			mu.Unlock()
+
+			// Keep processing until every worker has its file
+			holding.Done()
+			holding.Wait()
+			claims.Release(file.ID)
+		})
+	}
+
+	holding.Wait()
+	if n := files.processing(); n != workers {
+		t.Errorf("%d files processing while %d workers hold files, want %d", n, workers, workers)
+	}
+	wg.Wait()
+
+	slices.Sort(got)
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("workers claimed files %v, want [1 2]", got)
+	}
+	if claims.Len() != 0 {
+		t.Errorf("Len() = %d after all releases, want 0", claims.Len())
+	}
+}
+
+func TestFileClaims_SkipsClaimedFiles(t *testing.T) {
+	var claims fileClaims
+	var skipped [][]int
+	next := func(id int) func([]int) (*db.DomainFile, error) {
+		return func(skip []int) (*db.DomainFile, error) {
+			skipped = append(skipped, skip)
+			if id == 0 {
+				return nil, nil
+			}
+			return &db.DomainFile{ID: id}, nil
+		}
+	}
+
+	claims.Claim(next(5))                        //nolint:errcheck // next never fails
+	claims.Claim(next(3))                        //nolint:errcheck // next never fails
+	if f, _ := claims.Claim(next(0)); f != nil { //nolint:errcheck // next never fails
+		t.Errorf("Claim() = %+v when none available, want nil", f)
+	}
+	claims.Release(5)
+	claims.Claim(next(0)) //nolint:errcheck // next never fails
+
+	want := [][]int{{}, {5}, {3, 5}, {3}}
+	if !slices.EqualFunc(skipped, want, slices.Equal) {
+		t.Errorf("skip lists = %v, want %v", skipped, want)
+	}
+	if claims.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", claims.Len())
+	}
+}
+
+// fakeLocks mimics per-file advisory locks shared by several coordinators.
+type fakeLocks struct {
+	mu   sync.Mutex
+	held map[int]bool
+}
+
+func (l *fakeLocks) lock(fileID int) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[fileID] {
+		return nil, false, nil
+	}
+	if l.held == nil {
+		l.held = make(map[int]bool)
+	}
+	l.held[fileID] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, fileID)
+	}, true, nil
+}
+
+func TestFileClaims_ReplicasContendForSameFile(t *testing.T) {
+	// Two coordinators share the files table and the lock table, but not
+	// each other's in-process claims. File 1 is left processing, so both
+	// select it first.
+	files := &fakeFiles{status: map[int]string{1: "processing", 2: "pending"}}
+	locks := &fakeLocks{}
+	a := fileClaims{lock: locks.lock}
+	b := fileClaims{lock: locks.lock}
+
+	fa, err := a.Claim(files.next)
+	if err != nil || fa == nil || fa.ID != 1 {
+		t.Fatalf("replica A Claim() = %+v, %v; want file 1", fa, err)
+	}
+	fb, err := b.Claim(files.next)
+	if err != nil || fb == nil || fb.ID != 2 {
+		t.Fatalf("replica B Claim() = %+v, %v; want file 2, skipping A's locked file", fb, err)
+	}
+
+	// Nothing left for a second worker on B: file 1 is A's, file 2 is B's
+	if f, err := b.Claim(files.next); f != nil || err != nil {
+		t.Errorf("replica B second Claim() = %+v, %v; want none", f, err)
+	}
+
+	// Once A releases file 1, B can take it over
+	a.Release(1)
+	if f, err := b.Claim(files.next); err != nil || f == nil || f.ID != 1 {
+		t.Errorf("replica B Claim() after A released = %+v, %v; want file 1", f, err)
+	}
+}
+
+func TestFileClaims_LockError(t *testing.T) {
+	claims := fileClaims{lock: func(int) (func(), bool, error) {
+		return nil, false, errors.New("connection refused")
+	}}
+	files := &fakeFiles{status: map[int]string{1: "pending"}}
+
+	if f, err := claims.Claim(files.next); err == nil {
+		t.Errorf("Claim() = %+v, nil; want the lock error", f)
+	}
+	if claims.Len() != 0 {
+		t.Errorf("Len() = %d after a failed lock, want 0", claims.Len())
+	}
+}
+
+func TestFileClaims_GivesUpOnManyLockedFiles(t *testing.T) {
+	var calls int
+	claims := fileClaims{lock: func(int) (func(), bool, error) { return nil, false, nil }}
+	next := func(skip []int) (*db.DomainFile, error) {
+		calls++
+		return &db.DomainFile{ID: len(skip) + 1}, nil // An endless supply of locked files
+	}
+
+	if f, err := claims.Claim(next); f != nil || err != nil {
+		t.Errorf("Claim() = %+v, %v; want none", f, err)
+	}
+	if calls != maxLockedFileSkips {
+		t.Errorf("next called %d times, want %d", calls, maxLockedFileSkips)
+	}
+}
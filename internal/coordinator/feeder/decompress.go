@@ -0,0 +1,46 @@
+package feeder
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"github.com/ulikunitz/xz"
+)
+
+// domainFileExts are the extensions of domain files the feeder can read.
+var domainFileExts = []string{".xz", ".gz", ".txt"}
+
+// isDomainFileExt reports whether name has a supported domain file extension.
+func isDomainFileExt(name string) bool {
+	return slices.Contains(domainFileExts, path.Ext(name))
+}
+
+// compressionType names the compression of a domain file for metric labels.
+func compressionType(filename string) string {
+	switch path.Ext(filename) {
+	case ".xz":
+		return "xz"
+	case ".gz":
+		return "gzip"
+	default:
+		return "none"
+	}
+}
+
+// decompress wraps r in the decompressor matching the file's extension:
+// xz for ".xz", gzip for ".gz", and none for plain ".txt".
+func decompress(filename string, r io.Reader) (io.Reader, error) {
+	switch ext := path.Ext(filename); ext {
+	case ".xz":
+		return xz.NewReader(r)
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".txt":
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported domain file extension %q", ext)
+	}
+}
@@ -0,0 +1,159 @@
+package feeder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ulikunitz/xz"
+
+	"github.com/locplace/scanner/internal/coordinator/metrics"
+)
+
+func TestDecompress_Formats(t *testing.T) {
+	const content = "a.example.com\nb.example.com\n\n# comment\nc.example.com"
+	want := []string{"a.example.com", "b.example.com", "", "# comment", "c.example.com"}
+
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		t.Fatalf("xz writer: %v", err)
+	}
+	xw.Write([]byte(content)) //nolint:errcheck // Writes to a buffer
+	if err := xw.Close(); err != nil {
+		t.Fatalf("xz close: %v", err)
+	}
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	gw.Write([]byte(content)) //nolint:errcheck // Writes to a buffer
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	tests := []struct {
+		filename string
+		data     []byte
+	}{
+		{"data/x/domain2multi-x00.txt.xz", xzBuf.Bytes()},
+		{"data/x/domain2multi-x00.txt.gz", gzBuf.Bytes()},
+		{"data/x/domain2multi-x00.txt", []byte(content)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			r, err := decompress(tt.filename, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+			var got []string
+			sc := bufio.NewScanner(r)
+			for sc.Scan() {
+				got = append(got, sc.Text())
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("lines = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDecompress_Errors(t *testing.T) {
+	if _, err := decompress("data/x/file.zip", strings.NewReader("")); err == nil {
+		t.Error("decompress of .zip succeeded, want unsupported extension error")
+	}
+	// Content that doesn't match the extension fails rather than feeding garbage
+	if _, err := decompress("data/x/file.txt.gz", strings.NewReader("plain text")); err == nil {
+		t.Error("decompress of plain text as .gz succeeded")
+	}
+}
+
+func TestIsDomainFileExt(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"data/a/a.txt.xz", true},
+		{"data/a/a.txt.gz", true},
+		{"data/a/a.txt", true},
+		{"data/a/README.md", false},
+		{"data/a/a.txt.zip", false},
+		{"data/a/xz", false},
+	}
+	for _, tt := range tests {
+		if got := isDomainFileExt(tt.name); got != tt.want {
+			t.Errorf("isDomainFileExt(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileMetrics_SimulatedRun(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.FeederFileDuration, metrics.FeederDownloadBytesTotal)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	for i := range 100 {
+		fmt.Fprintf(gw, "domain-%03d.example.com\n", i)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	compressed := gz.Len()
+
+	bytesBefore, countBefore := gatherFeederMetrics(t, reg)
+
+	// Download, decompress and read a file the way processFile does
+	const filename = "data/x/domain2multi-x00.txt.gz"
+	began := time.Now()
+	r, err := decompress(filename, downloadCounter{io.NopCloser(&gz)})
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	observeFileDuration(filename, began)
+
+	bytesAfter, countAfter := gatherFeederMetrics(t, reg)
+	if got := bytesAfter - bytesBefore; got != float64(compressed) {
+		t.Errorf("download bytes grew by %v, want %d", got, compressed)
+	}
+	if got := countAfter - countBefore; got != 1 {
+		t.Errorf("gzip file duration observations grew by %d, want 1", got)
+	}
+}
+
+// gatherFeederMetrics returns the download byte counter and the number of
+// gzip file duration observations.
+func gatherFeederMetrics(t *testing.T, reg *prometheus.Registry) (downloadBytes float64, gzipFiles uint64) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "locplace_feeder_download_bytes_total":
+				downloadBytes = m.GetCounter().GetValue()
+			case "locplace_feeder_file_duration_seconds":
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "compression" && l.GetValue() == "gzip" {
+						gzipFiles = m.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+	}
+	return downloadBytes, gzipFiles
+}
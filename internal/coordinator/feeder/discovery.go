@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/locplace/scanner/internal/coordinator/db"
 )
@@ -42,81 +44,197 @@ type GitHubTreeObj struct {
 type DiscoveredFile struct {
 	Filename  string
 	URL       string
+	SHA       string
 	SizeBytes int64
 }
 
-// DiscoverFiles fetches the repository tree and returns all .xz domain files.
-func DiscoverFiles(ctx context.Context) ([]DiscoveredFile, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, GitHubTreeURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+// RateLimitError is returned when a GitHub API request fails because the
+// rate limit is exhausted.
+type RateLimitError struct {
+	Reset time.Time // When the limit resets (zero if GitHub didn't say)
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return "github api: rate limit exceeded"
+	}
+	return "github api: rate limit exceeded until " + e.Reset.UTC().Format(time.RFC3339)
+}
+
+// rateLimitError returns a *RateLimitError if a failed response reports an
+// exhausted rate limit, or nil otherwise.
+func rateLimitError(resp *http.Response) error {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return nil
+	}
+	e := &RateLimitError{}
+	if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		e.Reset = time.Unix(secs, 0)
 	}
+	return e
+}
+
+// DiscoverFiles fetches the repository tree and returns all .xz, .gz and .txt domain files.
+// token is an optional GitHub PAT; without one, GitHub allows only 60 API
+// requests per hour.
+func DiscoverFiles(ctx context.Context, token string) ([]DiscoveredFile, error) {
+	c := &treeClient{token: token, retry: DefaultRetryConfig()}
+	return c.discover(ctx, GitHubTreeURL)
+}
 
-	// GitHub API prefers Accept header
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "locplace-scanner/1.0")
+// treeClient fetches repository trees from the GitHub API.
+type treeClient struct {
+	token string
+	retry RetryConfig
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// discover fetches the recursive tree at treeURL, retrying transient
+// failures. GitHub truncates large recursive trees, in which case the
+// directories are walked individually instead.
+func (c *treeClient) discover(ctx context.Context, treeURL string) ([]DiscoveredFile, error) {
+	tree, err := c.fetchTree(ctx, treeURL)
 	if err != nil {
-		return nil, fmt.Errorf("fetch tree: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("github api: status %d", resp.StatusCode)
+	if !tree.Truncated {
+		return domainFiles(tree.Tree, ""), nil
 	}
 
-	var tree GitHubTree
-	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	slog.Info("Discovery: GitHub tree response was truncated, walking directories")
+	return c.walkTreeLevel(ctx, tree.URL, "")
+}
+
+// walkTree lists domain files in the tree at url, whose paths are relative to
+// prefix. It asks for the whole subtree in one request and only descends a
+// level at a time if GitHub truncates it.
+func (c *treeClient) walkTree(ctx context.Context, url, prefix string) ([]DiscoveredFile, error) {
+	tree, err := c.fetchTree(ctx, url+"?recursive=1")
+	if err != nil {
+		return nil, err
+	}
+	if !tree.Truncated {
+		return domainFiles(tree.Tree, prefix), nil
 	}
+	return c.walkTreeLevel(ctx, url, prefix)
+}
 
+// walkTreeLevel lists the tree at url non-recursively, then walks each
+// subdirectory that may hold domain files.
+func (c *treeClient) walkTreeLevel(ctx context.Context, url, prefix string) ([]DiscoveredFile, error) {
+	tree, err := c.fetchTree(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 	if tree.Truncated {
-		log.Println("Warning: GitHub tree response was truncated, some files may be missing")
+		// A single directory with more entries than GitHub will list
+		slog.Warn("Discovery: directory listing was truncated, some files may be missing", "dir", prefix)
 	}
 
-	// Filter for .xz files in the data directory
-	var files []DiscoveredFile
+	files := domainFiles(tree.Tree, prefix)
 	for _, obj := range tree.Tree {
+		dir := prefix + obj.Path
+		if obj.Type != "tree" || (dir != "data" && !strings.HasPrefix(dir, "data/")) {
+			continue
+		}
+		sub, err := c.walkTree(ctx, obj.URL, dir+"/")
+		if err != nil {
+			return nil, fmt.Errorf("walk %s: %w", dir, err)
+		}
+		files = append(files, sub...)
+	}
+	return files, nil
+}
+
+// domainFiles picks the domain files out of tree entries whose paths are
+// relative to prefix.
+func domainFiles(objs []GitHubTreeObj, prefix string) []DiscoveredFile {
+	var files []DiscoveredFile
+	for _, obj := range objs {
 		if obj.Type != "blob" {
 			continue
 		}
+		path := prefix + obj.Path
 
-		// We want files like "data/a.txt.xz", "data/b.txt.xz", etc.
-		if !strings.HasPrefix(obj.Path, "data/") {
+		// We want files like "data/a.txt.xz", "data/b.txt.gz", "data/c.txt", etc.
+		if !strings.HasPrefix(path, "data/") {
 			continue
 		}
-		if !strings.HasSuffix(obj.Path, ".txt.xz") {
+		if !isDomainFileExt(path) {
 			continue
 		}
 
 		files = append(files, DiscoveredFile{
-			Filename:  obj.Path,
-			URL:       RawFileBaseURL + obj.Path,
+			Filename:  path,
+			URL:       RawFileBaseURL + path,
+			SHA:       obj.SHA,
 			SizeBytes: obj.Size,
 		})
 	}
+	return files
+}
 
-	return files, nil
+// fetchTree fetches and decodes one GitHub tree API response.
+func (c *treeClient) fetchTree(ctx context.Context, treeURL string) (*GitHubTree, error) {
+	resp, err := doWithRetry(ctx, http.DefaultClient, c.retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, treeURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		// GitHub API prefers Accept header
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		req.Header.Set("User-Agent", "locplace-scanner/1.0")
+		if c.token != "" {
+			req.Header.Set("Authorization", "token "+c.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetch tree: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusOK {
+		if err := rateLimitError(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("github api: status %d", resp.StatusCode)
+	}
+
+	var tree GitHubTree
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &tree, nil
 }
 
 // DiscoverAndInsertFiles discovers files from GitHub and inserts them into the database.
-// Returns the number of new files discovered.
-func DiscoverAndInsertFiles(ctx context.Context, database *db.DB) (int, error) {
-	files, err := DiscoverFiles(ctx)
+// Files whose upstream SHA changed are reset so their new content gets scanned.
+// token is an optional GitHub PAT for the tree API requests.
+// Returns the number of files upserted.
+func DiscoverAndInsertFiles(ctx context.Context, database *db.DB, token string) (int, error) {
+	files, err := DiscoverFiles(ctx, token)
 	if err != nil {
 		return 0, err
 	}
 
-	count := 0
+	var count, added, changed int
 	for _, f := range files {
-		if err := database.UpsertDomainFile(ctx, f.Filename, f.URL, f.SizeBytes); err != nil {
-			log.Printf("Error upserting file %s: %v", f.Filename, err)
+		inserted, reset, err := database.UpsertDomainFile(ctx, f.Filename, f.URL, f.SHA, f.SizeBytes)
+		if err != nil {
+			slog.Error("Discovery: error upserting file", "file", f.Filename, "error", err)
 			continue
 		}
 		count++
+		if inserted {
+			added++
+		}
+		if reset {
+			changed++
+			slog.Info("Discovery: file changed upstream, re-queued", "file", f.Filename)
+		}
 	}
 
-	log.Printf("Discovery complete: %d files in database", count)
+	slog.Info("Discovery complete", "files", count, "new", added, "changed", changed)
 	return count, nil
 }
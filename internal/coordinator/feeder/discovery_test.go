@@ -0,0 +1,204 @@
+package feeder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// mockTreeServer serves GitHub tree API responses keyed by request URI.
+// Tree URLs are given as paths and served prefixed with the server address.
+// Requests for unknown URIs fail the test.
+func mockTreeServer(t *testing.T, trees map[string]GitHubTree) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tree, ok := trees[r.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected request for %s", r.URL.RequestURI())
+			http.NotFound(w, r)
+			return
+		}
+		if tree.URL != "" {
+			tree.URL = srv.URL + tree.URL
+		}
+		objs := slices.Clone(tree.Tree)
+		for i := range objs {
+			if objs[i].URL != "" {
+				objs[i].URL = srv.URL + objs[i].URL
+			}
+		}
+		tree.Tree = objs
+		json.NewEncoder(w).Encode(tree) //nolint:errcheck // Test server
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func filenames(files []DiscoveredFile) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Filename
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestDiscoverFiles_NotTruncated(t *testing.T) {
+	srv := mockTreeServer(t, map[string]GitHubTree{
+		"/trees/master?recursive=1": {Tree: []GitHubTreeObj{
+			{Path: "README.md", Type: "blob"},
+			{Path: "data", Type: "tree"},
+			{Path: "data/a/x.txt.xz", Type: "blob", SHA: "s1", Size: 10},
+			{Path: "data/a/x.json", Type: "blob"},
+		}},
+	})
+
+	files, err := (&treeClient{retry: fastRetry(0)}).discover(context.Background(), srv.URL+"/trees/master?recursive=1")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("files = %+v, want one", files)
+	}
+	want := DiscoveredFile{Filename: "data/a/x.txt.xz", URL: RawFileBaseURL + "data/a/x.txt.xz", SHA: "s1", SizeBytes: 10}
+	if files[0] != want {
+		t.Errorf("file = %+v, want %+v", files[0], want)
+	}
+}
+
+func TestDiscoverFiles_WalksTruncatedTree(t *testing.T) {
+	srv := mockTreeServer(t, map[string]GitHubTree{
+		// The recursive root listing is truncated partway through
+		"/trees/master?recursive=1": {URL: "/trees/root", Truncated: true, Tree: []GitHubTreeObj{
+			{Path: "data", Type: "tree", URL: "/trees/data"},
+			{Path: "data/a/x.txt.xz", Type: "blob", SHA: "x"},
+		}},
+		"/trees/root": {URL: "/trees/root", Tree: []GitHubTreeObj{
+			{Path: "README.md", Type: "blob"},
+			{Path: "docs", Type: "tree", URL: "/trees/docs"}, // Must not be walked
+			{Path: "data", Type: "tree", URL: "/trees/data"},
+		}},
+		// data is still too big to list recursively, so it's walked a level at a time
+		"/trees/data?recursive=1": {URL: "/trees/data", Truncated: true},
+		"/trees/data": {URL: "/trees/data", Tree: []GitHubTreeObj{
+			{Path: "top.txt.xz", Type: "blob", SHA: "top"},
+			{Path: "a", Type: "tree", URL: "/trees/a"},
+			{Path: "b", Type: "tree", URL: "/trees/b"},
+		}},
+		"/trees/a?recursive=1": {URL: "/trees/a", Tree: []GitHubTreeObj{
+			{Path: "x.txt.xz", Type: "blob", SHA: "x"},
+			{Path: "sub", Type: "tree"},
+			{Path: "sub/y.txt.xz", Type: "blob", SHA: "y"},
+		}},
+		"/trees/b?recursive=1": {URL: "/trees/b", Tree: []GitHubTreeObj{
+			{Path: "z.txt.xz", Type: "blob", SHA: "z"},
+			{Path: "notes.md", Type: "blob"},
+		}},
+	})
+
+	files, err := (&treeClient{retry: fastRetry(0)}).discover(context.Background(), srv.URL+"/trees/master?recursive=1")
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+
+	want := []string{"data/a/sub/y.txt.xz", "data/a/x.txt.xz", "data/b/z.txt.xz", "data/top.txt.xz"}
+	if got := filenames(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	for _, f := range files {
+		if f.URL != RawFileBaseURL+f.Filename {
+			t.Errorf("%s: URL = %q, want %q", f.Filename, f.URL, RawFileBaseURL+f.Filename)
+		}
+	}
+}
+
+func TestDiscoverFiles_WalkError(t *testing.T) {
+	// A subtree that 404s must fail discovery rather than silently dropping files
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		switch r.URL.RequestURI() {
+		case "/trees/master?recursive=1":
+			json.NewEncoder(w).Encode(GitHubTree{URL: base + "/trees/root", Truncated: true}) //nolint:errcheck // Test server
+		case "/trees/root":
+			json.NewEncoder(w).Encode(GitHubTree{Tree: []GitHubTreeObj{ //nolint:errcheck // Test server
+				{Path: "data", Type: "tree", URL: base + "/trees/missing"},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := (&treeClient{retry: fastRetry(0)}).discover(context.Background(), srv.URL+"/trees/master?recursive=1"); err == nil {
+		t.Error("discover succeeded despite a failed subtree fetch")
+	}
+}
+
+func TestTreeClient_Authorization(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"with token", "ghp_secret", "token ghp_secret"},
+		{"without token", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Authorization")
+				json.NewEncoder(w).Encode(GitHubTree{}) //nolint:errcheck // Test server
+			}))
+			defer srv.Close()
+
+			c := &treeClient{token: tt.token, retry: fastRetry(0)}
+			if _, err := c.discover(context.Background(), srv.URL); err != nil {
+				t.Fatalf("discover: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTreeClient_RateLimited(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := (&treeClient{retry: fastRetry(0)}).discover(context.Background(), srv.URL)
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("discover error = %v, want *RateLimitError", err)
+	}
+	if !rateErr.Reset.Equal(reset) {
+		t.Errorf("Reset = %s, want %s", rateErr.Reset, reset)
+	}
+}
+
+func TestTreeClient_ForbiddenWithoutRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := (&treeClient{retry: fastRetry(0)}).discover(context.Background(), srv.URL)
+	var rateErr *RateLimitError
+	if err == nil || errors.As(err, &rateErr) {
+		t.Errorf("discover error = %v, want a plain status error", err)
+	}
+}
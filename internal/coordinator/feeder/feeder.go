@@ -8,13 +8,15 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ulikunitz/xz"
-
 	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/metrics"
 )
 
 // Config holds feeder configuration.
@@ -33,14 +35,82 @@ type Config struct {
 	// Using a token allows downloads to count against your account's LFS quota
 	// instead of the repository owner's quota (which may be exceeded).
 	GitHubToken string
+
+	// RediscoverIdleTime is how long the feeder must find no processable files
+	// before it re-runs file discovery to pick up upstream changes.
+	// Zero disables automatic re-discovery.
+	RediscoverIdleTime time.Duration
+
+	// RediscoverMinInterval bounds how often automatic re-discovery can run.
+	RediscoverMinInterval time.Duration
+
+	// ShuffleWindow is the number of upcoming lines to draw from at random when
+	// building batches, so each batch spans many zones rather than a run of
+	// alphabetically-adjacent domains. Zero keeps file order.
+	// A resumed file may re-emit up to this many lines.
+	ShuffleWindow int
+
+	// FileIncludeGlobs limits processing to files whose names match at least
+	// one glob (e.g. "data/france/*"); empty means all files.
+	FileIncludeGlobs []string
+
+	// FileExcludeGlobs skips files whose names match any glob.
+	FileExcludeGlobs []string
+
+	// FeederConcurrency is the number of files processed in parallel, so one
+	// slow download doesn't stall batch production. Values below 1 mean 1.
+	FeederConcurrency int
+
+	// HTTPMaxRetries is how many times a failed file download is retried
+	// (with exponential backoff) before the file is left for the next pass.
+	HTTPMaxRetries int
+}
+
+// shouldRediscover reports whether automatic re-discovery is due.
+// idleSince is when the feeder last ran out of files; lastDiscovery is when
+// re-discovery last ran (zero if never).
+func (c Config) shouldRediscover(now, idleSince, lastDiscovery time.Time) bool {
+	if c.RediscoverIdleTime <= 0 || idleSince.IsZero() {
+		return false
+	}
+	if now.Sub(idleSince) < c.RediscoverIdleTime {
+		return false
+	}
+	return lastDiscovery.IsZero() || now.Sub(lastDiscovery) >= c.RediscoverMinInterval
+}
+
+// shrunkLineRatio is the fraction of the previous run's line count below which
+// a file is considered to have shrunk suspiciously.
+const shrunkLineRatio = 0.9
+
+// emptyFileMinSize is the compressed size above which a file that feeds no
+// domains at all is treated as a broken download rather than an empty file.
+const emptyFileMinSize = 4096
+
+// suspiciouslyEmpty reports whether a file of sizeBytes that has fed
+// linesFed domains in total looks like a download or decompression failure.
+func suspiciouslyEmpty(sizeBytes *int64, linesFed int64) bool {
+	return linesFed == 0 && sizeBytes != nil && *sizeBytes >= emptyFileMinSize
+}
+
+// lineCountShrunk reports whether a file read now has far fewer lines than on
+// its previous completed run. prior is nil if the file has never completed.
+func lineCountShrunk(prior *int64, current int64) bool {
+	if prior == nil || *prior <= 0 {
+		return false
+	}
+	return float64(current) < float64(*prior)*shrunkLineRatio
 }
 
 // DefaultConfig returns sensible default configuration.
 func DefaultConfig() Config {
 	return Config{
-		BatchSize:         1000,
-		MaxPendingBatches: 20,
-		PollInterval:      5 * time.Second,
+		BatchSize:             1000,
+		MaxPendingBatches:     20,
+		PollInterval:          5 * time.Second,
+		RediscoverMinInterval: 6 * time.Hour,
+		HTTPMaxRetries:        DefaultRetryConfig().MaxRetries,
+		FeederConcurrency:     1,
 	}
 }
 
@@ -49,6 +119,41 @@ type Feeder struct {
 	DB        *db.DB
 	Config    Config
 	LFSClient *LFSClient
+
+	// Capacity wakes workers waiting for queue room; PollInterval remains
+	// the fallback if a notification is missed.
+	Capacity *CapacitySignal
+
+	running  atomic.Bool
+	paused   atomic.Bool
+	claims   fileClaims
+	insertMu sync.Mutex // Serializes the pending-capacity check with the insert
+}
+
+// Running reports whether Run is active.
+func (f *Feeder) Running() bool {
+	return f.running.Load()
+}
+
+// Pause stops the feeder creating new batches until Resume. Batches already
+// queued or in flight are unaffected and still complete.
+func (f *Feeder) Pause() {
+	if !f.paused.Swap(true) {
+		slog.Info("Feeder paused")
+	}
+}
+
+// Resume lets a paused feeder create batches again.
+func (f *Feeder) Resume() {
+	if f.paused.Swap(false) {
+		slog.Info("Feeder resumed")
+		f.Capacity.Notify() // Wake workers held by the pause
+	}
+}
+
+// Paused reports whether the feeder is paused.
+func (f *Feeder) Paused() bool {
+	return f.paused.Load()
 }
 
 // New creates a new Feeder with the given configuration.
@@ -59,52 +164,132 @@ func New(database *db.DB, cfg Config) *Feeder {
 	} else {
 		lfsClient = NewLFSClient()
 	}
+	lfsClient.Retry.MaxRetries = cfg.HTTPMaxRetries
 
-	return &Feeder{
+	f := &Feeder{
 		DB:        database,
 		Config:    cfg,
 		LFSClient: lfsClient,
+		Capacity:  NewCapacitySignal(),
+	}
+	if database != nil {
+		f.claims.lock = f.lockFile
 	}
+	return f
+}
+
+// fileLockTimeout bounds taking or releasing a file's advisory lock.
+const fileLockTimeout = 10 * time.Second
+
+// lockFile takes a file's advisory lock so other coordinator replicas don't
+// feed it concurrently. The lock pins a database connection while held.
+func (f *Feeder) lockFile(fileID int) (unlock func(), ok bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fileLockTimeout)
+	defer cancel()
+	lock, err := f.DB.TryAdvisoryLock(ctx, db.FileLockKey(fileID))
+	if err != nil {
+		return nil, false, fmt.Errorf("lock file %d: %w", fileID, err)
+	}
+	if lock == nil {
+		slog.Debug("Feeder: file locked by another coordinator, skipping", "file_id", fileID)
+		return nil, false, nil
+	}
+	return func() {
+		// Not the worker's context: the lock must be released even on shutdown
+		ctx, cancel := context.WithTimeout(context.Background(), fileLockTimeout)
+		defer cancel()
+		if err := lock.Unlock(ctx); err != nil {
+			slog.Warn("Feeder: failed to unlock file", "file_id", fileID, "error", err)
+		}
+	}, true, nil
 }
 
 // Run starts the feeder loop. It processes files until all are complete,
-// then waits for new files to be discovered.
+// then waits for new files to be discovered. With FeederConcurrency > 1,
+// that many files are processed in parallel.
 func (f *Feeder) Run(ctx context.Context) {
-	log.Printf("Feeder started: batch_size=%d, max_pending=%d",
-		f.Config.BatchSize, f.Config.MaxPendingBatches)
+	f.running.Store(true)
+	defer f.running.Store(false)
+
+	workers := max(f.Config.FeederConcurrency, 1)
+	slog.Info("Feeder started", "batch_size", f.Config.BatchSize,
+		"max_pending", f.Config.MaxPendingBatches, "shuffle_window", f.Config.ShuffleWindow,
+		"include", f.Config.FileIncludeGlobs, "exclude", f.Config.FileExcludeGlobs, "workers", workers)
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Go(func() { f.runWorker(ctx, i) })
+	}
+	wg.Wait()
+	slog.Info("Feeder stopped")
+}
+
+// runWorker processes one file at a time until ctx is canceled. Worker 0
+// also re-runs discovery once the feeder as a whole has gone idle.
+func (f *Feeder) runWorker(ctx context.Context, id int) {
+	var idleSince, lastDiscovery time.Time
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Feeder stopped")
 			return
 		default:
 		}
 
-		// Get next file to process
-		file, err := f.DB.GetNextFileToProcess(ctx)
+		// Don't claim a new file while paused
+		if err := f.awaitCapacity(ctx, func() (bool, error) { return !f.Paused(), nil }); err != nil {
+			return
+		}
+
+		// Get next file to process, skipping any another worker holds
+		file, err := f.claims.Claim(func(skip []int) (*db.DomainFile, error) {
+			return f.DB.GetNextFileToProcess(ctx, db.FileFilter{
+				Include: f.Config.FileIncludeGlobs,
+				Exclude: f.Config.FileExcludeGlobs,
+				SkipIDs: skip,
+			})
+		})
 		if err != nil {
-			log.Printf("Feeder: error getting next file: %v", err)
-			time.Sleep(f.Config.PollInterval)
+			slog.Error("Feeder: error getting next file", "worker", id, "error", err)
+			sleepCtx(ctx, f.Config.PollInterval)
 			continue
 		}
 
 		if file == nil {
-			// No files to process, wait and check again
-			time.Sleep(f.Config.PollInterval)
+			// No files to process; after a sustained idle period, look for new upstream data
+			now := time.Now()
+			if id != 0 || f.claims.Len() > 0 {
+				idleSince = time.Time{}
+				sleepCtx(ctx, f.Config.PollInterval)
+				continue
+			}
+			if idleSince.IsZero() {
+				idleSince = now
+			}
+			if f.Config.shouldRediscover(now, idleSince, lastDiscovery) {
+				lastDiscovery = now
+				slog.Info("Feeder: idle, re-running file discovery", "idle", now.Sub(idleSince).Round(time.Second).String())
+				if _, err := DiscoverAndInsertFiles(ctx, f.DB, f.Config.GitHubToken); err != nil {
+					slog.Error("Feeder: re-discovery failed", "error", err)
+				}
+				continue
+			}
+			sleepCtx(ctx, f.Config.PollInterval)
 			continue
 		}
+		idleSince = time.Time{}
 
-		log.Printf("Feeder: processing file %s (resuming from line %d)", file.Filename, file.ProcessedLines)
+		slog.Info("Feeder: processing file", "worker", id, "file", file.Filename, "resume_line", file.ProcessedLines)
 
 		err = f.processFile(ctx, file)
+		f.claims.Release(file.ID)
 		if err != nil {
 			if ctx.Err() != nil {
-				return // Context canceled
+				return
 			}
-			log.Printf("Feeder: error processing file %s: %v", file.Filename, err)
+			slog.Error("Feeder: error processing file", "worker", id, "file", file.Filename, "error", err)
 			// File will be retried on next iteration since it's still in 'processing' state
-			time.Sleep(f.Config.PollInterval)
+			sleepCtx(ctx, f.Config.PollInterval)
 		}
 		// processFile marks feeding_complete and checks for file completion,
 		// so we just continue to the next file
@@ -113,34 +298,138 @@ func (f *Feeder) Run(ctx context.Context) {
 
 // processFile downloads and processes a single domain file.
 func (f *Feeder) processFile(ctx context.Context, file *db.DomainFile) error {
-	log.Printf("Feeder: downloading %s via GitHub web interface", file.Filename)
-
-	// Use the web-based download which may bypass LFS quota issues
-	// The file.Filename is like "data/afghanistan/domain2multi-af00.txt.xz"
-	body, err := f.LFSClient.DownloadViaWeb(ctx, "tb0hdan", "domains", "master", file.Filename)
+	began := time.Now()
+	deny, err := f.DB.LoadDenylist(ctx)
 	if err != nil {
-		return fmt.Errorf("web download: %w", err)
+		return fmt.Errorf("load denylist: %w", err)
 	}
-	defer body.Close() //nolint:errcheck // Close error not actionable
-
-	// Create XZ decompressor
-	xzReader, err := xz.NewReader(body)
-	if err != nil {
-		return fmt.Errorf("xz reader: %w", err)
-	}
-
-	// Process lines
-	scanner := bufio.NewScanner(xzReader)
-	// Increase buffer size for potentially long lines
-	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 
 	var (
 		lineNum    int64
+		consumed   int64 // Decompressed bytes read through line lineNum
 		batch      []string
 		batchStart int64
+		batchEnd   int64
 		batchCount int
 		skipToLine = file.ProcessedLines
+		skipped    int64
+		denied     int
+		invalid    int   // Lines that aren't hostnames
+		fed        int64 // Domains added to batches this run
+		shuf       *shuffler
+		content    io.Reader
+		verifier   *verifyingReader
 	)
+	if f.Config.ShuffleWindow > 0 {
+		shuf = newShuffler(f.Config.ShuffleWindow)
+	}
+
+	// Without shuffling, the saved byte offset marks the end of line
+	// processed_lines, so we can range-download from the xz block holding it
+	if shuf == nil && path.Ext(file.Filename) == ".xz" && file.ProcessedBytes != nil && *file.ProcessedBytes > 0 && skipToLine > 0 {
+		fetch := func(ctx context.Context, start, end int64) (io.ReadCloser, int64, error) {
+			body, total, err := f.LFSClient.DownloadRangeViaWeb(ctx, "tb0hdan", "domains", "master", file.Filename, start, end)
+			if err != nil {
+				return nil, 0, err
+			}
+			return downloadCounter{body}, total, nil
+		}
+		r, body, rangeErr := openXZAt(ctx, fetch, *file.ProcessedBytes)
+		if rangeErr != nil {
+			slog.Warn("Feeder: range resume failed, downloading whole file",
+				"file", file.Filename, "offset", *file.ProcessedBytes, "error", rangeErr)
+		} else {
+			defer body.Close() //nolint:errcheck // Close error not actionable
+			slog.Info("Feeder: resuming from byte offset", "file", file.Filename,
+				"line", skipToLine, "offset", *file.ProcessedBytes)
+			metrics.FeederResumesTotal.Inc()
+			content = r
+			lineNum, consumed, skipToLine = skipToLine, *file.ProcessedBytes, 0
+		}
+	}
+
+	if content == nil {
+		// The raw URL serves the LFS pointer, whose OID lets us verify the download
+		pointer, err := f.LFSClient.FetchPointer(ctx, file.URL)
+		if err != nil {
+			slog.Warn("Feeder: could not fetch LFS pointer, download will not be verified",
+				"file", file.Filename, "error", err)
+		}
+
+		slog.Info("Feeder: downloading file via GitHub web interface", "file", file.Filename)
+
+		// Use the web-based download which may bypass LFS quota issues
+		// The file.Filename is like "data/afghanistan/domain2multi-af00.txt.xz"
+		body, err := f.download(ctx, file.Filename)
+		if err != nil {
+			return fmt.Errorf("web download: %w", err)
+		}
+		defer body.Close() //nolint:errcheck // Close error not actionable
+
+		var raw io.Reader = downloadCounter{body}
+		if pointer != nil {
+			verifier = newVerifyingReader(raw, pointer)
+			raw = verifier
+		}
+
+		// Pick the decompressor from the extension (.xz, .gz or plain .txt)
+		content, err = decompress(file.Filename, raw)
+		if err != nil {
+			return fmt.Errorf("decompress: %w", err)
+		}
+	}
+
+	// Process lines
+	scanner := bufio.NewScanner(content)
+	// Increase buffer size for potentially long lines
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	// Count consumed bytes, including line terminators, for the resume offset
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		consumed += int64(advance)
+		return advance, token, err
+	})
+
+	// addDomain appends a domain to the current batch, inserting the batch once full.
+	addDomain := func(line int64, domain string) error {
+		if len(batch) == 0 {
+			batchStart, batchEnd = line, line
+		}
+		batchStart = min(batchStart, line)
+		batchEnd = max(batchEnd, line)
+		batch = append(batch, domain)
+		fed++
+
+		if len(batch) < f.Config.BatchSize {
+			return nil
+		}
+
+		// Lines still held by the shuffler have not been emitted, so resume before
+		// them; the byte offset is only meaningful without shuffling
+		processed, processedBytes := lineNum, &consumed
+		if shuf != nil {
+			processedBytes = nil
+			if shuf.Len() > 0 {
+				processed = shuf.MinLine() - 1
+			}
+		}
+		if insertErr := f.insertBatch(ctx, file.ID, batchStart, batchEnd, processed, processedBytes, batch); insertErr != nil {
+			return fmt.Errorf("insert batch: %w", insertErr)
+		}
+		batchCount++
+		batch = batch[:0]
+
+		// Log progress periodically
+		if batchCount%100 == 0 {
+			slog.Info("Feeder: progress", "file", file.Filename, "batches", batchCount, "line", lineNum)
+		}
+		return nil
+	}
+
+	if skipToLine > 0 {
+		slog.Info("Feeder: resuming, skipping already-processed lines", "file", file.Filename, "skip_lines", skipToLine)
+		metrics.FeederResumesTotal.Inc()
+	}
 
 	for scanner.Scan() {
 		select {
@@ -153,6 +442,7 @@ func (f *Feeder) processFile(ctx context.Context, file *db.DomainFile) error {
 
 		// Skip already processed lines (for resume)
 		if lineNum <= skipToLine {
+			skipped++
 			continue
 		}
 
@@ -160,26 +450,29 @@ func (f *Feeder) processFile(ctx context.Context, file *db.DomainFile) error {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-
-		// Start a new batch if needed
-		if len(batch) == 0 {
-			batchStart = lineNum
+		line, ok := normalizeFQDN(line)
+		if !ok {
+			invalid++
+			continue
+		}
+		if deny.Denied(line) {
+			denied++
+			continue
 		}
 
-		batch = append(batch, line)
-
-		// Batch is full, insert it
-		if len(batch) >= f.Config.BatchSize {
-			if insertErr := f.insertBatch(ctx, file.ID, batchStart, lineNum, batch); insertErr != nil {
-				return fmt.Errorf("insert batch: %w", insertErr)
+		if shuf != nil {
+			e, ok := shuf.Add(lineNum, line)
+			if !ok {
+				continue
 			}
-			batchCount++
-			batch = batch[:0]
-
-			// Log progress periodically
-			if batchCount%100 == 0 {
-				log.Printf("Feeder: %s progress: %d batches created, line %d", file.Filename, batchCount, lineNum)
+			if err := addDomain(e.line, e.domain); err != nil {
+				return err
 			}
+			continue
+		}
+
+		if err := addDomain(lineNum, line); err != nil {
+			return err
 		}
 	}
 
@@ -187,72 +480,164 @@ func (f *Feeder) processFile(ctx context.Context, file *db.DomainFile) error {
 		return fmt.Errorf("scan: %w", scanErr)
 	}
 
+	// Check the download before marking the file fed, so a truncated or
+	// corrupted copy leaves it in processing to be retried
+	if verifier != nil {
+		if verifyErr := verifier.Verify(); verifyErr != nil {
+			metrics.FeederIntegrityFailuresTotal.Inc()
+			return fmt.Errorf("verify download: %w", verifyErr)
+		}
+	}
+
+	if skipToLine > 0 {
+		metrics.FeederResumeLinesSkippedTotal.Add(float64(skipped))
+		if skipped < skipToLine {
+			// The file is shorter than our saved offset, so its content has changed
+			// since we started. Batches created before the resume may not match it.
+			slog.Warn("Feeder: file ended before resume offset; content may have changed",
+				"file", file.Filename, "lines", lineNum, "resume_offset", skipToLine)
+			metrics.FeederLineCountMismatchesTotal.WithLabelValues("short_resume").Inc()
+		}
+	}
+	if lineCountShrunk(file.TotalLines, lineNum) {
+		slog.Warn("Feeder: file has far fewer lines than on the previous run; download may be truncated",
+			"file", file.Filename, "lines", lineNum, "previous_lines", *file.TotalLines)
+		metrics.FeederLineCountMismatchesTotal.WithLabelValues("shrunk").Inc()
+	}
+
+	if shuf != nil {
+		for e, ok := shuf.Pop(); ok; e, ok = shuf.Pop() {
+			if err := addDomain(e.line, e.domain); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Insert final partial batch
 	if len(batch) > 0 {
-		if insertErr := f.insertBatch(ctx, file.ID, batchStart, lineNum, batch); insertErr != nil {
+		if insertErr := f.insertBatch(ctx, file.ID, batchStart, batchEnd, lineNum, &consumed, batch); insertErr != nil {
 			return fmt.Errorf("insert final batch: %w", insertErr)
 		}
 		batchCount++
 	}
 
-	log.Printf("Feeder: %s feeding done: %d batches created", file.Filename, batchCount)
+	if denied > 0 {
+		metrics.DenylistRejectionsTotal.WithLabelValues("feeder").Add(float64(denied))
+	}
+	if invalid > 0 {
+		metrics.FeederInvalidLinesTotal.Add(float64(invalid))
+	}
+	linesFed := file.LinesFed + fed
+	slog.Info("Feeder: feeding done", "file", file.Filename, "batches", batchCount, "lines_fed", linesFed, "denied", denied, "invalid", invalid)
+
+	// Denylisted lines are a legitimate reason for a file to feed nothing
+	if denied == 0 && suspiciouslyEmpty(file.SizeBytes, linesFed) {
+		slog.Warn("Feeder: file fed no domains despite its size; download or decompression may have failed",
+			"file", file.Filename, "size_bytes", *file.SizeBytes, "lines", lineNum)
+		metrics.FeederLineCountMismatchesTotal.WithLabelValues("empty").Inc()
+	}
 
 	// Mark feeding complete now that we've read all lines
-	if markErr := f.DB.MarkFeedingComplete(ctx, file.ID); markErr != nil {
+	if markErr := f.DB.MarkFeedingComplete(ctx, file.ID, lineNum); markErr != nil {
 		return fmt.Errorf("mark feeding complete: %w", markErr)
 	}
+	observeFileDuration(file.Filename, began)
 
 	// Try to mark file complete if all batches are already done
 	completed, err := f.DB.CheckAndMarkFileComplete(ctx, file.ID)
 	if err != nil {
-		log.Printf("Feeder: error checking file completion %s: %v", file.Filename, err)
+		slog.Error("Feeder: error checking file completion", "file", file.Filename, "error", err)
 	}
 	if completed {
-		log.Printf("Feeder: %s complete (all batches done)", file.Filename)
+		slog.Info("Feeder: file complete (all batches done)", "file", file.Filename)
 	} else if batchCount > 0 {
-		log.Printf("Feeder: %s has %d batches pending, moving to next file", file.Filename, batchCount)
+		slog.Info("Feeder: batches pending, moving to next file", "file", file.Filename, "batches", batchCount)
 	}
 
 	return nil
 }
 
+// download fetches a whole domain file, counting failures by reason.
+func (f *Feeder) download(ctx context.Context, filename string) (io.ReadCloser, error) {
+	body, err := f.LFSClient.DownloadViaWeb(ctx, "tb0hdan", "domains", "master", filename)
+	if err != nil {
+		if reason := downloadErrorReason(err); reason != "" {
+			metrics.FeederDownloadErrorsTotal.WithLabelValues(reason).Inc()
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
 // insertBatch waits for queue capacity and inserts a batch.
-func (f *Feeder) insertBatch(ctx context.Context, fileID int, lineStart, lineEnd int64, domains []string) error {
-	// Wait for queue capacity
+// Workers check capacity and insert under insertMu so that together they
+// never exceed MaxPendingBatches.
+func (f *Feeder) insertBatch(ctx context.Context, fileID int, lineStart, lineEnd, processedLines int64, processedBytes *int64, domains []string) error {
+	domainsStr := strings.Join(domains, "\n")
+	return f.awaitCapacity(ctx, func() (bool, error) {
+		return f.tryInsertBatch(ctx, fileID, lineStart, lineEnd, processedLines, processedBytes, domainsStr)
+	})
+}
+
+// awaitCapacity calls try until it reports done or fails. While the queue is
+// full, it waits between attempts until Capacity fires or PollInterval passes.
+func (f *Feeder) awaitCapacity(ctx context.Context, try func() (done bool, err error)) error {
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Subscribe before trying so a notification during the attempt isn't lost
+		wake := f.Capacity.Wait()
+		done, err := try()
+		if err != nil || done {
+			return err
+		}
+
+		// Queue is full, wait
+		t := time.NewTimer(f.Config.PollInterval)
 		select {
 		case <-ctx.Done():
+			t.Stop()
 			return ctx.Err()
-		default:
+		case <-wake:
+		case <-t.C:
 		}
+		t.Stop()
+	}
+}
 
-		pending, err := f.DB.GetPendingBatchCount(ctx)
-		if err != nil {
-			return fmt.Errorf("get pending count: %w", err)
-		}
+// tryInsertBatch inserts a batch if the queue has capacity and the feeder
+// isn't paused, reporting whether it did.
+func (f *Feeder) tryInsertBatch(ctx context.Context, fileID int, lineStart, lineEnd, processedLines int64, processedBytes *int64, domains string) (bool, error) {
+	if f.Paused() {
+		return false, nil
+	}
 
-		if pending < f.Config.MaxPendingBatches {
-			break
-		}
+	f.insertMu.Lock()
+	defer f.insertMu.Unlock()
 
-		// Queue is full, wait
-		time.Sleep(f.Config.PollInterval)
+	pending, err := f.DB.GetPendingBatchCount(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get pending count: %w", err)
+	}
+	if pending >= f.Config.MaxPendingBatches {
+		return false, nil
 	}
 
 	// Insert batch
-	domainsStr := strings.Join(domains, "\n")
-	return f.DB.CreateBatchAndUpdateProgress(ctx, fileID, lineStart, lineEnd, domainsStr)
+	return true, f.DB.CreateBatchAndUpdateProgress(ctx, fileID, lineStart, lineEnd, processedLines, processedBytes, domains)
 }
 
 // ProcessFileByID processes a specific file by ID (for manual triggering).
 func (f *Feeder) ProcessFileByID(ctx context.Context, fileID int) error {
 	var file db.DomainFile
 	err := f.DB.Pool.QueryRow(ctx, `
-		SELECT id, filename, url, size_bytes, processed_lines, batches_created, batches_completed, feeding_complete, status, started_at, completed_at
+		SELECT id, filename, url, size_bytes, processed_lines, processed_bytes, lines_fed, batches_created, batches_completed, feeding_complete, total_lines, status, started_at, completed_at
 		FROM domain_files
 		WHERE id = $1
-	`, fileID).Scan(&file.ID, &file.Filename, &file.URL, &file.SizeBytes, &file.ProcessedLines,
-		&file.BatchesCreated, &file.BatchesCompleted, &file.FeedingComplete, &file.Status, &file.StartedAt, &file.CompletedAt)
+	`, fileID).Scan(&file.ID, &file.Filename, &file.URL, &file.SizeBytes, &file.ProcessedLines, &file.ProcessedBytes, &file.LinesFed,
+		&file.BatchesCreated, &file.BatchesCompleted, &file.FeedingComplete, &file.TotalLines, &file.Status, &file.StartedAt, &file.CompletedAt)
 	if err != nil {
 		return fmt.Errorf("get file: %w", err)
 	}
@@ -263,26 +648,46 @@ func (f *Feeder) ProcessFileByID(ctx context.Context, fileID int) error {
 // WaitForCapacity blocks until there's room in the batch queue.
 // Useful for startup to ensure we don't create too many batches.
 func (f *Feeder) WaitForCapacity(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
+	return f.awaitCapacity(ctx, func() (bool, error) {
 		pending, err := f.DB.GetPendingBatchCount(ctx)
 		if err != nil {
-			return err
-		}
-
-		if pending < f.Config.MaxPendingBatches {
-			return nil
+			return false, err
 		}
+		return pending < f.Config.MaxPendingBatches, nil
+	})
+}
 
-		time.Sleep(f.Config.PollInterval)
+// sleepCtx waits for d or until ctx is canceled, whichever comes first.
+// Returns false if ctx was canceled. Used instead of time.Sleep so the feeder
+// stops promptly on shutdown rather than holding up the DB close.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
 	}
 }
 
+// downloadCounter counts bytes read from a download body in
+// locplace_feeder_download_bytes_total.
+type downloadCounter struct {
+	io.ReadCloser
+}
+
+func (d downloadCounter) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	metrics.FeederDownloadBytesTotal.Add(float64(n))
+	return n, err
+}
+
+// observeFileDuration records how long a file took to feed since start.
+func observeFileDuration(filename string, start time.Time) {
+	metrics.FeederFileDuration.WithLabelValues(compressionType(filename)).Observe(time.Since(start).Seconds())
+}
+
 // StreamingReader wraps an io.Reader with context cancellation support.
 type StreamingReader struct {
 	ctx    context.Context
@@ -0,0 +1,221 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+)
+
+func TestConfig_ShouldRediscover(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := Config{
+		RediscoverIdleTime:    time.Hour,
+		RediscoverMinInterval: 6 * time.Hour,
+	}
+
+	tests := []struct {
+		name          string
+		cfg           Config
+		idleSince     time.Time
+		lastDiscovery time.Time
+		want          bool
+	}{
+		{
+			name:      "disabled",
+			cfg:       Config{},
+			idleSince: now.Add(-24 * time.Hour),
+			want:      false,
+		},
+		{
+			name: "not idle",
+			cfg:  cfg,
+			want: false,
+		},
+		{
+			name:      "idle but not long enough",
+			cfg:       cfg,
+			idleSince: now.Add(-30 * time.Minute),
+			want:      false,
+		},
+		{
+			name:      "idle long enough, never discovered",
+			cfg:       cfg,
+			idleSince: now.Add(-2 * time.Hour),
+			want:      true,
+		},
+		{
+			name:          "idle long enough but discovered recently",
+			cfg:           cfg,
+			idleSince:     now.Add(-2 * time.Hour),
+			lastDiscovery: now.Add(-time.Hour),
+			want:          false,
+		},
+		{
+			name:          "idle long enough and min interval elapsed",
+			cfg:           cfg,
+			idleSince:     now.Add(-10 * time.Hour),
+			lastDiscovery: now.Add(-7 * time.Hour),
+			want:          true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.shouldRediscover(now, tt.idleSince, tt.lastDiscovery); got != tt.want {
+				t.Errorf("shouldRediscover() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineCountShrunk(t *testing.T) {
+	ptr := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name    string
+		prior   *int64
+		current int64
+		want    bool
+	}{
+		{"never completed", nil, 10, false},
+		{"zero prior", ptr(0), 0, false},
+		{"same count", ptr(1000), 1000, false},
+		{"grew", ptr(1000), 1500, false},
+		{"slightly fewer", ptr(1000), 950, false},
+		{"at threshold", ptr(1000), 900, false},
+		{"far fewer", ptr(1000), 899, true},
+		{"empty", ptr(1000), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineCountShrunk(tt.prior, tt.current); got != tt.want {
+				t.Errorf("lineCountShrunk(%v, %d) = %v, want %v", tt.prior, tt.current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuspiciouslyEmpty(t *testing.T) {
+	ptr := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name     string
+		size     *int64
+		linesFed int64
+		want     bool
+	}{
+		{"large file fed nothing", ptr(50 << 20), 0, true},
+		{"at threshold fed nothing", ptr(emptyFileMinSize), 0, true},
+		{"tiny file fed nothing", ptr(32), 0, false}, // e.g. an empty .xz stream
+		{"unknown size", nil, 0, false},
+		{"large file fed domains", ptr(50 << 20), 12345, false},
+		{"resumed file fed earlier", ptr(50 << 20), 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suspiciouslyEmpty(tt.size, tt.linesFed); got != tt.want {
+				t.Errorf("suspiciouslyEmpty(%v, %d) = %v, want %v", tt.size, tt.linesFed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSleepCtx(t *testing.T) {
+	if !sleepCtx(context.Background(), time.Millisecond) {
+		t.Error("sleepCtx returned false without cancellation")
+	}
+
+	// A canceled context must return immediately, not after the full duration,
+	// so shutdown can wait for the feeder before closing the DB pool.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if sleepCtx(ctx, time.Hour) {
+		t.Error("sleepCtx returned true after cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleepCtx took %s after cancellation", elapsed)
+	}
+}
+
+func TestFeeder_PauseGatesProduction(t *testing.T) {
+	// A nil DB panics on any query, so these pass only if the pause
+	// stops the feeder before it touches the database.
+	f := &Feeder{Config: Config{PollInterval: time.Hour}, Capacity: NewCapacitySignal()}
+	f.Pause()
+
+	t.Run("insert waits", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := f.insertBatch(ctx, 1, 1, 1, 1, nil, []string{"example.com"})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("insertBatch while paused = %v, want deadline exceeded", err)
+		}
+	})
+
+	t.Run("no file claimed", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		f.runWorker(ctx, 0) // Returns on cancel without claiming a file
+		if f.claims.Len() != 0 {
+			t.Errorf("claims = %d while paused, want 0", f.claims.Len())
+		}
+	})
+}
+
+func TestFeeder_PauseResume(t *testing.T) {
+	f := &Feeder{Capacity: NewCapacitySignal()}
+	if f.Paused() {
+		t.Fatal("new feeder is paused")
+	}
+
+	f.Pause()
+	f.Pause() // Idempotent
+	if !f.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+
+	// Resume must wake workers waiting on the pause
+	wake := f.Capacity.Wait()
+	f.Resume()
+	if f.Paused() {
+		t.Error("Paused() = true after Resume")
+	}
+	select {
+	case <-wake:
+	default:
+		t.Error("Resume did not notify waiting workers")
+	}
+}
+
+func TestFeeder_RunStopsOnCancel(t *testing.T) {
+	f := New(dbtest.Unreachable(t), Config{
+		BatchSize:         100,
+		MaxPendingBatches: 10,
+		PollInterval:      time.Hour,
+		FeederConcurrency: 2,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond) // Let the workers reach their poll wait
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if f.Running() {
+		t.Error("Running() = true after Run returned")
+	}
+}
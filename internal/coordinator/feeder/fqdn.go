@@ -0,0 +1,81 @@
+package feeder
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// normalizeFQDN turns a domain file line into the FQDN to scan, or returns
+// false if it isn't a hostname. Lines are sometimes URLs or host:port pairs
+// rather than bare names, so the scheme, userinfo, port and path are
+// stripped; the name is lowercased, loses any trailing dot and has
+// internationalized labels converted to punycode. IP addresses,
+// single-label names and anything with characters DNS names can't hold are
+// rejected.
+func normalizeFQDN(line string) (string, bool) {
+	host := strings.ToLower(strings.TrimSpace(line))
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if i := strings.LastIndexByte(host, '@'); i >= 0 {
+		host = host[i+1:]
+	}
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && isDigits(host[i+1:]) {
+		host = host[:i]
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if strings.ContainsFunc(host, func(r rune) bool { return r > 0x7f }) {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", false
+		}
+		host = ascii
+	}
+
+	if host == "" || len(host) > 253 || net.ParseIP(host) != nil {
+		return "", false
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 || isDigits(labels[len(labels)-1]) {
+		return "", false // A bare word, or a numeric TLD (a mangled IP)
+	}
+	for _, label := range labels {
+		if !isLabel(label) {
+			return "", false
+		}
+	}
+	return host, true
+}
+
+// isLabel reports whether s is a valid lowercase DNS label: 1 to 63 letters,
+// digits, hyphens and underscores, not starting or ending with a hyphen.
+func isLabel(s string) bool {
+	if s == "" || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
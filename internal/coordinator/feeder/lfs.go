@@ -4,16 +4,25 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 const (
 	// LFSBatchURL is the Git LFS batch API endpoint for the domains repository.
 	LFSBatchURL = "https://github.com/tb0hdan/domains.git/info/lfs/objects/batch"
+
+	// maxPointerSize bounds how much of a pointer file is read.
+	maxPointerSize = 1024
 )
 
 // LFSPointer represents a Git LFS pointer file.
@@ -63,11 +72,61 @@ type LFSError struct {
 	Message string `json:"message"`
 }
 
+// StatusError is returned when a download gets an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Body       string // Start of the response body, for diagnostics
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// newStatusError builds a StatusError from resp, reading a little of its body.
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // Best effort to get error details
+	return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+// downloadErrorReason classifies a download failure for the
+// locplace_feeder_download_errors_total metric: "quota" when GitHub refuses
+// for LFS bandwidth or storage quota, "not_found", "network" for transport
+// failures, and "other". Returns "" for cancellation, which isn't a failure.
+func downloadErrorReason(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ""
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == 509: // GitHub's "bandwidth limit exceeded"
+			return "quota"
+		case statusErr.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(statusErr.Body), "quota"):
+			return "quota"
+		case statusErr.StatusCode == http.StatusNotFound:
+			return "not_found"
+		default:
+			return "other"
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded) {
+		return "network"
+	}
+	return "other"
+}
+
 // LFSClient handles Git LFS operations.
 type LFSClient struct {
 	HTTPClient  *http.Client
 	BatchURL    string
 	GitHubToken string // Optional: GitHub PAT for authenticated downloads
+	Retry       RetryConfig
 }
 
 // NewLFSClient creates a new LFS client.
@@ -75,6 +134,7 @@ func NewLFSClient() *LFSClient {
 	return &LFSClient{
 		HTTPClient: http.DefaultClient,
 		BatchURL:   LFSBatchURL,
+		Retry:      DefaultRetryConfig(),
 	}
 }
 
@@ -86,6 +146,7 @@ func NewLFSClientWithToken(token string) *LFSClient {
 		HTTPClient:  http.DefaultClient,
 		BatchURL:    LFSBatchURL,
 		GitHubToken: token,
+		Retry:       DefaultRetryConfig(),
 	}
 }
 
@@ -134,21 +195,22 @@ func (c *LFSClient) GetDownloadURL(ctx context.Context, oid string, size int64)
 		return "", nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BatchURL, bytes.NewReader(body))
-	if err != nil {
-		return "", nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
-	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	resp, err := doWithRetry(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BatchURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
 
-	// Add authentication if token is provided
-	// This allows downloads to count against your LFS quota instead of the repo's
-	if c.GitHubToken != "" {
-		req.Header.Set("Authorization", "token "+c.GitHubToken)
-	}
+		req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+		req.Header.Set("Accept", "application/vnd.git-lfs+json")
 
-	resp, err := c.HTTPClient.Do(req)
+		// Add authentication if token is provided
+		// This allows downloads to count against your LFS quota instead of the repo's
+		if c.GitHubToken != "" {
+			req.Header.Set("Authorization", "token "+c.GitHubToken)
+		}
+		return req, nil
+	})
 	if err != nil {
 		return "", nil, fmt.Errorf("lfs batch request: %w", err)
 	}
@@ -190,24 +252,25 @@ func (c *LFSClient) Download(ctx context.Context, oid string, size int64) (io.Re
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create download request: %w", err)
-	}
-
-	// Add any headers from the LFS response
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
+	resp, err := doWithRetry(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create download request: %w", err)
+		}
 
-	resp, err := c.HTTPClient.Do(req)
+		// Add any headers from the LFS response
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("download: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close() //nolint:errcheck // Close error not actionable
-		return nil, fmt.Errorf("download: status %d", resp.StatusCode)
+		defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+		return nil, fmt.Errorf("download: %w", newStatusError(resp))
 	}
 
 	return resp.Body, nil
@@ -217,7 +280,55 @@ func (c *LFSClient) Download(ctx context.Context, oid string, size int64) (io.Re
 // This uses github.com/{owner}/{repo}/raw/{branch}/{path} which redirects to
 // the actual LFS content. This may have different quota handling than the LFS batch API.
 func (c *LFSClient) DownloadViaWeb(ctx context.Context, owner, repo, branch, path string) (io.ReadCloser, error) {
-	// Construct the GitHub web raw URL
+	// Use a client that follows redirects (default behavior)
+	resp, err := doWithRetry(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		return c.newWebRequest(ctx, owner, repo, branch, path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+		return nil, fmt.Errorf("download: %w", newStatusError(resp))
+	}
+
+	return resp.Body, nil
+}
+
+// DownloadRangeViaWeb downloads bytes start through end (inclusive) of a file
+// via GitHub's web interface; end < 0 means through the end of the file.
+// Returns the body and the file's total size. Fails if the server ignores
+// the Range header, so callers can fall back to a full download.
+func (c *LFSClient) DownloadRangeViaWeb(ctx context.Context, owner, repo, branch, path string, start, end int64) (io.ReadCloser, int64, error) {
+	resp, err := doWithRetry(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		req, err := c.newWebRequest(ctx, owner, repo, branch, path)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", byteRange(start, end))
+		return req, nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("download range: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close() //nolint:errcheck // Close error not actionable
+		return nil, 0, fmt.Errorf("download range: status %d (range requests unsupported?)", resp.StatusCode)
+	}
+
+	total, err := contentRangeTotal(resp.Header.Get("Content-Range"))
+	if err != nil {
+		resp.Body.Close() //nolint:errcheck // Close error not actionable
+		return nil, 0, fmt.Errorf("download range: %w", err)
+	}
+
+	return resp.Body, total, nil
+}
+
+// newWebRequest builds a GET for a file via github.com/{owner}/{repo}/raw/{branch}/{path}.
+func (c *LFSClient) newWebRequest(ctx context.Context, owner, repo, branch, path string) (*http.Request, error) {
 	// e.g., https://github.com/tb0hdan/domains/raw/master/data/afghanistan/domain2multi-af00.txt.xz
 	webURL := fmt.Sprintf("https://github.com/%s/%s/raw/%s/%s", owner, repo, branch, path)
 
@@ -232,30 +343,76 @@ func (c *LFSClient) DownloadViaWeb(ctx context.Context, owner, repo, branch, pat
 	}
 	req.Header.Set("Accept", "application/octet-stream")
 	req.Header.Set("User-Agent", "locplace-scanner/1.0")
+	return req, nil
+}
 
-	// Use a client that follows redirects (default behavior)
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("download: %w", err)
+// byteRange formats an HTTP Range header for bytes start through end
+// (inclusive), or through the end of the file if end < 0.
+func byteRange(start, end int64) string {
+	if end < 0 {
+		return fmt.Sprintf("bytes=%d-", start)
 	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close() //nolint:errcheck // Close error not actionable
-		return nil, fmt.Errorf("download: status %d: %s", resp.StatusCode, string(body))
+// contentRangeTotal extracts the complete length from a Content-Range header
+// such as "bytes 0-11/123456".
+func contentRangeTotal(header string) (int64, error) {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok || !strings.HasPrefix(header, "bytes ") {
+		return 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Content-Range %q has no total size", header)
 	}
+	return n, nil
+}
 
-	return resp.Body, nil
+// verifyingReader hashes everything read through it, so a download can be
+// checked against its LFS pointer once it has been fully consumed.
+type verifyingReader struct {
+	r       io.Reader
+	pointer *LFSPointer
+	hash    hash.Hash
+	n       int64
 }
 
-// FetchPointer fetches and parses an LFS pointer file from a raw GitHub URL.
-func (c *LFSClient) FetchPointer(ctx context.Context, rawURL string) (*LFSPointer, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+func newVerifyingReader(r io.Reader, pointer *LFSPointer) *verifyingReader {
+	return &verifyingReader{r: r, pointer: pointer, hash: sha256.New()}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n]) //nolint:errcheck // hash.Hash.Write never fails
+	v.n += int64(n)
+	return n, err
+}
+
+// Verify drains any unread bytes and checks the size and SHA-256 of
+// everything read against the pointer.
+func (v *verifyingReader) Verify() error {
+	if _, err := io.Copy(io.Discard, v); err != nil {
+		return fmt.Errorf("drain download: %w", err)
+	}
+	if v.pointer.Size > 0 && v.n != v.pointer.Size {
+		return fmt.Errorf("size mismatch: got %d bytes, pointer says %d", v.n, v.pointer.Size)
+	}
+	if got := hex.EncodeToString(v.hash.Sum(nil)); !strings.EqualFold(got, v.pointer.OID) {
+		return fmt.Errorf("sha256 mismatch: got %s, pointer says %s", got, v.pointer.OID)
 	}
+	return nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
+// FetchPointer fetches and parses an LFS pointer file from a raw GitHub URL.
+func (c *LFSClient) FetchPointer(ctx context.Context, rawURL string) (*LFSPointer, error) {
+	resp, err := doWithRetry(ctx, c.HTTPClient, c.Retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		return req, nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("fetch pointer: %w", err)
 	}
@@ -265,7 +422,8 @@ func (c *LFSClient) FetchPointer(ctx context.Context, rawURL string) (*LFSPointe
 		return nil, fmt.Errorf("fetch pointer: status %d", resp.StatusCode)
 	}
 
-	content, err := io.ReadAll(resp.Body)
+	// Pointers are tiny; don't read a whole file if this one isn't stored in LFS
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxPointerSize))
 	if err != nil {
 		return nil, fmt.Errorf("read pointer: %w", err)
 	}
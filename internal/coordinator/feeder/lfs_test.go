@@ -0,0 +1,197 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/locplace/scanner/internal/coordinator/metrics"
+)
+
+func TestByteRange(t *testing.T) {
+	tests := []struct {
+		start, end int64
+		want       string
+	}{
+		{0, 11, "bytes=0-11"},
+		{1024, 2047, "bytes=1024-2047"},
+		{500, -1, "bytes=500-"},
+	}
+	for _, tt := range tests {
+		if got := byteRange(tt.start, tt.end); got != tt.want {
+			t.Errorf("byteRange(%d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 0-11/123456", 123456, false},
+		{"bytes 100-199/200", 200, false},
+		{"bytes 0-11/*", 0, true},
+		{"bytes */123", 123, false},
+		{"items 0-11/123", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := contentRangeTotal(tt.header)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("contentRangeTotal(%q) error = %v, wantErr %v", tt.header, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("contentRangeTotal(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	content := []byte("domain-00001.example.com\ndomain-00002.example.com\n")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		body    []byte
+		pointer LFSPointer
+		readN   int // bytes to read before verifying; the rest must be drained
+		wantErr bool
+	}{
+		{"match", content, LFSPointer{OID: oid, Size: int64(len(content))}, len(content), false},
+		{"match partially read", content, LFSPointer{OID: oid, Size: int64(len(content))}, 10, false},
+		{"uppercase oid", content, LFSPointer{OID: strings.ToUpper(oid), Size: int64(len(content))}, len(content), false},
+		{"truncated", content[:20], LFSPointer{OID: oid, Size: int64(len(content))}, 20, true},
+		{"corrupted", append([]byte("X"), content[1:]...), LFSPointer{OID: oid, Size: int64(len(content))}, len(content), true},
+		{"wrong oid, no size", content, LFSPointer{OID: strings.Repeat("0", 64)}, len(content), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerifyingReader(bytes.NewReader(tt.body), &tt.pointer)
+			if _, err := io.ReadFull(v, make([]byte, tt.readN)); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			err := v.Verify()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// redirectTransport sends every request to target, whatever its URL.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// downloadErrorCount reads locplace_feeder_download_errors_total{reason}.
+func downloadErrorCount(t *testing.T, reason string) float64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.FeederDownloadErrorsTotal)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "reason" && l.GetValue() == reason {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestFeeder_DownloadErrorMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		closed  bool // Server is shut down before the request
+		want    string
+	}{
+		{
+			name:    "bandwidth limit",
+			handler: func(w http.ResponseWriter, _ *http.Request) { http.Error(w, "Bandwidth limit exceeded", 509) },
+			want:    "quota",
+		},
+		{
+			name: "over data quota",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "This repository is over its data quota.", http.StatusForbidden)
+			},
+			want: "quota",
+		},
+		{
+			name:    "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) },
+			want:    "not_found",
+		},
+		{
+			name:    "forbidden",
+			handler: func(w http.ResponseWriter, _ *http.Request) { http.Error(w, "nope", http.StatusForbidden) },
+			want:    "other",
+		},
+		{
+			name:    "server error",
+			handler: func(w http.ResponseWriter, _ *http.Request) { http.Error(w, "oops", http.StatusInternalServerError) },
+			want:    "other",
+		},
+		{
+			name:   "connection refused",
+			closed: true,
+			want:   "network",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			target, _ := url.Parse(srv.URL) //nolint:errcheck // httptest URLs are valid
+			if tt.closed {
+				srv.Close()
+			} else {
+				defer srv.Close()
+			}
+
+			lfs := NewLFSClient()
+			lfs.HTTPClient = &http.Client{Transport: redirectTransport{target}}
+			lfs.Retry = fastRetry(0)
+			f := &Feeder{LFSClient: lfs}
+
+			before := downloadErrorCount(t, tt.want)
+			if _, err := f.download(context.Background(), "data/x/x.txt.xz"); err == nil {
+				t.Fatal("download succeeded, want error")
+			}
+			if got := downloadErrorCount(t, tt.want) - before; got != 1 {
+				t.Errorf("download_errors_total{reason=%q} grew by %v, want 1", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDownloadErrorReason_Canceled(t *testing.T) {
+	if got := downloadErrorReason(fmt.Errorf("download: %w", context.Canceled)); got != "" {
+		t.Errorf("downloadErrorReason(canceled) = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,118 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryConfig controls how feeder HTTP requests are retried.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt. Zero disables retrying.
+	MaxRetries int
+
+	// BaseDelay is the wait before the first retry; it doubles on each further retry.
+	BaseDelay time.Duration
+
+	// MaxDelay caps any single wait, including one requested via Retry-After.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryConfig returns the retry policy used unless configured otherwise.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries: 3,
+		BaseDelay:  time.Second,
+		MaxDelay:   30 * time.Second,
+	}
+}
+
+// delay returns how long to wait before retry number attempt (1-based).
+// A positive retryAfter from the server takes precedence over the backoff.
+func (c RetryConfig) delay(attempt int, retryAfter time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = c.BaseDelay << (attempt - 1)
+		if d <= 0 { // overflow
+			d = c.MaxDelay
+		}
+	}
+	if c.MaxDelay > 0 {
+		d = min(d, c.MaxDelay)
+	}
+	return d
+}
+
+// retryableStatus reports whether a response status is worth retrying:
+// server errors and rate limiting. Other statuses (e.g. 404) won't change.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// Returns zero if the header is absent or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// doWithRetry sends the request built by newReq, retrying network errors and
+// retryable statuses with exponential backoff. newReq is called per attempt so
+// request bodies can be rebuilt. It returns the first non-retryable response,
+// which the caller must still check, or the last response or error once
+// retries are exhausted.
+func doWithRetry(ctx context.Context, client *http.Client, cfg RetryConfig, newReq func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+		case retryableStatus(resp.StatusCode):
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		default:
+			return resp, nil
+		}
+
+		if attempt >= cfg.MaxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close() //nolint:errcheck // Close error not actionable
+		}
+
+		wait := cfg.delay(attempt+1, retryAfter)
+		slog.Warn("Feeder: HTTP request failed, retrying", "url", req.URL.Redacted(),
+			"attempt", attempt+1, "status", statusOf(resp), "error", err, "wait", wait.String())
+		if !sleepCtx(ctx, wait) {
+			return nil, fmt.Errorf("retry %s: %w", req.URL.Redacted(), ctx.Err())
+		}
+	}
+}
+
+// statusOf returns the response status code, or zero if there is no response.
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
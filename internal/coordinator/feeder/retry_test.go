@@ -0,0 +1,184 @@
+package feeder
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first `failures` requests with failStatus, then
+// serves body with 200. It counts every request it receives.
+func flakyServer(t *testing.T, failures int32, failStatus int, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= failures {
+			http.Error(w, "try again", failStatus)
+			return
+		}
+		io.WriteString(w, body) //nolint:errcheck // Test server
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// fastRetry retries quickly so tests don't sleep for real backoff periods.
+func fastRetry(maxRetries int) RetryConfig {
+	return RetryConfig{MaxRetries: maxRetries, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+}
+
+func getWithRetry(t *testing.T, url string, cfg RetryConfig) (*http.Response, error) {
+	t.Helper()
+	ctx := context.Background()
+	return doWithRetry(ctx, http.DefaultClient, cfg, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	})
+}
+
+func TestDoWithRetry_RecoversFromTransientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable, "ok")
+
+	resp, err := getWithRetry(t, srv.URL, fastRetry(3))
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestDoWithRetry_GivesUp(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusServiceUnavailable, "ok")
+
+	resp, err := getWithRetry(t, srv.URL, fastRetry(2))
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want the last 503", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3 (1 + 2 retries)", got)
+	}
+}
+
+func TestDoWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	srv, calls := flakyServer(t, 10, http.StatusNotFound, "ok")
+
+	resp, err := getWithRetry(t, srv.URL, fastRetry(3))
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
+
+func TestDoWithRetry_RetriesNetworkErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close() // Connections are now refused
+
+	start := time.Now()
+	_, err := getWithRetry(t, url, fastRetry(2))
+	if err == nil {
+		t.Fatal("doWithRetry against a closed server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Millisecond {
+		t.Errorf("returned after %s, want at least two backoff waits", elapsed)
+	}
+}
+
+func TestRetryConfig_Delay(t *testing.T) {
+	cfg := RetryConfig{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{1, 0, time.Second},
+		{2, 0, 2 * time.Second},
+		{3, 0, 4 * time.Second},
+		{5, 0, 10 * time.Second}, // capped
+		{1, 5 * time.Second, 5 * time.Second},
+		{1, time.Minute, 10 * time.Second}, // Retry-After is capped too
+		{70, 0, 10 * time.Second},          // shift overflow
+	}
+	for _, tt := range tests {
+		if got := cfg.delay(tt.attempt, tt.retryAfter); got != tt.want {
+			t.Errorf("delay(%d, %s) = %s, want %s", tt.attempt, tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"-3", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLFSClient_GetDownloadURL_Retries(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusBadGateway,
+		`{"objects":[{"oid":"abc","size":1,"actions":{"download":{"href":"https://example.com/obj"}}}]}`)
+
+	c := NewLFSClient()
+	c.BatchURL = srv.URL
+	c.Retry = fastRetry(3)
+
+	href, _, err := c.GetDownloadURL(context.Background(), "abc", 1)
+	if err != nil {
+		t.Fatalf("GetDownloadURL: %v", err)
+	}
+	if href != "https://example.com/obj" {
+		t.Errorf("href = %q", href)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestDiscoverFiles_Retries(t *testing.T) {
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable,
+		`{"tree":[{"path":"data/a/x.txt.xz","type":"blob","sha":"s1","size":10},{"path":"README.md","type":"blob"}]}`)
+
+	files, err := (&treeClient{retry: fastRetry(3)}).discover(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(files) != 1 || files[0].Filename != "data/a/x.txt.xz" {
+		t.Errorf("files = %+v, want just data/a/x.txt.xz", files)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
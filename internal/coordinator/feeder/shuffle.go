@@ -0,0 +1,72 @@
+package feeder
+
+import "math/rand/v2"
+
+// shuffleEntry is a domain held in the shuffle buffer along with its line number.
+type shuffleEntry struct {
+	line   int64
+	domain string
+}
+
+// shuffler interleaves domains within a file using a fixed-size reservoir.
+// Domain files are sorted, so consecutive lines tend to share a zone and its
+// authoritative servers; drawing randomly from a window of upcoming lines
+// spreads each batch's lookups across many zones instead.
+type shuffler struct {
+	buf  []shuffleEntry
+	size int
+	intn func(int) int
+}
+
+func newShuffler(size int) *shuffler {
+	return &shuffler{
+		buf:  make([]shuffleEntry, 0, size),
+		size: size,
+		intn: rand.IntN,
+	}
+}
+
+// Add places a domain into the buffer. Once the buffer is full, a random
+// buffered entry is evicted to make room and returned with ok=true.
+func (s *shuffler) Add(line int64, domain string) (out shuffleEntry, ok bool) {
+	e := shuffleEntry{line: line, domain: domain}
+	if len(s.buf) < s.size {
+		s.buf = append(s.buf, e)
+		return shuffleEntry{}, false
+	}
+	i := s.intn(len(s.buf))
+	out = s.buf[i]
+	s.buf[i] = e
+	return out, true
+}
+
+// Pop removes and returns a random buffered entry, or ok=false if empty.
+// Used to drain the buffer at the end of a file.
+func (s *shuffler) Pop() (out shuffleEntry, ok bool) {
+	if len(s.buf) == 0 {
+		return shuffleEntry{}, false
+	}
+	i := s.intn(len(s.buf))
+	last := len(s.buf) - 1
+	out = s.buf[i]
+	s.buf[i] = s.buf[last]
+	s.buf = s.buf[:last]
+	return out, true
+}
+
+// Len returns the number of buffered entries.
+func (s *shuffler) Len() int {
+	return len(s.buf)
+}
+
+// MinLine returns the lowest line number still buffered, or 0 if empty.
+// Every line before it has been emitted, so MinLine-1 is a safe resume point.
+func (s *shuffler) MinLine() int64 {
+	var m int64
+	for _, e := range s.buf {
+		if m == 0 || e.line < m {
+			m = e.line
+		}
+	}
+	return m
+}
@@ -0,0 +1,79 @@
+package feeder
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShuffler_EmitsEveryEntryOnce(t *testing.T) {
+	const n = 1000
+	s := newShuffler(64)
+
+	seen := make(map[int64]bool, n)
+	emit := func(e shuffleEntry) {
+		if seen[e.line] {
+			t.Fatalf("line %d emitted twice", e.line)
+		}
+		if e.domain != fmt.Sprintf("d%d.example", e.line) {
+			t.Fatalf("line %d has domain %q", e.line, e.domain)
+		}
+		seen[e.line] = true
+	}
+
+	inOrder := true
+	var last int64
+	for line := int64(1); line <= n; line++ {
+		if e, ok := s.Add(line, fmt.Sprintf("d%d.example", line)); ok {
+			if e.line < last {
+				inOrder = false
+			}
+			last = e.line
+			emit(e)
+		}
+		if s.Len() > 64 {
+			t.Fatalf("buffer grew to %d", s.Len())
+		}
+	}
+	for e, ok := s.Pop(); ok; e, ok = s.Pop() {
+		emit(e)
+	}
+
+	if len(seen) != n {
+		t.Errorf("emitted %d entries, want %d", len(seen), n)
+	}
+	if inOrder {
+		t.Error("entries were emitted in file order; expected interleaving")
+	}
+}
+
+func TestShuffler_MinLine(t *testing.T) {
+	s := newShuffler(3)
+	// Always evict the first slot so the outcome is deterministic
+	s.intn = func(int) int { return 0 }
+
+	if got := s.MinLine(); got != 0 {
+		t.Errorf("empty MinLine = %d, want 0", got)
+	}
+	for line := int64(1); line <= 3; line++ {
+		s.Add(line, "x")
+	}
+	if got := s.MinLine(); got != 1 {
+		t.Errorf("MinLine = %d, want 1", got)
+	}
+
+	// Evicts line 1, buffer holds 4,2,3
+	if e, ok := s.Add(4, "x"); !ok || e.line != 1 {
+		t.Fatalf("Add evicted %+v, %v; want line 1", e, ok)
+	}
+	if got := s.MinLine(); got != 2 {
+		t.Errorf("MinLine = %d, want 2", got)
+	}
+
+	// Pop slot 0 (line 4); 3 moves into its place
+	if e, ok := s.Pop(); !ok || e.line != 4 {
+		t.Fatalf("Pop = %+v, %v; want line 4", e, ok)
+	}
+	if got := s.MinLine(); got != 2 {
+		t.Errorf("MinLine = %d, want 2", got)
+	}
+}
@@ -0,0 +1,44 @@
+package feeder
+
+import "sync"
+
+// CapacitySignal wakes feeder workers waiting for queue capacity. The
+// scanner API notifies it when batches leave the pending queue, so the
+// feeder refills promptly instead of waiting out its poll interval.
+// A nil *CapacitySignal is valid and never fires.
+type CapacitySignal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// NewCapacitySignal creates a signal with no waiters.
+func NewCapacitySignal() *CapacitySignal {
+	return &CapacitySignal{}
+}
+
+// Wait returns a channel that is closed by the next Notify. Call it before
+// checking capacity so a Notify that races with the check isn't missed.
+func (s *CapacitySignal) Wait() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+// Notify wakes every current waiter. It never blocks.
+func (s *CapacitySignal) Notify() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
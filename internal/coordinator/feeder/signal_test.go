@@ -0,0 +1,132 @@
+package feeder
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCapacitySignal_NotifyWakesAllWaiters(t *testing.T) {
+	s := NewCapacitySignal()
+	a, b := s.Wait(), s.Wait()
+	s.Notify()
+	for i, ch := range []<-chan struct{}{a, b} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("waiter %d not woken by Notify", i)
+		}
+	}
+
+	// A later waiter needs a new notification
+	select {
+	case <-s.Wait():
+		t.Error("waiter subscribed after Notify woke immediately")
+	default:
+	}
+}
+
+func TestCapacitySignal_Nil(t *testing.T) {
+	var s *CapacitySignal
+	s.Notify() // Must not panic
+	if s.Wait() != nil {
+		t.Error("nil signal Wait() returned a channel")
+	}
+}
+
+func TestFeeder_AwaitCapacity_WakesOnNotify(t *testing.T) {
+	// With an hour-long poll, only the signal can unblock the wait in time
+	f := &Feeder{Config: Config{PollInterval: time.Hour}, Capacity: NewCapacitySignal()}
+
+	var attempts atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- f.awaitCapacity(context.Background(), func() (bool, error) {
+			// Queue is full on the first attempt; a scanner then frees a slot
+			return attempts.Add(1) > 1, nil
+		})
+	}()
+
+	// Give the feeder time to find the queue full and start waiting
+	deadline := time.Now().Add(time.Second)
+	for attempts.Load() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	f.Capacity.Notify() // e.g. a batch was claimed or completed
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("awaitCapacity: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("awaitCapacity still blocked after Notify")
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestFeeder_AwaitCapacity_NotifyDuringAttempt(t *testing.T) {
+	// A notification that arrives while the capacity check is running must
+	// still wake the wait that follows it
+	f := &Feeder{Config: Config{PollInterval: time.Hour}, Capacity: NewCapacitySignal()}
+
+	attempts := 0
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.awaitCapacity(context.Background(), func() (bool, error) {
+			attempts++
+			if attempts == 1 {
+				f.Capacity.Notify()
+				return false, nil
+			}
+			return true, nil
+		})
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("awaitCapacity: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification during the capacity check was lost")
+	}
+}
+
+func TestFeeder_AwaitCapacity_FallsBackToPolling(t *testing.T) {
+	f := &Feeder{Config: Config{PollInterval: time.Millisecond}} // No signal at all
+
+	attempts := 0
+	err := f.awaitCapacity(context.Background(), func() (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	})
+	if err != nil {
+		t.Fatalf("awaitCapacity: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestFeeder_AwaitCapacity_StopsOnErrorAndCancel(t *testing.T) {
+	f := &Feeder{Config: Config{PollInterval: time.Hour}, Capacity: NewCapacitySignal()}
+
+	boom := errors.New("db down")
+	if err := f.awaitCapacity(context.Background(), func() (bool, error) { return false, boom }); !errors.Is(err, boom) {
+		t.Errorf("awaitCapacity error = %v, want %v", err, boom)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := f.awaitCapacity(ctx, func() (bool, error) { return false, nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("awaitCapacity error = %v, want context.Canceled", err)
+	}
+}
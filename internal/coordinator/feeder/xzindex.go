@@ -0,0 +1,255 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// xz container layout (see the .xz file format spec):
+//
+//	stream header (12) | block 0 | block 1 | ... | index | stream footer (12)
+//
+// The index lists every block's unpadded and uncompressed size, so it maps
+// decompressed offsets to the compressed offset of the block holding them.
+// A stream can be decoded from any block boundary by prefixing the original
+// header and appending an index that lists only the remaining blocks.
+const (
+	xzHeaderLen = 12
+	xzFooterLen = 12
+)
+
+var (
+	xzHeaderMagic = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+	xzFooterMagic = []byte{'Y', 'Z'}
+)
+
+// xzBlock locates one block in the compressed and decompressed streams.
+type xzBlock struct {
+	Offset             int64 // Compressed offset of the block header
+	UnpaddedSize       int64 // As recorded in the index
+	UncompressedOffset int64
+	UncompressedSize   int64
+}
+
+// paddedSize is the block's size on disk, including padding to 4 bytes.
+func (b xzBlock) paddedSize() int64 {
+	return (b.UnpaddedSize + 3) &^ 3
+}
+
+// xzIndex is the parsed index of a single-stream xz file.
+type xzIndex struct {
+	Flags       [2]byte // Stream flags, shared by header and footer
+	Blocks      []xzBlock
+	IndexOffset int64 // Compressed offset where the index starts
+}
+
+// parseXZFooter validates a stream footer and returns the size of the index
+// preceding it and the stream flags.
+func parseXZFooter(footer []byte) (indexSize int64, flags [2]byte, err error) {
+	if len(footer) != xzFooterLen || !bytes.Equal(footer[10:], xzFooterMagic) {
+		return 0, flags, errors.New("xz: invalid stream footer")
+	}
+	if crc32.ChecksumIEEE(footer[4:10]) != binary.LittleEndian.Uint32(footer[:4]) {
+		return 0, flags, errors.New("xz: stream footer checksum mismatch")
+	}
+	copy(flags[:], footer[8:10])
+	return (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4, flags, nil
+}
+
+// parseXZIndex parses an index and lays out its blocks. fileSize must be the
+// size of the whole file; files with more than one stream or with stream
+// padding are rejected since their blocks can't be located from one index.
+func parseXZIndex(index []byte, flags [2]byte, fileSize int64) (*xzIndex, error) {
+	if len(index) < 8 || len(index)%4 != 0 || index[0] != 0 {
+		return nil, errors.New("xz: invalid index")
+	}
+	body, sum := index[:len(index)-4], index[len(index)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum) {
+		return nil, errors.New("xz: index checksum mismatch")
+	}
+
+	r := bytes.NewReader(body[1:])
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("xz: index record count: %w", err)
+	}
+	if count > uint64(len(body)) {
+		return nil, errors.New("xz: implausible index record count")
+	}
+
+	idx := &xzIndex{Flags: flags, Blocks: make([]xzBlock, 0, count)}
+	offset, uncompressed := int64(xzHeaderLen), int64(0)
+	for i := uint64(0); i < count; i++ {
+		unpadded, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("xz: index record %d: %w", i, err)
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("xz: index record %d: %w", i, err)
+		}
+		b := xzBlock{
+			Offset:             offset,
+			UnpaddedSize:       int64(unpadded),
+			UncompressedOffset: uncompressed,
+			UncompressedSize:   int64(size),
+		}
+		idx.Blocks = append(idx.Blocks, b)
+		offset += b.paddedSize()
+		uncompressed += b.UncompressedSize
+	}
+	for r.Len() > 0 {
+		if c, _ := r.ReadByte(); c != 0 { //nolint:errcheck // Len() > 0 guarantees a byte
+			return nil, errors.New("xz: non-zero index padding")
+		}
+	}
+
+	idx.IndexOffset = offset
+	if offset+int64(len(index))+xzFooterLen != fileSize {
+		return nil, errors.New("xz: file is not a single unpadded stream")
+	}
+	return idx, nil
+}
+
+// resumeBlock returns the position of the last block starting at or before
+// the decompressed offset pos. ok is false if that is the first block, since
+// resuming there saves nothing over a full download.
+func (x *xzIndex) resumeBlock(pos int64) (i int, ok bool) {
+	i = -1
+	for j, b := range x.Blocks {
+		if b.UncompressedOffset > pos {
+			break
+		}
+		i = j
+	}
+	return i, i > 0
+}
+
+// tailFrom builds an index and stream footer listing blocks i onwards, to be
+// appended after those blocks so a decoder sees a complete, valid stream.
+func (x *xzIndex) tailFrom(i int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0) // index indicator
+	buf.Write(binary.AppendUvarint(nil, uint64(len(x.Blocks)-i)))
+	for _, b := range x.Blocks[i:] {
+		buf.Write(binary.AppendUvarint(nil, uint64(b.UnpaddedSize)))
+		buf.Write(binary.AppendUvarint(nil, uint64(b.UncompressedSize)))
+	}
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+
+	footer := make([]byte, xzFooterLen)
+	binary.LittleEndian.PutUint32(footer[4:8], uint32(buf.Len()/4-1))
+	copy(footer[8:10], x.Flags[:])
+	copy(footer[10:], xzFooterMagic)
+	binary.LittleEndian.PutUint32(footer[:4], crc32.ChecksumIEEE(footer[4:10]))
+	buf.Write(footer)
+
+	return buf.Bytes()
+}
+
+// checkXZHeader validates a stream header and returns its flags.
+func checkXZHeader(header []byte) ([2]byte, error) {
+	var flags [2]byte
+	if len(header) != xzHeaderLen || !bytes.Equal(header[:6], xzHeaderMagic) {
+		return flags, errors.New("xz: invalid stream header")
+	}
+	if crc32.ChecksumIEEE(header[6:8]) != binary.LittleEndian.Uint32(header[8:12]) {
+		return flags, errors.New("xz: stream header checksum mismatch")
+	}
+	copy(flags[:], header[6:8])
+	return flags, nil
+}
+
+// rangeFunc fetches bytes start through end (inclusive) of a file, or through
+// the end of the file if end < 0, and returns the body and the file's size.
+type rangeFunc func(ctx context.Context, start, end int64) (io.ReadCloser, int64, error)
+
+// readRange fetches a range fully into memory.
+func readRange(ctx context.Context, fetch rangeFunc, start, end int64) ([]byte, int64, error) {
+	body, total, err := fetch(ctx, start, end)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close() //nolint:errcheck // Close error not actionable
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, 0, fmt.Errorf("range %d-%d: got %d bytes", start, end, len(data))
+	}
+	return data, total, nil
+}
+
+// openXZAt returns a reader over the decompressed content of a single-stream
+// xz file starting at decompressed offset pos, downloading only from the
+// block containing pos onwards. The caller must close the returned body.
+func openXZAt(ctx context.Context, fetch rangeFunc, pos int64) (io.Reader, io.Closer, error) {
+	header, size, err := readRange(ctx, fetch, 0, xzHeaderLen-1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch header: %w", err)
+	}
+	flags, err := checkXZHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	footer, _, err := readRange(ctx, fetch, size-xzFooterLen, size-1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch footer: %w", err)
+	}
+	indexSize, footerFlags, err := parseXZFooter(footer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if footerFlags != flags {
+		return nil, nil, errors.New("xz: header and footer flags differ")
+	}
+	if indexSize > size-xzHeaderLen-xzFooterLen {
+		return nil, nil, errors.New("xz: index larger than file")
+	}
+
+	indexStart := size - xzFooterLen - indexSize
+	index, _, err := readRange(ctx, fetch, indexStart, size-xzFooterLen-1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch index: %w", err)
+	}
+	idx, err := parseXZIndex(index, flags, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i, ok := idx.resumeBlock(pos)
+	if !ok {
+		return nil, nil, fmt.Errorf("xz: offset %d is in the first block", pos)
+	}
+	blk := idx.Blocks[i]
+
+	body, _, err := fetch(ctx, blk.Offset, idx.IndexOffset-1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch blocks: %w", err)
+	}
+
+	stream := io.MultiReader(bytes.NewReader(header), body, bytes.NewReader(idx.tailFrom(i)))
+	r, err := xz.NewReader(stream)
+	if err != nil {
+		body.Close() //nolint:errcheck // Close error not actionable
+		return nil, nil, fmt.Errorf("xz reader: %w", err)
+	}
+	if _, err := io.CopyN(io.Discard, r, pos-blk.UncompressedOffset); err != nil {
+		body.Close() //nolint:errcheck // Close error not actionable
+		return nil, nil, fmt.Errorf("skip to offset %d: %w", pos, err)
+	}
+	return r, body, nil
+}
@@ -0,0 +1,202 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+// multiBlockXZ compresses lines into an xz file split into small blocks.
+func multiBlockXZ(t *testing.T, lines int, blockSize int64) (compressed, plain []byte) {
+	t.Helper()
+	var src bytes.Buffer
+	for i := range lines {
+		fmt.Fprintf(&src, "domain-%05d.example.com\n", i)
+	}
+
+	var out bytes.Buffer
+	w, err := xz.WriterConfig{BlockSize: blockSize, DictCap: 4096}.NewWriter(&out)
+	if err != nil {
+		t.Fatalf("xz writer: %v", err)
+	}
+	if _, err := w.Write(src.Bytes()); err != nil {
+		t.Fatalf("xz write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("xz close: %v", err)
+	}
+	return out.Bytes(), src.Bytes()
+}
+
+// parseTestIndex parses the index of an in-memory xz file the way the feeder
+// does from ranged downloads: header, footer, then the index they point to.
+func parseTestIndex(t *testing.T, data []byte) *xzIndex {
+	t.Helper()
+	flags, err := checkXZHeader(data[:xzHeaderLen])
+	if err != nil {
+		t.Fatalf("checkXZHeader: %v", err)
+	}
+	size := int64(len(data))
+	indexSize, footerFlags, err := parseXZFooter(data[size-xzFooterLen:])
+	if err != nil {
+		t.Fatalf("parseXZFooter: %v", err)
+	}
+	if footerFlags != flags {
+		t.Fatalf("footer flags %v != header flags %v", footerFlags, flags)
+	}
+	idx, err := parseXZIndex(data[size-xzFooterLen-indexSize:size-xzFooterLen], flags, size)
+	if err != nil {
+		t.Fatalf("parseXZIndex: %v", err)
+	}
+	return idx
+}
+
+func TestParseXZIndex(t *testing.T) {
+	data, plain := multiBlockXZ(t, 2000, 8*1024)
+	idx := parseTestIndex(t, data)
+
+	if len(idx.Blocks) < 3 {
+		t.Fatalf("got %d blocks, want several", len(idx.Blocks))
+	}
+
+	var uncompressed int64
+	for i, b := range idx.Blocks {
+		if b.UncompressedOffset != uncompressed {
+			t.Errorf("block %d UncompressedOffset = %d, want %d", i, b.UncompressedOffset, uncompressed)
+		}
+		uncompressed += b.UncompressedSize
+	}
+	if uncompressed != int64(len(plain)) {
+		t.Errorf("total uncompressed = %d, want %d", uncompressed, len(plain))
+	}
+	if idx.Blocks[0].Offset != xzHeaderLen {
+		t.Errorf("first block offset = %d, want %d", idx.Blocks[0].Offset, xzHeaderLen)
+	}
+}
+
+func TestParseXZIndex_RejectsTrailingData(t *testing.T) {
+	data, _ := multiBlockXZ(t, 100, 1024)
+	idx := parseTestIndex(t, data)
+
+	size := int64(len(data))
+	indexSize, _, _ := parseXZFooter(data[size-xzFooterLen:]) //nolint:errcheck // Validated above
+	index := data[size-xzFooterLen-indexSize : size-xzFooterLen]
+	if _, err := parseXZIndex(index, idx.Flags, size+4); err == nil {
+		t.Error("expected error for a file with stream padding")
+	}
+}
+
+func TestXZIndex_ResumeBlock(t *testing.T) {
+	idx := &xzIndex{Blocks: []xzBlock{
+		{UncompressedOffset: 0, UncompressedSize: 100},
+		{UncompressedOffset: 100, UncompressedSize: 100},
+		{UncompressedOffset: 200, UncompressedSize: 50},
+	}}
+
+	tests := []struct {
+		pos    int64
+		wantI  int
+		wantOK bool
+	}{
+		{0, 0, false},
+		{99, 0, false},
+		{100, 1, true},
+		{150, 1, true},
+		{249, 2, true},
+		{250, 2, true}, // end of file: resume in the last block
+	}
+
+	for _, tt := range tests {
+		i, ok := idx.resumeBlock(tt.pos)
+		if i != tt.wantI || ok != tt.wantOK {
+			t.Errorf("resumeBlock(%d) = %d, %v; want %d, %v", tt.pos, i, ok, tt.wantI, tt.wantOK)
+		}
+	}
+}
+
+func TestXZIndex_DecodeFromBlock(t *testing.T) {
+	data, plain := multiBlockXZ(t, 2000, 8*1024)
+	idx := parseTestIndex(t, data)
+
+	for _, i := range []int{1, len(idx.Blocks) / 2, len(idx.Blocks) - 1} {
+		t.Run(fmt.Sprintf("block %d", i), func(t *testing.T) {
+			b := idx.Blocks[i]
+			stream := io.MultiReader(
+				bytes.NewReader(data[:xzHeaderLen]),
+				bytes.NewReader(data[b.Offset:idx.IndexOffset]),
+				bytes.NewReader(idx.tailFrom(i)),
+			)
+			r, err := xz.NewReader(stream)
+			if err != nil {
+				t.Fatalf("xz reader: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("decode from block %d: %v", i, err)
+			}
+			if !bytes.Equal(got, plain[b.UncompressedOffset:]) {
+				t.Errorf("decoded %d bytes, want the %d bytes from offset %d", len(got), len(plain)-int(b.UncompressedOffset), b.UncompressedOffset)
+			}
+		})
+	}
+}
+
+// memRange serves ranges of an in-memory file and records what was fetched.
+type memRange struct {
+	data    []byte
+	fetched int64
+}
+
+func (m *memRange) fetch(_ context.Context, start, end int64) (io.ReadCloser, int64, error) {
+	if end < 0 {
+		end = int64(len(m.data)) - 1
+	}
+	m.fetched += end - start + 1
+	return io.NopCloser(bytes.NewReader(m.data[start : end+1])), int64(len(m.data)), nil
+}
+
+func TestOpenXZAt(t *testing.T) {
+	data, plain := multiBlockXZ(t, 2000, 8*1024)
+	idx := parseTestIndex(t, data)
+	last := idx.Blocks[len(idx.Blocks)-1]
+
+	for _, pos := range []int64{
+		idx.Blocks[1].UncompressedOffset,     // exactly on a block boundary
+		idx.Blocks[1].UncompressedOffset + 7, // just inside a block
+		last.UncompressedOffset + last.UncompressedSize/2,
+	} {
+		t.Run(fmt.Sprintf("offset %d", pos), func(t *testing.T) {
+			m := &memRange{data: data}
+			r, body, err := openXZAt(context.Background(), m.fetch, pos)
+			if err != nil {
+				t.Fatalf("openXZAt: %v", err)
+			}
+			defer body.Close() //nolint:errcheck // Close error not actionable
+
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(got, plain[pos:]) {
+				t.Errorf("got %d bytes, want the %d bytes from offset %d", len(got), len(plain)-int(pos), pos)
+			}
+			if m.fetched >= int64(len(data)) {
+				t.Errorf("fetched %d bytes, want less than the %d-byte file", m.fetched, len(data))
+			}
+		})
+	}
+}
+
+func TestOpenXZAt_FirstBlock(t *testing.T) {
+	data, _ := multiBlockXZ(t, 2000, 8*1024)
+	idx := parseTestIndex(t, data)
+
+	m := &memRange{data: data}
+	if _, _, err := openXZAt(context.Background(), m.fetch, idx.Blocks[1].UncompressedOffset-1); err == nil {
+		t.Error("openXZAt in the first block succeeded, want an error so the caller downloads the whole file")
+	}
+}
@@ -2,12 +2,22 @@
 package handlers
 
 import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 
 	"github.com/locplace/scanner/internal/coordinator/db"
 	"github.com/locplace/scanner/internal/coordinator/feeder"
@@ -18,8 +28,14 @@ import (
 type AdminHandlers struct {
 	DB               *db.DB
 	HeartbeatTimeout time.Duration
+	GitHubToken      string // Optional: authenticates file discovery against the GitHub API
+	Feeder           *feeder.Feeder
+	BatchSize        int // Domains per manual scan batch (defaults to DefaultManualBatchSize)
 }
 
+// DefaultManualBatchSize is the default number of domains per manual scan batch.
+const DefaultManualBatchSize = 1000
+
 // RegisterClient handles POST /api/admin/clients.
 func (h *AdminHandlers) RegisterClient(w http.ResponseWriter, r *http.Request) {
 	var req api.RegisterClientRequest
@@ -54,13 +70,40 @@ func (h *AdminHandlers) ListClients(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := time.Now()
+	sessions, err := h.DB.ListActiveSessions(r.Context(), h.HeartbeatTimeout)
+	if err != nil {
+		writeError(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildListClientsResponse(clients, sessions, h.HeartbeatTimeout, time.Now()))
+}
+
+// buildListClientsResponse reports each client with its live sessions.
+func buildListClientsResponse(clients []db.ClientWithStats, sessions []db.ScannerSession, heartbeatTimeout time.Duration, now time.Time) api.ListClientsResponse {
+	byClient := make(map[string][]api.SessionInfo)
+	for _, s := range sessions {
+		domains := s.ActiveDomains
+		if domains == nil {
+			domains = []string{}
+		}
+		byClient[s.ClientID] = append(byClient[s.ClientID], api.SessionInfo{
+			ID:            s.ID,
+			CreatedAt:     s.CreatedAt,
+			LastHeartbeat: s.LastHeartbeat,
+			ActiveDomains: domains,
+		})
+	}
+
 	resp := api.ListClientsResponse{
 		Clients: make([]api.ClientInfo, 0, len(clients)),
 	}
-
 	for _, c := range clients {
-		isAlive := c.LastHeartbeat != nil && now.Sub(*c.LastHeartbeat) < h.HeartbeatTimeout
+		isAlive := c.LastHeartbeat != nil && now.Sub(*c.LastHeartbeat) < heartbeatTimeout
+		clientSessions := byClient[c.ID]
+		if clientSessions == nil {
+			clientSessions = []api.SessionInfo{}
+		}
 		resp.Clients = append(resp.Clients, api.ClientInfo{
 			ID:            c.ID,
 			Name:          c.Name,
@@ -68,10 +111,11 @@ func (h *AdminHandlers) ListClients(w http.ResponseWriter, r *http.Request) {
 			LastHeartbeat: c.LastHeartbeat,
 			ActiveBatches: c.ActiveBatches,
 			IsAlive:       isAlive,
+			Disabled:      c.Disabled,
+			Sessions:      clientSessions,
 		})
 	}
-
-	writeJSON(w, http.StatusOK, resp)
+	return resp
 }
 
 // DeleteClient handles DELETE /api/admin/clients/{id}.
@@ -91,10 +135,336 @@ func (h *AdminHandlers) DeleteClient(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RotateClientToken handles POST /api/admin/clients/{id}/rotate-token.
+// Issues a new token for an existing client; the old token stops working immediately.
+func (h *AdminHandlers) RotateClientToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := clientID(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := h.DB.RotateClientToken(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "client not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to rotate token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.RotateClientTokenResponse{
+		ID:    id,
+		Token: token,
+	})
+}
+
+// DisableClient handles POST /api/admin/clients/{id}/disable.
+// The client is kept (with its history) but can no longer authenticate.
+func (h *AdminHandlers) DisableClient(w http.ResponseWriter, r *http.Request) {
+	h.setClientDisabled(w, r, true)
+}
+
+// EnableClient handles POST /api/admin/clients/{id}/enable.
+func (h *AdminHandlers) EnableClient(w http.ResponseWriter, r *http.Request) {
+	h.setClientDisabled(w, r, false)
+}
+
+func (h *AdminHandlers) setClientDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := clientID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.SetClientDisabled(r.Context(), id, disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "client not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to update client", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientID returns the {id} URL parameter in canonical UUID form. If it's
+// missing it writes a 400; if it isn't a UUID it can't name a client, so it
+// writes a 404 rather than letting the database reject it as a 500.
+func clientID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, "client id is required", http.StatusBadRequest)
+		return "", false
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		writeError(w, "client not found", http.StatusNotFound)
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// ListFailedBatches handles GET /api/admin/batches/failed.
+// Lists quarantined batches, including their domains, so operators can find
+// the lines that keep failing.
+func (h *AdminHandlers) ListFailedBatches(w http.ResponseWriter, r *http.Request) {
+	limit := min(parseIntParam(r, "limit", 50), 500)
+	offset := parseIntParam(r, "offset", 0)
+
+	batches, total, err := h.DB.ListQuarantinedBatches(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, "failed to list batches", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.ListFailedBatchesResponse{
+		Batches: make([]api.FailedBatch, 0, len(batches)),
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	for _, b := range batches {
+		resp.Batches = append(resp.Batches, failedBatchInfo(b))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// BatchQueueStats handles GET /api/admin/batches/stats.
+// Reports queue depth and the age of the oldest pending and in_flight
+// batches, overall and per file.
+func (h *AdminHandlers) BatchQueueStats(w http.ResponseWriter, r *http.Request) {
+	q, err := h.DB.GetQueueDepth(r.Context())
+	if err != nil {
+		writeError(w, "failed to get queue stats", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildBatchQueueStatsResponse(q))
+}
+
+// buildBatchQueueStatsResponse totals the per-file queue depth, measuring
+// ages against the snapshot's database time.
+func buildBatchQueueStatsResponse(q db.QueueDepth) api.BatchQueueStatsResponse {
+	resp := api.BatchQueueStatsResponse{
+		Files: make([]api.FileQueueStats, 0, len(q.Files)),
+	}
+	for _, f := range q.Files {
+		fs := api.FileQueueStats{
+			FileID:                   f.FileID,
+			Filename:                 f.Filename,
+			Pending:                  f.Pending,
+			InFlight:                 f.InFlight,
+			OldestPendingAgeSeconds:  ageSeconds(f.OldestPending, q.Now),
+			OldestInFlightAgeSeconds: ageSeconds(f.OldestInFlight, q.Now),
+		}
+		resp.Files = append(resp.Files, fs)
+
+		resp.Pending += fs.Pending
+		resp.InFlight += fs.InFlight
+		resp.OldestPendingAgeSeconds = max(resp.OldestPendingAgeSeconds, fs.OldestPendingAgeSeconds)
+		resp.OldestInFlightAgeSeconds = max(resp.OldestInFlightAgeSeconds, fs.OldestInFlightAgeSeconds)
+	}
+	return resp
+}
+
+// ageSeconds returns how many seconds before now t was, or zero if t is
+// nil or in the future.
+func ageSeconds(t *time.Time, now time.Time) float64 {
+	if t == nil {
+		return 0
+	}
+	return max(now.Sub(*t).Seconds(), 0)
+}
+
+// failedBatchInfo converts a quarantined batch to its API representation.
+func failedBatchInfo(b db.FailedBatch) api.FailedBatch {
+	return api.FailedBatch{
+		BatchID:   b.ID,
+		FileID:    b.FileID,
+		Filename:  b.Filename,
+		LineStart: b.LineStart,
+		LineEnd:   b.LineEnd,
+		Attempts:  b.Attempts,
+		Domains:   splitDomains(b.Domains),
+	}
+}
+
+// RequeueBatch handles POST /api/admin/batches/{id}/requeue.
+// Returns a quarantined batch to the queue with its attempt count reset.
+func (h *AdminHandlers) RequeueBatch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, "invalid batch id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.RequeueBatch(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "quarantined batch not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to requeue batch", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteRecord handles DELETE /api/admin/records/{fqdn}.
+// Removes a bogus LOC record from the dataset.
+func (h *AdminHandlers) DeleteRecord(w http.ResponseWriter, r *http.Request) {
+	fqdn := chi.URLParam(r, "fqdn")
+	if fqdn == "" {
+		writeError(w, "fqdn is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.DeleteLOCRecordByFQDN(r.Context(), fqdn)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "record not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to delete record", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PatchRecord handles PATCH /api/admin/records/{fqdn}.
+// Corrects a record's coordinates and returns the updated record.
+func (h *AdminHandlers) PatchRecord(w http.ResponseWriter, r *http.Request) {
+	fqdn := chi.URLParam(r, "fqdn")
+	if fqdn == "" {
+		writeError(w, "fqdn is required", http.StatusBadRequest)
+		return
+	}
+
+	var req api.PatchLOCRecordRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateRecordPatch(req); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.DB.CorrectLOCRecord(r.Context(), fqdn, req)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "record not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to update record", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// validateRecordPatch checks that a patch sets at least one field and that
+// any coordinates it sets are in range.
+func validateRecordPatch(req api.PatchLOCRecordRequest) error {
+	if req.Latitude == nil && req.Longitude == nil && req.AltitudeM == nil {
+		return errors.New("at least one of latitude, longitude, altitude_m is required")
+	}
+	if req.Latitude != nil && (*req.Latitude < -90 || *req.Latitude > 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if req.Longitude != nil && (*req.Longitude < -180 || *req.Longitude > 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// ListDenylist handles GET /api/admin/denylist.
+func (h *AdminHandlers) ListDenylist(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.DB.ListDenylist(r.Context())
+	if err != nil {
+		writeError(w, "failed to list denylist", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.ListDenylistResponse{Entries: make([]api.DenylistEntry, 0, len(entries))}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, api.DenylistEntry{
+			Pattern:   e.Pattern,
+			Reason:    e.Reason,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// AddDenylistEntry handles POST /api/admin/denylist.
+// Denied domains are no longer queued by the feeder and their LOC records are
+// dropped on submission. Records already stored are left alone.
+func (h *AdminHandlers) AddDenylistEntry(w http.ResponseWriter, r *http.Request) {
+	var req api.AddDenylistEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pattern, err := db.NormalizeDenyPattern(req.Pattern)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.AddDenylistEntry(r.Context(), pattern, req.Reason); err != nil {
+		writeError(w, "failed to add denylist entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveDenylistEntry handles DELETE /api/admin/denylist/{pattern}.
+func (h *AdminHandlers) RemoveDenylistEntry(w http.ResponseWriter, r *http.Request) {
+	pattern, err := db.NormalizeDenyPattern(chi.URLParam(r, "pattern"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.RemoveDenylistEntry(r.Context(), pattern)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "denylist entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to remove denylist entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // DiscoverFiles handles POST /api/admin/discover-files.
 // Fetches the domain file list from GitHub and updates the database.
 func (h *AdminHandlers) DiscoverFiles(w http.ResponseWriter, r *http.Request) {
-	count, err := feeder.DiscoverAndInsertFiles(r.Context(), h.DB)
+	if h.Feeder == nil {
+		writeError(w, "feeder disabled", http.StatusServiceUnavailable)
+		return
+	}
+	count, err := feeder.DiscoverAndInsertFiles(r.Context(), h.DB, h.GitHubToken)
+	var rateErr *feeder.RateLimitError
+	if errors.As(err, &rateErr) {
+		if !rateErr.Reset.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(max(int(time.Until(rateErr.Reset).Seconds()), 1)))
+		}
+		writeError(w, "failed to discover files: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		writeError(w, "failed to discover files: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -105,6 +475,27 @@ func (h *AdminHandlers) DiscoverFiles(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// PauseFeeder handles POST /api/admin/feeder/pause.
+// Stops new batches being created; queued and in-flight batches still complete.
+func (h *AdminHandlers) PauseFeeder(w http.ResponseWriter, _ *http.Request) {
+	if h.Feeder == nil {
+		writeError(w, "feeder not configured", http.StatusServiceUnavailable)
+		return
+	}
+	h.Feeder.Pause()
+	writeJSON(w, http.StatusOK, api.FeederStateResponse{Paused: true})
+}
+
+// ResumeFeeder handles POST /api/admin/feeder/resume.
+func (h *AdminHandlers) ResumeFeeder(w http.ResponseWriter, _ *http.Request) {
+	if h.Feeder == nil {
+		writeError(w, "feeder not configured", http.StatusServiceUnavailable)
+		return
+	}
+	h.Feeder.Resume()
+	writeJSON(w, http.StatusOK, api.FeederStateResponse{Paused: false})
+}
+
 // ResetScan handles POST /api/admin/reset-scan.
 // Resets all files to pending status for a full re-scan.
 func (h *AdminHandlers) ResetScan(w http.ResponseWriter, r *http.Request) {
@@ -127,47 +518,221 @@ func (h *AdminHandlers) ResetScan(w http.ResponseWriter, r *http.Request) {
 }
 
 // ManualScan handles POST /api/admin/manual-scan.
-// Queues a list of domains for scanning as a single batch.
+// Queues a list of domains for scanning, split into batches of BatchSize.
+// The list is either a JSON api.ManualScanRequest or, with Content-Type
+// text/plain, one domain per line.
 func (h *AdminHandlers) ManualScan(w http.ResponseWriter, r *http.Request) {
-	var req api.ManualScanRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	domains, err := readManualScanDomains(r)
+	if err != nil {
 		writeError(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Domains) == 0 {
+	if len(domains) == 0 {
 		writeError(w, "at least one domain is required", http.StatusBadRequest)
 		return
 	}
 
-	// Clean up domains: trim whitespace, skip empty lines
-	var cleanDomains []string
-	for _, d := range req.Domains {
+	cleanDomains := cleanManualDomains(domains)
+	if len(cleanDomains) == 0 {
+		writeError(w, "no valid domains provided", http.StatusBadRequest)
+		return
+	}
+
+	batches := splitManualBatches(cleanDomains, h.BatchSize)
+	if err := h.DB.CreateManualBatches(r.Context(), batches); err != nil {
+		writeError(w, "failed to queue domains: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.ManualScanResponse{
+		DomainsQueued:  len(cleanDomains),
+		BatchesCreated: len(batches),
+	})
+}
+
+// readManualScanDomains reads the submitted domain list from a JSON or
+// text/plain request body.
+func readManualScanDomains(r *http.Request) ([]string, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		var domains []string
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			domains = append(domains, sc.Text())
+		}
+		return domains, sc.Err()
+	}
+
+	var req api.ManualScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req.Domains, nil
+}
+
+// splitManualBatches splits domains into batches of at most size domains
+// (DefaultManualBatchSize if size isn't positive).
+func splitManualBatches(domains []string, size int) [][]string {
+	if size <= 0 {
+		size = DefaultManualBatchSize
+	}
+	return slices.Collect(slices.Chunk(domains, size))
+}
+
+// cleanManualDomains trims whitespace and drops blank and # comment lines.
+func cleanManualDomains(domains []string) []string {
+	var clean []string
+	for _, d := range domains {
 		d = strings.TrimSpace(d)
 		if d != "" && !strings.HasPrefix(d, "#") {
-			cleanDomains = append(cleanDomains, d)
+			clean = append(clean, d)
 		}
 	}
+	return clean
+}
 
-	if len(cleanDomains) == 0 {
-		writeError(w, "no valid domains provided", http.StatusBadRequest)
+// Coverage handles GET /api/admin/coverage.
+// Returns per-file scan outcomes as JSON, or CSV with ?format=csv.
+func (h *AdminHandlers) Coverage(w http.ResponseWriter, r *http.Request) {
+	files, err := h.DB.GetCoverageReport(r.Context())
+	if err != nil {
+		writeError(w, "failed to get coverage report", http.StatusInternalServerError)
 		return
 	}
 
-	// Create the batch
-	domainsStr := strings.Join(cleanDomains, "\n")
-	if err := h.DB.CreateManualBatch(r.Context(), domainsStr); err != nil {
-		writeError(w, "failed to queue domains: "+err.Error(), http.StatusInternalServerError)
+	resp := api.CoverageReportResponse{
+		Files: make([]api.FileCoverage, 0, len(files)),
+	}
+	for _, f := range files {
+		resp.Files = append(resp.Files, fileCoverageInfo(f))
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="coverage.csv"`)
+		w.WriteHeader(http.StatusOK)
+		_ = writeCoverageCSV(w, resp.Files) // Error is client disconnect, can't recover
 		return
 	}
 
-	writeJSON(w, http.StatusOK, api.ManualScanResponse{
-		DomainsQueued: len(cleanDomains),
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// fileCoverageInfo converts a file's coverage to its API representation.
+func fileCoverageInfo(f db.FileCoverage) api.FileCoverage {
+	return api.FileCoverage{
+		ID:               f.ID,
+		Filename:         f.Filename,
+		Status:           f.Status,
+		SizeBytes:        f.SizeBytes,
+		DomainsFed:       f.LinesFed,
+		BatchesCreated:   f.BatchesCreated,
+		BatchesCompleted: f.BatchesCompleted,
+		LOCRecords:       f.LOCRecords,
+		StartedAt:        f.StartedAt,
+		CompletedAt:      f.CompletedAt,
+	}
+}
+
+// ListFiles handles GET /api/admin/files.
+// Lists domain files with their LOC record yield, highest first, to help
+// pick files worth re-scanning. ?status= limits it to pending, processing
+// or complete files.
+func (h *AdminHandlers) ListFiles(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "processing", "complete":
+	default:
+		writeError(w, "status must be pending, processing or complete", http.StatusBadRequest)
+		return
+	}
+
+	files, err := h.DB.GetCoverageReport(r.Context())
+	if err != nil {
+		writeError(w, "failed to list files", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildListFilesResponse(files, status))
+}
+
+// buildListFilesResponse computes each file's yield and the totals over the
+// files matching status (all files if empty), ordered by yield descending.
+func buildListFilesResponse(files []db.FileCoverage, status string) api.ListFilesResponse {
+	resp := api.ListFilesResponse{Files: []api.FileYield{}}
+	for _, f := range files {
+		if status != "" && f.Status != status {
+			continue
+		}
+		fc := fileCoverageInfo(f)
+		resp.Files = append(resp.Files, api.FileYield{
+			FileCoverage:  fc,
+			LOCPerMillion: locPerMillion(fc.LOCRecords, fc.DomainsFed),
+		})
+		resp.DomainsFed += fc.DomainsFed
+		resp.LOCRecords += fc.LOCRecords
+	}
+	resp.LOCPerMillion = locPerMillion(resp.LOCRecords, resp.DomainsFed)
+
+	slices.SortStableFunc(resp.Files, func(a, b api.FileYield) int {
+		return cmp.Compare(b.LOCPerMillion, a.LOCPerMillion)
 	})
+	return resp
+}
+
+// locPerMillion returns LOC records found per million domains fed, or zero
+// if nothing has been fed.
+func locPerMillion(records int, domains int64) float64 {
+	if domains <= 0 {
+		return 0
+	}
+	return float64(records) / float64(domains) * 1e6
+}
+
+// writeCoverageCSV writes the coverage report as CSV with a header row.
+func writeCoverageCSV(w io.Writer, files []api.FileCoverage) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"id", "filename", "status", "size_bytes", "domains_fed",
+		"batches_created", "batches_completed", "loc_records", "started_at", "completed_at",
+	}); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		size := ""
+		if f.SizeBytes != nil {
+			size = strconv.FormatInt(*f.SizeBytes, 10)
+		}
+		if err := cw.Write([]string{
+			strconv.Itoa(f.ID),
+			f.Filename,
+			f.Status,
+			size,
+			strconv.FormatInt(f.DomainsFed, 10),
+			strconv.Itoa(f.BatchesCreated),
+			strconv.Itoa(f.BatchesCompleted),
+			strconv.Itoa(f.LOCRecords),
+			formatOptionalTime(f.StartedAt),
+			formatOptionalTime(f.CompletedAt),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
 }
 
 // Helper functions
 
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -1,12 +1,28 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+	"github.com/locplace/scanner/internal/coordinator/feeder"
+	"github.com/locplace/scanner/internal/coordinator/middleware"
 	"github.com/locplace/scanner/pkg/api"
 )
 
@@ -477,3 +493,1480 @@ func TestLOCRecord_Parsing(t *testing.T) {
 		})
 	}
 }
+
+func TestParseBBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *db.BoundingBox
+		wantErr bool
+	}{
+		{
+			name:  "empty means no filter",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "normal box",
+			input: "4.5,52.0,5.5,53.0",
+			want:  &db.BoundingBox{MinLon: 4.5, MinLat: 52.0, MaxLon: 5.5, MaxLat: 53.0},
+		},
+		{
+			name:  "anti-meridian box",
+			input: "170,-20,-170,20",
+			want:  &db.BoundingBox{MinLon: 170, MinLat: -20, MaxLon: -170, MaxLat: 20},
+		},
+		{
+			name:    "too few values",
+			input:   "1,2,3",
+			wantErr: true,
+		},
+		{
+			name:    "non-numeric value",
+			input:   "a,2,3,4",
+			wantErr: true,
+		},
+		{
+			name:    "longitude out of range",
+			input:   "-181,0,10,10",
+			wantErr: true,
+		},
+		{
+			name:    "latitude out of range",
+			input:   "0,-91,10,10",
+			wantErr: true,
+		},
+		{
+			name:    "inverted latitude",
+			input:   "0,10,10,0",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBBox(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseBBox(%q) expected error, got %+v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBBox(%q) unexpected error: %v", tt.input, err)
+			}
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("parseBBox(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+			if got != nil && *got != *tt.want {
+				t.Errorf("parseBBox(%q) = %+v, want %+v", tt.input, *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicHandlers_InvalidBBox(t *testing.T) {
+	// Validation happens before any database access, so no DB is needed
+	h := &PublicHandlers{}
+
+	for _, path := range []string{"/api/public/records?bbox=1,2,3", "/api/public/records.geojson?bbox=x,0,1,1"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		if strings.Contains(path, "geojson") {
+			h.GetRecordsGeoJSON(rr, req)
+		} else {
+			h.ListRecords(rr, req)
+		}
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: status code = %d, want %d", path, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestPublicHandlers_SearchTooLong(t *testing.T) {
+	h := &PublicHandlers{} // Rejected before any database access
+
+	req := httptest.NewRequest(http.MethodGet, "/api/public/records?search="+strings.Repeat("a", 254), nil)
+	rr := httptest.NewRecorder()
+	h.ListRecords(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestParseAltitudeRange(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		query   string
+		wantMin *float64
+		wantMax *float64
+		wantErr bool
+	}{
+		{"", nil, nil, false},
+		{"min_altitude_m=-420", f(-420), nil, false},
+		{"max_altitude_m=0", nil, f(0), false},
+		{"min_altitude_m=0&max_altitude_m=8848", f(0), f(8848), false},
+		{"min_altitude_m=-10&max_altitude_m=-10", f(-10), f(-10), false},
+		{"min_altitude_m=100&max_altitude_m=-100", nil, nil, true},
+		{"min_altitude_m=high", nil, nil, true},
+		{"max_altitude_m=Inf", nil, nil, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/public/records?"+tt.query, nil)
+		gotMin, gotMax, err := parseAltitudeRange(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAltitudeRange(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		eq := func(a, b *float64) bool { return (a == nil) == (b == nil) && (a == nil || *a == *b) }
+		if !eq(gotMin, tt.wantMin) || !eq(gotMax, tt.wantMax) {
+			t.Errorf("parseAltitudeRange(%q) = %v, %v; want %v, %v", tt.query, gotMin, gotMax, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestParseNearParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"lat=52.37&lon=4.89&radius_km=10", false},
+		{"lat=-90&lon=180&radius_km=1000", false},
+		{"lon=4.89&radius_km=10", true},
+		{"lat=52.37&lon=4.89", true},
+		{"lat=abc&lon=4.89&radius_km=10", true},
+		{"lat=NaN&lon=4.89&radius_km=10", true},
+		{"lat=91&lon=4.89&radius_km=10", true},
+		{"lat=52.37&lon=-181&radius_km=10", true},
+		{"lat=52.37&lon=4.89&radius_km=0", true},
+		{"lat=52.37&lon=4.89&radius_km=1001", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/public/records/near?"+tt.query, nil)
+		_, _, _, err := parseNearParams(req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNearParams(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "empty uses default window",
+			input: "",
+			want:  now.Add(-defaultHistoryWindow),
+		},
+		{
+			name:  "relative duration",
+			input: "24h",
+			want:  now.Add(-24 * time.Hour),
+		},
+		{
+			name:  "absolute timestamp",
+			input: "2025-05-01T00:00:00Z",
+			want:  time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "future timestamp",
+			input:   "2025-07-01T00:00:00Z",
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			input:   "-1h",
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			input:   "yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSince(tt.input, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSince(%q) expected error, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSince(%q) unexpected error: %v", tt.input, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseSince(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCoverageCSV(t *testing.T) {
+	size := int64(2048)
+	started := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := []api.FileCoverage{
+		{
+			ID:               1,
+			Filename:         "data/france/domain2multi-fr00.txt.xz",
+			Status:           "complete",
+			SizeBytes:        &size,
+			DomainsFed:       5000,
+			BatchesCreated:   5,
+			BatchesCompleted: 5,
+			LOCRecords:       3,
+			StartedAt:        &started,
+		},
+		{
+			ID:       2,
+			Filename: "__manual_submissions__",
+			Status:   "complete",
+		},
+	}
+
+	var buf strings.Builder
+	if err := writeCoverageCSV(&buf, files); err != nil {
+		t.Fatalf("writeCoverageCSV() error: %v", err)
+	}
+
+	want := "id,filename,status,size_bytes,domains_fed,batches_created,batches_completed,loc_records,started_at,completed_at\n" +
+		"1,data/france/domain2multi-fr00.txt.xz,complete,2048,5000,5,5,3,2025-01-02T03:04:05Z,\n" +
+		"2,__manual_submissions__,complete,,0,0,0,0,,\n"
+	if buf.String() != want {
+		t.Errorf("CSV output =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestGeoJSONETag(t *testing.T) {
+	seen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := seen.Add(time.Second)
+
+	base := geoJSONETag(10, &seen, "")
+	// Weak, as gzip and identity responses share it
+	if !strings.HasPrefix(base, `W/"`) || !strings.HasSuffix(base, `"`) {
+		t.Errorf("ETag %s is not a quoted weak validator", base)
+	}
+	if geoJSONETag(10, &seen, "") != base {
+		t.Error("ETag is not deterministic")
+	}
+	if geoJSONETag(11, &seen, "") == base {
+		t.Error("ETag should change with record count")
+	}
+	if geoJSONETag(10, &later, "") == base {
+		t.Error("ETag should change with last_seen_at")
+	}
+	if geoJSONETag(10, &seen, "bbox=0,0,1,1") == base {
+		t.Error("ETag should change with query")
+	}
+	if geoJSONETag(0, nil, "") == "" {
+		t.Error("ETag should be set for an empty dataset")
+	}
+}
+
+func TestCheckNotModified(t *testing.T) {
+	const etag = `"abc123"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantWritten bool
+	}{
+		{name: "no header returns 200 with ETag", ifNoneMatch: "", wantWritten: false},
+		{name: "matching ETag returns 304", ifNoneMatch: etag, wantWritten: true},
+		{name: "stale ETag returns 200", ifNoneMatch: `"old"`, wantWritten: false},
+		{name: "match in list", ifNoneMatch: `"old", "abc123"`, wantWritten: true},
+		{name: "weak comparison", ifNoneMatch: `W/"abc123"`, wantWritten: true},
+		{name: "wildcard", ifNoneMatch: "*", wantWritten: true},
+	}
+	weak := []struct {
+		name        string
+		ifNoneMatch string
+		wantWritten bool
+	}{
+		{name: "weak tag matches itself", ifNoneMatch: `W/"abc123"`, wantWritten: true},
+		{name: "weak tag matches stripped tag", ifNoneMatch: `"abc123"`, wantWritten: true},
+		{name: "weak tag stale", ifNoneMatch: `W/"old"`, wantWritten: false},
+	}
+	for _, tt := range weak {
+		req := httptest.NewRequest(http.MethodGet, "/api/public/records.geojson", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		if got := checkNotModified(httptest.NewRecorder(), req, `W/"abc123"`); got != tt.wantWritten {
+			t.Errorf("%s: checkNotModified() = %v, want %v", tt.name, got, tt.wantWritten)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/public/records.geojson", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rr := httptest.NewRecorder()
+
+			written := checkNotModified(rr, req, etag)
+			if written != tt.wantWritten {
+				t.Errorf("checkNotModified() = %v, want %v", written, tt.wantWritten)
+			}
+			if got := rr.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag header = %q, want %q", got, etag)
+			}
+			if tt.wantWritten && rr.Code != http.StatusNotModified {
+				t.Errorf("status code = %d, want %d", rr.Code, http.StatusNotModified)
+			}
+			if tt.wantWritten && rr.Body.Len() != 0 {
+				t.Errorf("304 response should have empty body, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestGeoJSONStream(t *testing.T) {
+	seen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	locations := []api.AggregatedLocation{
+		{FQDNs: []string{"a.example.com", "b.example.com"}, RootDomains: []string{"example.com"}, RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m", Latitude: 52.373, Longitude: 4.892, AltitudeM: -2, Count: 2, FirstSeenAt: seen, LastSeenAt: seen},
+		{FQDNs: []string{"nikhef.nl"}, RootDomains: []string{"nikhef.nl"}, RawRecord: "52 21 23.000 N 4 57 22.000 E 0.00m", Latitude: 52.356, Longitude: 4.956, Count: 1, FirstSeenAt: seen, LastSeenAt: seen},
+	}
+
+	tests := []struct {
+		name      string
+		locations []api.AggregatedLocation
+	}{
+		{"empty", nil},
+		{"single", locations[:1]},
+		{"multiple", locations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			stream := newGeoJSONStream(&buf)
+			want := api.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []api.GeoJSONFeature{}}
+			for _, loc := range tt.locations {
+				f := geoJSONFeature(loc, false)
+				if err := stream.WriteFeature(f); err != nil {
+					t.Fatalf("WriteFeature: %v", err)
+				}
+				want.Features = append(want.Features, f)
+			}
+			if err := stream.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			var got api.GeoJSONFeatureCollection
+			if err := json.Unmarshal([]byte(buf.String()), &got); err != nil {
+				t.Fatalf("streamed output is not valid JSON: %v\n%s", err, buf.String())
+			}
+
+			// Re-marshal both sides so property types (e.g. time.Time vs string) compare equal
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("streamed collection differs\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestStreamGeoJSONL(t *testing.T) {
+	seen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []api.PublicLOCRecord{
+		{FQDN: "a.example.com", RootDomain: "example.com", RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m", Latitude: 52.373, Longitude: 4.892, AltitudeM: -2, FirstSeenAt: seen, LastSeenAt: seen},
+		{FQDN: "b.example.com", RootDomain: "example.com", RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m", Latitude: 52.373, Longitude: 4.892, AltitudeM: -2, FirstSeenAt: seen, LastSeenAt: seen},
+		{FQDN: "nikhef.nl", RootDomain: "nikhef.nl", RawRecord: "52 21 23.000 N 4 57 22.000 E 0.00m", Latitude: 52.356, Longitude: 4.956, FirstSeenAt: seen, LastSeenAt: seen},
+	}
+
+	rr := httptest.NewRecorder()
+	streamGeoJSONL(rr, true, func(fn func(api.PublicLOCRecord) error) error {
+		for _, rec := range records {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if len(lines) != len(records) {
+		t.Fatalf("got %d lines, want one per record (%d):\n%s", len(lines), len(records), rr.Body.String())
+	}
+	for i, line := range lines {
+		var f api.GeoJSONFeature
+		if err := json.Unmarshal([]byte(line), &f); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v\n%s", i, err, line)
+		}
+		if f.Type != "Feature" || f.Geometry.Type != "Point" {
+			t.Errorf("line %d: type %q with %q geometry, want a Point Feature", i, f.Type, f.Geometry.Type)
+		}
+		if f.Properties["fqdn"] != records[i].FQDN {
+			t.Errorf("line %d: fqdn = %v, want %s", i, f.Properties["fqdn"], records[i].FQDN)
+		}
+		if got := f.Geometry.Coordinates; got[0] != records[i].Longitude || got[1] != records[i].Latitude {
+			t.Errorf("line %d: coordinates = %v, want lon %v lat %v", i, got, records[i].Longitude, records[i].Latitude)
+		}
+	}
+}
+
+func TestStreamGeoJSONL_QueryError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	streamGeoJSONL(rr, false, func(func(api.PublicLOCRecord) error) error {
+		return errors.New("connection reset")
+	})
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500 when the query fails before any record", rr.Code)
+	}
+}
+
+func TestGeoJSONFeature_Altitude(t *testing.T) {
+	ground := api.AggregatedLocation{Latitude: 52.356, Longitude: 4.956}
+	raised := api.AggregatedLocation{Latitude: 52.373, Longitude: 4.892, AltitudeM: -2}
+
+	tests := []struct {
+		name            string
+		loc             api.AggregatedLocation
+		includeAltitude bool
+		wantCoords      []float64
+	}{
+		{"zero altitude stays 2D", ground, true, []float64{4.956, 52.356}},
+		{"non-zero altitude is 3D", raised, true, []float64{4.892, 52.373, -2}},
+		{"altitude not requested", raised, false, []float64{4.892, 52.373}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := geoJSONFeature(tt.loc, tt.includeAltitude)
+			got := f.Geometry.Coordinates
+			if len(got) != len(tt.wantCoords) {
+				t.Fatalf("coordinates = %v, want %v", got, tt.wantCoords)
+			}
+			for i := range got {
+				if got[i] != tt.wantCoords[i] {
+					t.Errorf("coordinates = %v, want %v", got, tt.wantCoords)
+				}
+			}
+			_, hasDatum := f.Properties["altitude_datum"]
+			if hasDatum != (len(tt.wantCoords) == 3) {
+				t.Errorf("altitude_datum present = %v, want %v", hasDatum, len(tt.wantCoords) == 3)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_InvalidClientID(t *testing.T) {
+	// A non-UUID id can't name a client; it's rejected before any database access
+	h := &AdminHandlers{}
+	r := chi.NewRouter()
+	r.Post("/clients/{id}/rotate-token", h.RotateClientToken)
+	r.Post("/clients/{id}/disable", h.DisableClient)
+	r.Post("/clients/{id}/enable", h.EnableClient)
+
+	for _, path := range []string{"/clients/not-a-uuid/rotate-token", "/clients/not-a-uuid/disable", "/clients/not-a-uuid/enable"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: status code = %d, want %d", path, rr.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestAdminHandlers_RotateClientToken_ReplacesToken(t *testing.T) {
+	database := dbtest.Open(t)
+
+	id, oldToken, err := database.CreateClient(context.Background(), "rotate-token-test")
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	t.Cleanup(func() { _ = database.DeleteClient(context.Background(), id) })
+
+	h := &AdminHandlers{DB: database}
+	r := chi.NewRouter()
+	r.Post("/clients/{id}/rotate-token", h.RotateClientToken)
+	r.With(middleware.ScannerAuth(database)).Get("/scanner", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/clients/"+id+"/rotate-token", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rotate status code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp api.RotateClientTokenResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ID != id {
+		t.Errorf("ID = %q, want %q", resp.ID, id)
+	}
+
+	authStatus := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/scanner", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if got := authStatus(oldToken); got != http.StatusUnauthorized {
+		t.Errorf("old token: status code = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := authStatus(resp.Token); got != http.StatusNoContent {
+		t.Errorf("new token: status code = %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestEmptyQueueRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats db.DomainFileStats
+		want  int
+	}{
+		{"files pending", db.DomainFileStats{Total: 10, Pending: 5, Complete: 5}, retryAfterFeeding},
+		{"file processing", db.DomainFileStats{Total: 10, Processing: 1, Complete: 9}, retryAfterFeeding},
+		{"all complete", db.DomainFileStats{Total: 10, Complete: 10}, retryAfterIdle},
+		{"no files discovered", db.DomainFileStats{}, retryAfterIdle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := emptyQueueRetryAfter(&tt.stats)
+			if got != tt.want {
+				t.Errorf("emptyQueueRetryAfter() = %d, want %d", got, tt.want)
+			}
+			if got <= 0 || got > 3600 {
+				t.Errorf("emptyQueueRetryAfter() = %d, not a sane wait", got)
+			}
+		})
+	}
+}
+
+func TestClampBatchCount(t *testing.T) {
+	tests := []struct {
+		requested int
+		want      int
+	}{
+		{0, 1},
+		{-3, 1},
+		{1, 1},
+		{5, 5},
+		{maxBatchesPerRequest, maxBatchesPerRequest},
+		{1000, maxBatchesPerRequest},
+	}
+	for _, tt := range tests {
+		if got := clampBatchCount(tt.requested); got != tt.want {
+			t.Errorf("clampBatchCount(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBatchResponse(t *testing.T) {
+	claimed := []db.ScanBatch{
+		{ID: 7, Domains: "a.example.com\nb.example.com\n"},
+		{ID: 8, Domains: "c.example.com"},
+	}
+
+	t.Run("single batch keeps legacy shape", func(t *testing.T) {
+		resp := buildBatchResponse(claimed[:1], 1)
+		if resp.BatchID != 7 || len(resp.Domains) != 2 {
+			t.Errorf("resp = %+v, want batch 7 with 2 domains", resp)
+		}
+		if resp.Batches != nil {
+			t.Errorf("Batches = %v, want nil for single-batch request", resp.Batches)
+		}
+	})
+
+	t.Run("fewer claimed than requested", func(t *testing.T) {
+		resp := buildBatchResponse(claimed, 5)
+		if resp.BatchID != 0 || len(resp.Domains) != 0 {
+			t.Errorf("legacy fields set in multi-batch response: %+v", resp)
+		}
+		if len(resp.Batches) != 2 {
+			t.Fatalf("len(Batches) = %d, want 2", len(resp.Batches))
+		}
+		if resp.Batches[0].BatchID != 7 || len(resp.Batches[0].Domains) != 2 {
+			t.Errorf("Batches[0] = %+v", resp.Batches[0])
+		}
+		if resp.Batches[1].BatchID != 8 || resp.Batches[1].Domains[0] != "c.example.com" {
+			t.Errorf("Batches[1] = %+v", resp.Batches[1])
+		}
+	})
+}
+
+func TestFailedBatchInfo(t *testing.T) {
+	b := db.FailedBatch{
+		ScanBatch: db.ScanBatch{
+			ID:        42,
+			FileID:    3,
+			LineStart: 1001,
+			LineEnd:   2000,
+			Domains:   "bad.example.com\nworse.example.com\n",
+			Status:    "quarantined",
+			Attempts:  5,
+		},
+		Filename: "data/example/domain2multi-ex00.txt.xz",
+	}
+
+	got := failedBatchInfo(b)
+	if got.BatchID != 42 || got.FileID != 3 || got.Filename != b.Filename {
+		t.Errorf("identity fields = %+v", got)
+	}
+	if got.LineStart != 1001 || got.LineEnd != 2000 || got.Attempts != 5 {
+		t.Errorf("line range/attempts = %+v", got)
+	}
+	if len(got.Domains) != 2 || got.Domains[0] != "bad.example.com" || got.Domains[1] != "worse.example.com" {
+		t.Errorf("Domains = %v", got.Domains)
+	}
+}
+
+func TestAdminHandlers_RequeueBatch_InvalidID(t *testing.T) {
+	h := &AdminHandlers{} // nil DB is fine: invalid IDs are rejected before any query
+
+	for _, id := range []string{"", "abc", "0", "-1"} {
+		t.Run(id, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", id)
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/batches/x/requeue", nil)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+
+			h.RequeueBatch(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestBatchAlreadyCompleted(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"completed now", nil, false},
+		{"already completed", pgx.ErrNoRows, true},
+		{"wrapped", fmt.Errorf("complete batch: %w", pgx.ErrNoRows), true},
+		{"database error", errors.New("connection reset"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := batchAlreadyCompleted(tt.err); got != tt.want {
+				t.Errorf("batchAlreadyCompleted(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingFQDNs(t *testing.T) {
+	batch := []string{"a.example.com", "B.example.com", "c.example.com.", "d.example.com"}
+	found := []api.LOCRecord{{FQDN: "b.example.com"}, {FQDN: "C.Example.com"}, {FQDN: "other.example.com"}}
+
+	tests := []struct {
+		name string
+		req  api.SubmitBatchRequest
+		want []string
+	}{
+		{
+			"all checked",
+			api.SubmitBatchRequest{DomainsChecked: 4, LOCRecords: found, Checked: []string{"a.example.com", "b.example.com", "C.example.com", "d.example.com."}},
+			[]string{"a.example.com", "d.example.com"},
+		},
+		{
+			// d's lookup failed (e.g. SERVFAIL or a timeout), so the scanner
+			// left it out: its record isn't marked missing
+			"lookup error",
+			api.SubmitBatchRequest{DomainsChecked: 4, LOCRecords: found, Checked: []string{"a.example.com", "b.example.com", "c.example.com"}},
+			[]string{"a.example.com"},
+		},
+		{
+			// Time ran out before d was looked up: its record stays as it is
+			"partial",
+			api.SubmitBatchRequest{DomainsChecked: 3, LOCRecords: found, Checked: []string{"a.example.com", "b.example.com", "c.example.com"}},
+			[]string{"a.example.com"},
+		},
+		{
+			"checked outside the batch",
+			api.SubmitBatchRequest{DomainsChecked: 1, Checked: []string{"other.example.com"}},
+			nil,
+		},
+		{
+			// Without checked, "no record returned" may just be failed
+			// lookups, so nothing is marked
+			"older scanner",
+			api.SubmitBatchRequest{DomainsChecked: 4, LOCRecords: found},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingFQDNs(batch, tt.req); !slices.Equal(got, tt.want) {
+				t.Errorf("missingFQDNs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := missingFQDNs(nil, api.SubmitBatchRequest{LOCRecords: found}); got != nil {
+		t.Errorf("missingFQDNs for an unknown batch = %v, want none", got)
+	}
+}
+
+func TestScannerHandlers_ReturnBatch_Validation(t *testing.T) {
+	h := &ScannerHandlers{} // nil DB is fine: invalid requests are rejected before any query
+	client := &db.ScannerClient{ID: "client-1"}
+
+	tests := []struct {
+		name       string
+		client     *db.ScannerClient
+		body       string
+		wantStatus int
+	}{
+		{"unauthenticated", nil, `{"batch_id":1}`, http.StatusUnauthorized},
+		{"invalid json", client, `{`, http.StatusBadRequest},
+		{"missing batch id", client, `{"session_id":"s"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/scanner/return", strings.NewReader(tt.body))
+			if tt.client != nil {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.ClientContextKey, tt.client))
+			}
+			rr := httptest.NewRecorder()
+
+			h.ReturnBatch(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestScannerHandlers_BodyLimits(t *testing.T) {
+	// nil DB is fine: every case is rejected while decoding
+	h := &ScannerHandlers{MaxBodyBytes: 64}
+	client := &db.ScannerClient{ID: "client-1"}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"oversized body", `{"batch_id":1,"domains_checked":1,"loc_records":[` + strings.Repeat(`{},`, 40) + `{}]}`, http.StatusRequestEntityTooLarge},
+		{"malformed json", `{"batch_id":`, http.StatusBadRequest},
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"SubmitResults": h.SubmitResults,
+		"GetJobs":       h.GetJobs,
+		"Heartbeat":     h.Heartbeat,
+	}
+
+	for hname, handle := range handlers {
+		for _, tt := range tests {
+			t.Run(hname+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/api/scanner/x", strings.NewReader(tt.body))
+				req = req.WithContext(context.WithValue(req.Context(), middleware.ClientContextKey, client))
+				rr := httptest.NewRecorder()
+
+				handle(rr, req)
+
+				if rr.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d (%s)", rr.Code, tt.wantStatus, rr.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestScannerHandlers_DecodeBody_UnknownFields(t *testing.T) {
+	h := &ScannerHandlers{}
+	body := `{"batch_id":1,"domains_checked":1,"bogus":true}`
+
+	decode := func(v any) (bool, int) {
+		req := httptest.NewRequest(http.MethodPost, "/api/scanner/x", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		ok := h.decodeBody(rr, req, v)
+		return ok, rr.Code
+	}
+
+	// Submissions tolerate fields added by newer scanners
+	var submit api.SubmitBatchRequest
+	if ok, code := decode(&submit); !ok {
+		t.Fatalf("SubmitBatchRequest rejected with status %d", code)
+	}
+	if submit.BatchID != 1 || submit.DomainsChecked != 1 {
+		t.Errorf("SubmitBatchRequest = %+v, want batch 1 with 1 domain checked", submit)
+	}
+
+	// Everything else rejects them
+	for name, v := range map[string]any{
+		"GetBatchRequest":  &api.GetBatchRequest{},
+		"HeartbeatRequest": &api.HeartbeatRequest{},
+	} {
+		if ok, code := decode(v); ok || code != http.StatusBadRequest {
+			t.Errorf("%s: ok = %v, status = %d, want rejected with %d", name, ok, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestReconcileCoordinates(t *testing.T) {
+	// 52°22'23"N 4°53'32"E
+	const raw = "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m"
+	// Computed the way the parser does, so float rounding matches exactly
+	latDeg, latMin, latSec := 52.0, 22.0, 23.0
+	lonDeg, lonMin, lonSec := 4.0, 53.0, 32.0
+	wantLat := latDeg + latMin/60 + latSec/3600
+	wantLon := lonDeg + lonMin/60 + lonSec/3600
+
+	tests := []struct {
+		name         string
+		rec          api.LOCRecord
+		overwrite    bool
+		wantMismatch bool
+		wantLat      float64
+		wantLon      float64
+	}{
+		{
+			name:    "matching coordinates",
+			rec:     api.LOCRecord{FQDN: "a.example.com", RawRecord: raw, Latitude: wantLat, Longitude: wantLon},
+			wantLat: wantLat, wantLon: wantLon,
+		},
+		{
+			name:    "float noise within tolerance",
+			rec:     api.LOCRecord{FQDN: "a.example.com", RawRecord: raw, Latitude: wantLat + 1e-9, Longitude: wantLon - 1e-9},
+			wantLat: wantLat + 1e-9, wantLon: wantLon - 1e-9,
+		},
+		{
+			name:         "hemisphere flipped, kept",
+			rec:          api.LOCRecord{FQDN: "a.example.com", RawRecord: raw, Latitude: -wantLat, Longitude: wantLon},
+			wantMismatch: true,
+			wantLat:      -wantLat, wantLon: wantLon,
+		},
+		{
+			name:         "hemisphere flipped, overwritten",
+			rec:          api.LOCRecord{FQDN: "a.example.com", RawRecord: raw, Latitude: -wantLat, Longitude: wantLon},
+			overwrite:    true,
+			wantMismatch: true,
+			wantLat:      wantLat, wantLon: wantLon,
+		},
+		{
+			name:         "longitude off, overwritten",
+			rec:          api.LOCRecord{FQDN: "a.example.com", RawRecord: raw, Latitude: wantLat, Longitude: 4.8},
+			overwrite:    true,
+			wantMismatch: true,
+			wantLat:      wantLat, wantLon: wantLon,
+		},
+		{
+			name:      "unparseable raw record is left alone",
+			rec:       api.LOCRecord{FQDN: "a.example.com", RawRecord: "garbage", Latitude: 10, Longitude: 20},
+			overwrite: true,
+			wantLat:   10, wantLon: 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tt.rec
+			if got := reconcileCoordinates(&rec, tt.overwrite); got != tt.wantMismatch {
+				t.Errorf("reconcileCoordinates() = %v, want %v", got, tt.wantMismatch)
+			}
+			if rec.Latitude != tt.wantLat || rec.Longitude != tt.wantLon {
+				t.Errorf("coords = (%v, %v), want (%v, %v)", rec.Latitude, rec.Longitude, tt.wantLat, tt.wantLon)
+			}
+			if rec.FQDN != tt.rec.FQDN {
+				t.Errorf("FQDN = %q, want %q", rec.FQDN, tt.rec.FQDN)
+			}
+		})
+	}
+}
+
+func TestValidateRecordPatch(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		req     api.PatchLOCRecordRequest
+		wantErr bool
+	}{
+		{"empty patch", api.PatchLOCRecordRequest{}, true},
+		{"latitude only", api.PatchLOCRecordRequest{Latitude: f(52.37)}, false},
+		{"full correction", api.PatchLOCRecordRequest{Latitude: f(-33.9), Longitude: f(151.2), AltitudeM: f(-10)}, false},
+		{"boundary values", api.PatchLOCRecordRequest{Latitude: f(90), Longitude: f(-180)}, false},
+		{"latitude out of range", api.PatchLOCRecordRequest{Latitude: f(90.5)}, true},
+		{"longitude out of range", api.PatchLOCRecordRequest{Longitude: f(181)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRecordPatch(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("validateRecordPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_Records_InvalidRequests(t *testing.T) {
+	h := &AdminHandlers{} // nil DB is fine: these are rejected before any query
+
+	tests := []struct {
+		name   string
+		method string
+		fqdn   string
+		body   string
+		handle func(*AdminHandlers, http.ResponseWriter, *http.Request)
+	}{
+		{"delete without fqdn", http.MethodDelete, "", "", (*AdminHandlers).DeleteRecord},
+		{"patch without fqdn", http.MethodPatch, "", `{"latitude":1}`, (*AdminHandlers).PatchRecord},
+		{"patch malformed body", http.MethodPatch, "a.example.com", `{`, (*AdminHandlers).PatchRecord},
+		{"patch unknown field", http.MethodPatch, "a.example.com", `{"lat":1}`, (*AdminHandlers).PatchRecord},
+		{"patch empty", http.MethodPatch, "a.example.com", `{}`, (*AdminHandlers).PatchRecord},
+		{"patch out of range", http.MethodPatch, "a.example.com", `{"longitude":200}`, (*AdminHandlers).PatchRecord},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("fqdn", tt.fqdn)
+			req := httptest.NewRequest(tt.method, "/api/admin/records/x", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			rr := httptest.NewRecorder()
+
+			tt.handle(h, rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_Denylist_InvalidPattern(t *testing.T) {
+	h := &AdminHandlers{} // nil DB is fine: invalid patterns are rejected before any query
+
+	t.Run("add", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/denylist", strings.NewReader(`{"pattern":"parked*.com"}`))
+		rr := httptest.NewRecorder()
+		h.AddDenylistEntry(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("pattern", "")
+		req := httptest.NewRequest(http.MethodDelete, "/api/admin/denylist/x", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		h.RemoveDenylistEntry(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestAdminHandlers_PauseResumeFeeder(t *testing.T) {
+	f := &feeder.Feeder{Capacity: feeder.NewCapacitySignal()}
+	h := &AdminHandlers{Feeder: f}
+
+	post := func(handler http.HandlerFunc) api.FeederStateResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/api/admin/feeder", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+		}
+		var resp api.FeederStateResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if resp := post(h.PauseFeeder); !resp.Paused || !f.Paused() {
+		t.Errorf("after pause: response paused=%v, feeder paused=%v", resp.Paused, f.Paused())
+	}
+	if resp := post(h.ResumeFeeder); resp.Paused || f.Paused() {
+		t.Errorf("after resume: response paused=%v, feeder paused=%v", resp.Paused, f.Paused())
+	}
+}
+
+func TestAdminHandlers_PauseFeeder_NotConfigured(t *testing.T) {
+	h := &AdminHandlers{}
+	rr := httptest.NewRecorder()
+	h.PauseFeeder(rr, httptest.NewRequest(http.MethodPost, "/api/admin/feeder/pause", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestAdminHandlers_DiscoverFiles_FeederDisabled(t *testing.T) {
+	h := &AdminHandlers{} // No feeder: FEEDER_ENABLED=false
+	rr := httptest.NewRecorder()
+	h.DiscoverFiles(rr, httptest.NewRequest(http.MethodPost, "/api/admin/discover-files", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestBuildListClientsResponse_Sessions(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-10 * time.Second)
+	clients := []db.ClientWithStats{
+		{ScannerClient: db.ScannerClient{ID: "c1", Name: "busy", LastHeartbeat: &recent}, ActiveBatches: 2},
+		{ScannerClient: db.ScannerClient{ID: "c2", Name: "idle"}},
+	}
+	sessions := []db.ScannerSession{
+		{ID: "s1", ClientID: "c1", LastHeartbeat: recent, ActiveDomains: []string{"a.example.com", "b.example.com"}},
+		{ID: "s2", ClientID: "c1", LastHeartbeat: recent},
+	}
+
+	resp := buildListClientsResponse(clients, sessions, time.Minute, now)
+
+	// Round-trip through JSON as the admin API client would see it
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got api.ListClientsResponse
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if len(got.Clients) != 2 {
+		t.Fatalf("clients = %d, want 2", len(got.Clients))
+	}
+	busy, idle := got.Clients[0], got.Clients[1]
+	if !busy.IsAlive || len(busy.Sessions) != 2 {
+		t.Fatalf("busy client = %+v, want alive with 2 sessions", busy)
+	}
+	if d := busy.Sessions[0].ActiveDomains; len(d) != 2 || d[0] != "a.example.com" || d[1] != "b.example.com" {
+		t.Errorf("session s1 active_domains = %v", d)
+	}
+	if d := busy.Sessions[1].ActiveDomains; d == nil || len(d) != 0 {
+		t.Errorf("session s2 active_domains = %#v, want empty list", d)
+	}
+	if idle.IsAlive || idle.Sessions == nil || len(idle.Sessions) != 0 {
+		t.Errorf("idle client = %+v, want not alive with empty sessions", idle)
+	}
+	if !strings.Contains(string(data), `"sessions":[]`) {
+		t.Errorf("idle client sessions should encode as [], got %s", data)
+	}
+}
+
+func TestSplitManualBatches(t *testing.T) {
+	domains := []string{"a.com", "b.com", "c.com", "d.com", "e.com"}
+	tests := []struct {
+		size int
+		want []int // batch lengths
+	}{
+		{2, []int{2, 2, 1}},
+		{5, []int{5}},
+		{10, []int{5}},
+		{0, []int{5}}, // default size
+	}
+	for _, tt := range tests {
+		batches := splitManualBatches(domains, tt.size)
+		var got []int
+		for _, b := range batches {
+			got = append(got, len(b))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("size %d: batch lengths = %v, want %v", tt.size, got, tt.want)
+		}
+		if all := slices.Concat(batches...); !slices.Equal(all, domains) {
+			t.Errorf("size %d: batches = %v, want every domain once in order", tt.size, batches)
+		}
+	}
+}
+
+func TestReadManualScanDomains(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []string
+	}{
+		{"json", "application/json", `{"domains":["a.com","b.com"]}`, []string{"a.com", "b.com"}},
+		{"no content type", "", `{"domains":["a.com"]}`, []string{"a.com"}},
+		{"text", "text/plain", "a.com\nb.com\r\n\n# note\n", []string{"a.com", "b.com", "", "# note"}},
+		{"text with charset", "text/plain; charset=utf-8", "a.com", []string{"a.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/manual-scan", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			got, err := readManualScanDomains(req)
+			if err != nil {
+				t.Fatalf("readManualScanDomains: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("domains = %q, want %q", got, tt.want)
+			}
+			if clean := cleanManualDomains(got); slices.ContainsFunc(clean, func(d string) bool {
+				return d == "" || strings.TrimSpace(d) != d || strings.HasPrefix(d, "#")
+			}) {
+				t.Errorf("cleaned domains = %q, want no blanks, padding or comments", clean)
+			}
+		})
+	}
+}
+
+func TestAdminHandlers_ManualScan_TextPlain(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"empty body", "", http.StatusBadRequest},
+		{"only comments and blanks", "# header\n\n   \n", http.StatusBadRequest},
+		{"line too long", strings.Repeat("a", 128<<10), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &AdminHandlers{} // Every case is rejected before the DB is used
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/manual-scan", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "text/plain")
+			rr := httptest.NewRecorder()
+			h.ManualScan(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rr.Code, tt.wantStatus, rr.Body)
+			}
+		})
+	}
+}
+
+func TestAgeSeconds(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	tests := []struct {
+		name string
+		t    *time.Time
+		want float64
+	}{
+		{"nil", nil, 0},
+		{"now", ago(0), 0},
+		{"past", ago(90 * time.Second), 90},
+		{"fractional", ago(1500 * time.Millisecond), 1.5},
+		{"future", ago(-time.Minute), 0},
+	}
+	for _, tt := range tests {
+		if got := ageSeconds(tt.t, now); got != tt.want {
+			t.Errorf("%s: ageSeconds = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBatchQueueStatsResponse(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	q := db.QueueDepth{
+		Now: now,
+		Files: []db.FileQueueDepth{
+			{FileID: 1, Filename: "a.txt.xz", Pending: 3, InFlight: 1, OldestPending: ago(time.Minute), OldestInFlight: ago(10 * time.Second)},
+			{FileID: 2, Filename: "b.txt.xz", Pending: 2, OldestPending: ago(5 * time.Minute)},
+			{FileID: 3, Filename: "c.txt.xz", InFlight: 4, OldestInFlight: ago(2 * time.Minute)},
+		},
+	}
+
+	resp := buildBatchQueueStatsResponse(q)
+
+	if resp.Pending != 5 || resp.InFlight != 5 {
+		t.Errorf("pending, in_flight = %d, %d, want 5, 5", resp.Pending, resp.InFlight)
+	}
+	if resp.OldestPendingAgeSeconds != 300 {
+		t.Errorf("oldest pending age = %v, want 300 (file b)", resp.OldestPendingAgeSeconds)
+	}
+	if resp.OldestInFlightAgeSeconds != 120 {
+		t.Errorf("oldest in_flight age = %v, want 120 (file c)", resp.OldestInFlightAgeSeconds)
+	}
+
+	want := []api.FileQueueStats{
+		{FileID: 1, Filename: "a.txt.xz", Pending: 3, InFlight: 1, OldestPendingAgeSeconds: 60, OldestInFlightAgeSeconds: 10},
+		{FileID: 2, Filename: "b.txt.xz", Pending: 2, OldestPendingAgeSeconds: 300},
+		{FileID: 3, Filename: "c.txt.xz", InFlight: 4, OldestInFlightAgeSeconds: 120},
+	}
+	if !slices.Equal(resp.Files, want) {
+		t.Errorf("files = %+v, want %+v", resp.Files, want)
+	}
+}
+
+func TestBuildBatchQueueStatsResponse_Empty(t *testing.T) {
+	resp := buildBatchQueueStatsResponse(db.QueueDepth{Now: time.Now()})
+
+	// Round-trip through JSON as the admin API client would see it
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"pending":0,"in_flight":0,"oldest_pending_age_seconds":0,"oldest_in_flight_age_seconds":0,"files":[]}`
+	if string(data) != want {
+		t.Errorf("body = %s, want %s", data, want)
+	}
+}
+
+func TestBuildListFilesResponse(t *testing.T) {
+	files := []db.FileCoverage{
+		{ID: 1, Filename: "a.txt.xz", Status: "complete", ProcessedLines: 2_000_000, LinesFed: 2_000_000, LOCRecords: 10},
+		{ID: 2, Filename: "b.txt.xz", Status: "complete", ProcessedLines: 1_000_000, LinesFed: 1_000_000, LOCRecords: 20},
+		{ID: 3, Filename: "c.txt.xz", Status: "processing", ProcessedLines: 500_000, LinesFed: 500_000, LOCRecords: 1},
+		{ID: 4, Filename: "d.txt.xz", Status: "pending"},
+	}
+
+	tests := []struct {
+		status     string
+		wantIDs    []int // Highest yield first
+		wantYields []float64
+		wantFed    int64
+		wantLOC    int
+		wantYield  float64
+	}{
+		{"", []int{2, 1, 3, 4}, []float64{20, 5, 2, 0}, 3_500_000, 31, 31 / 3.5},
+		{"complete", []int{2, 1}, []float64{20, 5}, 3_000_000, 30, 10},
+		{"pending", []int{4}, []float64{0}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		resp := buildListFilesResponse(files, tt.status)
+
+		var ids []int
+		var yields []float64
+		for _, f := range resp.Files {
+			ids = append(ids, f.ID)
+			yields = append(yields, f.LOCPerMillion)
+		}
+		if !slices.Equal(ids, tt.wantIDs) {
+			t.Errorf("status %q: file IDs = %v, want %v", tt.status, ids, tt.wantIDs)
+		}
+		if !slices.Equal(yields, tt.wantYields) {
+			t.Errorf("status %q: yields = %v, want %v", tt.status, yields, tt.wantYields)
+		}
+		if resp.DomainsFed != tt.wantFed || resp.LOCRecords != tt.wantLOC {
+			t.Errorf("status %q: totals = %d fed, %d LOC, want %d, %d",
+				tt.status, resp.DomainsFed, resp.LOCRecords, tt.wantFed, tt.wantLOC)
+		}
+		if math.Abs(resp.LOCPerMillion-tt.wantYield) > 1e-9 {
+			t.Errorf("status %q: overall yield = %v, want %v", tt.status, resp.LOCPerMillion, tt.wantYield)
+		}
+	}
+}
+
+func TestBuildListFilesResponse_SkippedLines(t *testing.T) {
+	// Half of the lines read were comments and blanks that were never fed
+	files := []db.FileCoverage{
+		{ID: 1, Filename: "a.txt.xz", Status: "complete", ProcessedLines: 2_000_000, LinesFed: 1_000_000, LOCRecords: 10},
+	}
+	resp := buildListFilesResponse(files, "")
+	if got := resp.Files[0].DomainsFed; got != 1_000_000 {
+		t.Errorf("DomainsFed = %d, want 1000000 (lines fed, not lines read)", got)
+	}
+	if got := resp.Files[0].LOCPerMillion; got != 10 {
+		t.Errorf("LOCPerMillion = %v, want 10", got)
+	}
+	if resp.DomainsFed != 1_000_000 || resp.LOCPerMillion != 10 {
+		t.Errorf("totals = %d fed, %v per million, want 1000000, 10", resp.DomainsFed, resp.LOCPerMillion)
+	}
+}
+
+func TestBuildListFilesResponse_Empty(t *testing.T) {
+	data, err := json.Marshal(buildListFilesResponse(nil, "complete"))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"files":[],"domains_fed":0,"loc_records":0,"loc_per_million":0}`
+	if string(data) != want {
+		t.Errorf("body = %s, want %s", data, want)
+	}
+}
+
+func TestAdminHandlers_ListFiles_InvalidStatus(t *testing.T) {
+	h := &AdminHandlers{} // Rejected before the DB is used
+	rr := httptest.NewRecorder()
+	h.ListFiles(rr, httptest.NewRequest(http.MethodGet, "/api/admin/files?status=done", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSubmissionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantOK  bool
+		batchID int64
+	}{
+		{"header", "session-1:7", "session-1:7", true, 7},
+		{"no header falls back to batch", "", "batch:7", true, 7},
+		{"fallback differs per batch", "", "batch:8", true, 8},
+		{"too long", strings.Repeat("k", maxIdempotencyKeyLen+1), "", false, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/scanner/results", nil)
+			if tt.header != "" {
+				req.Header.Set(api.IdempotencyKeyHeader, tt.header)
+			}
+			got, ok := submissionKey(req, tt.batchID)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScannerHandlers_SubmitResults_KeyTooLong(t *testing.T) {
+	h := &ScannerHandlers{} // Rejected before the DB is used
+	req := httptest.NewRequest(http.MethodPost, "/api/scanner/results", strings.NewReader(`{"batch_id":7,"domains_checked":1}`))
+	req.Header.Set(api.IdempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKeyLen+1))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClientContextKey, &db.ScannerClient{ID: "c1"}))
+	rr := httptest.NewRecorder()
+
+	h.SubmitResults(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d (%s)", rr.Code, http.StatusBadRequest, rr.Body)
+	}
+}
+
+func gzipString(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScannerHandlers_DecodeBody_Gzip(t *testing.T) {
+	h := &ScannerHandlers{}
+	body := `{"batch_id":7,"domains_checked":3,"loc_records":[{"fqdn":"a.example.com","raw_record":"52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m","latitude":52.37,"longitude":4.89}]}`
+
+	decode := func(body []byte, encoding string) api.SubmitBatchRequest {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/scanner/results", bytes.NewReader(body))
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		rr := httptest.NewRecorder()
+		var got api.SubmitBatchRequest
+		if !h.decodeBody(rr, req, &got) {
+			t.Fatalf("decodeBody(%q) failed: %d %s", encoding, rr.Code, rr.Body)
+		}
+		return got
+	}
+
+	plain := decode([]byte(body), "")
+	if plain.BatchID != 7 || len(plain.LOCRecords) != 1 {
+		t.Fatalf("plain body decoded as %+v", plain)
+	}
+	for _, encoding := range []string{"gzip", "GZIP"} {
+		if got := decode(gzipString(t, body), encoding); !reflect.DeepEqual(got, plain) {
+			t.Errorf("Content-Encoding %s decoded as %+v, want %+v", encoding, got, plain)
+		}
+	}
+	if got := decode([]byte(body), "identity"); !reflect.DeepEqual(got, plain) {
+		t.Errorf("Content-Encoding identity decoded as %+v, want %+v", got, plain)
+	}
+}
+
+func TestScannerHandlers_DecodeBody_GzipErrors(t *testing.T) {
+	h := &ScannerHandlers{MaxBodyBytes: 64}
+	valid := `{"batch_id":1,"domains_checked":1}`
+	// Compresses to well under the limit but expands past it
+	bomb := `{"batch_id":1,"domains_checked":1` + strings.Repeat(" ", 1000) + `}`
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		wantStatus int
+	}{
+		{"unsupported encoding", "br", []byte(valid), http.StatusUnsupportedMediaType},
+		{"not gzip", "gzip", []byte(valid), http.StatusBadRequest},
+		{"truncated gzip", "gzip", gzipString(t, valid)[:20], http.StatusBadRequest},
+		{"expands past limit", "gzip", gzipString(t, bomb), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/scanner/results", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			rr := httptest.NewRecorder()
+
+			var v api.SubmitBatchRequest
+			if h.decodeBody(rr, req, &v) {
+				t.Fatalf("decodeBody accepted the body as %+v", v)
+			}
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", rr.Code, tt.wantStatus, rr.Body)
+			}
+		})
+	}
+}
+
+func TestScannerHandlers_GetConfig(t *testing.T) {
+	h := &ScannerHandlers{RecommendedConfig: api.ScannerConfigResponse{
+		BatchCount:             maxBatchesPerRequest + 5,
+		EmptyQueueDelaySeconds: 45,
+		MaxConcurrentLookups:   100,
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/scanner/config", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ClientContextKey, &db.ScannerClient{ID: "c1"}))
+	rr := httptest.NewRecorder()
+	h.GetConfig(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got api.ScannerConfigResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := api.ScannerConfigResponse{BatchCount: maxBatchesPerRequest, EmptyQueueDelaySeconds: 45, MaxConcurrentLookups: 100}
+	if got != want {
+		t.Errorf("config = %+v, want %+v (batch count capped)", got, want)
+	}
+
+	// Without a recommendation the fields are left out entirely
+	rr = httptest.NewRecorder()
+	(&ScannerHandlers{}).GetConfig(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != "{}" {
+		t.Errorf("empty config body = %s, want {}", body)
+	}
+
+	rr = httptest.NewRecorder()
+	h.GetConfig(rr, httptest.NewRequest(http.MethodGet, "/api/scanner/config", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status without client = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
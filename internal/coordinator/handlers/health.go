@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// defaultReadyTimeout bounds the database ping in /readyz.
+const defaultReadyTimeout = 2 * time.Second
+
+// Pinger checks connectivity to a dependency. *db.DB implements it.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthHandlers contains handlers for liveness and readiness probes.
+type HealthHandlers struct {
+	DB Pinger
+	// Components reports whether each named background component (feeder,
+	// reaper, ...) is still running.
+	Components map[string]func() bool
+	// Timeout bounds the database ping (defaults to 2s).
+	Timeout time.Duration
+}
+
+// Health handles GET /health.
+// A liveness probe: it only shows the process is serving HTTP.
+func (h *HealthHandlers) Health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok")) // Error is client disconnect, can't recover
+}
+
+// Ready handles GET /readyz.
+// A readiness probe: returns 503 if the database is unreachable or a
+// background component has stopped.
+func (h *HealthHandlers) Ready(w http.ResponseWriter, r *http.Request) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	resp := api.ReadinessResponse{
+		Status: "ok",
+		Checks: map[string]string{"database": "ok"},
+	}
+	if err := h.DB.Ping(ctx); err != nil {
+		resp.Status = "unavailable"
+		resp.Checks["database"] = err.Error()
+	}
+	for name, running := range h.Components {
+		if running() {
+			resp.Checks[name] = "ok"
+			continue
+		}
+		resp.Status = "unavailable"
+		resp.Checks[name] = "not running"
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
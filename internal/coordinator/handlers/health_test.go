@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// fakePinger is a Pinger returning a fixed error.
+type fakePinger struct{ err error }
+
+func (p fakePinger) Ping(context.Context) error { return p.err }
+
+func TestHealthHandlers_Ready(t *testing.T) {
+	running := func() bool { return true }
+	stopped := func() bool { return false }
+
+	tests := []struct {
+		name       string
+		pingErr    error
+		components map[string]func() bool
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "all healthy",
+			components: map[string]func() bool{"feeder": running, "reaper": running},
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"database": "ok", "feeder": "ok", "reaper": "ok"},
+		},
+		{
+			name:       "database unreachable",
+			pingErr:    errors.New("connection refused"),
+			components: map[string]func() bool{"feeder": running},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": "connection refused", "feeder": "ok"},
+		},
+		{
+			name:       "component stopped",
+			components: map[string]func() bool{"feeder": running, "reaper": stopped},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"database": "ok", "feeder": "ok", "reaper": "not running"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HealthHandlers{DB: fakePinger{err: tt.pingErr}, Components: tt.components}
+			rr := httptest.NewRecorder()
+			h.Ready(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+
+			var resp api.ReadinessResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON body: %v", err)
+			}
+			wantStatus := "ok"
+			if tt.wantStatus != http.StatusOK {
+				wantStatus = "unavailable"
+			}
+			if resp.Status != wantStatus {
+				t.Errorf("Status = %q, want %q", resp.Status, wantStatus)
+			}
+			if len(resp.Checks) != len(tt.wantChecks) {
+				t.Errorf("Checks = %v, want %v", resp.Checks, tt.wantChecks)
+			}
+			for k, v := range tt.wantChecks {
+				if resp.Checks[k] != v {
+					t.Errorf("Checks[%q] = %q, want %q", k, resp.Checks[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthHandlers_Health(t *testing.T) {
+	// Liveness doesn't touch the database
+	h := &HealthHandlers{}
+	rr := httptest.NewRecorder()
+	h.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok" {
+		t.Errorf("got %d %q, want 200 \"ok\"", rr.Code, rr.Body.String())
+	}
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/feeder"
 	"github.com/locplace/scanner/pkg/api"
 )
 
@@ -14,6 +23,8 @@ import (
 type PublicHandlers struct {
 	DB               *db.DB
 	HeartbeatTimeout time.Duration
+	Feeder           *feeder.Feeder // Optional: reports whether the feeder is paused
+	Hub              *RecordHub     // Optional: feeds the live record stream
 }
 
 // ListRecords handles GET /api/public/records.
@@ -21,12 +32,36 @@ func (h *PublicHandlers) ListRecords(w http.ResponseWriter, r *http.Request) {
 	limit := parseIntParam(r, "limit", 100)
 	offset := parseIntParam(r, "offset", 0)
 	domain := r.URL.Query().Get("domain")
+	search := strings.TrimSpace(r.URL.Query().Get("search"))
 
 	if limit > 1000 {
 		limit = 1000
 	}
 
-	records, total, err := h.DB.ListLOCRecords(r.Context(), limit, offset, domain)
+	if len(search) > db.MaxSearchLength {
+		writeError(w, fmt.Sprintf("search must be at most %d characters", db.MaxSearchLength), http.StatusBadRequest)
+		return
+	}
+
+	minAlt, maxAlt, err := parseAltitudeRange(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, total, err := h.DB.ListLOCRecords(r.Context(), limit, offset, db.LOCRecordFilter{
+		RootDomain:   domain,
+		BBox:         bbox,
+		Search:       search,
+		MinAltitudeM: minAlt,
+		MaxAltitudeM: maxAlt,
+	})
 	if err != nil {
 		writeError(w, "failed to list records", http.StatusInternalServerError)
 		return
@@ -44,52 +79,360 @@ func (h *PublicHandlers) ListRecords(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// MaxNearRadiusKm caps the radius of /api/public/records/near queries.
+const MaxNearRadiusKm = 1000.0
+
+// ListRecordsNear handles GET /api/public/records/near.
+// Returns records within radius_km of lat, lon, nearest first.
+func (h *PublicHandlers) ListRecordsNear(w http.ResponseWriter, r *http.Request) {
+	lat, lon, radiusKm, err := parseNearParams(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := min(parseIntParam(r, "limit", 100), 1000)
+
+	records, err := h.DB.ListLOCRecordsNear(r.Context(), lat, lon, radiusKm, limit)
+	if err != nil {
+		writeError(w, "failed to list records", http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []api.NearbyLOCRecord{}
+	}
+
+	writeJSON(w, http.StatusOK, api.ListNearbyRecordsResponse{
+		Records:  records,
+		Lat:      lat,
+		Lon:      lon,
+		RadiusKm: radiusKm,
+		Limit:    limit,
+	})
+}
+
+// parseNearParams parses and validates the lat, lon and radius_km parameters.
+func parseNearParams(r *http.Request) (lat, lon, radiusKm float64, err error) {
+	q := r.URL.Query()
+	parse := func(name string) (float64, error) {
+		s := q.Get(name)
+		if s == "" {
+			return 0, fmt.Errorf("%s is required", name)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("%s must be a number", name)
+		}
+		return f, nil
+	}
+
+	if lat, err = parse("lat"); err != nil {
+		return 0, 0, 0, err
+	}
+	if lon, err = parse("lon"); err != nil {
+		return 0, 0, 0, err
+	}
+	if radiusKm, err = parse("radius_km"); err != nil {
+		return 0, 0, 0, err
+	}
+	if lat < -90 || lat > 90 {
+		return 0, 0, 0, errors.New("lat must be between -90 and 90")
+	}
+	if lon < -180 || lon > 180 {
+		return 0, 0, 0, errors.New("lon must be between -180 and 180")
+	}
+	if radiusKm <= 0 || radiusKm > MaxNearRadiusKm {
+		return 0, 0, 0, fmt.Errorf("radius_km must be greater than 0 and at most %g", MaxNearRadiusKm)
+	}
+	return lat, lon, radiusKm, nil
+}
+
+// ListRootDomains handles GET /api/public/domains.
+// Returns per-root-domain record counts, centroids and first/last seen times.
+func (h *PublicHandlers) ListRootDomains(w http.ResponseWriter, r *http.Request) {
+	limit := min(parseIntParam(r, "limit", 100), 1000)
+	offset := parseIntParam(r, "offset", 0)
+
+	domains, total, err := h.DB.ListRootDomainSummaries(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, "failed to list domains", http.StatusInternalServerError)
+		return
+	}
+
+	if domains == nil {
+		domains = []api.RootDomainSummary{}
+	}
+
+	writeJSON(w, http.StatusOK, api.ListRootDomainsResponse{
+		Domains: domains,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
 // GetRecordsGeoJSON handles GET /api/public/records.geojson.
 // Returns LOC records aggregated by location as a GeoJSON FeatureCollection.
 // Multiple FQDNs at the same coordinates are combined into a single feature.
 func (h *PublicHandlers) GetRecordsGeoJSON(w http.ResponseWriter, r *http.Request) {
-	locations, err := h.DB.GetAggregatedLocationsForGeoJSON(r.Context())
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	includeAltitude := false
+	if v := r.URL.Query().Get("include_altitude"); v != "" {
+		includeAltitude, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, "include_altitude must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Skip the aggregation entirely if the client already has this version
+	count, lastSeen, err := h.DB.GetLOCRecordsVersion(r.Context())
 	if err != nil {
 		writeError(w, "failed to get records", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if checkNotModified(w, r, geoJSONETag(count, lastSeen, r.URL.RawQuery)) {
+		return
+	}
 
-	features := make([]api.GeoJSONFeature, 0, len(locations))
-	for _, loc := range locations {
-		feature := api.GeoJSONFeature{
-			Type: "Feature",
-			Geometry: api.GeoJSONPoint{
-				Type:        "Point",
-				Coordinates: []float64{loc.Longitude, loc.Latitude},
-			},
-			Properties: map[string]any{
-				"fqdns":        loc.FQDNs,
-				"root_domains": loc.RootDomains,
-				"raw_record":   loc.RawRecord,
-				"altitude_m":   loc.AltitudeM,
-				"count":        loc.Count,
-				"first_seen":   loc.FirstSeenAt,
-				"last_seen":    loc.LastSeenAt,
-			},
+	// Stream features straight from the database cursor so memory use stays
+	// flat regardless of how many records there are.
+	w.Header().Set("Content-Type", "application/geo+json")
+	stream := newGeoJSONStream(w)
+	err = h.DB.StreamAggregatedLocations(r.Context(), bbox, func(loc api.AggregatedLocation) error {
+		if !stream.Started() {
+			// Delay the 200 until the query has produced a row, so a query
+			// failure can still be reported as a 500.
+			w.WriteHeader(http.StatusOK)
+		}
+		return stream.WriteFeature(geoJSONFeature(loc, includeAltitude))
+	})
+	if err != nil {
+		if !stream.Started() {
+			writeError(w, "failed to get records", http.StatusInternalServerError)
+			return
 		}
-		features = append(features, feature)
+		// Headers are already sent; the truncated body will fail to parse client-side.
+		slog.Error("GeoJSON stream aborted", "error", err)
+		return
 	}
-
-	fc := api.GeoJSONFeatureCollection{
-		Type:     "FeatureCollection",
-		Features: features,
+	if err := stream.Close(); err != nil {
+		slog.Error("GeoJSON stream aborted", "error", err)
 	}
+}
 
-	data, err := json.Marshal(fc)
+// GetRecordsGeoJSONL handles GET /api/public/records.geojsonl.
+// Streams one GeoJSON Feature per LOC record, one per line, for bulk
+// imports that read features incrementally (ogr2ogr, DuckDB). Unlike
+// records.geojson, records sharing a location are not combined.
+func (h *PublicHandlers) GetRecordsGeoJSONL(w http.ResponseWriter, r *http.Request) {
+	bbox, err := parseBBox(r.URL.Query().Get("bbox"))
 	if err != nil {
-		writeError(w, "failed to encode geojson", http.StatusInternalServerError)
+		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	includeAltitude := false
+	if v := r.URL.Query().Get("include_altitude"); v != "" {
+		includeAltitude, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, "include_altitude must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/geo+json")
+	count, lastSeen, err := h.DB.GetLOCRecordsVersion(r.Context())
+	if err != nil {
+		writeError(w, "failed to get records", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Cache-Control", "public, max-age=300")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(data)
+	if checkNotModified(w, r, geoJSONETag(count, lastSeen, "geojsonl|"+r.URL.RawQuery)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json-seq")
+	streamGeoJSONL(w, includeAltitude, func(fn func(api.PublicLOCRecord) error) error {
+		return h.DB.StreamLOCRecords(r.Context(), db.LOCRecordFilter{BBox: bbox}, fn)
+	})
+}
+
+// streamGeoJSONL writes each record produced by stream as a feature on its
+// own line. The 200 is delayed until the first record so a query failure
+// can still be reported as a 500.
+func streamGeoJSONL(w http.ResponseWriter, includeAltitude bool, stream func(func(api.PublicLOCRecord) error) error) {
+	enc := json.NewEncoder(w)
+	started := false
+	err := stream(func(rec api.PublicLOCRecord) error {
+		if !started {
+			started = true
+			w.WriteHeader(http.StatusOK)
+		}
+		return enc.Encode(recordFeature(rec, includeAltitude))
+	})
+	if err != nil {
+		if !started {
+			writeError(w, "failed to get records", http.StatusInternalServerError)
+			return
+		}
+		// Lines already sent are complete features; the stream just ends early
+		slog.Error("GeoJSONL stream aborted", "error", err)
+	}
+}
+
+// recordFeature converts a single LOC record into a GeoJSON Point feature,
+// with altitude handled as in geoJSONFeature.
+func recordFeature(rec api.PublicLOCRecord, includeAltitude bool) api.GeoJSONFeature {
+	coords := []float64{rec.Longitude, rec.Latitude}
+	if includeAltitude && rec.AltitudeM != 0 {
+		coords = append(coords, rec.AltitudeM)
+	}
+
+	feature := api.GeoJSONFeature{
+		Type: "Feature",
+		Geometry: api.GeoJSONPoint{
+			Type:        "Point",
+			Coordinates: coords,
+		},
+		Properties: map[string]any{
+			"fqdn":         rec.FQDN,
+			"root_domain":  rec.RootDomain,
+			"raw_record":   rec.RawRecord,
+			"altitude_m":   rec.AltitudeM,
+			"size_m":       rec.SizeM,
+			"horiz_prec_m": rec.HorizPrecM,
+			"vert_prec_m":  rec.VertPrecM,
+			"first_seen":   rec.FirstSeenAt,
+			"last_seen":    rec.LastSeenAt,
+		},
+	}
+	if len(coords) == 3 {
+		feature.Properties["altitude_datum"] = altitudeDatum
+	}
+	return feature
+}
+
+// altitudeDatum describes what LOC altitudes are measured against (RFC 1876).
+const altitudeDatum = "WGS84 reference spheroid"
+
+// geoJSONFeature converts an aggregated location into a GeoJSON Point feature.
+// If includeAltitude is set and the altitude is non-zero, the point gets a third
+// [lon, lat, alt] coordinate, per RFC 7946.
+func geoJSONFeature(loc api.AggregatedLocation, includeAltitude bool) api.GeoJSONFeature {
+	coords := []float64{loc.Longitude, loc.Latitude}
+	if includeAltitude && loc.AltitudeM != 0 {
+		coords = append(coords, loc.AltitudeM)
+	}
+
+	feature := api.GeoJSONFeature{
+		Type: "Feature",
+		Geometry: api.GeoJSONPoint{
+			Type:        "Point",
+			Coordinates: coords,
+		},
+		Properties: map[string]any{
+			"fqdns":        loc.FQDNs,
+			"root_domains": loc.RootDomains,
+			"raw_record":   loc.RawRecord,
+			"altitude_m":   loc.AltitudeM,
+			"count":        loc.Count,
+			"first_seen":   loc.FirstSeenAt,
+			"last_seen":    loc.LastSeenAt,
+		},
+	}
+	if len(coords) == 3 {
+		// LOC altitude is height above the WGS84 spheroid, not above mean sea level
+		feature.Properties["altitude_datum"] = altitudeDatum
+	}
+	return feature
+}
+
+// geoJSONStream writes a GeoJSON FeatureCollection one feature at a time.
+// The opening of the collection is written lazily on the first feature (or
+// on Close), so nothing is sent until there is something to send.
+type geoJSONStream struct {
+	w       io.Writer
+	enc     *json.Encoder
+	started bool
+	count   int
+}
+
+func newGeoJSONStream(w io.Writer) *geoJSONStream {
+	return &geoJSONStream{w: w, enc: json.NewEncoder(w)}
+}
+
+// Started reports whether any output has been written yet.
+func (s *geoJSONStream) Started() bool {
+	return s.started
+}
+
+func (s *geoJSONStream) begin() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	_, err := io.WriteString(s.w, `{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+// WriteFeature appends a feature to the collection.
+func (s *geoJSONStream) WriteFeature(f api.GeoJSONFeature) error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	if s.count > 0 {
+		if _, err := io.WriteString(s.w, ","); err != nil {
+			return err
+		}
+	}
+	s.count++
+	return s.enc.Encode(f)
+}
+
+// Close terminates the collection. It must be called exactly once.
+func (s *geoJSONStream) Close() error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.w, "]}\n")
+	return err
+}
+
+// geoJSONETag builds a weak ETag from the dataset version and request query.
+// The query is included because filters (e.g. bbox) change the response body.
+// It's weak because the same tag is sent for gzip and identity responses,
+// whose bytes differ.
+func geoJSONETag(count int, lastSeen *time.Time, rawQuery string) string {
+	var lastSeenNanos int64
+	if lastSeen != nil {
+		lastSeenNanos = lastSeen.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%s", count, lastSeenNanos, rawQuery)))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// checkNotModified sets the ETag header and, if the request's If-None-Match
+// matches it by weak comparison, writes 304 Not Modified. Returns true if the
+// response was written.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
 }
 
 // GetStats handles GET /api/public/stats.
@@ -115,6 +458,12 @@ func (h *PublicHandlers) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	missingCount, err := h.DB.CountMissingLOCRecords(ctx)
+	if err != nil {
+		writeError(w, "failed to get missing LOC record count", http.StatusInternalServerError)
+		return
+	}
+
 	// Scanner stats - count active sessions (individual scanner instances)
 	activeSessions, err := h.DB.CountActiveSessions(ctx, h.HeartbeatTimeout)
 	if err != nil {
@@ -166,6 +515,7 @@ func (h *PublicHandlers) GetStats(w http.ResponseWriter, r *http.Request) {
 		TotalLOCRecords:          locCount,
 		UniqueRootDomainsWithLOC: uniqueWithLOC,
 		UniqueLocations:          uniqueLocations,
+		MissingLOCRecords:        missingCount,
 		ActiveScanners:           activeSessions,
 		DomainFiles: api.DomainFileStats{
 			Total:      fileStats.Total,
@@ -174,13 +524,68 @@ func (h *PublicHandlers) GetStats(w http.ResponseWriter, r *http.Request) {
 			Complete:   fileStats.Complete,
 		},
 		BatchQueue: api.BatchQueueStats{
-			Pending:  batchStats.Pending,
-			InFlight: batchStats.InFlight,
+			Pending:     batchStats.Pending,
+			InFlight:    batchStats.InFlight,
+			Quarantined: batchStats.Quarantined,
 		},
-		CurrentFile: currentFile,
+		CurrentFile:  currentFile,
+		FeederPaused: h.Feeder != nil && h.Feeder.Paused(),
 	})
 }
 
+// defaultHistoryWindow is how far back stats history goes when since is omitted.
+const defaultHistoryWindow = 7 * 24 * time.Hour
+
+// GetStatsHistory handles GET /api/public/stats/history.
+// Returns periodic stats snapshots captured since the given time.
+func (h *PublicHandlers) GetStatsHistory(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := h.DB.GetStatsSnapshots(r.Context(), since)
+	if err != nil {
+		writeError(w, "failed to get stats history", http.StatusInternalServerError)
+		return
+	}
+
+	resp := api.StatsHistoryResponse{
+		Since:     since,
+		Snapshots: make([]api.StatsSnapshot, 0, len(snapshots)),
+	}
+	for _, s := range snapshots {
+		resp.Snapshots = append(resp.Snapshots, api.StatsSnapshot{
+			CapturedAt:      s.CapturedAt,
+			TotalLOCRecords: s.TotalLOCRecords,
+			DomainsWithLOC:  s.DomainsWithLOC,
+			ActiveScanners:  s.ActiveScanners,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseSince parses the since parameter as either an RFC 3339 timestamp
+// or a duration relative to now (e.g. "24h"). Empty means the default window.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now.Add(-defaultHistoryWindow), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if t.After(now) {
+			return time.Time{}, errors.New("since must not be in the future")
+		}
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.New("since must be an RFC 3339 timestamp or a positive duration")
+}
+
 func parseIntParam(r *http.Request, name string, defaultVal int) int {
 	s := r.URL.Query().Get(name)
 	if s == "" {
@@ -192,3 +597,65 @@ func parseIntParam(r *http.Request, name string, defaultVal int) int {
 	}
 	return v
 }
+
+// parseAltitudeRange parses the optional min_altitude_m and max_altitude_m
+// parameters. Either may be absent for an open-ended range.
+func parseAltitudeRange(r *http.Request) (minAlt, maxAlt *float64, err error) {
+	parse := func(name string) (*float64, error) {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			return nil, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%s must be a number", name)
+		}
+		return &f, nil
+	}
+
+	if minAlt, err = parse("min_altitude_m"); err != nil {
+		return nil, nil, err
+	}
+	if maxAlt, err = parse("max_altitude_m"); err != nil {
+		return nil, nil, err
+	}
+	if minAlt != nil && maxAlt != nil && *minAlt > *maxAlt {
+		return nil, nil, errors.New("min_altitude_m must not exceed max_altitude_m")
+	}
+	return minAlt, maxAlt, nil
+}
+
+// parseBBox parses a "minLon,minLat,maxLon,maxLat" bounding box.
+// Returns nil if the parameter is empty. minLon > maxLon is allowed and
+// denotes a box crossing the anti-meridian.
+func parseBBox(s string) (*db.BoundingBox, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("bbox values must be numbers")
+		}
+		v[i] = f
+	}
+
+	bbox := &db.BoundingBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if bbox.MinLon < -180 || bbox.MinLon > 180 || bbox.MaxLon < -180 || bbox.MaxLon > 180 {
+		return nil, errors.New("bbox longitude must be between -180 and 180")
+	}
+	if bbox.MinLat < -90 || bbox.MinLat > 90 || bbox.MaxLat < -90 || bbox.MaxLat > 90 {
+		return nil, errors.New("bbox latitude must be between -90 and 90")
+	}
+	if bbox.MinLat > bbox.MaxLat {
+		return nil, errors.New("bbox minLat must not exceed maxLat")
+	}
+	return bbox, nil
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// DefaultSubscriberBuffer is how many records a stream subscriber can fall
+// behind before the oldest are dropped.
+const DefaultSubscriberBuffer = 64
+
+// RecordHub fans stored LOC records out to live stream subscribers.
+// Publishing never blocks: a subscriber whose buffer is full loses its
+// oldest pending record. A nil *RecordHub is valid and drops everything.
+type RecordHub struct {
+	mu     sync.Mutex
+	subs   map[*RecordSubscription]struct{}
+	closed bool
+}
+
+// RecordSubscription receives records published after it was created.
+type RecordSubscription struct {
+	// C delivers records; it is closed when the hub shuts down.
+	C  <-chan api.PublicLOCRecord
+	ch chan api.PublicLOCRecord
+
+	dropped int // Guarded by RecordHub.mu
+}
+
+// NewRecordHub creates a hub with no subscribers.
+func NewRecordHub() *RecordHub {
+	return &RecordHub{subs: make(map[*RecordSubscription]struct{})}
+}
+
+// Subscribe registers a subscriber buffering up to buffer records. It
+// returns nil if the hub is nil or closed.
+func (h *RecordHub) Subscribe(buffer int) *RecordSubscription {
+	if h == nil {
+		return nil
+	}
+	ch := make(chan api.PublicLOCRecord, max(buffer, 1))
+	sub := &RecordSubscription{C: ch, ch: ch}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes sub and returns how many records it dropped.
+func (h *RecordHub) Unsubscribe(sub *RecordSubscription) int {
+	if h == nil || sub == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, sub)
+	return sub.dropped
+}
+
+// Publish sends rec to every subscriber, dropping a slow subscriber's
+// oldest buffered record to make room.
+func (h *RecordHub) Publish(rec api.PublicLOCRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		select {
+		case sub.ch <- rec:
+			continue
+		default:
+		}
+		// Full: drop the oldest, then there's room since only Publish sends
+		select {
+		case <-sub.ch:
+			sub.dropped++
+		default:
+		}
+		sub.ch <- rec
+	}
+}
+
+// Subscribers returns the number of current subscribers.
+func (h *RecordHub) Subscribers() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Close ends every subscription by closing its channel, letting streams
+// finish so the HTTP server can shut down. Later subscribes return nil.
+func (h *RecordHub) Close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		close(sub.ch)
+		delete(h.subs, sub)
+	}
+}
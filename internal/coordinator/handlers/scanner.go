@@ -1,27 +1,103 @@
 package handlers
 
 import (
+	"compress/gzip"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/net/publicsuffix"
 
 	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/feeder"
 	"github.com/locplace/scanner/internal/coordinator/metrics"
 	"github.com/locplace/scanner/internal/coordinator/middleware"
 	"github.com/locplace/scanner/pkg/api"
+	"github.com/locplace/scanner/pkg/loc"
 )
 
+// DefaultMaxBodyBytes is the default cap on scanner request bodies.
+const DefaultMaxBodyBytes = 10 << 20
+
 // ScannerHandlers contains handlers for scanner endpoints.
 type ScannerHandlers struct {
 	DB *db.DB
+	// MaxBodyBytes caps request body size (defaults to DefaultMaxBodyBytes).
+	MaxBodyBytes int64
+	// OverwriteMismatchedCoords replaces submitted coordinates with the
+	// server's parse of raw_record when the two disagree.
+	OverwriteMismatchedCoords bool
+	// Capacity is notified when batches are claimed or completed, waking a
+	// feeder blocked on a full queue (optional).
+	Capacity *feeder.CapacitySignal
+	// Hub receives each stored record for the live stream (optional).
+	Hub *RecordHub
+	// RecommendedConfig is served to scanners by GetConfig.
+	RecommendedConfig api.ScannerConfigResponse
+}
+
+// decodeBody strictly decodes a size-limited JSON request body into v,
+// decompressing it first if sent with Content-Encoding: gzip. The limit
+// applies both to the body as sent and to its decompressed size. On failure
+// it writes 413 for an oversized body, 415 for an unsupported encoding or
+// 400 for anything malformed (including unknown fields) and returns false.
+//
+// Result submissions are the exception: they accept unknown fields, so that
+// newer scanners can add to them without older coordinators rejecting (and
+// losing) a batch's work.
+func (h *ScannerHandlers) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	limit := h.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	body := http.MaxBytesReader(w, r.Body, limit)
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			writeBodyError(w, err)
+			return false
+		}
+		defer zr.Close() //nolint:errcheck // Close error not actionable
+		body = http.MaxBytesReader(w, zr, limit)
+	default:
+		writeError(w, "unsupported content encoding: "+encoding, http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	dec := json.NewDecoder(body)
+	if _, ok := v.(*api.SubmitBatchRequest); !ok {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	return true
+}
+
+// writeBodyError writes 413 if err came from an oversized request body, or
+// 400 otherwise.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	writeError(w, "invalid request body", http.StatusBadRequest)
 }
 
 // GetJobs handles POST /api/scanner/jobs.
-// Claims a batch of domains for the scanner to process.
+// Claims one or more batches of domains for the scanner to process.
 func (h *ScannerHandlers) GetJobs(w http.ResponseWriter, r *http.Request) {
 	client := middleware.GetClient(r.Context())
 	if client == nil {
@@ -30,8 +106,7 @@ func (h *ScannerHandlers) GetJobs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req api.GetBatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, "invalid request body", http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
 
@@ -44,24 +119,100 @@ func (h *ScannerHandlers) GetJobs(w http.ResponseWriter, r *http.Request) {
 	// Also update client's last_heartbeat for backwards compat
 	_ = h.DB.UpdateHeartbeat(r.Context(), client.ID, req.SessionID)
 
-	// Claim a batch (pass both client ID and session ID)
-	batch, err := h.DB.ClaimBatch(r.Context(), client.ID, req.SessionID)
+	// Claim batches (pass both client ID and session ID)
+	count := clampBatchCount(req.BatchCount)
+	batches, err := h.DB.ClaimBatches(r.Context(), client.ID, req.SessionID, count)
 	if err != nil {
 		writeError(w, "failed to claim batch", http.StatusInternalServerError)
 		return
 	}
+	if len(batches) > 0 {
+		// Claimed batches left the pending queue, making room for the feeder
+		h.Capacity.Notify()
+	}
+	for _, b := range batches {
+		metrics.BatchQueueWaitSeconds.Observe(b.QueueWait().Seconds())
+	}
 
-	// No batches available
-	if batch == nil {
-		writeJSON(w, http.StatusOK, api.GetBatchResponse{
-			Domains: []string{},
-		})
+	// No batches available; advise a wait based on whether the feeder has more work
+	if len(batches) == 0 {
+		resp := api.GetBatchResponse{Domains: []string{}}
+		if fileStats, err := h.DB.GetDomainFileStats(r.Context()); err == nil {
+			resp.RetryAfterSeconds = emptyQueueRetryAfter(fileStats)
+		}
+		writeJSON(w, http.StatusOK, resp)
 		return
 	}
 
-	// Parse domains from newline-separated string
-	domains := strings.Split(batch.Domains, "\n")
-	// Filter empty strings
+	writeJSON(w, http.StatusOK, buildBatchResponse(batches, count))
+}
+
+// GetConfig handles GET /api/scanner/config.
+// Returns the settings scanners should apply, with the batch count capped
+// at what GetJobs will hand out.
+func (h *ScannerHandlers) GetConfig(w http.ResponseWriter, r *http.Request) {
+	if middleware.GetClient(r.Context()) == nil {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	resp := h.RecommendedConfig
+	if resp.BatchCount > 0 {
+		resp.BatchCount = clampBatchCount(resp.BatchCount)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// maxIdempotencyKeyLen caps the Idempotency-Key header stored per submission.
+const maxIdempotencyKeyLen = 255
+
+// submissionKey returns the idempotency key for a result submission: the
+// Idempotency-Key header, or one derived from the batch ID for scanners that
+// don't send it (a batch can only be completed once). ok is false if the
+// header is too long.
+func submissionKey(r *http.Request, batchID int64) (key string, ok bool) {
+	key = r.Header.Get(api.IdempotencyKeyHeader)
+	if key == "" {
+		return "batch:" + strconv.FormatInt(batchID, 10), true
+	}
+	return key, len(key) <= maxIdempotencyKeyLen
+}
+
+// maxBatchesPerRequest caps batch_count so one scanner can't drain the queue.
+const maxBatchesPerRequest = 10
+
+// clampBatchCount applies the default (1) and server-side cap to a requested batch count.
+func clampBatchCount(n int) int {
+	return min(max(n, 1), maxBatchesPerRequest)
+}
+
+// buildBatchResponse builds the jobs response for claimed batches. Single-batch
+// requests get the original batch_id/domains shape so older scanners keep working;
+// multi-batch requests get the batches list (which may be shorter than requested).
+func buildBatchResponse(batches []db.ScanBatch, requested int) api.GetBatchResponse {
+	if requested <= 1 {
+		return api.GetBatchResponse{
+			BatchID: batches[0].ID,
+			Domains: splitDomains(batches[0].Domains),
+		}
+	}
+
+	resp := api.GetBatchResponse{
+		Domains: []string{},
+		Batches: make([]api.BatchAssignment, 0, len(batches)),
+	}
+	for _, b := range batches {
+		resp.Batches = append(resp.Batches, api.BatchAssignment{
+			BatchID: b.ID,
+			Domains: splitDomains(b.Domains),
+		})
+	}
+	return resp
+}
+
+// splitDomains parses a batch's newline-separated domains, dropping empty lines.
+func splitDomains(s string) []string {
+	domains := strings.Split(s, "\n")
 	filtered := make([]string, 0, len(domains))
 	for _, d := range domains {
 		d = strings.TrimSpace(d)
@@ -69,11 +220,92 @@ func (h *ScannerHandlers) GetJobs(w http.ResponseWriter, r *http.Request) {
 			filtered = append(filtered, d)
 		}
 	}
+	return filtered
+}
+
+// coordTolerance is how far, in degrees, submitted coordinates may be from the
+// server's parse of raw_record. LOC seconds have millisecond precision
+// (about 3e-7 degrees), so this only absorbs floating-point noise.
+const coordTolerance = 1e-6
+
+// reconcileCoordinates re-parses rec.RawRecord and reports whether the
+// scanner's latitude/longitude disagree with it. When they do and overwrite is
+// set, rec takes the server-parsed values. Records the server can't parse are
+// left alone and not reported.
+func reconcileCoordinates(rec *api.LOCRecord, overwrite bool) bool {
+	parsed, err := loc.ParseLOCRecordLenient(rec.FQDN, rec.RawRecord)
+	if err != nil {
+		return false
+	}
+	if math.Abs(parsed.Latitude-rec.Latitude) <= coordTolerance &&
+		math.Abs(parsed.Longitude-rec.Longitude) <= coordTolerance {
+		return false
+	}
+	if overwrite {
+		*rec = *parsed
+	}
+	return true
+}
+
+// batchAlreadyCompleted reports whether a CompleteBatch error means the batch
+// is already gone, which makes repeated submissions idempotent.
+func batchAlreadyCompleted(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
+
+// missingFQDNs returns the batch domains a submission positively reports as
+// having no LOC record: those in req.Checked, whose lookups got a definitive
+// answer, that came back without one. Lookup failures and domains the
+// scanner didn't get to aren't in req.Checked, and older scanners that don't
+// send it report nothing, since "no record returned" alone may just mean a
+// flaky resolver. Submitted records count as found even if later rejected,
+// since the FQDN still has a LOC record.
+func missingFQDNs(batchDomains []string, req api.SubmitBatchRequest) []string {
+	checked := make(map[string]bool, len(req.Checked))
+	for _, fqdn := range req.Checked {
+		checked[normalizeFQDN(fqdn)] = true
+	}
+	var scanned []string
+	for _, d := range batchDomains {
+		if checked[normalizeFQDN(d)] {
+			scanned = append(scanned, d)
+		}
+	}
+
+	found := make(map[string]bool, len(req.LOCRecords))
+	for _, rec := range req.LOCRecords {
+		found[normalizeFQDN(rec.FQDN)] = true
+	}
+	var missing []string
+	for _, d := range scanned {
+		if !found[normalizeFQDN(d)] {
+			missing = append(missing, d)
+		}
+	}
+	return missing
+}
 
-	writeJSON(w, http.StatusOK, api.GetBatchResponse{
-		BatchID: batch.ID,
-		Domains: filtered,
-	})
+// normalizeFQDN lowercases fqdn and strips any trailing dot, for comparing
+// names as scanners and domain files spell them.
+func normalizeFQDN(fqdn string) string {
+	return strings.ToLower(strings.TrimSuffix(fqdn, "."))
+}
+
+// Empty-queue retry advice, in seconds.
+const (
+	// retryAfterFeeding is used while files remain to be fed, so new batches are imminent.
+	retryAfterFeeding = 10
+	// retryAfterIdle is used once every file is complete and nothing new is coming soon.
+	retryAfterIdle = 300
+)
+
+// emptyQueueRetryAfter recommends how long a scanner should wait after finding
+// the batch queue empty, based on feeder progress.
+func emptyQueueRetryAfter(stats *db.DomainFileStats) int {
+	if stats.Pending+stats.Processing > 0 {
+		return retryAfterFeeding
+	}
+	return retryAfterIdle
 }
 
 // Heartbeat handles POST /api/scanner/heartbeat.
@@ -85,8 +317,7 @@ func (h *ScannerHandlers) Heartbeat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req api.HeartbeatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, "invalid request body", http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
 
@@ -96,14 +327,54 @@ func (h *ScannerHandlers) Heartbeat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Progress reporting is best effort; the heartbeat itself succeeded
+	if err := h.DB.UpdateSessionActiveDomains(r.Context(), req.SessionID, req.ActiveDomains); err != nil {
+		slog.Warn("Failed to store session active domains", "session_id", req.SessionID, "error", err)
+	}
+
 	// Also update client heartbeat for backwards compat
 	_ = h.DB.UpdateHeartbeat(r.Context(), client.ID, req.SessionID)
 
 	writeJSON(w, http.StatusOK, api.HeartbeatResponse{OK: true})
 }
 
+// ReturnBatch handles POST /api/scanner/return.
+// Puts a claimed but unprocessed batch back in the queue immediately, so it
+// doesn't wait for the reaper when a scanner shuts down.
+func (h *ScannerHandlers) ReturnBatch(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClient(r.Context())
+	if client == nil {
+		writeError(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req api.ReturnBatchRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+
+	if req.BatchID == 0 {
+		writeError(w, "batch_id is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.ReturnBatch(r.Context(), req.BatchID, client.ID, req.SessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeError(w, "batch not held by this session", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, "failed to return batch", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.ReturnBatchResponse{OK: true})
+}
+
 // SubmitResults handles POST /api/scanner/results.
-// Stores LOC records and marks the batch as complete.
+// Stores LOC records and marks the batch as complete. A repeat of a completed
+// submission (same Idempotency-Key, or same batch without one) gets the
+// original response without being processed again.
 func (h *ScannerHandlers) SubmitResults(w http.ResponseWriter, r *http.Request) {
 	client := middleware.GetClient(r.Context())
 	if client == nil {
@@ -112,8 +383,7 @@ func (h *ScannerHandlers) SubmitResults(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req api.SubmitBatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, "invalid request body", http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
 
@@ -122,35 +392,113 @@ func (h *ScannerHandlers) SubmitResults(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	key, ok := submissionKey(r, req.BatchID)
+	if !ok {
+		writeError(w, fmt.Sprintf("%s must be at most %d bytes", api.IdempotencyKeyHeader, maxIdempotencyKeyLen), http.StatusBadRequest)
+		return
+	}
+	prevAccepted, seen, err := h.DB.GetSubmission(r.Context(), client.ID, key)
+	if err != nil {
+		writeError(w, "failed to look up submission", http.StatusInternalServerError)
+		return
+	}
+	if seen {
+		// A retry whose response was lost; the results were already stored
+		// and counted
+		slog.Info("Replayed duplicate submission", "batch_id", req.BatchID, "client", client.Name)
+		writeJSON(w, http.StatusOK, api.SubmitBatchResponse{Accepted: prevAccepted})
+		return
+	}
+
+	// Look up the source file so records can be attributed to it; manual
+	// submissions and stale rescans have none
+	sourceFileID, err := h.DB.GetBatchFileID(r.Context(), req.BatchID)
+	if err != nil {
+		writeError(w, "failed to look up batch", http.StatusInternalServerError)
+		return
+	}
+
+	// The batch's domains tell us which known records weren't found again
+	batchDomains, rescan, err := h.DB.GetBatchDomains(r.Context(), req.BatchID)
+	if err != nil {
+		writeError(w, "failed to look up batch", http.StatusInternalServerError)
+		return
+	}
+
+	var deny *db.Denylist
+	if len(req.LOCRecords) > 0 {
+		deny, err = h.DB.LoadDenylist(r.Context())
+		if err != nil {
+			writeError(w, "failed to load denylist", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Store LOC records
 	accepted := 0
-	for _, loc := range req.LOCRecords {
+	for _, rec := range req.LOCRecords {
+		if deny.Denied(rec.FQDN) {
+			metrics.DenylistRejectionsTotal.WithLabelValues("submit").Inc()
+			slog.Info("Rejected denylisted LOC record", "fqdn", rec.FQDN)
+			continue
+		}
+
+		// The scanner computes coordinates itself; check them against raw_record
+		if reconcileCoordinates(&rec, h.OverwriteMismatchedCoords) {
+			metrics.LOCCoordinateMismatchesTotal.Inc()
+			slog.Warn("Submitted coordinates disagree with raw record", "fqdn", rec.FQDN,
+				"raw_record", rec.RawRecord, "overwritten", h.OverwriteMismatchedCoords)
+		}
+
 		// Validate coordinates before attempting insert
-		if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
-			log.Printf("Rejected invalid coordinates for %s: lat=%f, lon=%f", loc.FQDN, loc.Latitude, loc.Longitude)
+		if rec.Latitude < -90 || rec.Latitude > 90 || rec.Longitude < -180 || rec.Longitude > 180 {
+			slog.Warn("Rejected invalid coordinates", "fqdn", rec.FQDN, "lat", rec.Latitude, "lon", rec.Longitude)
 			continue
 		}
 
 		// Extract root domain from FQDN
-		rootDomain, err := publicsuffix.EffectiveTLDPlusOne(loc.FQDN)
+		rootDomain, err := publicsuffix.EffectiveTLDPlusOne(rec.FQDN)
 		if err != nil {
 			// If we can't parse it, use the FQDN as-is
-			rootDomain = loc.FQDN
+			rootDomain = rec.FQDN
 		}
 
-		if err := h.DB.UpsertLOCRecord(r.Context(), rootDomain, loc); err != nil {
-			log.Printf("Failed to insert LOC record for %s: %v", loc.FQDN, err)
+		stored, err := h.DB.UpsertLOCRecord(r.Context(), rootDomain, sourceFileID, rec)
+		if err != nil {
+			slog.Error("Failed to insert LOC record", "fqdn", rec.FQDN, "error", err)
 			continue
 		}
+		h.Hub.Publish(*stored)
 		accepted++
 	}
 
+	// Known records that were scanned again without a LOC record are marked
+	// missing; the pruner deletes them if they stay missing
+	if missing := missingFQDNs(batchDomains, req); len(missing) > 0 {
+		marked, err := h.DB.MarkLOCRecordsMissing(r.Context(), missing)
+		if err != nil {
+			slog.Error("Failed to mark LOC records missing", "batch_id", req.BatchID, "error", err)
+		} else if marked > 0 {
+			metrics.LOCRecordsMarkedMissingTotal.Add(float64(marked))
+			slog.Info("Marked LOC records missing", "batch_id", req.BatchID, "records", marked, "rescan", rescan)
+		}
+	}
+
 	// Mark batch as complete
-	fileID, assignedAt, err := h.DB.CompleteBatch(r.Context(), req.BatchID)
+	fileID, assignedAt, err := h.DB.CompleteBatch(r.Context(), req.BatchID,
+		&db.SubmissionKey{ClientID: client.ID, Key: key, Accepted: accepted})
+	if batchAlreadyCompleted(err) {
+		// A retried submission whose first attempt already completed the batch.
+		// The records above were upserted again (harmlessly); report success so
+		// the scanner doesn't treat its results as lost.
+		writeJSON(w, http.StatusOK, api.SubmitBatchResponse{Accepted: accepted})
+		return
+	}
 	if err != nil {
 		writeError(w, "failed to complete batch", http.StatusInternalServerError)
 		return
 	}
+	h.Capacity.Notify()
 
 	// Check if the file is now complete (all batches done)
 	completed, err := h.DB.CheckAndMarkFileComplete(r.Context(), fileID)
@@ -169,6 +517,7 @@ func (h *ScannerHandlers) SubmitResults(w http.ResponseWriter, r *http.Request)
 	}
 	metrics.DomainsCheckedTotal.Add(float64(req.DomainsChecked))
 	metrics.LOCDiscoveriesTotal.Add(float64(accepted))
+	metrics.RecordScannerThroughput(client.Name, req.DomainsChecked, accepted)
 
 	writeJSON(w, http.StatusOK, api.SubmitBatchResponse{Accepted: accepted})
 }
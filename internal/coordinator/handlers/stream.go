@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// streamKeepalive is how often an idle stream sends a comment so proxies
+// don't time the connection out.
+const streamKeepalive = 30 * time.Second
+
+// StreamRecords handles GET /api/public/records/stream.
+// Streams each LOC record as it's stored, as Server-Sent Events named
+// "record" whose data is a PublicLOCRecord. Only records stored after the
+// client connects are sent.
+func (h *PublicHandlers) StreamRecords(w http.ResponseWriter, r *http.Request) {
+	sub := h.Hub.Subscribe(DefaultSubscriberBuffer)
+	if sub == nil {
+		writeError(w, "record stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer func() {
+		if dropped := h.Hub.Unsubscribe(sub); dropped > 0 {
+			slog.Info("Record stream client fell behind", "dropped", dropped)
+		}
+	}()
+
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Debug("Record stream: can't clear write deadline", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case rec, ok := <-sub.C:
+			if !ok {
+				return // Hub closed for shutdown
+			}
+			data, err := json.Marshal(rec)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: record\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
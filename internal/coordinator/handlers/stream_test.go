@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestRecordHub_DropsOldestForSlowSubscriber(t *testing.T) {
+	hub := NewRecordHub()
+	sub := hub.Subscribe(2)
+
+	for _, fqdn := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		hub.Publish(api.PublicLOCRecord{FQDN: fqdn})
+	}
+
+	for _, want := range []string{"b.example.com", "c.example.com"} {
+		if got := (<-sub.C).FQDN; got != want {
+			t.Errorf("received %s, want %s", got, want)
+		}
+	}
+	if dropped := hub.Unsubscribe(sub); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	if n := hub.Subscribers(); n != 0 {
+		t.Errorf("subscribers after unsubscribe = %d, want 0", n)
+	}
+}
+
+func TestRecordHub_Close(t *testing.T) {
+	hub := NewRecordHub()
+	sub := hub.Subscribe(1)
+	hub.Close()
+	hub.Close() // Idempotent
+
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription channel still open after Close")
+	}
+	if hub.Subscribe(1) != nil {
+		t.Error("Subscribe after Close returned a subscription")
+	}
+	hub.Publish(api.PublicLOCRecord{FQDN: "a.example.com"}) // Must not panic
+}
+
+func TestRecordHub_Nil(t *testing.T) {
+	var hub *RecordHub
+	hub.Publish(api.PublicLOCRecord{})
+	hub.Close()
+	if hub.Subscribe(1) != nil {
+		t.Error("nil hub returned a subscription")
+	}
+}
+
+func TestStreamRecords(t *testing.T) {
+	hub := NewRecordHub()
+	h := &PublicHandlers{Hub: hub}
+	srv := httptest.NewServer(http.HandlerFunc(h.StreamRecords))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Headers arrive after subscribing, so this record is stored "after" the client connected
+	want := api.PublicLOCRecord{FQDN: "loc.example.com", RootDomain: "example.com", Latitude: 52.5, Longitude: 4.9}
+	hub.Publish(want)
+
+	events := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		var event string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: ") && event == "record":
+				events <- strings.TrimPrefix(line, "data: ")
+				return
+			}
+		}
+	}()
+
+	select {
+	case data := <-events:
+		var got api.PublicLOCRecord
+		if err := json.Unmarshal([]byte(data), &got); err != nil {
+			t.Fatalf("decode event data %q: %v", data, err)
+		}
+		if got != want {
+			t.Errorf("streamed %+v, want %+v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no record event received")
+	}
+}
+
+func TestStreamRecords_Disconnect(t *testing.T) {
+	hub := NewRecordHub()
+	h := &PublicHandlers{Hub: hub}
+	srv := httptest.NewServer(http.HandlerFunc(h.StreamRecords))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	if n := hub.Subscribers(); n != 1 {
+		t.Fatalf("subscribers = %d, want 1", n)
+	}
+	resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Subscribers() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not removed after client disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamRecords_NoHub(t *testing.T) {
+	h := &PublicHandlers{}
+	rec := httptest.NewRecorder()
+	h.StreamRecords(rec, httptest.NewRequest("GET", "/api/public/records/stream", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,121 @@
+// Package leader elects one coordinator replica to run background jobs
+// while every replica serves HTTP.
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/metrics"
+)
+
+// Lock is a held leadership lock.
+type Lock interface {
+	// Check returns an error if the lock may have been lost, e.g. because
+	// the database connection holding it broke.
+	Check(ctx context.Context) error
+	// Unlock gives up the lock.
+	Unlock(ctx context.Context) error
+}
+
+// AcquireFunc tries to take the leadership lock without waiting. It returns
+// a nil Lock if another replica holds it.
+type AcquireFunc func(ctx context.Context) (Lock, error)
+
+// unlockTimeout bounds giving up the lock after leading ends.
+const unlockTimeout = 10 * time.Second
+
+// Elector repeatedly tries to become leader, and runs the lead func for as
+// long as it stays leader.
+type Elector struct {
+	Acquire AcquireFunc
+	// RetryInterval is how often a follower tries to take over.
+	RetryInterval time.Duration
+	// CheckInterval is how often the leader verifies it still holds the lock.
+	CheckInterval time.Duration
+
+	leader atomic.Bool
+}
+
+// Leader reports whether this replica currently leads.
+func (e *Elector) Leader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns for leadership until ctx is canceled. Each time it's
+// elected it calls lead, canceling lead's context when leadership is lost
+// or ctx is canceled. On stepping down it waits for lead to return before
+// releasing the lock, so the next leader doesn't start alongside it. If the
+// lock is lost outright, e.g. with its connection, another replica may take
+// over up to CheckInterval before this one notices.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	slog.Info("Leader election started", "retry_interval", e.RetryInterval.String(),
+		"check_interval", e.CheckInterval.String())
+
+	for {
+		lock, err := e.Acquire(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				slog.Error("Leader election: failed to acquire lock", "error", err)
+			}
+		case lock != nil:
+			e.hold(ctx, lock, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Leader election stopped")
+			return
+		case <-time.After(e.RetryInterval):
+		}
+	}
+}
+
+// hold runs lead while lock stays valid, then releases it.
+func (e *Elector) hold(ctx context.Context, lock Lock, lead func(ctx context.Context)) {
+	slog.Info("Leader election: became leader")
+	e.leader.Store(true)
+	metrics.Leader.Set(1)
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.CheckInterval)
+	defer ticker.Stop()
+watch:
+	for {
+		select {
+		case <-ctx.Done():
+			break watch
+		case <-done:
+			slog.Warn("Leader election: background jobs ended while leading")
+			break watch
+		case <-ticker.C:
+			if err := lock.Check(ctx); err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Leader election: lost leadership", "error", err)
+				}
+				break watch
+			}
+		}
+	}
+
+	cancel()
+	<-done
+	e.leader.Store(false)
+	metrics.Leader.Set(0)
+
+	unlockCtx, cancelUnlock := context.WithTimeout(context.Background(), unlockTimeout)
+	defer cancelUnlock()
+	if err := lock.Unlock(unlockCtx); err != nil {
+		slog.Warn("Leader election: failed to release lock", "error", err)
+	}
+	slog.Info("Leader election: stepped down")
+}
@@ -0,0 +1,216 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockTable mimics Postgres advisory locks shared by several replicas.
+// A held lock can be "lost" to simulate its connection breaking.
+type lockTable struct {
+	mu   sync.Mutex
+	held map[int64]*fakeLock
+}
+
+type fakeLock struct {
+	table *lockTable
+	key   int64
+	lost  bool
+}
+
+func (t *lockTable) acquire(key int64) AcquireFunc {
+	return func(context.Context) (Lock, error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.held[key] != nil {
+			return nil, nil
+		}
+		if t.held == nil {
+			t.held = make(map[int64]*fakeLock)
+		}
+		l := &fakeLock{table: t, key: key}
+		t.held[key] = l
+		return l, nil
+	}
+}
+
+// lose drops the lock on key as if its session ended.
+func (t *lockTable) lose(key int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l := t.held[key]; l != nil {
+		l.lost = true
+		delete(t.held, key)
+	}
+}
+
+func (l *fakeLock) Check(context.Context) error {
+	l.table.mu.Lock()
+	defer l.table.mu.Unlock()
+	if l.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (l *fakeLock) Unlock(context.Context) error {
+	l.table.mu.Lock()
+	defer l.table.mu.Unlock()
+	if l.table.held[l.key] == l {
+		delete(l.table.held, l.key)
+	}
+	return nil
+}
+
+// replica runs an Elector whose lead func records whether it's running.
+type replica struct {
+	elector *Elector
+	mu      sync.Mutex
+	leading bool
+	terms   int // Times lead was called
+}
+
+func newReplica(acquire AcquireFunc) *replica {
+	return &replica{elector: &Elector{
+		Acquire:       acquire,
+		RetryInterval: 5 * time.Millisecond,
+		CheckInterval: 5 * time.Millisecond,
+	}}
+}
+
+func (r *replica) lead(ctx context.Context) {
+	r.mu.Lock()
+	r.leading = true
+	r.terms++
+	r.mu.Unlock()
+
+	<-ctx.Done()
+
+	r.mu.Lock()
+	r.leading = false
+	r.mu.Unlock()
+}
+
+func (r *replica) state() (leading bool, terms int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.leading, r.terms
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+const testLockKey = 42
+
+func TestElector_AcquireLoseReacquire(t *testing.T) {
+	locks := &lockTable{}
+	a := newReplica(locks.acquire(testLockKey))
+	b := newReplica(locks.acquire(testLockKey))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { a.elector.Run(ctx, a.lead) })
+	waitFor(t, "A to lead", func() bool { l, _ := a.state(); return l })
+	wg.Go(func() { b.elector.Run(ctx, b.lead) })
+
+	// B keeps campaigning but can't lead while A holds the lock
+	time.Sleep(30 * time.Millisecond)
+	if l, _ := b.state(); l || b.elector.Leader() {
+		t.Fatal("B leads while A holds the lock")
+	}
+	if !a.elector.Leader() {
+		t.Error("A.Leader() = false while leading")
+	}
+
+	// A loses its lock: it must stop leading, and B takes over
+	locks.lose(testLockKey)
+	waitFor(t, "A to step down", func() bool { l, _ := a.state(); return !l && !a.elector.Leader() })
+	waitFor(t, "B to take over", func() bool { l, _ := b.state(); return l })
+
+	// Losing B's lock hands leadership back to A for a second term. A may
+	// take over before B's next check notices the loss, so B's step-down is
+	// awaited rather than asserted.
+	locks.lose(testLockKey)
+	waitFor(t, "A to lead again", func() bool { l, terms := a.state(); return l && terms == 2 })
+	waitFor(t, "B to step down", func() bool { l, _ := b.state(); return !l && !b.elector.Leader() })
+
+	cancel()
+	wg.Wait()
+	if l, _ := a.state(); l || a.elector.Leader() {
+		t.Error("A still leads after Run returned")
+	}
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if len(locks.held) != 0 {
+		t.Errorf("locks still held after shutdown: %v", locks.held)
+	}
+}
+
+func TestElector_UnlocksAfterLeadReturns(t *testing.T) {
+	locks := &lockTable{}
+	var heldWhenStopped bool
+	lead := func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // Jobs take a moment to stop
+		locks.mu.Lock()
+		heldWhenStopped = locks.held[testLockKey] != nil
+		locks.mu.Unlock()
+	}
+	e := newReplica(locks.acquire(testLockKey)).elector
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, lead)
+		close(done)
+	}()
+	waitFor(t, "leadership", e.Leader)
+	cancel()
+	<-done
+
+	if !heldWhenStopped {
+		t.Error("lock released before lead returned; another replica could have started leading")
+	}
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	if locks.held[testLockKey] != nil {
+		t.Error("lock still held after Run returned")
+	}
+}
+
+func TestElector_AcquireError(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	e := &Elector{
+		Acquire: func(context.Context) (Lock, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			return nil, errors.New("connection refused")
+		},
+		RetryInterval: time.Millisecond,
+		CheckInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, func(context.Context) { t.Error("lead called without the lock") })
+		close(done)
+	}()
+	waitFor(t, "retries", func() bool { mu.Lock(); defer mu.Unlock(); return attempts >= 3 })
+	cancel()
+	<-done
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import "sync"
+
+// MaxClientLabels caps the distinct client label values on the per-scanner
+// metrics. Clients first seen after the cap is reached are counted under
+// OtherClientLabel, so churning through clients can't grow series unbounded.
+const MaxClientLabels = 100
+
+// OtherClientLabel is the client label for clients beyond MaxClientLabels.
+// The parentheses keep it from colliding with a real client name.
+const OtherClientLabel = "(other)"
+
+// labelCap hands out label values, passing through the first max distinct
+// values and folding the rest into OtherClientLabel.
+type labelCap struct {
+	max int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func (c *labelCap) label(v string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.seen[v]; ok {
+		return v
+	}
+	if len(c.seen) >= c.max {
+		return OtherClientLabel
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]struct{})
+	}
+	c.seen[v] = struct{}{}
+	return v
+}
+
+var clientLabels = &labelCap{max: MaxClientLabels}
+
+// RecordScannerThroughput adds a result submission's domains checked and
+// LOC records accepted to the per-scanner counters for the named client.
+func RecordScannerThroughput(client string, domainsChecked, locFound int) {
+	label := clientLabels.label(client)
+	ScannerDomainsCheckedTotal.WithLabelValues(label).Add(float64(domainsChecked))
+	ScannerLOCFoundTotal.WithLabelValues(label).Add(float64(locFound))
+}
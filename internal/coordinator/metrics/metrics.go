@@ -73,6 +73,12 @@ var (
 		Help: "Number of batches currently assigned to scanners (gauge, from DB).",
 	})
 
+	// BatchesQuarantined is the number of batches pulled from the queue after too many attempts.
+	BatchesQuarantined = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "locplace_batches_quarantined",
+		Help: "Number of batches quarantined after exceeding max claim attempts (gauge, from DB).",
+	})
+
 	// LOCRecordsTotal is the number of unique LOC records in the database.
 	LOCRecordsTotal = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "locplace_loc_records_total",
@@ -139,6 +145,14 @@ var (
 		Buckets: []float64{1, 2, 5, 10, 15, 20, 30, 45, 60, 120},
 	})
 
+	// BatchQueueWaitSeconds tracks how long batches wait in the pending queue
+	// between creation and their first or next claim.
+	BatchQueueWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "locplace_batch_queue_wait_seconds",
+		Help:    "Time between batch creation and claim in seconds.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 9), // 1s to ~18h
+	})
+
 	// DomainsCheckedTotal increments by the number of domains checked per batch.
 	DomainsCheckedTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "locplace_domains_checked_total",
@@ -151,16 +165,140 @@ var (
 		Help: "Total number of LOC record discoveries (counter). Increments on every discovery including rediscoveries. Use rate() for LOC/second.",
 	})
 
+	// ScannerDomainsCheckedTotal counts domains checked per scanner client
+	// (see RecordScannerThroughput).
+	ScannerDomainsCheckedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "locplace_scanner_domains_checked_total",
+		Help: "Total FQDNs checked, by scanner client name.",
+	}, []string{"client"})
+
+	// ScannerLOCFoundTotal counts LOC records accepted per scanner client.
+	ScannerLOCFoundTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "locplace_scanner_loc_found_total",
+		Help: "Total LOC records accepted from submissions, by scanner client name.",
+	}, []string{"client"})
+
+	// LOCCoordinateMismatchesTotal counts submitted records whose coordinates disagree with their raw record.
+	LOCCoordinateMismatchesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_loc_coordinate_mismatches_total",
+		Help: "Total number of submitted LOC records whose coordinates disagreed with the server's parse of raw_record (counter).",
+	})
+
+	// DenylistRejectionsTotal counts domains dropped because they match the denylist.
+	DenylistRejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "locplace_denylist_rejections_total",
+		Help: "Total number of denylisted domains dropped, by source (feeder: not queued; submit: LOC record not stored).",
+	}, []string{"source"})
+
 	// ReaperRunsTotal counts reaper execution cycles.
 	ReaperRunsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "locplace_reaper_runs_total",
 		Help: "Total number of reaper execution cycles (counter).",
 	})
 
-	// ReaperBatchesReleasedTotal counts batches released by the reaper.
-	ReaperBatchesReleasedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	// ReaperBatchesReleasedTotal counts batches released by the reaper, by reason.
+	ReaperBatchesReleasedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "locplace_reaper_batches_released_total",
-		Help: "Total number of batches released by the reaper due to timeout (counter).",
+		Help: "Total number of batches released back to pending by the reaper, by reason (dead_session: the scanner stopped heartbeating; timeout: a batch without a session was in flight too long).",
+	}, []string{"reason"})
+
+	// ReaperBatchesQuarantinedTotal counts batches quarantined by the reaper.
+	ReaperBatchesQuarantinedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_reaper_batches_quarantined_total",
+		Help: "Total number of batches quarantined by the reaper after exceeding max attempts (counter).",
+	})
+
+	// Leader is 1 while this coordinator leads and runs background jobs.
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "locplace_coordinator_leader",
+		Help: "Whether this coordinator replica is the leader running background jobs (1) or not (0). Always 1 without LEADER_ELECTION.",
+	})
+
+	// ReaperBatchHeldSeconds tracks how long batches the reaper releases had
+	// been in flight, i.e. how long dead scanners sat on their work.
+	ReaperBatchHeldSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "locplace_reaper_batch_held_seconds",
+		Help:    "Time released batches spent in_flight before the reaper reclaimed them, in seconds.",
+		Buckets: prometheus.ExponentialBuckets(30, 2, 10), // 30s to ~4h
+	})
+
+	// ReaperSessionsDeletedTotal counts scanner sessions deleted by the reaper.
+	ReaperSessionsDeletedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_reaper_sessions_deleted_total",
+		Help: "Total number of expired scanner sessions deleted by the reaper (counter).",
+	})
+
+	// StaleRescansQueuedTotal counts stored LOC records re-queued for verification.
+	StaleRescansQueuedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_stale_rescans_queued_total",
+		Help: "Total number of stale LOC records queued for a rescan (counter).",
+	})
+
+	// LOCRecordsMarkedMissingTotal counts known records a scan found without a LOC record.
+	LOCRecordsMarkedMissingTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_loc_records_marked_missing_total",
+		Help: "Total number of LOC records marked missing after a scan found no LOC record (counter).",
+	})
+
+	// LOCRecordsPrunedTotal counts records deleted after staying missing past the grace period.
+	LOCRecordsPrunedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_loc_records_pruned_total",
+		Help: "Total number of LOC records deleted after being missing longer than the grace period (counter).",
+	})
+)
+
+// ========================================
+// Feeder Metrics
+// ========================================
+
+var (
+	// FeederResumesTotal counts files whose feeding resumed from a saved line offset.
+	FeederResumesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_feeder_resumes_total",
+		Help: "Total number of times the feeder resumed a file from a saved line offset (counter).",
+	})
+
+	// FeederResumeLinesSkippedTotal counts lines skipped while resuming a file.
+	FeederResumeLinesSkippedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_feeder_resume_lines_skipped_total",
+		Help: "Total number of lines skipped when resuming files (counter). Compare with locplace_feeder_line_count_mismatches_total to spot drift.",
+	})
+
+	// FeederLineCountMismatchesTotal counts files whose line count did not match what was expected.
+	FeederLineCountMismatchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "locplace_feeder_line_count_mismatches_total",
+		Help: "Total number of files whose line count did not match expectations, by reason (short_resume: file ended before the resume offset; shrunk: far fewer lines than the previous run; empty: a large file fed no domains).",
+	}, []string{"reason"})
+
+	// FeederFileDuration observes how long each file takes to feed, by compression type.
+	FeederFileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "locplace_feeder_file_duration_seconds",
+		Help:    "Time to download, decompress and feed one domain file in seconds, by compression (xz, gzip, none).",
+		Buckets: []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200},
+	}, []string{"compression"})
+
+	// FeederDownloadBytesTotal counts bytes the feeder downloads, as transferred (compressed).
+	FeederDownloadBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_feeder_download_bytes_total",
+		Help: "Total bytes of domain file content downloaded by the feeder, before decompression (counter).",
+	})
+
+	// FeederDownloadErrorsTotal counts failed file downloads by reason.
+	FeederDownloadErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "locplace_feeder_download_errors_total",
+		Help: "Total number of failed domain file downloads, by reason (quota, not_found, network, other).",
+	}, []string{"reason"})
+
+	// FeederIntegrityFailuresTotal counts downloads that didn't match their LFS pointer.
+	FeederIntegrityFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_feeder_integrity_failures_total",
+		Help: "Total number of file downloads whose SHA-256 or size did not match the LFS pointer (counter).",
+	})
+
+	// FeederInvalidLinesTotal counts domain file lines skipped for not being hostnames.
+	FeederInvalidLinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "locplace_feeder_invalid_lines_total",
+		Help: "Total number of domain file lines skipped because they were not valid hostnames, such as IP addresses or garbage (counter).",
 	})
 )
 
@@ -216,6 +354,7 @@ func Register() {
 	prometheus.MustRegister(DomainFilesComplete)
 	prometheus.MustRegister(BatchesPending)
 	prometheus.MustRegister(BatchesInFlight)
+	prometheus.MustRegister(BatchesQuarantined)
 
 	// Gauges - Results
 	prometheus.MustRegister(LOCRecordsTotal)
@@ -229,13 +368,37 @@ func Register() {
 	prometheus.MustRegister(DBPoolIdleConns)
 	prometheus.MustRegister(DBPoolMaxConns)
 
+	// Leader election
+	prometheus.MustRegister(Leader)
+
 	// Counters
 	prometheus.MustRegister(ScanCompletionsTotal)
 	prometheus.MustRegister(BatchProcessingDuration)
+	prometheus.MustRegister(BatchQueueWaitSeconds)
 	prometheus.MustRegister(DomainsCheckedTotal)
 	prometheus.MustRegister(LOCDiscoveriesTotal)
+	prometheus.MustRegister(ScannerDomainsCheckedTotal)
+	prometheus.MustRegister(ScannerLOCFoundTotal)
+	prometheus.MustRegister(LOCCoordinateMismatchesTotal)
+	prometheus.MustRegister(DenylistRejectionsTotal)
 	prometheus.MustRegister(ReaperRunsTotal)
 	prometheus.MustRegister(ReaperBatchesReleasedTotal)
+	prometheus.MustRegister(ReaperBatchesQuarantinedTotal)
+	prometheus.MustRegister(ReaperBatchHeldSeconds)
+	prometheus.MustRegister(ReaperSessionsDeletedTotal)
+	prometheus.MustRegister(StaleRescansQueuedTotal)
+	prometheus.MustRegister(LOCRecordsMarkedMissingTotal)
+	prometheus.MustRegister(LOCRecordsPrunedTotal)
+
+	// Feeder
+	prometheus.MustRegister(FeederResumesTotal)
+	prometheus.MustRegister(FeederResumeLinesSkippedTotal)
+	prometheus.MustRegister(FeederLineCountMismatchesTotal)
+	prometheus.MustRegister(FeederIntegrityFailuresTotal)
+	prometheus.MustRegister(FeederInvalidLinesTotal)
+	prometheus.MustRegister(FeederFileDuration)
+	prometheus.MustRegister(FeederDownloadBytesTotal)
+	prometheus.MustRegister(FeederDownloadErrorsTotal)
 
 	// HTTP
 	prometheus.MustRegister(HTTPRequestsTotal)
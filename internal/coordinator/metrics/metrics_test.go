@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegister(t *testing.T) {
+	Register()
+
+	// Registering again must fail with AlreadyRegisteredError if Register covered it
+	for name, c := range map[string]prometheus.Collector{
+		"locplace_feeder_file_duration_seconds":     FeederFileDuration,
+		"locplace_feeder_download_bytes_total":      FeederDownloadBytesTotal,
+		"locplace_feeder_download_errors_total":     FeederDownloadErrorsTotal,
+		"locplace_stale_rescans_queued_total":       StaleRescansQueuedTotal,
+		"locplace_loc_records_marked_missing_total": LOCRecordsMarkedMissingTotal,
+		"locplace_loc_records_pruned_total":         LOCRecordsPrunedTotal,
+		"locplace_reaper_sessions_deleted_total":    ReaperSessionsDeletedTotal,
+		"locplace_reaper_batch_held_seconds":        ReaperBatchHeldSeconds,
+		"locplace_coordinator_leader":               Leader,
+		"locplace_batch_queue_wait_seconds":         BatchQueueWaitSeconds,
+		"locplace_scanner_domains_checked_total":    ScannerDomainsCheckedTotal,
+		"locplace_scanner_loc_found_total":          ScannerLOCFoundTotal,
+	} {
+		var are prometheus.AlreadyRegisteredError
+		if err := prometheus.Register(c); !errors.As(err, &are) {
+			t.Errorf("%s not registered by Register(): Register again returned %v", name, err)
+		}
+	}
+}
+
+// countersByClient gathers a client-labelled counter from reg.
+func countersByClient(t *testing.T, reg *prometheus.Registry, name string) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	got := make(map[string]float64)
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "client" {
+					got[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return got
+}
+
+func TestRecordScannerThroughput_AttributesClients(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(ScannerDomainsCheckedTotal, ScannerLOCFoundTotal)
+
+	checkedBefore := countersByClient(t, reg, "locplace_scanner_domains_checked_total")
+	foundBefore := countersByClient(t, reg, "locplace_scanner_loc_found_total")
+	RecordScannerThroughput("scanner-a", 1000, 2)
+	RecordScannerThroughput("scanner-b", 500, 0)
+	RecordScannerThroughput("scanner-a", 1000, 1)
+	checked := countersByClient(t, reg, "locplace_scanner_domains_checked_total")
+	found := countersByClient(t, reg, "locplace_scanner_loc_found_total")
+
+	for _, tt := range []struct {
+		client       string
+		checked, loc float64
+	}{
+		{"scanner-a", 2000, 3},
+		{"scanner-b", 500, 0},
+	} {
+		if got := checked[tt.client] - checkedBefore[tt.client]; got != tt.checked {
+			t.Errorf("%s domains checked grew by %v, want %v", tt.client, got, tt.checked)
+		}
+		if got := found[tt.client] - foundBefore[tt.client]; got != tt.loc {
+			t.Errorf("%s LOC found grew by %v, want %v", tt.client, got, tt.loc)
+		}
+	}
+}
+
+func TestLabelCap(t *testing.T) {
+	c := &labelCap{max: 2}
+	for _, tt := range []struct{ in, want string }{
+		{"a", "a"},
+		{"b", "b"},
+		{"c", OtherClientLabel}, // Over the cap
+		{"a", "a"},              // Already seen clients keep their label
+		{"d", OtherClientLabel},
+		{"b", "b"},
+	} {
+		if got := c.label(tt.in); got != tt.want {
+			t.Errorf("label(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
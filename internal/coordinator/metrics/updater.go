@@ -2,7 +2,7 @@ package metrics
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -34,7 +34,7 @@ func NewUpdater(database *db.DB, config UpdaterConfig) *Updater {
 
 // Run starts the updater loop. It blocks until the context is canceled.
 func (u *Updater) Run(ctx context.Context) {
-	log.Printf("Metrics updater started: interval=%s", u.config.Interval)
+	slog.Info("Metrics updater started", "interval", u.config.Interval.String())
 
 	// Update immediately on start
 	u.update(ctx)
@@ -45,7 +45,7 @@ func (u *Updater) Run(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Metrics updater stopped")
+			slog.Info("Metrics updater stopped")
 			return
 		case <-ticker.C:
 			u.update(ctx)
@@ -57,7 +57,7 @@ func (u *Updater) update(ctx context.Context) {
 	// Get metrics snapshot from database
 	snapshot, err := u.db.GetMetricsSnapshot(ctx, u.config.HeartbeatTimeout)
 	if err != nil {
-		log.Printf("Metrics updater: failed to get snapshot: %v", err)
+		slog.Error("Metrics updater: failed to get snapshot", "error", err)
 		return
 	}
 
@@ -68,6 +68,7 @@ func (u *Updater) update(ctx context.Context) {
 	DomainFilesComplete.Set(float64(snapshot.FilesComplete))
 	BatchesPending.Set(float64(snapshot.BatchesPending))
 	BatchesInFlight.Set(float64(snapshot.BatchesInFlight))
+	BatchesQuarantined.Set(float64(snapshot.BatchesQuarantined))
 
 	// Update LOC/scanner gauges
 	LOCRecordsTotal.Set(float64(snapshot.LOCRecordsTotal))
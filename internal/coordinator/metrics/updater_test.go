@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+)
+
+func TestUpdater_RunStopsOnCancel(t *testing.T) {
+	u := NewUpdater(dbtest.Unreachable(t), UpdaterConfig{Interval: time.Hour, HeartbeatTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		u.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond) // Let the first update start
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -31,7 +31,17 @@ func AdminAuth(apiKey string) func(http.Handler) http.Handler {
 }
 
 // ScannerAuth returns middleware that validates scanner bearer tokens.
+// Disabled clients are rejected with 403.
 func ScannerAuth(database *db.DB) func(http.Handler) http.Handler {
+	return scannerAuth(func(ctx context.Context, token string) (*db.ScannerClient, error) {
+		return database.GetClientByToken(ctx, token)
+	})
+}
+
+// clientLookup resolves a bearer token to a client (nil if unknown).
+type clientLookup func(ctx context.Context, token string) (*db.ScannerClient, error)
+
+func scannerAuth(lookup clientLookup) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			auth := r.Header.Get("Authorization")
@@ -41,7 +51,7 @@ func ScannerAuth(database *db.DB) func(http.Handler) http.Handler {
 			}
 
 			token := strings.TrimPrefix(auth, "Bearer ")
-			client, err := database.GetClientByToken(r.Context(), token)
+			client, err := lookup(r.Context(), token)
 			if err != nil {
 				http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
 				return
@@ -50,6 +60,10 @@ func ScannerAuth(database *db.DB) func(http.Handler) http.Handler {
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
+			if client.Disabled {
+				http.Error(w, `{"error":"client disabled"}`, http.StatusForbidden)
+				return
+			}
 
 			ctx := context.WithValue(r.Context(), ClientContextKey, client)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -298,3 +298,49 @@ func TestClientContextKey_Type(t *testing.T) {
 		t.Errorf("ClientContextKey = %v, want %v", ClientContextKey, contextKey("client"))
 	}
 }
+
+func TestScannerAuth_ClientLookup(t *testing.T) {
+	clients := map[string]*db.ScannerClient{
+		"active-token":   {ID: "active", Name: "scanner-1"},
+		"disabled-token": {ID: "disabled", Name: "scanner-2", Disabled: true},
+	}
+	lookup := func(_ context.Context, token string) (*db.ScannerClient, error) {
+		return clients[token], nil
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		wantStatusCode int
+		wantNextCalled bool
+	}{
+		{"active client", "active-token", http.StatusOK, true},
+		{"disabled client", "disabled-token", http.StatusForbidden, false},
+		{"unknown token", "unknown-token", http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				if GetClient(r.Context()) == nil {
+					t.Error("client not set in context")
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			scannerAuth(lookup)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatusCode {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatusCode)
+			}
+			if nextCalled != tt.wantNextCalled {
+				t.Errorf("next called = %v, want %v", nextCalled, tt.wantNextCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures cross-origin access.
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to make requests, e.g.
+	// "https://map.example.com". "*" allows any origin. Empty disables CORS.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in preflighted requests.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflighted requests.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers readable by browser scripts
+	// beyond the CORS-safelisted ones.
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response (0 = unset).
+	MaxAge time.Duration
+}
+
+// CORS returns middleware that adds CORS headers for allowed origins and
+// answers preflight OPTIONS requests itself. Requests from other origins
+// are served without CORS headers, so browsers block scripts from reading them.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			if !anyOrigin {
+				h.Add("Vary", "Origin")
+			}
+			allowed := origin != "" && (anyOrigin || slices.Contains(cfg.AllowedOrigins, origin))
+			if !allowed {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if !preflight {
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if methods != "" {
+				h.Set("Access-Control-Allow-Methods", methods)
+			}
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
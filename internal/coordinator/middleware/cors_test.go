@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testCORS = CORSConfig{
+	AllowedOrigins: []string{"https://map.example.com"},
+	AllowedMethods: []string{"GET", "HEAD"},
+	AllowedHeaders: []string{"If-None-Match"},
+	ExposedHeaders: []string{"ETag"},
+	MaxAge:         time.Hour,
+}
+
+// corsRequest sends a request through CORS middleware and reports whether
+// the wrapped handler ran.
+func corsRequest(cfg CORSConfig, method, origin string, header http.Header) (*httptest.ResponseRecorder, bool) {
+	nextCalled := false
+	h := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		nextCalled = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(method, "/api/public/records", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec, nextCalled
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	rec, nextCalled := corsRequest(testCORS, http.MethodGet, "https://map.example.com", nil)
+
+	if !nextCalled || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, nextCalled = %v; want 200 from the handler", rec.Code, nextCalled)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://map.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "ETag" {
+		t.Errorf("Access-Control-Expose-Headers = %q, want ETag", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	rec, nextCalled := corsRequest(testCORS, http.MethodGet, "https://evil.example.net", nil)
+
+	if !nextCalled || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, nextCalled = %v; want the request served", rec.Code, nextCalled)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	rec, nextCalled := corsRequest(testCORS, http.MethodOptions, "https://map.example.com", http.Header{
+		"Access-Control-Request-Method":  {"GET"},
+		"Access-Control-Request-Headers": {"if-none-match"},
+	})
+
+	if nextCalled {
+		t.Error("preflight reached the handler")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", rec.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://map.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD",
+		"Access-Control-Allow-Headers": "If-None-Match",
+		"Access-Control-Max-Age":       "3600",
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestCORS_PreflightDisallowedOrigin(t *testing.T) {
+	rec, nextCalled := corsRequest(testCORS, http.MethodOptions, "https://evil.example.net", http.Header{
+		"Access-Control-Request-Method": {"GET"},
+	})
+
+	if nextCalled {
+		t.Error("preflight reached the handler")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("Access-Control-Allow-Methods = %q, want none", got)
+	}
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	cfg := testCORS
+	cfg.AllowedOrigins = []string{"*"}
+	rec, _ := corsRequest(cfg, http.MethodGet, "https://anywhere.example.org", nil)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q, want none for a wildcard origin", got)
+	}
+}
+
+func TestCORS_Disabled(t *testing.T) {
+	rec, nextCalled := corsRequest(CORSConfig{}, http.MethodGet, "https://map.example.com", nil)
+
+	if !nextCalled {
+		t.Fatal("handler not called")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit returns middleware that limits each client IP to perMinute
+// requests per minute using a token bucket that holds up to perMinute
+// tokens. Requests over the limit get 429 with a Retry-After header.
+// Run it after chi's RealIP so proxied clients are told apart.
+// perMinute <= 0 disables limiting.
+func RateLimit(perMinute int) func(http.Handler) http.Handler {
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return newRateLimiter(perMinute, time.Now).middleware
+}
+
+// bucket is one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last refilled
+}
+
+// rateLimiter tracks a token bucket per client IP.
+type rateLimiter struct {
+	capacity float64
+	perSec   float64 // Refill rate
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(perMinute int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		capacity:  float64(perMinute),
+		perSec:    float64(perMinute) / 60,
+		now:       now,
+		buckets:   make(map[string]*bucket),
+		lastSweep: now(),
+	}
+}
+
+// allow takes a token from key's bucket. If the bucket is empty it returns
+// false and how long until a token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.capacity, b.tokens+now.Sub(b.last).Seconds()*l.perSec)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perSec * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// would be identical. It runs at most once a minute. Callers hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSec >= l.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.allow(clientIP(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the request's remote IP, without the port when present.
+// RealIP replaces RemoteAddr with a bare IP for proxied requests.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
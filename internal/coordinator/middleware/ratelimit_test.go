@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for rate limiter tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(perMinute int) (http.Handler, *fakeClock, *rateLimiter) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := newRateLimiter(perMinute, clock.now)
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	return h, clock, l
+}
+
+func doFrom(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/public/stats", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit_RejectsOverLimit(t *testing.T) {
+	h, _, _ := newTestLimiter(3)
+
+	for i := range 3 {
+		if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+
+	rec := doFrom(h, "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over limit: status = %d, want 429", rec.Code)
+	}
+	// One token refills every 20s at 3 per minute
+	if got := rec.Header().Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %q, want 20", got)
+	}
+}
+
+func TestRateLimit_Refills(t *testing.T) {
+	h, clock, _ := newTestLimiter(3)
+
+	for range 3 {
+		doFrom(h, "192.0.2.1:1234")
+	}
+	if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 with an empty bucket", rec.Code)
+	}
+
+	clock.advance(20 * time.Second)
+	if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after one token refilled", rec.Code)
+	}
+	if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 after using the refilled token", rec.Code)
+	}
+
+	// A long idle period refills only up to capacity
+	clock.advance(time.Hour)
+	for i := range 3 {
+		if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d after idle: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+	if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429 beyond capacity", rec.Code)
+	}
+}
+
+func TestRateLimit_PerClientIP(t *testing.T) {
+	h, _, _ := newTestLimiter(1)
+
+	if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("first client: status = %d, want 200", rec.Code)
+	}
+	// Same IP from another port shares the bucket
+	if rec := doFrom(h, "192.0.2.1:5678"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("first client, new port: status = %d, want 429", rec.Code)
+	}
+	// RealIP leaves a bare IP for proxied requests
+	if rec := doFrom(h, "198.51.100.7"); rec.Code != http.StatusOK {
+		t.Errorf("second client: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestRateLimit_SweepsIdleBuckets(t *testing.T) {
+	h, clock, l := newTestLimiter(60)
+
+	doFrom(h, "192.0.2.1:1234")
+	doFrom(h, "198.51.100.7:1234")
+
+	clock.advance(2 * time.Minute)
+	doFrom(h, "203.0.113.9:1234")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets = %d after sweep, want only the new client's", len(l.buckets))
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	h := RateLimit(0)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i := range 100 {
+		if rec := doFrom(h, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+}
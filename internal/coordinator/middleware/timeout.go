@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WriteTimeout returns middleware that replaces the server's write timeout
+// with d for the wrapped routes, for responses that legitimately take longer
+// to stream than the server-wide limit. d == 0 removes the deadline.
+func WriteTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var deadline time.Time
+			if d > 0 {
+				deadline = time.Now().Add(d)
+			}
+			if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+				slog.Debug("Can't extend write deadline", "path", r.URL.Path, "error", err)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteTimeout(t *testing.T) {
+	// A handler that writes after the server's write timeout has passed
+	slow := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done") //nolint:errcheck // Test server
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		wantOK  bool
+	}{
+		{"server timeout", slow, false},
+		{"extended", WriteTimeout(5 * time.Second)(slow), true},
+		{"removed", WriteTimeout(0)(slow), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewUnstartedServer(tt.handler)
+			srv.Config.WriteTimeout = 50 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			var body []byte
+			if err == nil {
+				body, err = io.ReadAll(resp.Body)
+				resp.Body.Close() //nolint:errcheck // Close error not actionable
+			}
+			gotOK := err == nil && string(body) == "done"
+			if gotOK != tt.wantOK {
+				t.Errorf("response complete = %v (body %q, err %v), want %v", gotOK, body, err, tt.wantOK)
+			}
+		})
+	}
+}
@@ -3,61 +3,144 @@ package reaper
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"math/rand/v2"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/locplace/scanner/internal/coordinator/db"
 	"github.com/locplace/scanner/internal/coordinator/metrics"
 )
 
+// Reasons a batch is released, as reported in ReaperBatchesReleasedTotal.
+const (
+	ReasonDeadSession = "dead_session" // The claiming session stopped heartbeating
+	ReasonTimeout     = "timeout"      // A batch without a session was in flight too long
+)
+
 // Reaper periodically releases stale batch assignments.
 type Reaper struct {
 	DB               *db.DB
 	Interval         time.Duration
 	BatchTimeout     time.Duration
 	HeartbeatTimeout time.Duration
+	// MaxAttempts is how many times a batch may be claimed before the reaper
+	// quarantines it instead of resetting it. Zero disables quarantine.
+	MaxAttempts int
+	// SessionTTL is how long after its last heartbeat a session is deleted.
+	// Zero keeps sessions forever.
+	SessionTTL time.Duration
+	// Jitter varies each wait by up to ±Jitter×Interval (0 to 1), so
+	// replicas started together drift apart instead of reaping in lockstep.
+	// Zero waits exactly Interval.
+	Jitter float64
+
+	running atomic.Bool
+}
+
+// Running reports whether Run is active.
+func (r *Reaper) Running() bool {
+	return r.running.Load()
 }
 
 // Run starts the reaper loop. It blocks until the context is canceled.
 func (r *Reaper) Run(ctx context.Context) {
-	ticker := time.NewTicker(r.Interval)
-	defer ticker.Stop()
+	r.running.Store(true)
+	defer r.running.Store(false)
 
-	log.Printf("Reaper started: interval=%s, batch_timeout=%s, heartbeat_timeout=%s",
-		r.Interval, r.BatchTimeout, r.HeartbeatTimeout)
+	// Export both reasons from the start so rate() sees the first release
+	metrics.ReaperBatchesReleasedTotal.WithLabelValues(ReasonDeadSession)
+	metrics.ReaperBatchesReleasedTotal.WithLabelValues(ReasonTimeout)
 
-	// Run immediately on startup, then on each tick
+	slog.Info("Reaper started", "interval", r.Interval.String(), "jitter", r.Jitter,
+		"batch_timeout", r.BatchTimeout.String(), "heartbeat_timeout", r.HeartbeatTimeout.String(),
+		"max_attempts", r.MaxAttempts, "session_ttl", r.SessionTTL.String())
+
+	// Run immediately on startup, then after each wait
 	for {
 		r.runOnce(ctx)
 
 		select {
 		case <-ctx.Done():
-			log.Println("Reaper stopped")
+			slog.Info("Reaper stopped")
 			return
-		case <-ticker.C:
+		case <-time.After(r.nextInterval(rand.Float64)):
 		}
 	}
 }
 
+// nextInterval returns the wait before the next run: Interval scaled by a
+// random factor in [1-Jitter, 1+Jitter), with Jitter clamped to [0, 1].
+// random returns values in [0, 1), like rand.Float64.
+func (r *Reaper) nextInterval(random func() float64) time.Duration {
+	jitter := min(max(r.Jitter, 0), 1)
+	if jitter == 0 {
+		return r.Interval
+	}
+	factor := 1 + jitter*(2*random()-1)
+	return time.Duration(float64(r.Interval) * factor)
+}
+
 func (r *Reaper) runOnce(ctx context.Context) {
 	metrics.ReaperRunsTotal.Inc()
 
 	// Reset batches from dead sessions (sessions that haven't heartbeated)
 	// This is the primary mechanism for reclaiming batches from crashed scanners
-	releasedFromDeadSessions, err := r.DB.ResetBatchesFromDeadSessions(ctx, r.HeartbeatTimeout)
+	fromDeadSessions, err := r.DB.ResetBatchesFromDeadSessions(ctx, r.HeartbeatTimeout, r.MaxAttempts)
 	if err != nil {
-		log.Printf("Reaper error resetting batches from dead sessions: %v", err)
-	} else if releasedFromDeadSessions > 0 {
-		metrics.ReaperBatchesReleasedTotal.Add(float64(releasedFromDeadSessions))
-		log.Printf("Reaper reset %d batches from dead sessions", releasedFromDeadSessions)
+		slog.Error("Reaper: error resetting batches from dead sessions", "error", err)
+	} else {
+		r.recordReleased(ReasonDeadSession, fromDeadSessions)
 	}
 
 	// Reset stale batches without session_id (backwards compat for old batches)
-	released, err := r.DB.ResetStaleBatches(ctx, r.BatchTimeout)
+	stale, err := r.DB.ResetStaleBatches(ctx, r.BatchTimeout, r.MaxAttempts)
 	if err != nil {
-		log.Printf("Reaper error resetting stale batches: %v", err)
-	} else if released > 0 {
-		metrics.ReaperBatchesReleasedTotal.Add(float64(released))
-		log.Printf("Reaper reset %d stale batches (no session)", released)
+		slog.Error("Reaper: error resetting stale batches", "error", err)
+	} else {
+		r.recordReleased(ReasonTimeout, stale)
+	}
+
+	// Delete long-dead sessions; scanners get a new session ID on every start
+	if r.SessionTTL > 0 {
+		deleted, err := r.DB.DeleteExpiredSessions(ctx, r.SessionTTL)
+		if err != nil {
+			slog.Error("Reaper: error deleting expired sessions", "error", err)
+		} else if deleted > 0 {
+			metrics.ReaperSessionsDeletedTotal.Add(float64(deleted))
+			slog.Info("Reaper: deleted expired sessions", "sessions", deleted)
+		}
+	}
+
+	// Forget old submission idempotency keys
+	if _, err := r.DB.DeleteExpiredSubmissionKeys(ctx, db.SubmissionKeyTTL); err != nil {
+		slog.Error("Reaper: error deleting expired submission keys", "error", err)
+	}
+}
+
+// recordReleased updates metrics and logs for batches released for reason.
+func (r *Reaper) recordReleased(reason string, res db.ReleasedBatches) {
+	if res.Released > 0 {
+		metrics.ReaperBatchesReleasedTotal.WithLabelValues(reason).Add(float64(res.Released))
+		slog.Info("Reaper: reset batches", "reason", reason, "batches", res.Released)
+	}
+	r.recordQuarantined(res.Quarantined)
+	observeHeld(metrics.ReaperBatchHeldSeconds, res.Held)
+}
+
+// observeHeld records how long each released batch was in flight.
+func observeHeld(o prometheus.Observer, held []time.Duration) {
+	for _, d := range held {
+		o.Observe(d.Seconds())
+	}
+}
+
+func (r *Reaper) recordQuarantined(n int) {
+	if n == 0 {
+		return
 	}
+	metrics.ReaperBatchesQuarantinedTotal.Add(float64(n))
+	slog.Warn("Reaper: quarantined batches", "batches", n, "max_attempts", r.MaxAttempts)
 }
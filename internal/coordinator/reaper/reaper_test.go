@@ -0,0 +1,143 @@
+package reaper
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+	"github.com/locplace/scanner/internal/coordinator/metrics"
+)
+
+func TestRun_StopsOnCancel(t *testing.T) {
+	r := &Reaper{
+		DB:               dbtest.Unreachable(t),
+		Interval:         time.Hour,
+		BatchTimeout:     time.Minute,
+		HeartbeatTimeout: time.Minute,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	// Wait for Run to start before canceling
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.Running() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if r.Running() {
+		t.Error("Running() = true after Run returned")
+	}
+}
+
+// observations records values passed to Observe.
+type observations []float64
+
+func (o *observations) Observe(v float64) { *o = append(*o, v) }
+
+func TestObserveHeld(t *testing.T) {
+	var got observations
+	observeHeld(&got, []time.Duration{90 * time.Second, 2 * time.Hour})
+
+	if len(got) != 2 || got[0] != 90 || got[1] != 7200 {
+		t.Errorf("observed %v, want [90 7200] seconds", got)
+	}
+}
+
+// releasedByReason gathers locplace_reaper_batches_released_total by reason.
+func releasedByReason(t *testing.T, reg *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	got := make(map[string]float64)
+	for _, mf := range families {
+		if mf.GetName() != "locplace_reaper_batches_released_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "reason" {
+					got[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return got
+}
+
+func TestRecordReleased_Reasons(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metrics.ReaperBatchesReleasedTotal)
+	r := &Reaper{}
+
+	before := releasedByReason(t, reg)
+	r.recordReleased(ReasonDeadSession, db.ReleasedBatches{Released: 3})
+	r.recordReleased(ReasonTimeout, db.ReleasedBatches{Released: 2})
+	r.recordReleased(ReasonDeadSession, db.ReleasedBatches{Quarantined: 4}) // Not released
+	after := releasedByReason(t, reg)
+
+	if got := after[ReasonDeadSession] - before[ReasonDeadSession]; got != 3 {
+		t.Errorf("dead_session grew by %v, want 3", got)
+	}
+	if got := after[ReasonTimeout] - before[ReasonTimeout]; got != 2 {
+		t.Errorf("timeout grew by %v, want 2", got)
+	}
+}
+
+func TestNextInterval_WithinJitterBounds(t *testing.T) {
+	r := &Reaper{Interval: time.Minute, Jitter: 0.25}
+	lo, hi := 45*time.Second, 75*time.Second
+
+	var sawLow, sawHigh bool
+	for range 10000 {
+		d := r.nextInterval(rand.Float64)
+		if d < lo || d >= hi {
+			t.Fatalf("nextInterval = %s, want within [%s, %s)", d, lo, hi)
+		}
+		sawLow = sawLow || d < time.Minute
+		sawHigh = sawHigh || d > time.Minute
+	}
+	if !sawLow || !sawHigh {
+		t.Errorf("intervals not spread around Interval (below: %v, above: %v)", sawLow, sawHigh)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		random float64
+		want   time.Duration
+	}{
+		{"no jitter", 0, 0.9, time.Minute},
+		{"negative jitter", -0.5, 0.9, time.Minute},
+		{"lowest", 0.5, 0, 30 * time.Second},
+		{"middle", 0.5, 0.5, time.Minute},
+		{"near highest", 0.5, 0.75, 75 * time.Second},
+		{"jitter clamped to 1", 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reaper{Interval: time.Minute, Jitter: tt.jitter}
+			if got := r.nextInterval(func() float64 { return tt.random }); got != tt.want {
+				t.Errorf("nextInterval = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
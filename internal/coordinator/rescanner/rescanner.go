@@ -0,0 +1,95 @@
+// Package rescanner periodically re-queues stale LOC records for scanning so
+// records that change or disappear are noticed, and prunes records that have
+// stayed missing past a grace period.
+package rescanner
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/metrics"
+)
+
+// Config holds configuration for the rescanner.
+type Config struct {
+	Interval   time.Duration // How often to look for stale records
+	StaleAfter time.Duration // Records not seen for this long are rescanned (0 disables)
+	PruneAfter time.Duration // Records missing for this long are deleted (0 disables)
+	BatchSize  int           // FQDNs per rescan batch
+	MaxPerRun  int           // Most FQDNs queued per run
+}
+
+// Rescanner periodically queues batches of stale LOC records and prunes
+// missing ones.
+type Rescanner struct {
+	db     *db.DB
+	config Config
+}
+
+// New creates a new rescanner.
+func New(database *db.DB, config Config) *Rescanner {
+	return &Rescanner{
+		db:     database,
+		config: config,
+	}
+}
+
+// Run starts the rescan loop. It blocks until the context is canceled.
+func (r *Rescanner) Run(ctx context.Context) {
+	slog.Info("Stale record rescanner started", "interval", r.config.Interval.String(),
+		"stale_after", r.config.StaleAfter.String(), "max_per_run", r.config.MaxPerRun,
+		"prune_after", r.config.PruneAfter.String())
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if r.config.StaleAfter > 0 {
+			r.queueStale(ctx)
+		}
+		if r.config.PruneAfter > 0 {
+			r.pruneMissing(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stale record rescanner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rescanner) queueStale(ctx context.Context) {
+	fqdns, err := r.db.GetStaleLOCRecords(ctx, r.config.StaleAfter, r.config.MaxPerRun)
+	if err != nil {
+		slog.Error("Rescanner: failed to find stale records", "error", err)
+		return
+	}
+	if len(fqdns) == 0 {
+		return
+	}
+
+	batches := slices.Collect(slices.Chunk(fqdns, max(r.config.BatchSize, 1)))
+	if err := r.db.CreateRescanBatches(ctx, batches); err != nil {
+		slog.Error("Rescanner: failed to queue rescan batches", "error", err)
+		return
+	}
+	metrics.StaleRescansQueuedTotal.Add(float64(len(fqdns)))
+	slog.Info("Rescanner: queued stale records", "fqdns", len(fqdns), "batches", len(batches))
+}
+
+func (r *Rescanner) pruneMissing(ctx context.Context) {
+	pruned, err := r.db.PruneMissingLOCRecords(ctx, r.config.PruneAfter)
+	if err != nil {
+		slog.Error("Rescanner: failed to prune missing records", "error", err)
+		return
+	}
+	if pruned > 0 {
+		metrics.LOCRecordsPrunedTotal.Add(float64(pruned))
+		slog.Info("Rescanner: pruned missing records", "records", pruned, "missing_for", r.config.PruneAfter.String())
+	}
+}
@@ -0,0 +1,34 @@
+package rescanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+)
+
+func TestRun_StopsOnCancel(t *testing.T) {
+	r := New(dbtest.Unreachable(t), Config{
+		Interval:   time.Hour,
+		StaleAfter: 24 * time.Hour,
+		BatchSize:  100,
+		MaxPerRun:  1000,
+		PruneAfter: 24 * time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond) // Let the first pass start
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -10,14 +10,66 @@ import (
 
 	"github.com/locplace/scanner/frontend"
 	"github.com/locplace/scanner/internal/coordinator/db"
+	"github.com/locplace/scanner/internal/coordinator/feeder"
 	"github.com/locplace/scanner/internal/coordinator/handlers"
 	"github.com/locplace/scanner/internal/coordinator/middleware"
+	"github.com/locplace/scanner/pkg/api"
 )
 
 // Config holds server configuration.
 type Config struct {
 	AdminAPIKey      string
 	HeartbeatTimeout time.Duration
+	// MaxRequestBodyBytes caps scanner request bodies (0 = handlers default).
+	MaxRequestBodyBytes int64
+	// OverwriteMismatchedCoords makes the server's parse of raw_record win
+	// over scanner-computed coordinates when they disagree.
+	OverwriteMismatchedCoords bool
+	// GitHubToken authenticates admin-triggered file discovery (optional).
+	GitHubToken string
+	// BatchSize is the number of domains per batch created from manual
+	// scan uploads (0 = handlers default).
+	BatchSize int
+	// Capacity is notified when scanners claim or complete batches, waking
+	// the feeder if it's waiting for queue room (optional).
+	Capacity *feeder.CapacitySignal
+	// Feeder is paused and resumed via the admin API (optional; without it
+	// the feeder endpoints and file discovery return 503).
+	Feeder *feeder.Feeder
+	// RecordHub carries stored records to /api/public/records/stream
+	// (optional; the stream returns 503 without it).
+	RecordHub *handlers.RecordHub
+	// PublicRateLimit caps requests per minute per client IP to the public
+	// API (0 = unlimited).
+	PublicRateLimit int
+	// StreamWriteTimeout replaces the server's write timeout for the
+	// GeoJSON exports, which can take minutes to stream (0 = none).
+	StreamWriteTimeout time.Duration
+	// CORS configures cross-origin access to the public API (disabled
+	// without allowed origins).
+	CORS middleware.CORSConfig
+	// ScannerConfig is the settings recommended to scanners at
+	// /api/scanner/config.
+	ScannerConfig api.ScannerConfigResponse
+	// Components maps background component names to a func reporting
+	// whether they are running; all must be running for /readyz to pass.
+	Components map[string]func() bool
+}
+
+// compressedTypes are the response content types gzipped for clients that
+// accept it. Event streams and already-compressed content are left alone.
+var compressedTypes = []string{
+	"application/json",
+	"application/geo+json",
+	"application/geo+json-seq",
+	"text/html",
+	"text/plain",
+}
+
+// compressMiddleware compresses compressedTypes responses, adding
+// Vary: Accept-Encoding so caches keep encodings apart.
+func compressMiddleware() func(http.Handler) http.Handler {
+	return chimw.Compress(5, compressedTypes...)
 }
 
 // NewServer creates a new HTTP server with all routes configured.
@@ -28,19 +80,32 @@ func NewServer(database *db.DB, cfg Config) http.Handler {
 	r.Use(chimw.Logger)
 	r.Use(chimw.Recoverer)
 	r.Use(chimw.RealIP)
-	r.Use(chimw.Compress(5, "application/json", "application/geo+json", "text/html", "text/plain"))
 
 	// Initialize handlers
 	adminHandlers := &handlers.AdminHandlers{
 		DB:               database,
 		HeartbeatTimeout: cfg.HeartbeatTimeout,
+		GitHubToken:      cfg.GitHubToken,
+		Feeder:           cfg.Feeder,
+		BatchSize:        cfg.BatchSize,
 	}
 	scannerHandlers := &handlers.ScannerHandlers{
-		DB: database,
+		DB:                        database,
+		MaxBodyBytes:              cfg.MaxRequestBodyBytes,
+		OverwriteMismatchedCoords: cfg.OverwriteMismatchedCoords,
+		Capacity:                  cfg.Capacity,
+		Hub:                       cfg.RecordHub,
+		RecommendedConfig:         cfg.ScannerConfig,
 	}
 	publicHandlers := &handlers.PublicHandlers{
 		DB:               database,
 		HeartbeatTimeout: cfg.HeartbeatTimeout,
+		Feeder:           cfg.Feeder,
+		Hub:              cfg.RecordHub,
+	}
+	healthHandlers := &handlers.HealthHandlers{
+		DB:         database,
+		Components: cfg.Components,
 	}
 
 	// Admin routes (authenticated with API key)
@@ -49,9 +114,24 @@ func NewServer(database *db.DB, cfg Config) http.Handler {
 		r.Post("/clients", adminHandlers.RegisterClient)
 		r.Get("/clients", adminHandlers.ListClients)
 		r.Delete("/clients/{id}", adminHandlers.DeleteClient)
+		r.Post("/clients/{id}/rotate-token", adminHandlers.RotateClientToken)
+		r.Post("/clients/{id}/disable", adminHandlers.DisableClient)
+		r.Post("/clients/{id}/enable", adminHandlers.EnableClient)
 		r.Post("/discover-files", adminHandlers.DiscoverFiles)
+		r.Post("/feeder/pause", adminHandlers.PauseFeeder)
+		r.Post("/feeder/resume", adminHandlers.ResumeFeeder)
 		r.Post("/reset-scan", adminHandlers.ResetScan)
 		r.Post("/manual-scan", adminHandlers.ManualScan)
+		r.Get("/coverage", adminHandlers.Coverage)
+		r.Get("/files", adminHandlers.ListFiles)
+		r.Get("/batches/failed", adminHandlers.ListFailedBatches)
+		r.Get("/batches/stats", adminHandlers.BatchQueueStats)
+		r.Post("/batches/{id}/requeue", adminHandlers.RequeueBatch)
+		r.Delete("/records/{fqdn}", adminHandlers.DeleteRecord)
+		r.Patch("/records/{fqdn}", adminHandlers.PatchRecord)
+		r.Get("/denylist", adminHandlers.ListDenylist)
+		r.Post("/denylist", adminHandlers.AddDenylistEntry)
+		r.Delete("/denylist/{pattern}", adminHandlers.RemoveDenylistEntry)
 	})
 
 	// Scanner routes (authenticated with bearer token)
@@ -60,20 +140,28 @@ func NewServer(database *db.DB, cfg Config) http.Handler {
 		r.Post("/jobs", scannerHandlers.GetJobs)
 		r.Post("/heartbeat", scannerHandlers.Heartbeat)
 		r.Post("/results", scannerHandlers.SubmitResults)
+		r.Post("/return", scannerHandlers.ReturnBatch)
+		r.Get("/config", scannerHandlers.GetConfig)
 	})
 
 	// Public routes (no authentication)
 	r.Route("/api/public", func(r chi.Router) {
+		r.Use(middleware.CORS(cfg.CORS)) // Before rate limiting, so preflights are free and 429s readable
+		r.Use(middleware.RateLimit(cfg.PublicRateLimit))
+		r.Use(compressMiddleware())
 		r.Get("/records", publicHandlers.ListRecords)
-		r.Get("/records.geojson", publicHandlers.GetRecordsGeoJSON)
+		r.With(middleware.WriteTimeout(cfg.StreamWriteTimeout)).Get("/records.geojson", publicHandlers.GetRecordsGeoJSON)
+		r.With(middleware.WriteTimeout(cfg.StreamWriteTimeout)).Get("/records.geojsonl", publicHandlers.GetRecordsGeoJSONL)
+		r.Get("/records/stream", publicHandlers.StreamRecords)
+		r.Get("/records/near", publicHandlers.ListRecordsNear)
+		r.Get("/domains", publicHandlers.ListRootDomains)
 		r.Get("/stats", publicHandlers.GetStats)
+		r.Get("/stats/history", publicHandlers.GetStatsHistory)
 	})
 
-	// Health check
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("ok")) // Error is client disconnect, can't recover
-	})
+	// Liveness and readiness probes
+	r.Get("/health", healthHandlers.Health)
+	r.Get("/readyz", healthHandlers.Ready)
 
 	// Serve frontend (must be last to not override API routes)
 	r.Handle("/*", frontend.Handler())
@@ -0,0 +1,117 @@
+package coordinator
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewServer_GzipsPublicResponses(t *testing.T) {
+	// Invalid parameters are rejected before any database access
+	srv := httptest.NewServer(NewServer(nil, Config{}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/public/records?bbox=1,2,3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req) // Don't let the client decompress transparently
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := resp.Header.Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", got)
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(zr).Decode(&body); err != nil {
+		t.Fatalf("decompressed body is not JSON: %v", err)
+	}
+	if body["error"] == "" {
+		t.Errorf("decompressed body = %v, want an error message", body)
+	}
+}
+
+func TestNewServer_NoGzipWithoutAcceptEncoding(t *testing.T) {
+	srv := httptest.NewServer(NewServer(nil, Config{}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/public/records?bbox=1,2,3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewServer_NoGzipOutsidePublicAPI(t *testing.T) {
+	srv := httptest.NewServer(NewServer(nil, Config{AdminAPIKey: "test-key"}))
+	defer srv.Close()
+
+	// Rejected by auth before any database access
+	for _, path := range []string{"/api/admin/coverage", "/api/scanner/jobs"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: request: %v", path, err)
+		}
+		resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want %d", path, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if got := resp.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", path, got)
+		}
+	}
+}
+
+func TestNewServer_FeederDisabled(t *testing.T) {
+	// Without a feeder, its admin endpoints report it unavailable rather
+	// than failing; manual scan and scanner routes don't depend on it
+	srv := httptest.NewServer(NewServer(nil, Config{AdminAPIKey: "test-key"}))
+	defer srv.Close()
+
+	for _, path := range []string{"/api/admin/discover-files", "/api/admin/feeder/pause", "/api/admin/feeder/resume"} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		resp.Body.Close() //nolint:errcheck // Close error not actionable
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("%s: status = %d, want %d", path, resp.StatusCode, http.StatusServiceUnavailable)
+		}
+	}
+}
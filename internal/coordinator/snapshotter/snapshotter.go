@@ -0,0 +1,57 @@
+// Package snapshotter periodically records stats snapshots for history charts.
+package snapshotter
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db"
+)
+
+// Config holds configuration for the snapshotter.
+type Config struct {
+	Interval         time.Duration
+	HeartbeatTimeout time.Duration
+}
+
+// Snapshotter periodically writes stats snapshots to the database.
+type Snapshotter struct {
+	db     *db.DB
+	config Config
+}
+
+// New creates a new snapshotter.
+func New(database *db.DB, config Config) *Snapshotter {
+	return &Snapshotter{
+		db:     database,
+		config: config,
+	}
+}
+
+// Run starts the snapshot loop. It blocks until the context is canceled.
+func (s *Snapshotter) Run(ctx context.Context) {
+	slog.Info("Stats snapshotter started", "interval", s.config.Interval.String())
+
+	// Capture immediately on start
+	s.capture(ctx)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stats snapshotter stopped")
+			return
+		case <-ticker.C:
+			s.capture(ctx)
+		}
+	}
+}
+
+func (s *Snapshotter) capture(ctx context.Context) {
+	if _, err := s.db.InsertStatsSnapshot(ctx, s.config.HeartbeatTimeout); err != nil {
+		slog.Error("Stats snapshotter: failed to insert snapshot", "error", err)
+	}
+}
@@ -0,0 +1,28 @@
+package snapshotter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/internal/coordinator/db/dbtest"
+)
+
+func TestRun_StopsOnCancel(t *testing.T) {
+	s := New(dbtest.Unreachable(t), Config{Interval: time.Hour, HeartbeatTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond) // Let the first capture start
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
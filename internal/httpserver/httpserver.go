@@ -0,0 +1,34 @@
+// Package httpserver starts HTTP servers so that bind failures are reported
+// at startup instead of being lost in a background goroutine.
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Start binds srv.Addr and serves srv in the background. A bind failure,
+// such as the port already being in use, is returned immediately so callers
+// can fail fast. Once serving, any error other than http.ErrServerClosed is
+// sent on the returned channel, which is closed when the server stops.
+func Start(srv *http.Server) (<-chan error, error) {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+	return errs, nil
+}
@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStart_Serves(t *testing.T) {
+	srv := &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			io.WriteString(w, "ok") //nolint:errcheck // Test server
+		}),
+	}
+	// Bind ourselves first to learn a free port, then hand it to Start
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv.Addr = ln.Addr().String()
+	ln.Close() //nolint:errcheck // Only needed the port
+
+	errs, err := Start(srv)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	resp, err := http.Get("http://" + srv.Addr)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close() //nolint:errcheck // Close error not actionable
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want ok", body)
+	}
+
+	// A clean shutdown closes the channel without reporting an error
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err, ok := <-errs:
+		if ok {
+			t.Errorf("error after shutdown = %v, want channel closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("error channel not closed after shutdown")
+	}
+}
+
+func TestStart_PortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close() //nolint:errcheck // Close error not actionable
+
+	errs, err := Start(&http.Server{Addr: ln.Addr().String()})
+	if err == nil {
+		t.Fatal("Start succeeded on a port that is already in use")
+	}
+	if errs != nil {
+		t.Error("Start returned an error channel alongside a bind error")
+	}
+}
+
+func TestTimeouts_Apply(t *testing.T) {
+	srv := &http.Server{}
+	Timeouts{Read: time.Second, ReadHeader: 2 * time.Second, Write: 3 * time.Second, Idle: 4 * time.Second}.Apply(srv)
+
+	if srv.ReadTimeout != time.Second || srv.ReadHeaderTimeout != 2*time.Second ||
+		srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Errorf("server timeouts = read %s, header %s, write %s, idle %s",
+			srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
@@ -0,0 +1,33 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// Timeouts are an http.Server's connection timeouts. Zero disables a
+// timeout, except that a zero ReadHeader falls back to Read as in http.Server.
+type Timeouts struct {
+	Read       time.Duration
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used unless configured otherwise.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:       30 * time.Second,
+		ReadHeader: 10 * time.Second,
+		Write:      30 * time.Second,
+		Idle:       2 * time.Minute,
+	}
+}
+
+// Apply sets srv's timeouts.
+func (t Timeouts) Apply(srv *http.Server) {
+	srv.ReadTimeout = t.Read
+	srv.ReadHeaderTimeout = t.ReadHeader
+	srv.WriteTimeout = t.Write
+	srv.IdleTimeout = t.Idle
+}
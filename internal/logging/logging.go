@@ -0,0 +1,41 @@
+// Package logging configures structured JSON logging shared by the coordinator and scanner.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ParseLevel converts a LOG_LEVEL value (debug, info, warn, error) to a slog level.
+// An empty string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// New returns a logger writing JSON lines to w at the given minimum level.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// Setup installs a JSON logger on stderr as the process default, so both
+// slog calls and the standard log package emit structured output.
+// An invalid level falls back to info and is reported as an error.
+func Setup(levelName string) error {
+	level, err := ParseLevel(levelName)
+	slog.SetDefault(New(os.Stderr, level))
+	return err
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"", slog.LevelInfo, false},
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"warning", slog.LevelWarn, false},
+		{" error ", slog.LevelError, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLevel(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_EmitsStructuredFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	// A representative event: a worker submitting a batch
+	logger.Info("submitted batch", "worker", 3, "batch_id", int64(42), "fqdns", 1000, "loc_records", 2)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v (%q)", err, buf.String())
+	}
+
+	want := map[string]any{
+		"level":       "INFO",
+		"msg":         "submitted batch",
+		"worker":      float64(3),
+		"batch_id":    float64(42),
+		"fqdns":       float64(1000),
+		"loc_records": float64(2),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Error("missing time field")
+	}
+}
+
+func TestNew_FiltersBelowLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+
+	logger.Info("dropped")
+	logger.Debug("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("messages below warn were logged: %q", buf.String())
+	}
+
+	logger.Warn("kept")
+	if buf.Len() == 0 {
+		t.Error("warn message was not logged")
+	}
+}
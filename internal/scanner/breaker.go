@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"    // Calls go through
+	BreakerOpen     = "open"      // Calls are held back until the cool-down ends
+	BreakerHalfOpen = "half-open" // One probe call is let through to test recovery
+)
+
+// breakerProbeWait is how often callers held back by a half-open breaker
+// check whether the probe has closed it.
+const breakerProbeWait = time.Second
+
+// CircuitBreaker pauses coordinator calls from all of a scanner's workers
+// once the coordinator looks down, so they don't each keep hammering it and
+// then rush back at once when it recovers. It opens after Threshold
+// consecutive failed calls across all workers, holds every call back for
+// Cooldown, then half-opens to let a single probe through: the probe's
+// success closes it again, its failure reopens it for another cool-down.
+//
+// A nil *CircuitBreaker lets every call through.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	now func() time.Time // time.Now if nil; tests replace it
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker creates a closed breaker that opens after threshold
+// consecutive failures and stays open for cooldown.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown, state: BreakerClosed}
+}
+
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// State returns the breaker's current state.
+func (b *CircuitBreaker) State() string {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a coordinator call may be made now, and if not, how
+// long to wait before asking again. Once the cool-down has passed the first
+// caller is let through as the probe; its outcome must be reported with
+// Success or Failure, and everyone else is held back until then.
+func (b *CircuitBreaker) Allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if remaining := b.openedAt.Add(b.Cooldown).Sub(b.clock()); remaining > 0 {
+			return false, remaining
+		}
+		b.state = BreakerHalfOpen
+		slog.Info("Coordinator circuit breaker half-open, probing")
+		return true, 0
+	case BreakerHalfOpen:
+		return false, min(breakerProbeWait, b.Cooldown)
+	default:
+		return true, 0
+	}
+}
+
+// Success records a successful coordinator call, closing the breaker.
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		slog.Info("Coordinator circuit breaker closed, resuming calls")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed coordinator call. It opens the breaker once
+// Threshold calls in a row have failed, or straight away if the probe failed.
+// Failures of calls made before the breaker opened don't extend the cool-down.
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= max(b.Threshold, 1) {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.open()
+	}
+}
+
+// open trips the breaker. b.mu must be held.
+func (b *CircuitBreaker) open() {
+	slog.Warn("Coordinator circuit breaker open, pausing calls",
+		"failures", b.failures, "cooldown", b.Cooldown.String())
+	b.state = BreakerOpen
+	b.openedAt = b.clock()
+}
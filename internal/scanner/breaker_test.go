@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// atomicClock is a fakeClock that's safe to read while workers run.
+type atomicClock struct {
+	start  time.Time
+	offset atomic.Int64
+}
+
+func newAtomicClock() *atomicClock {
+	return &atomicClock{start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *atomicClock) Now() time.Time          { return c.start.Add(time.Duration(c.offset.Load())) }
+func (c *atomicClock) Advance(d time.Duration) { c.offset.Add(int64(d)) }
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	clock := newAtomicClock()
+	b := NewCircuitBreaker(3, time.Minute)
+	b.now = clock.Now
+
+	allow := func(want bool) {
+		t.Helper()
+		if ok, _ := b.Allow(); ok != want {
+			t.Fatalf("Allow() = %v in state %s, want %v", ok, b.State(), want)
+		}
+	}
+	state := func(want string) {
+		t.Helper()
+		if got := b.State(); got != want {
+			t.Fatalf("State() = %s, want %s", got, want)
+		}
+	}
+
+	// A success in between resets the count of failures in a row
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	state(BreakerClosed)
+	allow(true)
+
+	b.Failure()
+	state(BreakerOpen)
+	allow(false)
+	if _, wait := b.Allow(); wait != time.Minute {
+		t.Errorf("wait while open = %s, want the full cool-down", wait)
+	}
+
+	// Failures of calls already in flight don't extend the cool-down
+	clock.Advance(40 * time.Second)
+	b.Failure()
+	if _, wait := b.Allow(); wait != 20*time.Second {
+		t.Errorf("wait while open = %s, want the remaining 20s", wait)
+	}
+
+	// After the cool-down exactly one probe goes through
+	clock.Advance(20 * time.Second)
+	allow(true)
+	state(BreakerHalfOpen)
+	allow(false)
+
+	// A failed probe reopens it for another full cool-down
+	b.Failure()
+	state(BreakerOpen)
+	if _, wait := b.Allow(); wait != time.Minute {
+		t.Errorf("wait after failed probe = %s, want the full cool-down", wait)
+	}
+
+	// A successful probe closes it
+	clock.Advance(time.Minute)
+	allow(true)
+	b.Success()
+	state(BreakerClosed)
+	allow(true)
+	allow(true)
+}
+
+func TestCircuitBreaker_Nil(t *testing.T) {
+	var b *CircuitBreaker
+	b.Failure()
+	if ok, _ := b.Allow(); !ok {
+		t.Error("nil breaker held a call back")
+	}
+	if got := b.State(); got != BreakerClosed {
+		t.Errorf("State() = %s, want %s", got, BreakerClosed)
+	}
+}
+
+func TestWorker_CircuitBreakerPausesAllWorkers(t *testing.T) {
+	var calls atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`)) // Empty queue
+	}))
+	defer srv.Close()
+
+	// The clock only moves when the test says so, keeping the breaker open.
+	// Held-back workers recheck every few milliseconds of real time.
+	clock := newAtomicClock()
+	breaker := NewCircuitBreaker(4, 5*time.Millisecond)
+	breaker.now = clock.Now
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	coord := NewCoordinatorClient(srv.URL, "token")
+	// No per-worker backoff, so without the breaker the workers would
+	// retry flat out
+	config := WorkerConfig{EmptyQueueDelay: time.Hour, MaxBackoff: time.Hour}
+	for i := range 2 {
+		w := NewWorker(i+1, config, coord, nil, nil, make(chan struct{}), nil)
+		w.Breaker = breaker
+		wg.Go(func() { w.Run(ctx) })
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	steady := func() int32 {
+		t.Helper()
+		time.Sleep(20 * time.Millisecond) // Let calls already in flight land
+		n := calls.Load()
+		time.Sleep(50 * time.Millisecond)
+		if got := calls.Load(); got != n {
+			t.Fatalf("coordinator got %d more calls while the breaker was %s", got-n, breaker.State())
+		}
+		return n
+	}
+
+	// Failures across both workers open the breaker and stop all calls
+	waitFor("breaker to open", func() bool { return breaker.State() == BreakerOpen })
+	n := steady()
+	if n < 4 || n > 5 {
+		t.Errorf("coordinator got %d calls before the breaker opened, want 4 (plus at most one in flight)", n)
+	}
+
+	// After the cool-down a single probe is sent; it fails, reopening it
+	clock.Advance(5 * time.Millisecond)
+	waitFor("probe", func() bool { return calls.Load() > n })
+	waitFor("breaker to reopen", func() bool { return breaker.State() == BreakerOpen })
+	if got := steady(); got != n+1 {
+		t.Errorf("coordinator got %d calls after the cool-down, want 1 probe", got-n)
+	}
+
+	// Once a probe succeeds, both workers resume
+	down.Store(false)
+	clock.Advance(5 * time.Millisecond)
+	waitFor("breaker to close", func() bool { return breaker.State() == BreakerClosed })
+	waitFor("both workers to resume", func() bool { return calls.Load() == n+3 })
+}
+
+func TestWorker_Submit_WaitsForBreaker(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	breaker := NewCircuitBreaker(1, time.Hour)
+	breaker.Failure()
+	w := NewWorker(1, WorkerConfig{SubmitMaxAttempts: 1}, NewCoordinatorClient(srv.URL, "token"), nil, nil, nil, nil)
+	w.Breaker = breaker
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	submitted, canceled := w.submit(ctx, 1, 1, nil, []api.LOCRecord{})
+	if submitted || !canceled {
+		t.Errorf("submit = (%v, %v), want (false, true) while the breaker is open", submitted, canceled)
+	}
+	if got := calls.Load(); got != 0 {
+		t.Errorf("coordinator got %d submissions while the breaker was open", got)
+	}
+}
@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultCacheSize bounds the LOC cache when DNSConfig.CacheSize is unset.
+const defaultCacheSize = 100_000
+
+// locCacheEntry is a cached lookup result for one FQDN.
+type locCacheEntry struct {
+	fqdn      string
+	hasLOC    bool
+	rawRecord string
+	status    string
+	hasTTL    bool // Expiry follows the record's own TTL
+	expiry    time.Time
+}
+
+// locCache is a size-bounded LRU of recent LOC lookup results. LOC records
+// are kept for their own TTL, up to the cache's; other results for the
+// cache's TTL. Only definitive answers (NOERROR or NXDOMAIN) are cached, so
+// transient errors and statuses such as SERVFAIL are retried.
+type locCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	now     func() time.Time // injectable for tests
+}
+
+// newLOCCache creates a cache holding at most size entries for at most ttl each.
+func newLOCCache(ttl time.Duration, size int) *locCache {
+	if size < 1 {
+		size = defaultCacheSize
+	}
+	return &locCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached result for fqdn, if present and not expired.
+func (c *locCache) Get(fqdn string) (LOCResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[fqdn]
+	if !ok {
+		return LOCResult{}, false
+	}
+	entry := elem.Value.(*locCacheEntry) //nolint:errcheck // list only holds *locCacheEntry
+	if !c.now().Before(entry.expiry) {
+		c.order.Remove(elem)
+		delete(c.entries, fqdn)
+		return LOCResult{}, false
+	}
+	c.order.MoveToFront(elem)
+	result := LOCResult{FQDN: fqdn, HasLOC: entry.hasLOC, RawRecord: entry.rawRecord, Status: entry.status}
+	if entry.hasTTL {
+		// Like a caching resolver, report what's left of the TTL
+		result.TTL = entry.expiry.Sub(c.now())
+	}
+	return result, true
+}
+
+// entryTTL returns how long result may be cached: a LOC record's own TTL,
+// if known, capped at the cache's.
+func (c *locCache) entryTTL(result LOCResult) (time.Duration, bool) {
+	if result.HasLOC && result.TTL > 0 && result.TTL < c.ttl {
+		return result.TTL, true
+	}
+	return c.ttl, result.HasLOC && result.TTL > 0
+}
+
+// Put stores a lookup result, evicting the least recently used entry if full.
+func (c *locCache) Put(result LOCResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl, hasTTL := c.entryTTL(result)
+	expiry := c.now().Add(ttl)
+	if elem, ok := c.entries[result.FQDN]; ok {
+		entry := elem.Value.(*locCacheEntry) //nolint:errcheck // list only holds *locCacheEntry
+		entry.hasLOC = result.HasLOC
+		entry.rawRecord = result.RawRecord
+		entry.status = result.Status
+		entry.hasTTL = hasTTL
+		entry.expiry = expiry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		if oldest := c.order.Back(); oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*locCacheEntry).fqdn) //nolint:errcheck // list only holds *locCacheEntry
+		}
+	}
+
+	c.entries[result.FQDN] = c.order.PushFront(&locCacheEntry{
+		fqdn:      result.FQDN,
+		hasLOC:    result.HasLOC,
+		rawRecord: result.RawRecord,
+		status:    result.Status,
+		hasTTL:    hasTTL,
+		expiry:    expiry,
+	})
+}
+
+// Len returns the number of cached entries, including any not yet evicted after expiry.
+func (c *locCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
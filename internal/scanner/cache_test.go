@@ -0,0 +1,225 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zmap/zdns/v2/src/zdns"
+)
+
+// fakeClock is a manually advanced clock for cache expiry tests.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestCache(ttl time.Duration, size int) (*locCache, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := newLOCCache(ttl, size)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestLOCCache_HitAndMiss(t *testing.T) {
+	c, _ := newTestCache(time.Hour, 10)
+
+	if _, ok := c.Get("example.com"); ok {
+		t.Fatal("Get() on empty cache reported a hit")
+	}
+
+	c.Put(LOCResult{FQDN: "example.com", HasLOC: true, RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m"})
+	c.Put(LOCResult{FQDN: "nothing.example.com"})
+
+	got, ok := c.Get("example.com")
+	if !ok {
+		t.Fatal("Get() missed a cached entry")
+	}
+	if !got.HasLOC || got.RawRecord != "52 22 23.000 N 4 53 32.000 E -2.00m" || got.FQDN != "example.com" {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	// Negative results are cached too
+	got, ok = c.Get("nothing.example.com")
+	if !ok || got.HasLOC {
+		t.Errorf("Get() = %+v, %v; want cached miss without LOC", got, ok)
+	}
+}
+
+func TestLOCCache_Expiry(t *testing.T) {
+	c, clock := newTestCache(time.Hour, 10)
+	c.Put(LOCResult{FQDN: "example.com", HasLOC: true, RawRecord: "raw"})
+
+	clock.Advance(59 * time.Minute)
+	if _, ok := c.Get("example.com"); !ok {
+		t.Fatal("entry expired before its TTL")
+	}
+
+	clock.Advance(time.Minute)
+	if _, ok := c.Get("example.com"); ok {
+		t.Fatal("entry still served at its TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d after expiry, want 0", c.Len())
+	}
+
+	// Re-putting refreshes the expiry
+	c.Put(LOCResult{FQDN: "example.com"})
+	clock.Advance(30 * time.Minute)
+	c.Put(LOCResult{FQDN: "example.com"})
+	clock.Advance(45 * time.Minute)
+	if _, ok := c.Get("example.com"); !ok {
+		t.Error("refreshed entry expired early")
+	}
+}
+
+func TestLOCCache_RecordTTL(t *testing.T) {
+	c, clock := newTestCache(time.Hour, 10)
+	c.Put(LOCResult{FQDN: "short.example.com", HasLOC: true, RawRecord: "raw", TTL: 5 * time.Minute})
+	c.Put(LOCResult{FQDN: "long.example.com", HasLOC: true, RawRecord: "raw", TTL: 30 * time.Minute})
+	c.Put(LOCResult{FQDN: "longer.example.com", HasLOC: true, RawRecord: "raw", TTL: 24 * time.Hour})
+	c.Put(LOCResult{FQDN: "none.example.com"})
+
+	clock.Advance(4 * time.Minute)
+	got, ok := c.Get("short.example.com")
+	if !ok {
+		t.Fatal("short-TTL entry expired before its TTL")
+	}
+	if got.TTL != time.Minute {
+		t.Errorf("cached TTL = %s, want the remaining 1m", got.TTL)
+	}
+
+	clock.Advance(time.Minute)
+	if _, ok := c.Get("short.example.com"); ok {
+		t.Error("short-TTL entry still served after its TTL")
+	}
+	if _, ok := c.Get("long.example.com"); !ok {
+		t.Error("long-TTL entry expired with the short one")
+	}
+
+	clock.Advance(25 * time.Minute)
+	if _, ok := c.Get("long.example.com"); ok {
+		t.Error("long-TTL entry still served after its TTL")
+	}
+
+	// Record TTLs beyond the cache's are capped; results without a record
+	// keep the cache's TTL
+	clock.Advance(30 * time.Minute)
+	if _, ok := c.Get("longer.example.com"); ok {
+		t.Error("entry served beyond the cache TTL")
+	}
+	if _, ok := c.Get("none.example.com"); ok {
+		t.Error("negative entry served beyond the cache TTL")
+	}
+}
+
+func TestLOCCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestCache(time.Hour, 2)
+	c.Put(LOCResult{FQDN: "a.example.com"})
+	c.Put(LOCResult{FQDN: "b.example.com"})
+
+	// Touch a so that b becomes the eviction candidate
+	c.Get("a.example.com")
+	c.Put(LOCResult{FQDN: "c.example.com"})
+
+	if _, ok := c.Get("b.example.com"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, fqdn := range []string{"a.example.com", "c.example.com"} {
+		if _, ok := c.Get(fqdn); !ok {
+			t.Errorf("%s was evicted", fqdn)
+		}
+	}
+}
+
+func TestDNSScanner_CacheDisabledByDefault(t *testing.T) {
+	if s := NewDNSScanner(DefaultDNSConfig(), nil); s.cache != nil {
+		t.Error("cache enabled without CacheTTL")
+	}
+}
+
+func TestDNSScanner_LookupLOCUsesCache(t *testing.T) {
+	config := DefaultDNSConfig()
+	config.CacheTTL = time.Hour
+	s := NewDNSScanner(config, nil)
+	s.cache.Put(LOCResult{FQDN: "cached.example.com", HasLOC: true, RawRecord: "raw"})
+
+	// A cancelled context would fail a real lookup, so a hit proves no query was made
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got := s.LookupLOC(ctx, "cached.example.com.")
+	if got.Error != nil || !got.HasLOC || got.RawRecord != "raw" {
+		t.Errorf("LookupLOC() = %+v, want cached record", got)
+	}
+}
+
+func TestDNSScanner_CachesOnlyDefinitiveAnswers(t *testing.T) {
+	answers := map[string]locAnswer{
+		"missing.example.com": {Status: zdns.StatusNXDomain},
+		"broken.example.com":  {Status: zdns.StatusServFail},
+	}
+	config := DefaultDNSConfig()
+	config.CacheTTL = time.Hour
+	s := NewDNSScanner(config, nil)
+	var queries int
+	s.query = cnameQuery(answers, &queries)
+
+	ctx := context.Background()
+	for range 2 {
+		s.LookupLOC(ctx, "missing.example.com")
+		s.LookupLOC(ctx, "broken.example.com")
+	}
+	if queries != 3 {
+		t.Errorf("sent %d queries, want 3 (NXDOMAIN cached, SERVFAIL retried)", queries)
+	}
+	if got, ok := s.cache.Get("missing.example.com"); !ok || got.Status != string(zdns.StatusNXDomain) {
+		t.Errorf("cached NXDOMAIN = %+v, %v; want status kept", got, ok)
+	}
+}
+
+func TestDNSScanner_CachesForRecordTTL(t *testing.T) {
+	const raw = "42 21 43.528 N 71 5 6.284 W -25.00m"
+	answers := map[string]locAnswer{
+		"short.example.com": {LOC: raw, TTL: time.Minute},
+		"long.example.com":  {LOC: raw, TTL: time.Hour},
+		// The alias expires before the record it points at
+		"alias.example.com": {CNAME: "long.example.com.", TTL: 10 * time.Minute},
+	}
+	config := DefaultDNSConfig()
+	config.CacheTTL = 24 * time.Hour
+	config.MaxCNAMEHops = 1
+	s := NewDNSScanner(config, nil)
+	var queries int
+	s.query = cnameQuery(answers, &queries)
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s.cache.now = clock.Now
+
+	ctx := context.Background()
+	for fqdn, want := range map[string]time.Duration{
+		"short.example.com": time.Minute,
+		"long.example.com":  time.Hour,
+		"alias.example.com": 10 * time.Minute,
+	} {
+		if got := s.LookupLOC(ctx, fqdn); got.TTL != want {
+			t.Errorf("LookupLOC(%s).TTL = %s, want %s", fqdn, got.TTL, want)
+		}
+	}
+
+	lookups := func(fqdns ...string) int {
+		before := queries
+		for _, fqdn := range fqdns {
+			s.LookupLOC(ctx, fqdn)
+		}
+		return queries - before
+	}
+
+	clock.Advance(2 * time.Minute)
+	if n := lookups("short.example.com", "long.example.com", "alias.example.com"); n != 1 {
+		t.Errorf("after 2m sent %d queries, want 1 for the expired short-TTL record", n)
+	}
+	clock.Advance(10 * time.Minute)
+	if n := lookups("long.example.com", "alias.example.com"); n != 2 {
+		t.Errorf("after 12m sent %d queries, want 2 to follow the expired alias", n)
+	}
+}
@@ -2,11 +2,16 @@ package scanner
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,14 +19,39 @@ import (
 	"github.com/locplace/scanner/pkg/api"
 )
 
+// Coordinator is the part of the coordinator API that workers use.
+// CoordinatorClient implements it over HTTP; tests substitute fakes.
+type Coordinator interface {
+	GetBatch(ctx context.Context) (*Batch, error)
+	SubmitBatch(ctx context.Context, batchID int64, domainsChecked int, checked []string, locRecords []api.LOCRecord) error
+	Heartbeat(ctx context.Context, activeDomains []string) error
+	ReturnBatch(ctx context.Context, batchID int64) error
+}
+
+var _ Coordinator = (*CoordinatorClient)(nil)
+
 // CoordinatorClient is an HTTP client for the coordinator API.
 type CoordinatorClient struct {
 	BaseURL    string
 	Token      string
 	SessionID  string // Unique ID for this scanner session (generated on startup)
 	HTTPClient *http.Client
+
+	// GzipSubmissions gzips SubmitBatch request bodies, sending them with
+	// Content-Encoding: gzip. The coordinator must support this.
+	GzipSubmissions bool
+
+	// batchCount is how many batches GetBatch claims at once (see
+	// SetBatchCount); those beyond the first wait in prefetched.
+	batchCount atomic.Int64
+	mu         sync.Mutex
+	prefetched []*Batch
 }
 
+// DefaultCoordinatorTimeout bounds each coordinator request unless
+// configured otherwise.
+const DefaultCoordinatorTimeout = 30 * time.Second
+
 // NewCoordinatorClient creates a new coordinator API client.
 // A new session ID is generated to track this scanner instance.
 func NewCoordinatorClient(baseURL, token string) *CoordinatorClient {
@@ -30,20 +60,79 @@ func NewCoordinatorClient(baseURL, token string) *CoordinatorClient {
 		Token:     token,
 		SessionID: uuid.New().String(),
 		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: DefaultCoordinatorTimeout,
 		},
 	}
 }
 
+// newCoordinatorHTTPClient returns an HTTP client whose requests time out
+// after timeout, keeping up to maxIdleConns idle connections to the
+// coordinator so concurrent workers reuse them rather than reconnecting
+// (the default transport keeps only two per host).
+func newCoordinatorHTTPClient(timeout time.Duration, maxIdleConns int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:errcheck // DefaultTransport is always an *http.Transport
+	transport.MaxIdleConnsPerHost = maxIdleConns
+	transport.MaxIdleConns = max(transport.MaxIdleConns, maxIdleConns)
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
 // Batch represents a batch of FQDNs to scan.
 type Batch struct {
 	ID      int64
 	Domains []string
+
+	// RetryAfter is the coordinator's advised wait when no batch was available (zero if none given).
+	RetryAfter time.Duration
+}
+
+// SetBatchCount sets how many batches GetBatch claims per request (at
+// least one). The extra batches are handed out by later GetBatch calls,
+// from any worker, before the coordinator is asked again.
+func (c *CoordinatorClient) SetBatchCount(n int) {
+	c.batchCount.Store(int64(max(n, 1)))
+}
+
+// popPrefetched returns the next batch claimed by an earlier request, or nil.
+func (c *CoordinatorClient) popPrefetched() *Batch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.prefetched) == 0 {
+		return nil
+	}
+	b := c.prefetched[0]
+	c.prefetched = c.prefetched[1:]
+	return b
+}
+
+// ReturnPrefetched gives back every batch claimed ahead but not yet handed
+// to a worker, returning how many were returned. Batches that can't be
+// returned are left for the coordinator's reaper.
+func (c *CoordinatorClient) ReturnPrefetched(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	batches := c.prefetched
+	c.prefetched = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for _, b := range batches {
+		if err := c.ReturnBatch(ctx, b.ID); err != nil {
+			errs = append(errs, fmt.Errorf("batch %d: %w", b.ID, err))
+		}
+	}
+	return len(batches) - len(errs), errors.Join(errs...)
 }
 
-// GetBatch requests a batch of FQDNs to scan from the coordinator.
+// GetBatch requests a batch of FQDNs to scan from the coordinator, or hands
+// out one claimed by an earlier request when claiming several at once.
 func (c *CoordinatorClient) GetBatch(ctx context.Context) (*Batch, error) {
+	if b := c.popPrefetched(); b != nil {
+		return b, nil
+	}
+
 	req := api.GetBatchRequest{SessionID: c.SessionID}
+	if n := int(c.batchCount.Load()); n > 1 {
+		req.BatchCount = n
+	}
 	body, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
@@ -72,8 +161,22 @@ func (c *CoordinatorClient) GetBatch(ctx context.Context) (*Batch, error) {
 		return nil, err
 	}
 
+	if len(result.Batches) > 0 {
+		batches := make([]*Batch, len(result.Batches))
+		for i, b := range result.Batches {
+			batches[i] = &Batch{ID: b.BatchID, Domains: b.Domains}
+		}
+		c.mu.Lock()
+		c.prefetched = append(c.prefetched, batches[1:]...)
+		c.mu.Unlock()
+		return batches[0], nil
+	}
+
 	// Empty response means no batches available
 	if result.BatchID == 0 && len(result.Domains) == 0 {
+		if result.RetryAfterSeconds > 0 {
+			return &Batch{RetryAfter: time.Duration(result.RetryAfterSeconds) * time.Second}, nil
+		}
 		return nil, nil
 	}
 
@@ -83,9 +186,10 @@ func (c *CoordinatorClient) GetBatch(ctx context.Context) (*Batch, error) {
 	}, nil
 }
 
-// Heartbeat sends a keepalive signal to the coordinator.
-func (c *CoordinatorClient) Heartbeat(ctx context.Context) error {
-	req := api.HeartbeatRequest{SessionID: c.SessionID}
+// Heartbeat sends a keepalive signal to the coordinator, reporting the
+// domains currently being scanned.
+func (c *CoordinatorClient) Heartbeat(ctx context.Context, activeDomains []string) error {
+	req := api.HeartbeatRequest{SessionID: c.SessionID, ActiveDomains: activeDomains}
 	body, err := json.Marshal(req)
 	if err != nil {
 		return err
@@ -112,18 +216,85 @@ func (c *CoordinatorClient) Heartbeat(ctx context.Context) error {
 	return nil
 }
 
-// SubmitBatch sends scan results for a batch to the coordinator.
+// ReturnBatch gives a claimed batch back to the coordinator without scanning it,
+// so it's requeued immediately instead of waiting for the reaper.
+func (c *CoordinatorClient) ReturnBatch(ctx context.Context, batchID int64) error {
+	req := api.ReturnBatchRequest{SessionID: c.SessionID, BatchID: batchID}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/scanner/return", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body) //nolint:errcheck // Best effort to get error details
+		return fmt.Errorf("return batch failed: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// GetConfig fetches the settings the coordinator recommends to scanners.
+// It returns nil, without an error, if the coordinator predates them.
+func (c *CoordinatorClient) GetConfig(ctx context.Context) (*api.ScannerConfigResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/scanner/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body) //nolint:errcheck // Best effort to get error details
+		return nil, fmt.Errorf("get config failed: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var result api.ScannerConfigResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SubmitBatch sends scan results for a batch to the coordinator, along with
+// the FQDNs whose lookups got a definitive answer (see api.SubmitBatchRequest).
 // Uses a longer timeout than other requests since large result sets may take time to process.
-func (c *CoordinatorClient) SubmitBatch(ctx context.Context, batchID int64, domainsChecked int, locRecords []api.LOCRecord) error {
+func (c *CoordinatorClient) SubmitBatch(ctx context.Context, batchID int64, domainsChecked int, checked []string, locRecords []api.LOCRecord) error {
 	req := api.SubmitBatchRequest{
 		BatchID:        batchID,
 		DomainsChecked: domainsChecked,
 		LOCRecords:     locRecords,
+		Checked:        checked,
 	}
 	body, err := json.Marshal(req)
 	if err != nil {
 		return err
 	}
+	if c.GzipSubmissions {
+		if body, err = gzipBytes(body); err != nil {
+			return err
+		}
+	}
 
 	// Use a longer timeout for submitting results (60s instead of 30s)
 	submitCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
@@ -134,7 +305,13 @@ func (c *CoordinatorClient) SubmitBatch(ctx context.Context, batchID int64, doma
 		return err
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	if c.GzipSubmissions {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
 	httpReq.Header.Set("Authorization", "Bearer "+c.Token)
+	// The same key on every retry lets the coordinator spot a repeat of a
+	// submission whose response was lost
+	httpReq.Header.Set(api.IdempotencyKeyHeader, c.SessionID+":"+strconv.FormatInt(batchID, 10))
 
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
@@ -149,3 +326,16 @@ func (c *CoordinatorClient) SubmitBatch(ctx context.Context, batchID int64, doma
 
 	return nil
 }
+
+// gzipBytes returns data gzip-compressed.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
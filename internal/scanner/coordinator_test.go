@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestCoordinatorClient_GetBatch_Empty(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		wantNil        bool
+		wantRetryAfter time.Duration
+	}{
+		{"no advice", `{"domains":[]}`, true, 0},
+		{"retry advice", `{"domains":[],"retry_after_seconds":10}`, false, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			batch, err := NewCoordinatorClient(srv.URL, "token").GetBatch(context.Background())
+			if err != nil {
+				t.Fatalf("GetBatch() error: %v", err)
+			}
+			if tt.wantNil {
+				if batch != nil {
+					t.Errorf("GetBatch() = %+v, want nil", batch)
+				}
+				return
+			}
+			if batch == nil {
+				t.Fatal("GetBatch() = nil, want batch carrying retry advice")
+			}
+			if len(batch.Domains) != 0 {
+				t.Errorf("Domains = %v, want empty", batch.Domains)
+			}
+			if batch.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %s, want %s", batch.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestCoordinatorClient_ReturnBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"returned", http.StatusOK, false},
+		{"not held", http.StatusNotFound, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotAuth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err := NewCoordinatorClient(srv.URL, "token").ReturnBatch(context.Background(), 7)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReturnBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotPath != "/api/scanner/return" {
+				t.Errorf("path = %q, want /api/scanner/return", gotPath)
+			}
+			if gotAuth != "Bearer token" {
+				t.Errorf("Authorization = %q, want %q", gotAuth, "Bearer token")
+			}
+		})
+	}
+}
+
+func TestCoordinatorClient_Heartbeat_ActiveDomains(t *testing.T) {
+	var got api.HeartbeatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/scanner/heartbeat" {
+			t.Errorf("path = %s, want /api/scanner/heartbeat", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_ = json.NewEncoder(w).Encode(api.HeartbeatResponse{OK: true})
+	}))
+	defer srv.Close()
+
+	c := NewCoordinatorClient(srv.URL, "token")
+	active := []string{"a.example.com", "b.example.com"}
+	if err := c.Heartbeat(context.Background(), active); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if got.SessionID != c.SessionID {
+		t.Errorf("session_id = %q, want %q", got.SessionID, c.SessionID)
+	}
+	if !slices.Equal(got.ActiveDomains, active) {
+		t.Errorf("active_domains = %v, want %v", got.ActiveDomains, active)
+	}
+}
+
+func TestCoordinatorClient_SubmitBatch_IdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(api.IdempotencyKeyHeader))
+		_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+	}))
+	defer srv.Close()
+
+	c := NewCoordinatorClient(srv.URL, "token")
+	ctx := context.Background()
+	for _, batchID := range []int64{7, 7, 8} { // A retry of batch 7, then batch 8
+		if err := c.SubmitBatch(ctx, batchID, 1, nil, nil); err != nil {
+			t.Fatalf("SubmitBatch(%d): %v", batchID, err)
+		}
+	}
+
+	if keys[0] == "" {
+		t.Fatal("no idempotency key sent")
+	}
+	if keys[1] != keys[0] {
+		t.Errorf("retry sent key %q, want the original %q", keys[1], keys[0])
+	}
+	if keys[2] == keys[0] {
+		t.Errorf("a different batch reused key %q", keys[2])
+	}
+}
+
+func TestCoordinatorClient_SubmitBatch_Gzip(t *testing.T) {
+	records := []api.LOCRecord{{FQDN: "a.example.com", RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m", Latitude: 52.37, Longitude: 4.89}}
+
+	for _, gzipped := range []bool{false, true} {
+		var encoding string
+		var got api.SubmitBatchRequest
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding = r.Header.Get("Content-Encoding")
+			body := r.Body
+			if encoding == "gzip" {
+				zr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				body = zr
+			}
+			if err := json.NewDecoder(body).Decode(&got); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+		}))
+
+		c := NewCoordinatorClient(srv.URL, "token")
+		c.GzipSubmissions = gzipped
+		err := c.SubmitBatch(context.Background(), 7, 3, nil, records)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("SubmitBatch (gzip %v): %v", gzipped, err)
+		}
+
+		if (encoding == "gzip") != gzipped {
+			t.Errorf("gzip %v: Content-Encoding = %q", gzipped, encoding)
+		}
+		if got.BatchID != 7 || got.DomainsChecked != 3 || !slices.Equal(got.LOCRecords, records) {
+			t.Errorf("gzip %v: coordinator got %+v", gzipped, got)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCTLogURL is crt.sh's search endpoint.
+const DefaultCTLogURL = "https://crt.sh/"
+
+// CTLogEnumerator finds subdomains in certificate transparency logs by
+// searching crt.sh for certificates issued to names under a domain.
+type CTLogEnumerator struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// MaxRetries is how many times a rate-limited or failed query is retried.
+	MaxRetries int
+	// RetryDelay is the wait before a retry when the server doesn't send Retry-After.
+	RetryDelay time.Duration
+}
+
+// NewCTLogEnumerator returns a CTLogEnumerator that queries crt.sh.
+func NewCTLogEnumerator() *CTLogEnumerator {
+	return &CTLogEnumerator{
+		BaseURL: DefaultCTLogURL,
+		// crt.sh can be slow to answer for domains with many certificates
+		HTTPClient: &http.Client{Timeout: 2 * time.Minute},
+		MaxRetries: 3,
+		RetryDelay: 10 * time.Second,
+	}
+}
+
+// ctLogEntry is the part of a crt.sh JSON result we use. NameValue holds
+// the certificate's names, one per line.
+type ctLogEntry struct {
+	NameValue  string `json:"name_value"`
+	CommonName string `json:"common_name"`
+}
+
+// Enumerate returns the distinct subdomains of domain named in logged
+// certificates. Wildcard names contribute their parent, and malformed
+// entries are skipped.
+func (e *CTLogEnumerator) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	for attempt := 0; ; attempt++ {
+		entries, retryAfter, err := e.query(ctx, domain)
+		if err == nil {
+			return subdomainsOf(domain, ctLogNames(entries)), nil
+		}
+		if retryAfter < 0 || attempt >= e.MaxRetries {
+			return nil, err
+		}
+
+		wait := e.RetryDelay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		slog.Warn("CT log query failed, retrying", "domain", domain, "attempt", attempt+1, "error", err, "wait", wait.String())
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// query runs one crt.sh search. On failure, retryAfter is negative if the
+// error isn't worth retrying, or the server's requested wait (zero if none).
+func (e *CTLogEnumerator) query(ctx context.Context, domain string) (entries []json.RawMessage, retryAfter time.Duration, err error) {
+	q := url.Values{"q": {"%." + domain}, "output": {"json"}}
+	req, err := http.NewRequestWithContext(ctx, "GET", e.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close error not actionable
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After")) //nolint:errcheck // Absent or invalid means no hint
+		return nil, time.Duration(max(secs, 0)) * time.Second, fmt.Errorf("crt.sh query for %s: status %d", domain, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 512)) //nolint:errcheck // Best effort to get error details
+		return nil, -1, fmt.Errorf("crt.sh query for %s: status %d %s", domain, resp.StatusCode, string(bodyBytes))
+	}
+
+	// Decode entries individually so one odd record doesn't lose the rest
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("crt.sh query for %s: decode: %w", domain, err)
+	}
+	return entries, 0, nil
+}
+
+// ctLogNames extracts the certificate names from raw crt.sh entries,
+// turning wildcards into their parent name and dropping anything that
+// isn't a valid hostname.
+func ctLogNames(entries []json.RawMessage) []string {
+	var names []string
+	for _, raw := range entries {
+		var entry ctLogEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		for _, name := range strings.Split(entry.NameValue+"\n"+entry.CommonName, "\n") {
+			name = strings.TrimPrefix(strings.TrimSpace(name), "*.")
+			if isHostname(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// isHostname reports whether name looks like a DNS hostname: dot-separated
+// labels of letters, digits, hyphens and underscores. Certificates also
+// carry email addresses, IPs in odd forms and free text in their names.
+func isHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const sampleCTLogResponse = `[
+	{"issuer_name":"C=US, O=Let's Encrypt","common_name":"example.com","name_value":"example.com\nwww.example.com"},
+	{"common_name":"*.example.com","name_value":"*.example.com\nexample.com"},
+	{"common_name":"*.dev.example.com","name_value":"*.dev.example.com\nAPI.Example.com"},
+	{"common_name":"www.example.com","name_value":"www.example.com"},
+	{"common_name":"mail.example.com","name_value":"admin@example.com\nmail.example.com"},
+	{"common_name":"bad","name_value":"bad name.example.com\n.example.com"},
+	{"common_name":"notexample.com","name_value":"notexample.com"},
+	{"name_value":42},
+	"garbage"
+]`
+
+func newTestCTLogEnumerator(url string) *CTLogEnumerator {
+	e := NewCTLogEnumerator()
+	e.BaseURL = url
+	e.RetryDelay = time.Millisecond
+	return e
+}
+
+func TestCTLogEnumerator_Enumerate(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		if r.URL.Query().Get("output") != "json" {
+			t.Errorf("output = %q, want json", r.URL.Query().Get("output"))
+		}
+		io.WriteString(w, sampleCTLogResponse) //nolint:errcheck // Test server
+	}))
+	defer srv.Close()
+
+	got, err := newTestCTLogEnumerator(srv.URL).Enumerate(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Enumerate: %v", err)
+	}
+	if query != "%.example.com" {
+		t.Errorf("q = %q, want %%.example.com", query)
+	}
+	want := []string{"www.example.com", "dev.example.com", "api.example.com", "mail.example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Enumerate = %v, want %v", got, want)
+	}
+}
+
+func TestCTLogEnumerator_RetriesRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `[{"name_value":"www.example.com"}]`) //nolint:errcheck // Test server
+	}))
+	defer srv.Close()
+
+	got, err := newTestCTLogEnumerator(srv.URL).Enumerate(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Enumerate: %v", err)
+	}
+	if !slices.Equal(got, []string{"www.example.com"}) {
+		t.Errorf("Enumerate = %v", got)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestCTLogEnumerator_GivesUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{"rate limited", http.StatusTooManyRequests, 4}, // 1 + MaxRetries
+		{"client error", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				calls.Add(1)
+				http.Error(w, "no", tt.status)
+			}))
+			defer srv.Close()
+
+			if _, err := newTestCTLogEnumerator(srv.URL).Enumerate(context.Background(), "example.com"); err == nil {
+				t.Error("Enumerate succeeded")
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("server saw %d requests, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIsHostname(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"www.example.com", true},
+		{"_dmarc.example.com.", true},
+		{"xn--bcher-kva.example", true},
+		{"", false},
+		{"admin@example.com", false},
+		{"bad name.example.com", false},
+		{"a..example.com", false},
+		{".example.com", false},
+	}
+	for _, tt := range tests {
+		if got := isHostname(tt.name); got != tt.want {
+			t.Errorf("isHostname(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
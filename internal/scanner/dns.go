@@ -2,13 +2,16 @@ package scanner
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/miekg/dns"
+	zdnswire "github.com/zmap/dns"
 	"github.com/zmap/zdns/v2/src/zdns"
 )
 
@@ -18,16 +21,129 @@ type DNSConfig struct {
 	Nameservers []string
 	// Timeout for each DNS query.
 	Timeout time.Duration
-	// Workers is the number of concurrent DNS resolvers.
+	// Workers is the number of concurrent DNS lookups per batch.
 	Workers int
+	// PoolSize is the number of pooled resolvers (defaults to Workers). A
+	// scanner shared by several workers needs one per concurrent lookup.
+	PoolSize int
+	// CacheTTL is how long lookup results are remembered; zero disables the
+	// cache. LOC records with a shorter TTL of their own expire sooner.
+	CacheTTL time.Duration
+	// CacheSize is the maximum number of cached FQDNs (defaults to 100000).
+	CacheSize int
+	// MaxCNAMEHops is how many CNAMEs are followed to find a LOC record
+	// published on a canonical name; zero disables following.
+	MaxCNAMEHops int
+	// ClientSubnet, if set, is a CIDR sent with every query as the EDNS
+	// Client Subnet, for probing whether LOC answers vary by querier.
+	ClientSubnet string
+	// IPVersion is which IP versions resolvers are queried over: IPv4 (the
+	// default when empty), IPv6 or IPv4AndIPv6. Nameservers must include
+	// at least one of each version used.
+	IPVersion string
+}
+
+// IP versions for DNSConfig.IPVersion.
+const (
+	IPv4        = "v4"
+	IPv6        = "v6"
+	IPv4AndIPv6 = "v4v6"
+)
+
+// ipVersionMode returns the zdns mode for IPVersion.
+func (c DNSConfig) ipVersionMode() (zdns.IPVersionMode, error) {
+	switch c.IPVersion {
+	case "", IPv4:
+		return zdns.IPv4Only, nil
+	case IPv6:
+		return zdns.IPv6Only, nil
+	case IPv4AndIPv6:
+		return zdns.IPv4OrIPv6, nil
+	default:
+		return 0, fmt.Errorf("invalid IP version %q (want %s, %s or %s)", c.IPVersion, IPv4, IPv6, IPv4AndIPv6)
+	}
+}
+
+// splitNameservers sorts nameservers into IPv4 and IPv6 resolvers.
+func splitNameservers(nameservers []string) (v4, v6 []zdns.NameServer, err error) {
+	for _, ns := range nameservers {
+		ip := net.ParseIP(ns)
+		switch {
+		case ip == nil:
+			return nil, nil, fmt.Errorf("nameserver %q is not an IP address", ns)
+		case ip.To4() != nil:
+			v4 = append(v4, zdns.NameServer{IP: ip.To4(), Port: 53})
+		default:
+			v6 = append(v6, zdns.NameServer{IP: ip, Port: 53})
+		}
+	}
+	return v4, v6, nil
+}
+
+// resolvers returns the IP version mode and the nameservers of each version
+// to query, checking that they fit together.
+func (c DNSConfig) resolvers() (zdns.IPVersionMode, []zdns.NameServer, []zdns.NameServer, error) {
+	mode, err := c.ipVersionMode()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	v4, v6, err := splitNameservers(c.Nameservers)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	switch {
+	case mode == zdns.IPv4Only && len(v6) > 0:
+		return 0, nil, nil, fmt.Errorf("IPv6 nameserver %s needs IP version %s or %s", v6[0].IP, IPv6, IPv4AndIPv6)
+	case mode == zdns.IPv6Only && len(v4) > 0:
+		return 0, nil, nil, fmt.Errorf("IPv4 nameserver %s needs IP version %s or %s", v4[0].IP, IPv4, IPv4AndIPv6)
+	case mode != zdns.IPv6Only && len(v4) == 0:
+		return 0, nil, nil, errors.New("no IPv4 nameservers configured")
+	case mode != zdns.IPv4Only && len(v6) == 0:
+		return 0, nil, nil, errors.New("no IPv6 nameservers configured")
+	}
+	return mode, v4, v6, nil
+}
+
+// Validate checks the settings that can't be used as given.
+func (c DNSConfig) Validate() error {
+	if _, _, _, err := c.resolvers(); err != nil {
+		return err
+	}
+	if c.ClientSubnet != "" {
+		if _, err := clientSubnetOption(c.ClientSubnet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientSubnetOption builds the EDNS Client Subnet option for cidr, using
+// the dns package zdns is built on.
+func clientSubnetOption(cidr string) (*zdnswire.EDNS0_SUBNET, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client subnet: %w", err)
+	}
+	ones, _ := network.Mask.Size()
+	opt := &zdnswire.EDNS0_SUBNET{
+		Code:          zdnswire.EDNS0SUBNET,
+		Family:        1, // IPv4, per RFC 7871
+		SourceNetmask: uint8(ones),
+		Address:       network.IP,
+	}
+	if network.IP.To4() == nil {
+		opt.Family = 2
+	}
+	return opt, nil
 }
 
 // DefaultDNSConfig returns the default DNS configuration.
 func DefaultDNSConfig() DNSConfig {
 	return DNSConfig{
-		Nameservers: []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"},
-		Timeout:     5 * time.Second,
-		Workers:     10,
+		Nameservers:  []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"},
+		Timeout:      5 * time.Second,
+		Workers:      10,
+		MaxCNAMEHops: 5,
 	}
 }
 
@@ -39,20 +155,45 @@ type DNSScanner struct {
 	initOnce     sync.Once
 	initErr      error
 	mu           sync.Mutex
+	closed       bool
+	cache        *locCache // nil when caching is disabled
+	limiter      *LookupLimiter
+
+	// query sends a single LOC query; tests replace it to avoid real DNS
+	query func(ctx context.Context, name string) (locAnswer, error)
+}
+
+// locAnswer is the outcome of a single LOC query.
+type locAnswer struct {
+	Status zdns.Status   // Response status, e.g. NOERROR or NXDOMAIN
+	LOC    string        // Coordinates from the first LOC answer, if any
+	CNAME  string        // Alias target, if the name is a CNAME and no LOC was returned
+	TTL    time.Duration // TTL of the LOC or CNAME answer
 }
 
 // NewDNSScanner creates a new DNS scanner.
-func NewDNSScanner(config DNSConfig) *DNSScanner {
-	// Pool size matches worker count to ensure each concurrent lookup can get a resolver
-	poolSize := config.Workers
+// Queries also wait for limiter, which may be shared with other scanners
+// to cap their combined concurrency; nil means no shared cap.
+func NewDNSScanner(config DNSConfig, limiter *LookupLimiter) *DNSScanner {
+	// Pool size defaults to worker count to ensure each concurrent lookup can get a resolver
+	poolSize := config.PoolSize
+	if poolSize < 1 {
+		poolSize = config.Workers
+	}
 	if poolSize < 1 {
 		poolSize = 10
 	}
-	return &DNSScanner{
+	s := &DNSScanner{
 		config:       config,
 		resolverPool: make(chan *zdns.Resolver, poolSize),
 		poolSize:     poolSize,
+		limiter:      limiter,
 	}
+	if config.CacheTTL > 0 {
+		s.cache = newLOCCache(config.CacheTTL, config.CacheSize)
+	}
+	s.query = s.queryLOC
+	return s
 }
 
 // initPool initializes the resolver pool (called once lazily)
@@ -72,22 +213,36 @@ func (s *DNSScanner) initPool() error {
 
 // createResolver creates a new zdns resolver instance
 func (s *DNSScanner) createResolver() (*zdns.Resolver, error) {
-	// Build nameserver list
-	nameservers := make([]zdns.NameServer, len(s.config.Nameservers))
-	for i, ns := range s.config.Nameservers {
-		nameservers[i] = zdns.NameServer{
-			IP:   net.ParseIP(ns),
-			Port: 53,
-		}
+	config, err := s.resolverConfig()
+	if err != nil {
+		return nil, err
+	}
+	return zdns.InitResolver(config)
+}
+
+// resolverConfig builds the zdns configuration for the scanner's resolvers.
+func (s *DNSScanner) resolverConfig() (*zdns.ResolverConfig, error) {
+	mode, v4, v6, err := s.config.resolvers()
+	if err != nil {
+		return nil, err
 	}
 
 	// Create resolver config
 	config := zdns.NewResolverConfig()
-	config.ExternalNameServersV4 = nameservers
+	config.ExternalNameServersV4 = v4
+	config.ExternalNameServersV6 = v6
 	config.Timeout = s.config.Timeout
-	config.IPVersionMode = zdns.IPv4Only
+	config.IPVersionMode = mode
 
-	return zdns.InitResolver(config)
+	if s.config.ClientSubnet != "" {
+		ecs, err := clientSubnetOption(s.config.ClientSubnet)
+		if err != nil {
+			return nil, err
+		}
+		config.EdnsOptions = append(config.EdnsOptions, ecs)
+	}
+
+	return config, nil
 }
 
 // getResolver borrows a resolver from the pool
@@ -108,10 +263,14 @@ func (s *DNSScanner) returnResolver(r *zdns.Resolver) {
 	}
 }
 
-// Close releases any resources held by the scanner.
+// Close releases any resources held by the scanner. Later calls do nothing.
 func (s *DNSScanner) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
 
 	// Drain and close all resolvers in the pool
 	close(s.resolverPool)
@@ -127,6 +286,13 @@ type LOCResult struct {
 	HasLOC    bool
 	RawRecord string
 	Error     error
+	// Status is the response status of the last query, e.g. "NOERROR",
+	// "NXDOMAIN" or "SERVFAIL"; "ERROR" if the query failed without one.
+	// Empty if no query was sent.
+	Status string
+	// TTL is how long the LOC record may be cached, the lowest TTL along
+	// any CNAME chain followed to it. Zero if unknown or there's no record.
+	TTL time.Duration
 }
 
 // LookupLOC performs a LOC record lookup for a single domain.
@@ -136,16 +302,89 @@ func (s *DNSScanner) LookupLOC(ctx context.Context, fqdn string) LOCResult {
 	// Sanitize input: strip trailing dot to prevent zdns fatal error
 	// ("name already has trailing dot")
 	if strings.HasSuffix(fqdn, ".") {
-		log.Printf("Warning: domain %q has trailing dot, stripping", fqdn)
+		slog.Warn("Domain has trailing dot, stripping", "fqdn", fqdn)
 		fqdn = strings.TrimSuffix(fqdn, ".")
 		result.FQDN = fqdn
 	}
 
+	if s.cache != nil {
+		if cached, ok := s.cache.Get(fqdn); ok {
+			return cached
+		}
+	}
+
+	result = s.lookup(ctx, fqdn)
+	if s.cache != nil && result.definitive() {
+		s.cache.Put(result)
+	}
+	return result
+}
+
+// definitive reports whether the lookup got an authoritative answer on
+// whether the name has a LOC record: NOERROR or NXDOMAIN, without an error.
+func (r LOCResult) definitive() bool {
+	return r.Error == nil && (r.Status == string(zdns.StatusNoError) || r.Status == string(zdns.StatusNXDomain))
+}
+
+// lookup queries the resolvers for a LOC record, bypassing the cache.
+// If fqdn is an alias, up to MaxCNAMEHops CNAMEs are followed and a LOC
+// record on the canonical name is reported as fqdn's.
+func (s *DNSScanner) lookup(ctx context.Context, fqdn string) LOCResult {
+	result := LOCResult{FQDN: fqdn}
+	seen := map[string]bool{strings.ToLower(fqdn): true}
+
+	name := fqdn
+	var ttl time.Duration // Lowest TTL along the chain so far
+	for hops := 0; ; hops++ {
+		answer, err := s.limitedQuery(ctx, name)
+		result.Status = string(answer.Status)
+		if err != nil {
+			result.Error = err
+			if result.Status == "" && ctx.Err() == nil {
+				result.Status = string(zdns.StatusError)
+			}
+			return result
+		}
+		if hops == 0 || answer.TTL < ttl {
+			ttl = answer.TTL
+		}
+		if answer.LOC != "" {
+			result.HasLOC = true
+			result.RawRecord = answer.LOC
+			result.TTL = ttl
+			return result
+		}
+		if answer.CNAME == "" || hops >= s.config.MaxCNAMEHops {
+			return result
+		}
+
+		target := strings.TrimSuffix(answer.CNAME, ".")
+		if seen[strings.ToLower(target)] {
+			slog.Debug("CNAME loop, giving up", "fqdn", fqdn, "target", target)
+			return result
+		}
+		seen[strings.ToLower(target)] = true
+		name = target
+	}
+}
+
+// limitedQuery sends one query once the shared limiter has room.
+func (s *DNSScanner) limitedQuery(ctx context.Context, name string) (locAnswer, error) {
+	if err := s.limiter.Acquire(ctx); err != nil {
+		return locAnswer{}, err
+	}
+	defer s.limiter.Release()
+	return s.query(ctx, name)
+}
+
+// queryLOC sends one LOC query for name using a pooled resolver.
+func (s *DNSScanner) queryLOC(ctx context.Context, name string) (locAnswer, error) {
+	var answer locAnswer
+
 	// Borrow resolver from pool
 	resolver, err := s.getResolver()
 	if err != nil {
-		result.Error = err
-		return result
+		return answer, err
 	}
 	defer s.returnResolver(resolver)
 
@@ -153,34 +392,38 @@ func (s *DNSScanner) LookupLOC(ctx context.Context, fqdn string) LOCResult {
 	question := &zdns.Question{
 		Type:  dns.TypeLOC,
 		Class: dns.ClassINET,
-		Name:  fqdn,
+		Name:  name,
 	}
 
 	// Perform lookup
 	queryResult, _, status, err := resolver.ExternalLookup(ctx, question, nil)
+	answer.Status = status
 	if err != nil {
-		result.Error = err
-		return result
+		return answer, err
 	}
 
 	// Check status
 	if status != zdns.StatusNoError {
-		return result // No LOC record, not an error
+		return answer, nil // No LOC record, not an error
 	}
 
-	// Check for LOC answers
+	// Check for LOC answers, noting any CNAME in case there are none
 	if queryResult != nil && queryResult.Answers != nil {
-		for _, answer := range queryResult.Answers {
+		for _, a := range queryResult.Answers {
 			// zdns returns value types, not pointers
-			if locAnswer, ok := answer.(zdns.LOCAnswer); ok {
-				result.HasLOC = true
-				result.RawRecord = locAnswer.Coordinates
-				return result
+			switch a := a.(type) {
+			case zdns.LOCAnswer:
+				return locAnswer{Status: status, LOC: a.Coordinates, TTL: time.Duration(a.TTL) * time.Second}, nil
+			case zdns.Answer:
+				if a.RrType == dns.TypeCNAME && answer.CNAME == "" {
+					answer.CNAME = a.Answer
+					answer.TTL = time.Duration(a.TTL) * time.Second
+				}
 			}
 		}
 	}
 
-	return result
+	return answer, nil
 }
 
 // LookupLOCBatch performs LOC lookups for multiple domains concurrently.
@@ -1,8 +1,17 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+	"maps"
+	"net"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	zdnswire "github.com/zmap/dns"
+	"github.com/zmap/zdns/v2/src/zdns"
 )
 
 func TestDefaultDNSConfig(t *testing.T) {
@@ -56,7 +65,7 @@ func TestNewDNSScanner(t *testing.T) {
 		Workers:     5,
 	}
 
-	scanner := NewDNSScanner(config)
+	scanner := NewDNSScanner(config, nil)
 	if scanner == nil {
 		t.Fatal("NewDNSScanner() returned nil")
 	}
@@ -75,6 +84,141 @@ func TestNewDNSScanner(t *testing.T) {
 	}
 }
 
+func TestDNSScanner_ResolverConfig_ClientSubnet(t *testing.T) {
+	tests := []struct {
+		name       string
+		subnet     string
+		wantFamily uint16
+		wantMask   uint8
+		wantAddr   string
+	}{
+		{"IPv4", "203.0.113.77/24", 1, 24, "203.0.113.0"},
+		{"IPv6", "2001:db8:1234::1/48", 2, 48, "2001:db8:1234::"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDNSScanner(DNSConfig{Nameservers: []string{"8.8.8.8"}, ClientSubnet: tt.subnet}, nil)
+			config, err := s.resolverConfig()
+			if err != nil {
+				t.Fatalf("resolverConfig: %v", err)
+			}
+			if len(config.EdnsOptions) != 1 {
+				t.Fatalf("EdnsOptions = %v, want just the client subnet", config.EdnsOptions)
+			}
+			ecs, ok := config.EdnsOptions[0].(*zdnswire.EDNS0_SUBNET)
+			if !ok {
+				t.Fatalf("EdnsOptions[0] = %T, want *EDNS0_SUBNET", config.EdnsOptions[0])
+			}
+			if ecs.Code != zdnswire.EDNS0SUBNET || ecs.Family != tt.wantFamily || ecs.SourceNetmask != tt.wantMask ||
+				ecs.SourceScope != 0 || ecs.Address.String() != tt.wantAddr {
+				t.Errorf("ECS = %+v, want family %d, %s/%d", ecs, tt.wantFamily, tt.wantAddr, tt.wantMask)
+			}
+		})
+	}
+}
+
+func TestDNSScanner_ResolverConfig_NoClientSubnet(t *testing.T) {
+	config, err := NewDNSScanner(DefaultDNSConfig(), nil).resolverConfig()
+	if err != nil {
+		t.Fatalf("resolverConfig: %v", err)
+	}
+	if len(config.EdnsOptions) != 0 {
+		t.Errorf("EdnsOptions = %v, want none", config.EdnsOptions)
+	}
+}
+
+func TestSplitNameservers(t *testing.T) {
+	v4, v6, err := splitNameservers([]string{"8.8.8.8", "2001:4860:4860::8888", "::ffff:1.1.1.1"})
+	if err != nil {
+		t.Fatalf("splitNameservers: %v", err)
+	}
+	if len(v4) != 2 || v4[0].IP.String() != "8.8.8.8" || v4[1].IP.String() != "1.1.1.1" || len(v4[1].IP) != net.IPv4len {
+		t.Errorf("IPv4 nameservers = %v, want 8.8.8.8 and 1.1.1.1 (4-byte)", v4)
+	}
+	if len(v6) != 1 || v6[0].IP.String() != "2001:4860:4860::8888" || v6[0].Port != 53 {
+		t.Errorf("IPv6 nameservers = %v, want [2001:4860:4860::8888]:53", v6)
+	}
+
+	if _, _, err := splitNameservers([]string{"dns.google"}); err == nil {
+		t.Error("splitNameservers accepted a hostname")
+	}
+}
+
+func TestDNSScanner_ResolverConfig_IPVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		nameservers []string
+		wantMode    zdns.IPVersionMode
+		wantV4      int
+		wantV6      int
+	}{
+		{"", []string{"8.8.8.8"}, zdns.IPv4Only, 1, 0},
+		{IPv4, []string{"8.8.8.8", "1.1.1.1"}, zdns.IPv4Only, 2, 0},
+		{IPv6, []string{"2001:4860:4860::8888"}, zdns.IPv6Only, 0, 1},
+		{IPv4AndIPv6, []string{"8.8.8.8", "2001:4860:4860::8888"}, zdns.IPv4OrIPv6, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run("version "+tt.version, func(t *testing.T) {
+			s := NewDNSScanner(DNSConfig{Nameservers: tt.nameservers, IPVersion: tt.version}, nil)
+			config, err := s.resolverConfig()
+			if err != nil {
+				t.Fatalf("resolverConfig: %v", err)
+			}
+			if config.IPVersionMode != tt.wantMode {
+				t.Errorf("IPVersionMode = %v, want %v", config.IPVersionMode, tt.wantMode)
+			}
+			if len(config.ExternalNameServersV4) != tt.wantV4 || len(config.ExternalNameServersV6) != tt.wantV6 {
+				t.Errorf("nameservers = %v / %v, want %d IPv4 and %d IPv6",
+					config.ExternalNameServersV4, config.ExternalNameServersV6, tt.wantV4, tt.wantV6)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("zdns rejected the config: %v", err)
+			}
+		})
+	}
+}
+
+func TestDNSConfig_Validate_IPVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		nameservers []string
+	}{
+		{"unknown version", "v5", []string{"8.8.8.8"}},
+		{"IPv6 nameserver in IPv4 mode", IPv4, []string{"8.8.8.8", "2001:4860:4860::8888"}},
+		{"IPv4 nameserver in IPv6 mode", IPv6, []string{"8.8.8.8", "2001:4860:4860::8888"}},
+		{"no IPv6 nameserver for both", IPv4AndIPv6, []string{"8.8.8.8"}},
+		{"no IPv4 nameserver for both", IPv4AndIPv6, []string{"2001:4860:4860::8888"}},
+		{"no nameservers", IPv4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DNSConfig{Nameservers: tt.nameservers, IPVersion: tt.version}
+			if err := config.Validate(); err == nil {
+				t.Error("Validate() accepted the config")
+			}
+		})
+	}
+}
+
+func TestDNSConfig_Validate_ClientSubnet(t *testing.T) {
+	for subnet, wantErr := range map[string]bool{
+		"":               false,
+		"203.0.113.0/24": false,
+		"2001:db8::/32":  false,
+		"203.0.113.0":    true, // No prefix length
+		"203.0.113.0/33": true,
+		"somewhere/24":   true,
+		"2001:db8::/129": true,
+	} {
+		config := DefaultDNSConfig()
+		config.ClientSubnet = subnet
+		if err := config.Validate(); (err != nil) != wantErr {
+			t.Errorf("Validate() with ClientSubnet %q = %v, wantErr %v", subnet, err, wantErr)
+		}
+	}
+}
+
 func TestLOCResult_Fields(t *testing.T) {
 	// Test that LOCResult struct can hold all expected data
 	result := LOCResult{
@@ -112,3 +256,106 @@ func TestDNSConfig_ZeroValues(t *testing.T) {
 		t.Errorf("Zero-value Nameservers = %v, want empty", config.Nameservers)
 	}
 }
+
+// cnameQuery answers from a table of per-name answers, counting queries.
+func cnameQuery(answers map[string]locAnswer, queries *int) func(context.Context, string) (locAnswer, error) {
+	return func(_ context.Context, name string) (locAnswer, error) {
+		*queries++
+		answer := answers[strings.ToLower(name)]
+		if answer.Status == "" {
+			answer.Status = zdns.StatusNoError
+		}
+		return answer, nil
+	}
+}
+
+func TestDNSScanner_FollowsCNAME(t *testing.T) {
+	const raw = "42 21 43.528 N 71 5 6.284 W -25.00m 1.00m 3000.00m 10.00m"
+	answers := map[string]locAnswer{
+		"www.example.com":       {CNAME: "host.example.net."},
+		"host.example.net":      {CNAME: "canonical.example.org."},
+		"canonical.example.org": {LOC: raw},
+		"loop-a.example.com":    {CNAME: "Loop-B.example.com."},
+		"loop-b.example.com":    {CNAME: "LOOP-A.example.com."},
+	}
+
+	tests := []struct {
+		name        string
+		fqdn        string
+		maxHops     int
+		wantLOC     bool
+		wantQueries int
+	}{
+		{"chain within limit", "www.example.com", 5, true, 3},
+		{"chain at limit", "www.example.com", 2, true, 3},
+		{"chain beyond limit", "www.example.com", 1, false, 2},
+		{"following disabled", "www.example.com", 0, false, 1},
+		{"direct record", "canonical.example.org", 5, true, 1},
+		{"loop", "loop-a.example.com", 5, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDNSScanner(DNSConfig{Workers: 1, MaxCNAMEHops: tt.maxHops}, nil)
+			var queries int
+			s.query = cnameQuery(answers, &queries)
+
+			got := s.LookupLOC(context.Background(), tt.fqdn)
+			if got.HasLOC != tt.wantLOC {
+				t.Errorf("HasLOC = %v, want %v", got.HasLOC, tt.wantLOC)
+			}
+			if tt.wantLOC && got.RawRecord != raw {
+				t.Errorf("RawRecord = %q, want %q", got.RawRecord, raw)
+			}
+			if got.FQDN != tt.fqdn {
+				t.Errorf("FQDN = %q, want the queried name %q", got.FQDN, tt.fqdn)
+			}
+			if queries != tt.wantQueries {
+				t.Errorf("queries = %d, want %d", queries, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestDNSStatusMetric(t *testing.T) {
+	answers := map[string]locAnswer{
+		"loc.example.com":       {Status: zdns.StatusNoError, LOC: "42 21 43.528 N 71 5 6.284 W -25.00m"},
+		"noloc.example.com":     {Status: zdns.StatusNoError},
+		"missing.example.com":   {Status: zdns.StatusNXDomain},
+		"broken.example.com":    {Status: zdns.StatusServFail},
+		"slow.example.com":      {Status: zdns.StatusTimeout},
+		"alias.example.com":     {Status: zdns.StatusNoError, CNAME: "gone.example.net."},
+		"gone.example.net":      {Status: zdns.StatusNXDomain},
+		"unreached.example.com": {}, // Fails before any status is known
+	}
+	s := NewDNSScanner(DNSConfig{Workers: 4, MaxCNAMEHops: 5}, nil)
+	s.query = func(_ context.Context, name string) (locAnswer, error) {
+		a := answers[name]
+		if a.Status == "" || a.Status == zdns.StatusTimeout {
+			return a, errors.New("query failed")
+		}
+		return a, nil
+	}
+
+	fqdns := make([]string, 0, len(answers))
+	for name := range answers {
+		if name != "gone.example.net" {
+			fqdns = append(fqdns, name)
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+	m.recordDNSStatuses(s.LookupLOCBatch(context.Background(), fqdns))
+
+	want := map[string]float64{
+		"NOERROR":  2,
+		"NXDOMAIN": 2, // missing, plus alias whose target is gone
+		"SERVFAIL": 1,
+		"TIMEOUT":  1,
+		"ERROR":    1,
+	}
+	got := labeledCounterValues(t, reg, "scanner_dns_status_total", "status")
+	if !maps.Equal(got, want) {
+		t.Errorf("scanner_dns_status_total = %v, want %v", got, want)
+	}
+}
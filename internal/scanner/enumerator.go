@@ -0,0 +1,11 @@
+package scanner
+
+import "context"
+
+// SubdomainEnumerator finds subdomains of a domain, e.g. by querying
+// passive sources or certificate transparency logs.
+type SubdomainEnumerator interface {
+	// Enumerate returns the distinct, lowercased subdomains found for
+	// domain. The domain itself is not included.
+	Enumerate(ctx context.Context, domain string) ([]string, error)
+}
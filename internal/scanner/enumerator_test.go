@@ -0,0 +1,54 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// fakeEnumerator returns canned subdomains per domain and fails for any
+// domain it doesn't know.
+type fakeEnumerator map[string][]string
+
+func (f fakeEnumerator) Enumerate(_ context.Context, domain string) ([]string, error) {
+	subs, ok := f[domain]
+	if !ok {
+		return nil, errors.New("enumeration failed")
+	}
+	return subs, nil
+}
+
+func TestEnumerators(t *testing.T) {
+	var _ SubdomainEnumerator = NewSubfinder()
+	var _ SubdomainEnumerator = NewCTLogEnumerator()
+
+	if _, ok := newEnumerator("crtsh").(*CTLogEnumerator); !ok {
+		t.Error(`newEnumerator("crtsh") is not a CTLogEnumerator`)
+	}
+	if e := newEnumerator("amass"); e != nil {
+		t.Errorf(`newEnumerator("amass") = %T, want nil`, e)
+	}
+}
+
+func TestWorker_ExpandDomains(t *testing.T) {
+	w := &Worker{ID: 1, Config: WorkerConfig{Enumerator: fakeEnumerator{
+		"a.com": {"www.a.com", "mail.a.com"},
+		"b.com": {"www.b.com", "www.a.com"},
+	}}}
+
+	// Failed enumerations still scan the domain itself; duplicates are dropped
+	got := w.expandDomains(context.Background(), []string{"a.com", "broken.com", "b.com", "www.b.com"})
+	want := []string{"a.com", "broken.com", "b.com", "www.b.com", "www.a.com", "mail.a.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandDomains = %v, want %v", got, want)
+	}
+}
+
+func TestWorker_ExpandDomains_Disabled(t *testing.T) {
+	w := &Worker{ID: 1}
+	domains := []string{"a.com", "b.com"}
+	if got := w.expandDomains(context.Background(), domains); !slices.Equal(got, domains) {
+		t.Errorf("expandDomains = %v, want %v", got, domains)
+	}
+}
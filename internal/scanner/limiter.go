@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// LookupLimiter caps the number of DNS queries in flight across every worker
+// sharing it. A nil limiter imposes no cap.
+type LookupLimiter struct {
+	mu       sync.Mutex
+	base     int // Cap it was created with (0 = none)
+	limit    int // Cap in force: base, tightened by Restrict (0 = none)
+	inFlight int
+	freed    chan struct{} // Closed, then replaced, whenever a slot may have opened
+}
+
+// NewLookupLimiter returns a limiter allowing n concurrent queries, or nil
+// (no cap) if n is not positive.
+func NewLookupLimiter(n int) *LookupLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return newLookupLimiter(n)
+}
+
+// newLookupLimiter returns a limiter allowing n concurrent queries, or any
+// number if n is not positive, that can later be tightened with Restrict.
+func newLookupLimiter(n int) *LookupLimiter {
+	n = max(n, 0)
+	return &LookupLimiter{base: n, limit: n, freed: make(chan struct{})}
+}
+
+// Acquire blocks until a query slot is free or ctx is done.
+func (l *LookupLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.limit == 0 || l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *LookupLimiter) Release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.wake()
+}
+
+// Restrict caps concurrent queries at n, or at the limiter's own cap if
+// that's lower. A non-positive n lifts the restriction. Queries already in
+// flight finish regardless; new ones wait until they're under the cap.
+func (l *LookupLimiter) Restrict(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case n <= 0:
+		l.limit = l.base
+	case l.base == 0:
+		l.limit = n
+	default:
+		l.limit = min(n, l.base)
+	}
+	l.wake()
+}
+
+// Limit returns the cap in force, 0 meaning none.
+func (l *LookupLimiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// wake lets waiting Acquire calls recheck for a free slot. l.mu must be held.
+func (l *LookupLimiter) wake() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupLimiter_CapsConcurrencyAcrossWorkers(t *testing.T) {
+	const limit = 3
+	var inFlight, peak atomic.Int32
+	slowQuery := func(context.Context, string) (locAnswer, error) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		inFlight.Add(-1)
+		return locAnswer{}, nil
+	}
+
+	// Several workers, each allowing more concurrent lookups than the cap
+	dns := NewDNSScanner(DNSConfig{Workers: 10}, NewLookupLimiter(limit))
+	dns.query = slowQuery
+	var wg sync.WaitGroup
+	for w := range 4 {
+		worker := NewWorker(w+1, WorkerConfig{}, nil, dns, nil, nil, nil)
+		fqdns := make([]string, 20)
+		for i := range fqdns {
+			fqdns[i] = fmt.Sprintf("d%d.w%d.example.com", i, w)
+		}
+		wg.Go(func() { worker.DNS.LookupLOCBatch(context.Background(), fqdns) })
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("peak concurrent queries = %d, want at most %d", got, limit)
+	} else if got < limit {
+		t.Logf("peak concurrent queries = %d (cap %d never reached)", got, limit)
+	}
+}
+
+func TestLookupLimiter_Nil(t *testing.T) {
+	if l := NewLookupLimiter(0); l != nil {
+		t.Fatal("NewLookupLimiter(0) should impose no cap")
+	}
+	var l *LookupLimiter
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("nil Acquire: %v", err)
+	}
+	l.Release() // Must not panic
+}
+
+func TestLookupLimiter_AcquireCanceled(t *testing.T) {
+	l := NewLookupLimiter(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Acquire(ctx); err == nil {
+		t.Error("Acquire on a full limiter with a canceled context succeeded")
+	}
+}
+
+func TestLookupLimiter_Restrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     int
+		restrict int
+		want     int
+	}{
+		{"tightens", 5, 2, 2},
+		{"can't loosen", 5, 8, 5},
+		{"caps an uncapped limiter", 0, 3, 3},
+		{"lifted", 5, 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLookupLimiter(tt.base)
+			l.Restrict(tt.restrict)
+			if got := l.Limit(); got != tt.want {
+				t.Errorf("Limit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupLimiter_RestrictWhileInFlight(t *testing.T) {
+	l := newLookupLimiter(0)
+	ctx := context.Background()
+	for range 3 {
+		if err := l.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	}
+
+	// Queries already in flight carry on; new ones wait until under the cap
+	l.Restrict(2)
+	acquired := make(chan struct{})
+	go func() {
+		_ = l.Acquire(ctx)
+		close(acquired)
+	}()
+
+	l.Release() // 2 in flight: still at the cap
+	select {
+	case <-acquired:
+		t.Fatal("Acquire succeeded at the cap")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.Release() // 1 in flight
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire still blocked under the cap")
+	}
+}
@@ -4,6 +4,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Build information, set at compile time with
+// -ldflags "-X github.com/locplace/scanner/internal/scanner.Version=...".
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
 // Metrics holds all scanner Prometheus metrics.
 type Metrics struct {
 	// Phase durations
@@ -12,6 +19,10 @@ type Metrics struct {
 	SubmitDuration  *prometheus.HistogramVec
 	DomainDuration  *prometheus.HistogramVec
 
+	// DNSStatus counts lookups by response status, telling genuinely
+	// nonexistent domains (NXDOMAIN) apart from resolver trouble (SERVFAIL, TIMEOUT)
+	DNSStatus *prometheus.CounterVec
+
 	// Distribution metrics
 	LOCRecordsFound prometheus.Histogram
 
@@ -20,6 +31,13 @@ type Metrics struct {
 	LOCRecordsFoundTotal prometheus.Counter
 	SubmitRetries        prometheus.Counter
 	SubmitFailures       prometheus.Counter
+	LOCParseFailures     prometheus.Counter
+
+	// RecentParseFailures keeps the raw records behind LOCParseFailures
+	RecentParseFailures *ParseFailureLog
+
+	// BuildInfo carries Version and Commit as labels
+	BuildInfo *prometheus.GaugeVec
 }
 
 // NewMetrics creates and registers scanner metrics.
@@ -49,6 +67,11 @@ func NewMetrics(registry prometheus.Registerer) *Metrics {
 			Buckets: []float64{1, 2.5, 5, 10, 15, 30, 60, 120, 300, 600},
 		}, []string{"loc_found"}), // loc_found: "yes", "no"
 
+		DNSStatus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scanner_dns_status_total",
+			Help: "Total number of FQDN lookups by DNS response status.",
+		}, []string{"status"}), // status: zdns status, e.g. "NOERROR", "NXDOMAIN", "SERVFAIL", "TIMEOUT"
+
 		LOCRecordsFound: prometheus.NewHistogram(prometheus.HistogramOpts{
 			Name:    "scanner_loc_records_found_per_batch",
 			Help:    "Distribution of LOC records found per batch.",
@@ -74,6 +97,18 @@ func NewMetrics(registry prometheus.Registerer) *Metrics {
 			Name: "scanner_submit_failures_total",
 			Help: "Total number of failed submissions (after all retries).",
 		}),
+
+		LOCParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scanner_loc_parse_failures_total",
+			Help: "Total number of LOC records found but dropped because they could not be parsed.",
+		}),
+
+		RecentParseFailures: NewParseFailureLog(),
+
+		BuildInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanner_build_info",
+			Help: "Build information with version and commit labels. Value is always 1.",
+		}, []string{"version", "commit"}),
 	}
 
 	registry.MustRegister(
@@ -81,16 +116,30 @@ func NewMetrics(registry prometheus.Registerer) *Metrics {
 		m.DNSDuration,
 		m.SubmitDuration,
 		m.DomainDuration,
+		m.DNSStatus,
 		m.LOCRecordsFound,
 		m.DomainsProcessed,
 		m.LOCRecordsFoundTotal,
 		m.SubmitRetries,
 		m.SubmitFailures,
+		m.LOCParseFailures,
+		m.BuildInfo,
 	)
+	m.BuildInfo.WithLabelValues(Version, Commit).Set(1)
 
 	return m
 }
 
+// recordDNSStatuses counts each lookup under its response status. Lookups
+// that never sent a query (e.g. canceled before starting) aren't counted.
+func (m *Metrics) recordDNSStatuses(results []LOCResult) {
+	for _, r := range results {
+		if r.Status != "" {
+			m.DNSStatus.WithLabelValues(r.Status).Inc()
+		}
+	}
+}
+
 // BucketCount returns a label value for count buckets.
 func BucketCount(n int) string {
 	switch {
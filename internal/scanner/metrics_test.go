@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewMetrics_BuildInfo(t *testing.T) {
+	defer func(v, c string) { Version, Commit = v, c }(Version, Commit)
+	Version, Commit = "v1.2.3", "abc1234"
+
+	reg := prometheus.NewRegistry()
+	NewMetrics(reg)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != "scanner_build_info" {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("scanner_build_info has %d series, want 1", len(mf.GetMetric()))
+		}
+		m := mf.GetMetric()[0]
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["version"] != "v1.2.3" || labels["commit"] != "abc1234" || len(labels) != 2 {
+			t.Errorf("labels = %v, want version=v1.2.3 commit=abc1234", labels)
+		}
+		if got := m.GetGauge().GetValue(); got != 1 {
+			t.Errorf("value = %v, want 1", got)
+		}
+		return
+	}
+	t.Fatal("scanner_build_info not registered")
+}
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// parseFailureLogSize is how many unparseable LOC records are retained.
+const parseFailureLogSize = 100
+
+// ParseFailure is a LOC answer the scanner could not parse.
+type ParseFailure struct {
+	FQDN      string    `json:"fqdn"`
+	RawRecord string    `json:"raw_record"`
+	Error     string    `json:"error"`
+	At        time.Time `json:"at"`
+}
+
+// ParseFailureLog keeps the most recent LOC parse failures in a ring buffer,
+// so the raw strings can be inspected to improve the parser.
+// It is safe for concurrent use and serves its contents as JSON.
+type ParseFailureLog struct {
+	mu      sync.Mutex
+	entries []ParseFailure
+	next    int // Slot the next entry is written to once the buffer is full
+}
+
+// NewParseFailureLog creates an empty log.
+func NewParseFailureLog() *ParseFailureLog {
+	return &ParseFailureLog{entries: make([]ParseFailure, 0, parseFailureLogSize)}
+}
+
+// Add records a failure, evicting the oldest once the log is full.
+func (l *ParseFailureLog) Add(f ParseFailure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, f)
+		return
+	}
+	l.entries[l.next] = f
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// Recent returns the retained failures, oldest first.
+func (l *ParseFailureLog) Recent() []ParseFailure {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]ParseFailure, 0, len(l.entries))
+	out = append(out, l.entries[l.next:]...)
+	return append(out, l.entries[:l.next]...)
+}
+
+// ServeHTTP writes the retained failures as a JSON array, oldest first.
+func (l *ParseFailureLog) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.Recent()) //nolint:errcheck // Client may have gone away
+}
@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestParseFailureLog_EvictsOldest(t *testing.T) {
+	l := NewParseFailureLog()
+	total := parseFailureLogSize + 5
+	for i := range total {
+		l.Add(ParseFailure{FQDN: strconv.Itoa(i)})
+	}
+
+	recent := l.Recent()
+	if len(recent) != parseFailureLogSize {
+		t.Fatalf("len = %d, want %d", len(recent), parseFailureLogSize)
+	}
+	for i, f := range recent {
+		if want := strconv.Itoa(i + 5); f.FQDN != want {
+			t.Fatalf("recent[%d] = %s, want %s (oldest first)", i, f.FQDN, want)
+		}
+	}
+}
+
+func TestParseFailureLog_ServeHTTP(t *testing.T) {
+	l := NewParseFailureLog()
+	l.Add(ParseFailure{FQDN: "bad.example.", RawRecord: "garbage", Error: "parse error"})
+
+	rr := httptest.NewRecorder()
+	l.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/loc-parse-failures", nil))
+
+	var got []ParseFailure
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].RawRecord != "garbage" {
+		t.Errorf("body = %+v, want the one failure", got)
+	}
+
+	// An empty log is an empty array, not null
+	rr = httptest.NewRecorder()
+	NewParseFailureLog().ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if body := rr.Body.String(); body != "[]\n" {
+		t.Errorf("empty body = %q, want []", body)
+	}
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// DefaultConfigRefreshInterval is how often the scanner fetches the
+// coordinator's recommended settings.
+const DefaultConfigRefreshInterval = 5 * time.Minute
+
+// RemoteConfig holds the settings last recommended by the coordinator,
+// shared by a scanner's workers. Only settings that can change without
+// disrupting batches in progress are taken from it. A nil *RemoteConfig
+// recommends nothing.
+type RemoteConfig struct {
+	mu  sync.Mutex
+	cfg api.ScannerConfigResponse
+}
+
+// Get returns the current recommendations.
+func (r *RemoteConfig) Get() api.ScannerConfigResponse {
+	if r == nil {
+		return api.ScannerConfigResponse{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// set replaces the recommendations, reporting whether they changed.
+func (r *RemoteConfig) set(cfg api.ScannerConfigResponse) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cfg == r.cfg {
+		return false
+	}
+	r.cfg = cfg
+	return true
+}
+
+// EmptyQueueDelay returns the recommended wait after finding the queue
+// empty, or zero for none.
+func (r *RemoteConfig) EmptyQueueDelay() time.Duration {
+	return time.Duration(r.Get().EmptyQueueDelaySeconds) * time.Second
+}
+
+// applyConfig puts the coordinator's recommended settings into effect:
+// later batch claims, lookups and empty-queue waits use them, while work
+// already under way carries on as it was.
+func (s *Scanner) applyConfig(cfg api.ScannerConfigResponse) {
+	if !s.remote.set(cfg) {
+		return
+	}
+	s.coordinator.SetBatchCount(cfg.BatchCount)
+	s.limiter.Restrict(cfg.MaxConcurrentLookups)
+	slog.Info("Applied coordinator config", "batch_count", max(cfg.BatchCount, 1),
+		"empty_queue_delay", s.remote.EmptyQueueDelay().String(), "max_concurrent_lookups", s.limiter.Limit())
+}
+
+// refreshConfig fetches and applies the coordinator's recommended settings.
+// On failure the settings in effect are kept.
+func (s *Scanner) refreshConfig(ctx context.Context) {
+	cfg, err := s.coordinator.GetConfig(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Failed to fetch coordinator config, keeping current settings", "error", err)
+		}
+		return
+	}
+	if cfg == nil {
+		slog.Debug("Coordinator serves no scanner config")
+		return
+	}
+	s.applyConfig(*cfg)
+}
+
+// runConfigRefresh refreshes the coordinator's recommended settings every
+// interval until ctx is canceled.
+func (s *Scanner) runConfigRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshConfig(ctx)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// configCoordinator serves /api/scanner/config from cfg (404 while nil) and
+// hands out numbered batches at /api/scanner/jobs, recording each request.
+type configCoordinator struct {
+	cfg      atomic.Pointer[api.ScannerConfigResponse]
+	jobs     []api.GetBatchRequest
+	returned []int64
+	nextID   int64
+}
+
+func (c *configCoordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/scanner/config":
+		cfg := c.cfg.Load()
+		if cfg == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(cfg)
+	case "/api/scanner/jobs":
+		var req api.GetBatchRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c.jobs = append(c.jobs, req)
+		resp := api.GetBatchResponse{Domains: []string{}}
+		if req.BatchCount <= 1 {
+			c.nextID++
+			resp.BatchID, resp.Domains = c.nextID, []string{"example.com"}
+		}
+		for range req.BatchCount {
+			c.nextID++
+			resp.Batches = append(resp.Batches, api.BatchAssignment{BatchID: c.nextID, Domains: []string{"example.com"}})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case "/api/scanner/return":
+		var req api.ReturnBatchRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		c.returned = append(c.returned, req.BatchID)
+		_ = json.NewEncoder(w).Encode(api.ReturnBatchResponse{OK: true})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newConfigTestScanner(t *testing.T, coord *configCoordinator, maxLookups int) *Scanner {
+	t.Helper()
+	srv := httptest.NewServer(coord)
+	t.Cleanup(srv.Close)
+	s := New(Config{CoordinatorURL: srv.URL, Token: "token", WorkerCount: 1, MaxConcurrentLookups: maxLookups})
+	t.Cleanup(func() { s.dns.Close() }) //nolint:errcheck // Test cleanup
+	return s
+}
+
+func TestScanner_RefreshConfig_Applies(t *testing.T) {
+	coord := &configCoordinator{}
+	coord.cfg.Store(&api.ScannerConfigResponse{BatchCount: 3, EmptyQueueDelaySeconds: 60, MaxConcurrentLookups: 2})
+	s := newConfigTestScanner(t, coord, 5)
+	ctx := context.Background()
+
+	s.refreshConfig(ctx)
+
+	if got := s.limiter.Limit(); got != 2 {
+		t.Errorf("lookup cap = %d, want 2", got)
+	}
+	w := s.newWorkers()[0]
+	w.Config.MaxBackoff = time.Hour
+	if d := w.emptyQueueDelay(0); d < 30*time.Second || d > 90*time.Second {
+		t.Errorf("empty queue delay = %s, want 60s with jitter", d)
+	}
+
+	// Three batches are claimed at once and handed out one at a time
+	for want := int64(1); want <= 3; want++ {
+		b, err := s.coordinator.GetBatch(ctx)
+		if err != nil {
+			t.Fatalf("GetBatch: %v", err)
+		}
+		if b.ID != want {
+			t.Errorf("GetBatch returned batch %d, want %d", b.ID, want)
+		}
+	}
+	if len(coord.jobs) != 1 || coord.jobs[0].BatchCount != 3 {
+		t.Errorf("jobs requests = %+v, want one for 3 batches", coord.jobs)
+	}
+
+	// Batches claimed ahead but not yet scanned go back at shutdown
+	if _, err := s.coordinator.GetBatch(ctx); err != nil {
+		t.Fatalf("GetBatch: %v", err)
+	}
+	s.returnPrefetched(ctx)
+	if want := []int64{5, 6}; len(coord.returned) != 2 || coord.returned[0] != want[0] || coord.returned[1] != want[1] {
+		t.Errorf("returned batches %v, want %v", coord.returned, want)
+	}
+}
+
+func TestScanner_RefreshConfig_KeepsSettingsWithoutConfig(t *testing.T) {
+	coord := &configCoordinator{}
+	s := newConfigTestScanner(t, coord, 5)
+	ctx := context.Background()
+
+	// An older coordinator without the endpoint changes nothing
+	s.refreshConfig(ctx)
+	if got := s.limiter.Limit(); got != 5 {
+		t.Errorf("lookup cap = %d, want the scanner's own 5", got)
+	}
+	if _, err := s.coordinator.GetBatch(ctx); err != nil {
+		t.Fatalf("GetBatch: %v", err)
+	}
+	if coord.jobs[0].BatchCount != 0 {
+		t.Errorf("batch_count = %d, want it left out", coord.jobs[0].BatchCount)
+	}
+
+	// A later push takes effect, and withdrawing it restores the defaults
+	coord.cfg.Store(&api.ScannerConfigResponse{MaxConcurrentLookups: 1, BatchCount: 2})
+	s.refreshConfig(ctx)
+	if got := s.limiter.Limit(); got != 1 {
+		t.Errorf("lookup cap = %d after push, want 1", got)
+	}
+	coord.cfg.Store(&api.ScannerConfigResponse{})
+	s.refreshConfig(ctx)
+	if got := s.limiter.Limit(); got != 5 {
+		t.Errorf("lookup cap = %d after withdrawal, want 5", got)
+	}
+	if _, err := s.coordinator.GetBatch(ctx); err != nil {
+		t.Fatalf("GetBatch: %v", err)
+	}
+	if last := coord.jobs[len(coord.jobs)-1]; last.BatchCount != 0 {
+		t.Errorf("batch_count = %d after withdrawal, want it left out", last.BatchCount)
+	}
+}
@@ -1,10 +1,15 @@
+// Package scanner provides the DNS LOC record scanner implementation.
 package scanner
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/locplace/scanner/pkg/api"
 )
 
 // Config holds the scanner configuration.
@@ -14,6 +19,80 @@ type Config struct {
 	WorkerCount       int
 	HeartbeatInterval time.Duration
 	DNSConfig         DNSConfig
+	// MaxConcurrentLookups caps DNS queries in flight across all workers;
+	// zero leaves each worker limited only by DNSConfig.Workers.
+	MaxConcurrentLookups int
+
+	// EnumerateSubdomains also scans subdomains found for each domain
+	// handed out by the coordinator, using SubdomainEnumerator.
+	EnumerateSubdomains bool
+	// SubdomainEnumerator names the enumerator: "subfinder" (the default)
+	// or "crtsh".
+	SubdomainEnumerator string
+
+	// SubmitMaxAttempts and SubmitBackoff override the workers' result
+	// submission retry policy when positive (see WorkerConfig).
+	SubmitMaxAttempts int
+	SubmitBackoff     time.Duration
+
+	// SpoolDir, if set, keeps results that couldn't be submitted on disk.
+	// They are resent on startup and every DefaultSpoolFlushInterval.
+	SpoolDir string
+
+	// BreakerThreshold is how many coordinator calls in a row, across all
+	// workers, must fail before they all pause for BreakerCooldown (see
+	// CircuitBreaker). Zero or less disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// MaxBatchDuration, if positive, caps the time a worker spends scanning
+	// a batch before submitting partial results (see WorkerConfig).
+	MaxBatchDuration time.Duration
+
+	// CoordinatorTimeout bounds each request to the coordinator
+	// (DefaultCoordinatorTimeout if zero).
+	CoordinatorTimeout time.Duration
+	// CoordinatorMaxIdleConns is how many idle connections to the
+	// coordinator are kept for reuse. Zero means one per worker, plus two
+	// for heartbeats and spool flushes.
+	CoordinatorMaxIdleConns int
+	// CompressSubmissions gzips result submissions to the coordinator,
+	// shrinking large batches on metered links.
+	CompressSubmissions bool
+	// ConfigRefreshInterval is how often the coordinator's recommended
+	// settings are fetched (see RemoteConfig); zero disables fetching.
+	ConfigRefreshInterval time.Duration
+}
+
+// dnsPoolSize is how many resolvers the shared DNSScanner needs: one per
+// lookup that can be in flight at once across all workers.
+func (c Config) dnsPoolSize() int {
+	if c.DNSConfig.PoolSize > 0 {
+		return c.DNSConfig.PoolSize
+	}
+	n := max(c.DNSConfig.Workers, 1) * max(c.WorkerCount, 1)
+	if c.MaxConcurrentLookups > 0 {
+		n = min(n, c.MaxConcurrentLookups)
+	}
+	return n
+}
+
+// newCoordinatorClient creates the coordinator client shared by the
+// scanner's workers, with HTTP connections sized for them.
+func (c Config) newCoordinatorClient() *CoordinatorClient {
+	timeout := c.CoordinatorTimeout
+	if timeout <= 0 {
+		timeout = DefaultCoordinatorTimeout
+	}
+	maxIdleConns := c.CoordinatorMaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = max(c.WorkerCount, 1) + 2
+	}
+
+	client := NewCoordinatorClient(c.CoordinatorURL, c.Token)
+	client.HTTPClient = newCoordinatorHTTPClient(timeout, maxIdleConns)
+	client.GzipSubmissions = c.CompressSubmissions
+	return client
 }
 
 // DefaultConfig returns the default scanner configuration.
@@ -24,6 +103,10 @@ func DefaultConfig() Config {
 		WorkerCount:       4,
 		HeartbeatInterval: 30 * time.Second,
 		DNSConfig:         DefaultDNSConfig(),
+		BreakerThreshold:  10,
+		BreakerCooldown:   time.Minute,
+
+		ConfigRefreshInterval: DefaultConfigRefreshInterval,
 	}
 }
 
@@ -32,6 +115,11 @@ type Scanner struct {
 	config      Config
 	coordinator *CoordinatorClient
 	metrics     *Metrics
+	dns         *DNSScanner // Shared by all workers; closed when Run returns
+	tracker     *DomainTracker
+	breaker     *CircuitBreaker // Shared by all workers; nil if disabled
+	limiter     *LookupLimiter  // Caps the shared DNSScanner's lookups
+	remote      *RemoteConfig   // Coordinator-recommended settings
 
 	// Graceful shutdown
 	shutdownCh   chan struct{}
@@ -40,11 +128,23 @@ type Scanner struct {
 
 // New creates a new scanner.
 func New(config Config) *Scanner {
-	return &Scanner{
+	dnsConfig := config.DNSConfig
+	dnsConfig.PoolSize = config.dnsPoolSize()
+	// Always created, even without a cap, so the coordinator can set one
+	limiter := newLookupLimiter(config.MaxConcurrentLookups)
+	s := &Scanner{
 		config:      config,
-		coordinator: NewCoordinatorClient(config.CoordinatorURL, config.Token),
+		coordinator: config.newCoordinatorClient(),
+		dns:         NewDNSScanner(dnsConfig, limiter),
+		tracker:     NewDomainTracker(),
+		limiter:     limiter,
+		remote:      &RemoteConfig{},
 		shutdownCh:  make(chan struct{}),
 	}
+	if config.BreakerThreshold > 0 {
+		s.breaker = NewCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown)
+	}
+	return s
 }
 
 // InitiateShutdown signals workers to stop fetching new jobs.
@@ -62,65 +162,175 @@ func (s *Scanner) SetMetrics(m *Metrics) {
 
 // Run starts the scanner. It blocks until the context is canceled.
 func (s *Scanner) Run(ctx context.Context) error {
-	log.Printf("Starting scanner with %d workers", s.config.WorkerCount)
-	log.Printf("Session ID: %s", s.coordinator.SessionID)
-	log.Printf("Coordinator: %s", s.config.CoordinatorURL)
-	log.Printf("Heartbeat interval: %s", s.config.HeartbeatInterval)
+	slog.Info("Starting scanner", "version", Version, "commit", Commit, "workers", s.config.WorkerCount, "max_concurrent_lookups", s.config.MaxConcurrentLookups,
+		"session_id", s.coordinator.SessionID,
+		"coordinator", s.config.CoordinatorURL, "heartbeat_interval", s.config.HeartbeatInterval.String())
 
 	// Start heartbeat goroutine
 	heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
 	defer cancelHeartbeat()
 	go s.runHeartbeat(heartbeatCtx)
 
-	// Start workers
-	var wg sync.WaitGroup
-	workerConfig := WorkerConfig{
-		DNSConfig:       s.config.DNSConfig,
-		RetryDelay:      5 * time.Second,
-		EmptyQueueDelay: 30 * time.Second,
+	// Apply the coordinator's recommended settings before claiming work,
+	// then keep them up to date
+	if s.config.ConfigRefreshInterval > 0 {
+		s.refreshConfig(ctx)
+		go s.runConfigRefresh(heartbeatCtx, s.config.ConfigRefreshInterval)
 	}
 
-	for i := 0; i < s.config.WorkerCount; i++ {
+	// Resend results spooled by an earlier run, then keep flushing
+	if s.config.SpoolDir != "" {
+		spool := &Spool{Dir: s.config.SpoolDir}
+		go func() {
+			spool.flushAndLog(heartbeatCtx, s.submitSpooled)
+			spool.runFlusher(heartbeatCtx, DefaultSpoolFlushInterval, s.submitSpooled)
+		}()
+	}
+
+	// Start workers
+	var wg sync.WaitGroup
+	for _, worker := range s.newWorkers() {
 		wg.Add(1)
-		worker := NewWorker(i+1, workerConfig, s.coordinator, s.shutdownCh, s.metrics)
 		go func() {
 			defer wg.Done()
 			worker.Run(ctx)
 		}()
 	}
 
-	// Wait for all workers to finish
+	// Wait for all workers to finish, then release the shared resolvers
 	wg.Wait()
-	log.Println("Scanner stopped")
+	s.returnPrefetched(ctx)
+	if err := s.dns.Close(); err != nil {
+		slog.Error("Error closing DNS resolver", "error", err)
+	}
+	slog.Info("Scanner stopped")
 	return nil
 }
 
+// returnPrefetched hands back batches claimed ahead that no worker got to,
+// so they're requeued now rather than when the reaper times them out.
+func (s *Scanner) returnPrefetched(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	n, err := s.coordinator.ReturnPrefetched(ctx)
+	if n > 0 {
+		slog.Info("Returned prefetched batches", "batches", n)
+	}
+	if err != nil {
+		slog.Warn("Failed to return prefetched batches, they will be reaped", "error", err)
+	}
+}
+
+// submitSpooled resends spooled results to the coordinator.
+func (s *Scanner) submitSpooled(ctx context.Context, res SpooledResult) error {
+	return s.coordinator.SubmitBatch(ctx, res.BatchID, res.DomainsChecked, res.Checked, res.LOCRecords)
+}
+
+// newWorkers creates the configured number of workers, all sharing the
+// scanner's DNSScanner and circuit breaker.
+func (s *Scanner) newWorkers() []*Worker {
+	workerConfig := DefaultWorkerConfig()
+	if s.config.SubmitMaxAttempts > 0 {
+		workerConfig.SubmitMaxAttempts = s.config.SubmitMaxAttempts
+	}
+	if s.config.SubmitBackoff > 0 {
+		workerConfig.SubmitBackoff = s.config.SubmitBackoff
+	}
+	workerConfig.SpoolDir = s.config.SpoolDir
+	workerConfig.MaxBatchDuration = s.config.MaxBatchDuration
+	if s.config.EnumerateSubdomains {
+		workerConfig.Enumerator = newEnumerator(s.config.SubdomainEnumerator)
+	}
+	workers := make([]*Worker, s.config.WorkerCount)
+	for i := range workers {
+		workers[i] = NewWorker(i+1, workerConfig, s.coordinator, s.dns, s.tracker, s.shutdownCh, s.metrics)
+		workers[i].Breaker = s.breaker
+		workers[i].Remote = s.remote
+	}
+	return workers
+}
+
+// newEnumerator returns the named subdomain enumerator, or nil (after
+// logging why) if it can't be used.
+func newEnumerator(name string) SubdomainEnumerator {
+	switch name {
+	case "", "subfinder":
+		subfinder := NewSubfinder()
+		if !subfinder.IsAvailable() {
+			slog.Warn("Subdomain enumeration enabled but subfinder is not installed, scanning batch domains only")
+			return nil
+		}
+		return subfinder
+	case "crtsh":
+		return NewCTLogEnumerator()
+	default:
+		slog.Warn("Unknown subdomain enumerator, scanning batch domains only", "enumerator", name)
+		return nil
+	}
+}
+
+// SelfTestDomains have long-standing LOC records, making them a good default
+// for checking that DNS lookups work.
+var SelfTestDomains = []string{"caida.org", "ckdhr.com"}
+
+// SelfTest looks up LOC records for domains without contacting the
+// coordinator, logging each outcome, so operators can check their DNS
+// configuration before joining the queue. It returns the records found, and
+// an error if any lookup failed outright.
+func (s *Scanner) SelfTest(ctx context.Context, domains []string) ([]api.LOCRecord, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("no domains to test")
+	}
+	slog.Info("Starting self-test", "domains", len(domains), "nameservers", s.config.DNSConfig.Nameservers)
+
+	results := s.dns.LookupLOCBatch(ctx, domains)
+	var failed int
+	for _, r := range results {
+		switch {
+		case r.Error != nil:
+			failed++
+			slog.Error("Self-test lookup failed", "fqdn", r.FQDN, "error", r.Error)
+		case !r.HasLOC:
+			slog.Info("Self-test found no LOC record", "fqdn", r.FQDN)
+		}
+	}
+
+	// Parse the same way workers do, so unparseable answers show up too
+	w := &Worker{Metrics: s.metrics}
+	records := w.collectLOCRecords(results)
+
+	if failed > 0 {
+		return records, fmt.Errorf("%d of %d lookups failed", failed, len(results))
+	}
+	return records, nil
+}
+
 // runHeartbeat sends periodic heartbeats to the coordinator.
 func (s *Scanner) runHeartbeat(ctx context.Context) {
 	ticker := time.NewTicker(s.config.HeartbeatInterval)
 	defer ticker.Stop()
 
-	log.Printf("Heartbeat started: interval=%s", s.config.HeartbeatInterval)
+	slog.Info("Heartbeat started", "interval", s.config.HeartbeatInterval.String())
 
 	var consecutiveErrors int
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Heartbeat stopped")
+			slog.Info("Heartbeat stopped")
 			return
 		case <-ticker.C:
-			if err := s.coordinator.Heartbeat(ctx); err != nil {
+			if err := s.coordinator.Heartbeat(ctx, s.tracker.List()); err != nil {
 				consecutiveErrors++
 				if consecutiveErrors == 1 {
-					log.Printf("Heartbeat error: %v (entering backoff)", err)
+					slog.Error("Heartbeat error, entering backoff", "error", err)
 				}
 			} else {
 				if consecutiveErrors > 0 {
-					log.Printf("Heartbeat recovered after %d errors", consecutiveErrors)
+					slog.Info("Heartbeat recovered", "errors", consecutiveErrors)
 				}
 				consecutiveErrors = 0
-				log.Println("Heartbeat sent")
+				slog.Debug("Heartbeat sent")
 			}
 		}
 	}
@@ -0,0 +1,216 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeQuery answers LOC queries from a fixed table, standing in for DNS.
+// A result's RawRecord is the LOC answer; unknown names have no record.
+func fakeQuery(answers map[string]LOCResult) func(context.Context, string) (locAnswer, error) {
+	return func(_ context.Context, name string) (locAnswer, error) {
+		r := answers[name]
+		return locAnswer{LOC: r.RawRecord}, r.Error
+	}
+}
+
+func TestScanner_SelfTest(t *testing.T) {
+	// The coordinator must not be contacted during a self-test
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected coordinator request: %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	config := DefaultConfig()
+	config.CoordinatorURL = srv.URL
+	s := New(config)
+	s.dns.query = fakeQuery(map[string]LOCResult{
+		"caida.org": {HasLOC: true, RawRecord: "32 53 1.000 N 117 14 25.000 W 107.00m 30.00m 10.00m 10.00m"},
+		"ckdhr.com": {HasLOC: true, RawRecord: "42 21 43.528 N 71 5 6.284 W -25.00m 1.00m 3000.00m 10.00m"},
+	})
+
+	records, err := s.SelfTest(context.Background(), []string{"caida.org", "ckdhr.com", "example.com"})
+	if err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("records = %+v, want caida.org and ckdhr.com", records)
+	}
+	for _, r := range records {
+		if r.FQDN == "caida.org" && (r.Latitude < 32.88 || r.Latitude > 32.89) {
+			t.Errorf("caida.org latitude = %v, want ~32.883", r.Latitude)
+		}
+	}
+}
+
+func TestScanner_SelfTest_LookupErrors(t *testing.T) {
+	s := New(DefaultConfig())
+	s.dns.query = fakeQuery(map[string]LOCResult{
+		"caida.org": {HasLOC: true, RawRecord: "32 53 1.000 N 117 14 25.000 W 107.00m 30.00m 10.00m 10.00m"},
+		"ckdhr.com": {Error: errors.New("i/o timeout")},
+	})
+
+	records, err := s.SelfTest(context.Background(), SelfTestDomains)
+	if err == nil {
+		t.Error("SelfTest succeeded despite a failed lookup")
+	}
+	if len(records) != 1 || records[0].FQDN != "caida.org" {
+		t.Errorf("records = %+v, want caida.org still reported", records)
+	}
+}
+
+func TestScanner_SelfTest_NoDomains(t *testing.T) {
+	if _, err := New(DefaultConfig()).SelfTest(context.Background(), nil); err == nil {
+		t.Error("SelfTest with no domains succeeded")
+	}
+}
+
+func TestScanner_WorkersShareDNSScanner(t *testing.T) {
+	config := DefaultConfig()
+	config.WorkerCount = 3
+	config.DNSConfig.Workers = 4
+	s := New(config)
+
+	workers := s.newWorkers()
+	if len(workers) != 3 {
+		t.Fatalf("workers = %d, want 3", len(workers))
+	}
+	for _, w := range workers {
+		if w.DNS != s.dns {
+			t.Errorf("worker %d has its own DNSScanner, want the shared one", w.ID)
+		}
+	}
+	if s.dns.poolSize != 12 {
+		t.Errorf("shared pool size = %d, want 12 (3 workers x 4 lookups)", s.dns.poolSize)
+	}
+}
+
+func TestConfig_DNSPoolSize(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want int
+	}{
+		{"workers times lookups", Config{WorkerCount: 4, DNSConfig: DNSConfig{Workers: 10}}, 40},
+		{"capped by max concurrent lookups", Config{WorkerCount: 4, DNSConfig: DNSConfig{Workers: 10}, MaxConcurrentLookups: 16}, 16},
+		{"explicit pool size", Config{WorkerCount: 4, DNSConfig: DNSConfig{Workers: 10, PoolSize: 5}}, 5},
+		{"zero values", Config{}, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.dnsPoolSize(); got != tt.want {
+			t.Errorf("%s: dnsPoolSize() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanner_Run_ClosesDNSOnce(t *testing.T) {
+	config := DefaultConfig()
+	config.WorkerCount = 3
+	config.ConfigRefreshInterval = 0 // No coordinator to fetch settings from
+	s := New(config)
+	s.InitiateShutdown() // Workers exit before fetching any batch
+
+	// A worker exiting must leave the shared scanner open for the others
+	s.newWorkers()[0].Run(context.Background())
+	if s.dns.closed {
+		t.Fatal("worker closed the shared DNSScanner")
+	}
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !s.dns.closed {
+		t.Error("shared DNSScanner not closed after Run")
+	}
+	if _, open := <-s.dns.resolverPool; open {
+		t.Error("resolver pool still open after Run")
+	}
+}
+
+func TestScanner_NewWorkers_Config(t *testing.T) {
+	s := New(DefaultConfig())
+	s.SetMetrics(NewMetrics(prometheus.NewRegistry()))
+
+	for _, w := range s.newWorkers() {
+		if w.Config != DefaultWorkerConfig() {
+			t.Errorf("worker %d config = %+v, want %+v", w.ID, w.Config, DefaultWorkerConfig())
+		}
+		// Without MaxBackoff, backoffDelay would cap every wait at zero
+		w.consecutiveErrors = 1
+		if w.backoffDelay() <= 0 {
+			t.Errorf("worker %d does not back off after an error", w.ID)
+		}
+		if w.Metrics != s.metrics {
+			t.Errorf("worker %d metrics not passed through", w.ID)
+		}
+		if w.Coordinator != s.coordinator || w.ShutdownCh == nil {
+			t.Errorf("worker %d not wired to the scanner's coordinator and shutdown signal", w.ID)
+		}
+	}
+}
+
+func TestConfig_NewCoordinatorClient(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          Config
+		wantTimeout  time.Duration
+		wantMaxConns int
+	}{
+		{"defaults", Config{WorkerCount: 4}, DefaultCoordinatorTimeout, 6},
+		{"configured", Config{WorkerCount: 4, CoordinatorTimeout: 2 * time.Minute, CoordinatorMaxIdleConns: 32}, 2 * time.Minute, 32},
+		{"zero workers", Config{}, DefaultCoordinatorTimeout, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.CoordinatorURL = "http://coordinator.example"
+			tt.cfg.Token = "token"
+			c := tt.cfg.newCoordinatorClient()
+
+			if c.BaseURL != tt.cfg.CoordinatorURL || c.Token != "token" || c.SessionID == "" {
+				t.Errorf("client = %+v, want the configured URL and token with a session ID", c)
+			}
+			if c.HTTPClient.Timeout != tt.wantTimeout {
+				t.Errorf("Timeout = %s, want %s", c.HTTPClient.Timeout, tt.wantTimeout)
+			}
+			transport, ok := c.HTTPClient.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("Transport = %T, want *http.Transport", c.HTTPClient.Transport)
+			}
+			if transport == http.DefaultTransport {
+				t.Error("client shares http.DefaultTransport")
+			}
+			if transport.MaxIdleConnsPerHost != tt.wantMaxConns {
+				t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, tt.wantMaxConns)
+			}
+			if transport.MaxIdleConns < tt.wantMaxConns {
+				t.Errorf("MaxIdleConns = %d, below the per-host limit %d", transport.MaxIdleConns, tt.wantMaxConns)
+			}
+			if transport.Proxy == nil {
+				t.Error("transport dropped the default proxy settings")
+			}
+		})
+	}
+}
+
+func TestScanner_UsesConfiguredCoordinatorClient(t *testing.T) {
+	config := DefaultConfig()
+	config.CoordinatorTimeout = 45 * time.Second
+	s := New(config)
+	defer s.dns.Close() //nolint:errcheck // Test cleanup
+
+	if s.coordinator.HTTPClient.Timeout != 45*time.Second {
+		t.Errorf("Timeout = %s, want 45s", s.coordinator.HTTPClient.Timeout)
+	}
+	for _, w := range s.newWorkers() {
+		if w.Coordinator != s.coordinator {
+			t.Errorf("worker %d has its own coordinator client, want the shared one", w.ID)
+		}
+	}
+}
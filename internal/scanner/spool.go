@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+// DefaultSpoolFlushInterval is how often spooled results are resent while
+// the scanner runs.
+const DefaultSpoolFlushInterval = time.Minute
+
+// SpooledResult is a batch's results that couldn't be submitted.
+type SpooledResult struct {
+	BatchID        int64           `json:"batch_id"`
+	DomainsChecked int             `json:"domains_checked"`
+	LOCRecords     []api.LOCRecord `json:"loc_records"`
+	// Checked is the FQDNs that got a definitive answer.
+	Checked []string `json:"checked,omitempty"`
+}
+
+// Spool keeps unsubmitted batch results on disk, one JSON file per batch, so
+// they survive coordinator outages and scanner restarts.
+type Spool struct {
+	Dir string
+}
+
+// spoolFile returns the path results for batchID are spooled at.
+func (s *Spool) spoolFile(batchID int64) string {
+	return filepath.Join(s.Dir, "batch-"+strconv.FormatInt(batchID, 10)+".json")
+}
+
+// Save writes res to the spool, replacing any earlier results for its batch.
+// The file is written under a temporary name and renamed into place, so a
+// concurrent Flush never reads a partial file.
+func (s *Spool) Save(res SpooledResult) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".batch-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()           //nolint:errcheck // Already failing
+		os.Remove(tmp.Name()) //nolint:errcheck // Best effort cleanup
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck // Best effort cleanup
+		return err
+	}
+	return os.Rename(tmp.Name(), s.spoolFile(res.BatchID))
+}
+
+// pending returns the spooled result files, oldest batch first.
+func (s *Spool) pending() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, "batch-") && strings.HasSuffix(name, ".json") {
+			files = append(files, filepath.Join(s.Dir, name))
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// Flush submits every spooled result, deleting each once it's accepted. It
+// stops at the first failed submission, since the rest would likely fail
+// too, and returns how many were sent. Unreadable files are renamed with a
+// .bad suffix so they don't block the spool.
+func (s *Spool) Flush(ctx context.Context, submit func(ctx context.Context, res SpooledResult) error) (int, error) {
+	files, err := s.pending()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, path := range files {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+
+		var res SpooledResult
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &res)
+		}
+		if err != nil {
+			slog.Error("Unreadable spooled results, setting aside", "file", path, "error", err)
+			if err := os.Rename(path, path+".bad"); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		if err := submit(ctx, res); err != nil {
+			return sent, fmt.Errorf("submit spooled batch %d: %w", res.BatchID, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// runFlusher resends spooled results every interval until ctx is canceled.
+func (s *Spool) runFlusher(ctx context.Context, interval time.Duration, submit func(ctx context.Context, res SpooledResult) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		s.flushAndLog(ctx, submit)
+	}
+}
+
+// flushAndLog runs Flush, logging the outcome.
+func (s *Spool) flushAndLog(ctx context.Context, submit func(ctx context.Context, res SpooledResult) error) {
+	sent, err := s.Flush(ctx, submit)
+	if sent > 0 {
+		slog.Info("Resent spooled results", "batches", sent)
+	}
+	if err != nil && ctx.Err() == nil {
+		slog.Warn("Failed to resend spooled results, will retry", "error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestSpool_SaveAndFlush(t *testing.T) {
+	spool := &Spool{Dir: filepath.Join(t.TempDir(), "spool")} // Created on first Save
+	rec := api.LOCRecord{FQDN: "a.example.com", RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m"}
+	for _, res := range []SpooledResult{
+		{BatchID: 9, DomainsChecked: 10},
+		{BatchID: 3, DomainsChecked: 5, LOCRecords: []api.LOCRecord{rec}},
+	} {
+		if err := spool.Save(res); err != nil {
+			t.Fatalf("Save(%d): %v", res.BatchID, err)
+		}
+	}
+
+	var got []SpooledResult
+	sent, err := spool.Flush(context.Background(), func(_ context.Context, res SpooledResult) error {
+		got = append(got, res)
+		return nil
+	})
+	if err != nil || sent != 2 {
+		t.Fatalf("Flush = %d, %v; want 2, nil", sent, err)
+	}
+	if len(got) != 2 || got[0].BatchID != 3 || got[1].BatchID != 9 {
+		t.Fatalf("flushed %+v, want batches 3 then 9", got)
+	}
+	if got[0].DomainsChecked != 5 || !slices.Equal(got[0].LOCRecords, []api.LOCRecord{rec}) {
+		t.Errorf("batch 3 = %+v, want its saved results", got[0])
+	}
+
+	entries, _ := os.ReadDir(spool.Dir) //nolint:errcheck // Checked via len
+	if len(entries) != 0 {
+		t.Errorf("spool still holds %d files after a full flush", len(entries))
+	}
+}
+
+func TestSpool_FlushStopsOnFailure(t *testing.T) {
+	spool := &Spool{Dir: t.TempDir()}
+	for _, id := range []int64{1, 2} {
+		if err := spool.Save(SpooledResult{BatchID: id}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	calls := 0
+	sent, err := spool.Flush(context.Background(), func(context.Context, SpooledResult) error {
+		calls++
+		return errors.New("coordinator down")
+	})
+	if err == nil || sent != 0 || calls != 1 {
+		t.Errorf("Flush = %d, %v after %d submits; want an error after one", sent, err, calls)
+	}
+
+	files, _ := spool.pending() //nolint:errcheck // Checked via len
+	if len(files) != 2 {
+		t.Errorf("%d files left, want both kept for the next flush", len(files))
+	}
+}
+
+func TestSpool_SetsAsideUnreadableFiles(t *testing.T) {
+	spool := &Spool{Dir: t.TempDir()}
+	bad := filepath.Join(spool.Dir, "batch-1.json")
+	if err := os.WriteFile(bad, []byte("{truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := spool.Save(SpooledResult{BatchID: 2}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var got []int64
+	sent, err := spool.Flush(context.Background(), func(_ context.Context, res SpooledResult) error {
+		got = append(got, res.BatchID)
+		return nil
+	})
+	if err != nil || sent != 1 || !slices.Equal(got, []int64{2}) {
+		t.Errorf("Flush = %d, %v sending %v; want just batch 2", sent, err, got)
+	}
+	if _, err := os.Stat(bad + ".bad"); err != nil {
+		t.Errorf("unreadable file not set aside: %v", err)
+	}
+}
+
+func TestSpool_FlushMissingDir(t *testing.T) {
+	spool := &Spool{Dir: filepath.Join(t.TempDir(), "never-created")}
+	sent, err := spool.Flush(context.Background(), func(context.Context, SpooledResult) error {
+		t.Error("submit called for an empty spool")
+		return nil
+	})
+	if err != nil || sent != 0 {
+		t.Errorf("Flush = %d, %v; want 0, nil", sent, err)
+	}
+}
+
+func TestWorker_SpoolsFailedSubmission(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/scanner/jobs":
+			_ = json.NewEncoder(w).Encode(api.GetBatchResponse{BatchID: 7, Domains: []string{"a.example.com"}})
+		case "/api/scanner/results":
+			close(shutdownCh) // Stop after this batch
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dns := NewDNSScanner(DNSConfig{Workers: 1}, nil)
+	dns.query = func(context.Context, string) (locAnswer, error) { return locAnswer{}, nil }
+	cfg := DefaultWorkerConfig()
+	cfg.SubmitMaxAttempts = 1
+	cfg.SpoolDir = t.TempDir()
+	NewWorker(1, cfg, NewCoordinatorClient(srv.URL, "token"), dns, NewDomainTracker(), shutdownCh, nil).Run(context.Background())
+
+	// The next run's flush resends the spooled results to the coordinator
+	var replayed api.SubmitBatchRequest
+	replay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&replayed)
+		_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+	}))
+	defer replay.Close()
+
+	s := New(Config{CoordinatorURL: replay.URL, Token: "token", SpoolDir: cfg.SpoolDir})
+	defer s.dns.Close() //nolint:errcheck // Test cleanup
+	sent, err := (&Spool{Dir: cfg.SpoolDir}).Flush(context.Background(), s.submitSpooled)
+	if err != nil || sent != 1 {
+		t.Fatalf("Flush = %d, %v; want the one spooled batch", sent, err)
+	}
+	if replayed.BatchID != 7 || replayed.DomainsChecked != 1 {
+		t.Errorf("replayed %+v, want batch 7 with 1 domain checked", replayed)
+	}
+}
@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Subfinder enumerates a domain's subdomains by running the subfinder CLI
+// (https://github.com/projectdiscovery/subfinder).
+type Subfinder struct {
+	// Binary is the subfinder executable, looked up on PATH if not a path.
+	Binary string
+	// Timeout bounds a single domain's enumeration.
+	Timeout time.Duration
+}
+
+// NewSubfinder returns a Subfinder using the subfinder binary on PATH.
+func NewSubfinder() *Subfinder {
+	return &Subfinder{Binary: "subfinder", Timeout: 2 * time.Minute}
+}
+
+// IsAvailable reports whether the subfinder binary can be found.
+func (s *Subfinder) IsAvailable() bool {
+	_, err := exec.LookPath(s.Binary)
+	return err == nil
+}
+
+// IsSubfinderAvailable reports whether subfinder is installed on PATH.
+func IsSubfinderAvailable() bool {
+	return NewSubfinder().IsAvailable()
+}
+
+// Enumerate returns the distinct subdomains subfinder finds for domain,
+// lowercased. Output lines that aren't under domain are ignored.
+func (s *Subfinder) Enumerate(ctx context.Context, domain string) ([]string, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Binary, "-d", domain, "-silent")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("subfinder %s: %w: %s", domain, err, strings.TrimSpace(stderr.String()))
+	}
+	return subdomainsOf(domain, strings.Split(string(out), "\n")), nil
+}
+
+// subdomainsOf collects the distinct names under domain, lowercased and
+// without a trailing dot.
+func subdomainsOf(domain string, names []string) []string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	seen := make(map[string]bool)
+	var subs []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		if !strings.HasSuffix(name, "."+domain) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		subs = append(subs, name)
+	}
+	return subs
+}
@@ -0,0 +1,54 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeSubfinder writes a script that prints output in place of subfinder.
+func fakeSubfinder(t *testing.T, output string) *Subfinder {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "subfinder")
+	script := "#!/bin/sh\ncat <<'OUT'\n" + output + "OUT\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &Subfinder{Binary: path}
+}
+
+func TestSubdomainsOf(t *testing.T) {
+	out := "www.example.com\nMAIL.Example.com.\n\nwww.example.com\nexample.com\nnotexample.com\nother.org\n"
+	got := subdomainsOf("Example.com.", strings.Split(out, "\n"))
+	want := []string{"www.example.com", "mail.example.com"}
+	if !slices.Equal(got, want) {
+		t.Errorf("subdomainsOf = %v, want %v", got, want)
+	}
+}
+
+func TestSubfinder_Enumerate(t *testing.T) {
+	s := fakeSubfinder(t, "a.example.com\nb.example.com\n")
+	if !s.IsAvailable() {
+		t.Fatal("fake subfinder not available")
+	}
+	got, err := s.Enumerate(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Enumerate: %v", err)
+	}
+	if want := []string{"a.example.com", "b.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("Enumerate = %v, want %v", got, want)
+	}
+}
+
+func TestSubfinder_IsAvailable_Missing(t *testing.T) {
+	s := &Subfinder{Binary: filepath.Join(t.TempDir(), "nope")}
+	if s.IsAvailable() {
+		t.Error("IsAvailable = true for a missing binary")
+	}
+	if _, err := s.Enumerate(context.Background(), "example.com"); err == nil {
+		t.Error("Enumerate succeeded without a binary")
+	}
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"slices"
+	"sync"
+)
+
+// DomainTracker records which domains the scanner's workers are currently
+// scanning, so heartbeats can report them. A domain added twice (e.g. by two
+// batches) stays tracked until removed twice. A nil tracker tracks nothing.
+type DomainTracker struct {
+	mu      sync.Mutex
+	domains map[string]int
+}
+
+// NewDomainTracker creates an empty tracker.
+func NewDomainTracker() *DomainTracker {
+	return &DomainTracker{domains: make(map[string]int)}
+}
+
+// Add marks domains as being scanned.
+func (t *DomainTracker) Add(domains ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range domains {
+		t.domains[d]++
+	}
+}
+
+// Remove marks domains as done.
+func (t *DomainTracker) Remove(domains ...string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range domains {
+		if t.domains[d] <= 1 {
+			delete(t.domains, d)
+		} else {
+			t.domains[d]--
+		}
+	}
+}
+
+// List returns the tracked domains in sorted order.
+func (t *DomainTracker) List() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := make([]string, 0, len(t.domains))
+	for d := range t.domains {
+		list = append(list, d)
+	}
+	slices.Sort(list)
+	return list
+}
@@ -0,0 +1,35 @@
+package scanner
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDomainTracker(t *testing.T) {
+	tr := NewDomainTracker()
+	tr.Add("b.example.com", "a.example.com")
+	tr.Add("a.example.com") // Also in a second batch
+
+	if got, want := tr.List(), []string{"a.example.com", "b.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+
+	tr.Remove("a.example.com", "b.example.com")
+	if got, want := tr.List(), []string{"a.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("after first batch: List() = %v, want %v", got, want)
+	}
+
+	tr.Remove("a.example.com", "never-added.example.com")
+	if got := tr.List(); len(got) != 0 {
+		t.Errorf("after both batches: List() = %v, want empty", got)
+	}
+}
+
+func TestDomainTracker_Nil(t *testing.T) {
+	var tr *DomainTracker
+	tr.Add("a.example.com")
+	tr.Remove("a.example.com")
+	if got := tr.List(); got != nil {
+		t.Errorf("nil List() = %v, want nil", got)
+	}
+}
@@ -2,29 +2,53 @@ package scanner
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"math"
 	"math/rand/v2"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/locplace/scanner/pkg/api"
+	"github.com/locplace/scanner/pkg/loc"
 )
 
 // WorkerConfig holds configuration for a scanner worker.
 type WorkerConfig struct {
-	DNSConfig       DNSConfig
+	// Enumerator, if set, finds subdomains of each domain in a batch, which
+	// the worker then scans too.
+	Enumerator SubdomainEnumerator
+
 	RetryDelay      time.Duration
 	EmptyQueueDelay time.Duration
 	MaxBackoff      time.Duration
+
+	// SubmitMaxAttempts is how many times results are sent before the batch
+	// is given up on (at least once).
+	SubmitMaxAttempts int
+	// SubmitBackoff is the wait before the first resubmission; it doubles
+	// on each further one, capped at MaxBackoff.
+	SubmitBackoff time.Duration
+
+	// SpoolDir, if set, is where results that couldn't be submitted are
+	// kept (see Spool) instead of being dropped.
+	SpoolDir string
+
+	// MaxBatchDuration, if positive, bounds the time spent scanning a batch.
+	// FQDNs still unscanned when it runs out are skipped and what was found
+	// is submitted, so a batch of slow names isn't reclaimed mid-scan.
+	MaxBatchDuration time.Duration
 }
 
 // DefaultWorkerConfig returns the default worker configuration.
 func DefaultWorkerConfig() WorkerConfig {
 	return WorkerConfig{
-		DNSConfig:       DefaultDNSConfig(),
-		RetryDelay:      5 * time.Second,
-		EmptyQueueDelay: 30 * time.Second,
-		MaxBackoff:      5 * time.Minute,
+		RetryDelay:        5 * time.Second,
+		EmptyQueueDelay:   30 * time.Second,
+		MaxBackoff:        5 * time.Minute,
+		SubmitMaxAttempts: 3,
+		SubmitBackoff:     5 * time.Second,
 	}
 }
 
@@ -32,27 +56,47 @@ func DefaultWorkerConfig() WorkerConfig {
 type Worker struct {
 	ID          int
 	Config      WorkerConfig
-	Coordinator *CoordinatorClient
+	Coordinator Coordinator
 	DNS         *DNSScanner
+	Tracker     *DomainTracker // Domains being scanned, for heartbeats (optional)
 	ShutdownCh  <-chan struct{}
 	Metrics     *Metrics
 
+	// Breaker, if set, is shared by all of a scanner's workers and holds
+	// back their coordinator calls while the coordinator is down.
+	Breaker *CircuitBreaker
+	// Remote, if set, holds coordinator-recommended settings that take
+	// precedence over Config's.
+	Remote *RemoteConfig
+
 	// Circuit breaker state
 	consecutiveErrors int
+
+	// wait pauses between submit attempts, returning false if ctx ends
+	// first (sleepCtx if nil; tests replace it to skip real waits).
+	wait func(ctx context.Context, d time.Duration) bool
 }
 
-// NewWorker creates a new worker.
-func NewWorker(id int, config WorkerConfig, coordinator *CoordinatorClient, shutdownCh <-chan struct{}, metrics *Metrics) *Worker {
+// NewWorker creates a new worker that looks up LOC records with dns, which
+// is shared by all of a scanner's workers and closed by its owner. The
+// domains of each batch are kept on tracker until its results are submitted.
+func NewWorker(id int, config WorkerConfig, coordinator Coordinator, dns *DNSScanner, tracker *DomainTracker, shutdownCh <-chan struct{}, metrics *Metrics) *Worker {
 	return &Worker{
 		ID:          id,
 		Config:      config,
 		Coordinator: coordinator,
-		DNS:         NewDNSScanner(config.DNSConfig),
+		DNS:         dns,
+		Tracker:     tracker,
 		ShutdownCh:  shutdownCh,
 		Metrics:     metrics,
 	}
 }
 
+// logger returns the default logger tagged with this worker's ID.
+func (w *Worker) logger() *slog.Logger {
+	return slog.With("worker", w.ID)
+}
+
 // backoffDelay calculates exponential backoff delay based on consecutive errors.
 func (w *Worker) backoffDelay() time.Duration {
 	if w.consecutiveErrors == 0 {
@@ -66,6 +110,26 @@ func (w *Worker) backoffDelay() time.Duration {
 	return time.Duration(delay)
 }
 
+// submitDelay returns the wait before submit attempt number attempt+1:
+// SubmitBackoff doubled for each earlier retry, capped at MaxBackoff.
+func (w *Worker) submitDelay(attempt int) time.Duration {
+	d := w.Config.SubmitBackoff << (attempt - 1)
+	if d <= 0 || (w.Config.MaxBackoff > 0 && d > w.Config.MaxBackoff) { // Overflow or cap
+		d = w.Config.MaxBackoff
+	}
+	return d
+}
+
+// sleepCtx waits for d, returning false if ctx is canceled first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
 // recordError increments the consecutive error count.
 // Returns true if this is the first error (entering error state).
 func (w *Worker) recordError() bool {
@@ -81,34 +145,45 @@ func (w *Worker) resetErrors() int {
 	return prev
 }
 
+// emptyQueueDelay returns how long to wait after finding the queue empty.
+// It uses the coordinator's advice when given (capped at MaxBackoff), falling
+// back to the recommended or configured EmptyQueueDelay, with jitter (0.5x
+// to 1.5x) to avoid thundering herd.
+func (w *Worker) emptyQueueDelay(retryAfter time.Duration) time.Duration {
+	base := w.Config.EmptyQueueDelay
+	if d := w.Remote.EmptyQueueDelay(); d > 0 {
+		base = d
+	}
+	if retryAfter > 0 {
+		base = min(retryAfter, w.Config.MaxBackoff)
+	}
+	jitter := 0.5 + rand.Float64()
+	return time.Duration(float64(base) * jitter)
+}
+
 // Run starts the worker loop. It blocks until the context is canceled.
 func (w *Worker) Run(ctx context.Context) {
-	log.Printf("[Worker %d] Started", w.ID)
-	defer func() {
-		if err := w.DNS.Close(); err != nil {
-			log.Printf("[Worker %d] Error closing DNS resolver: %v", w.ID, err)
-		}
-	}() // Clean up DNS resolver resources
+	w.logger().Info("Worker started")
 
 	for {
 		// Check if we should stop getting new jobs (graceful shutdown or context canceled)
 		select {
 		case <-w.ShutdownCh:
-			log.Printf("[Worker %d] Shutdown signal received, exiting", w.ID)
+			w.logger().Info("Shutdown signal received, exiting")
 			return
 		case <-ctx.Done():
-			log.Printf("[Worker %d] Stopped", w.ID)
+			w.logger().Info("Worker stopped")
 			return
 		default:
 		}
 
 		// Apply backoff if we have consecutive errors
 		if backoff := w.backoffDelay(); backoff > 0 {
-			log.Printf("[Worker %d] Backing off for %v after %d consecutive errors",
-				w.ID, backoff, w.consecutiveErrors)
+			w.logger().Warn("Backing off after consecutive errors",
+				"backoff", backoff.String(), "errors", w.consecutiveErrors)
 			select {
 			case <-w.ShutdownCh:
-				log.Printf("[Worker %d] Shutdown signal received during backoff, exiting", w.ID)
+				w.logger().Info("Shutdown signal received during backoff, exiting")
 				return
 			case <-ctx.Done():
 				return
@@ -116,17 +191,24 @@ func (w *Worker) Run(ctx context.Context) {
 			}
 		}
 
+		// Wait while the coordinator is considered down
+		if !w.awaitBreaker(ctx, w.ShutdownCh) {
+			w.logger().Info("Worker stopped while coordinator circuit breaker open")
+			return
+		}
+
 		// Get a batch of FQDNs to scan
 		getBatchStart := time.Now()
 		batch, err := w.Coordinator.GetBatch(ctx)
 		getBatchDuration := time.Since(getBatchStart).Seconds()
+		w.recordBreaker(err)
 
 		if err != nil {
 			if w.Metrics != nil {
 				w.Metrics.GetJobsDuration.WithLabelValues("error").Observe(getBatchDuration)
 			}
 			if w.recordError() {
-				log.Printf("[Worker %d] Connection error: %v (entering backoff)", w.ID, err)
+				w.logger().Error("Connection error, entering backoff", "error", err)
 			}
 			continue
 		}
@@ -137,15 +219,17 @@ func (w *Worker) Run(ctx context.Context) {
 			}
 			// Empty queue is not an error, reset backoff
 			if prev := w.resetErrors(); prev > 0 {
-				log.Printf("[Worker %d] Connection recovered after %d errors", w.ID, prev)
+				w.logger().Info("Connection recovered", "errors", prev)
 			}
-			// Add jitter (0.5x to 1.5x) to avoid thundering herd
-			jitter := 0.5 + rand.Float64()
-			delay := time.Duration(float64(w.Config.EmptyQueueDelay) * jitter)
-			log.Printf("[Worker %d] No batches available, waiting %s...", w.ID, delay.Round(time.Second))
+			var retryAfter time.Duration
+			if batch != nil {
+				retryAfter = batch.RetryAfter
+			}
+			delay := w.emptyQueueDelay(retryAfter)
+			w.logger().Info("No batches available, waiting", "delay", delay.Round(time.Second).String())
 			select {
 			case <-w.ShutdownCh:
-				log.Printf("[Worker %d] Shutdown signal received, exiting", w.ID)
+				w.logger().Info("Shutdown signal received, exiting")
 				return
 			case <-ctx.Done():
 				return
@@ -159,75 +243,215 @@ func (w *Worker) Run(ctx context.Context) {
 			w.Metrics.GetJobsDuration.WithLabelValues("success").Observe(getBatchDuration)
 		}
 
+		// If shutdown began while we were fetching, hand the batch back rather
+		// than leave it in flight until the coordinator's reaper frees it
+		select {
+		case <-w.ShutdownCh:
+			w.returnBatch(ctx, batch.ID)
+			w.logger().Info("Shutdown signal received, exiting")
+			return
+		default:
+		}
+
 		// Process the batch
+		w.Tracker.Add(batch.Domains...)
 		batchStart := time.Now()
-		locRecords := w.processBatch(ctx, batch.Domains)
+		locRecords, tried, checked := w.scanBatch(ctx, batch.Domains)
 		batchDuration := time.Since(batchStart).Seconds()
 
 		hasLOC := len(locRecords) > 0
 
-		// Submit results with retries
-		submitted := false
-		var submitDuration float64
-		for attempt := 1; attempt <= 3; attempt++ {
-			submitStart := time.Now()
-			err := w.Coordinator.SubmitBatch(ctx, batch.ID, len(batch.Domains), locRecords)
-			submitDuration = time.Since(submitStart).Seconds()
-
-			if err == nil {
-				if prev := w.resetErrors(); prev > 0 {
-					log.Printf("[Worker %d] Connection recovered after %d errors", w.ID, prev)
-				}
-				log.Printf("[Worker %d] Submitted batch %d: %d FQDNs checked, %d LOC records found",
-					w.ID, batch.ID, len(batch.Domains), len(locRecords))
-				submitted = true
-				if w.Metrics != nil {
-					w.Metrics.SubmitDuration.WithLabelValues("success", BoolLabel(hasLOC)).Observe(submitDuration)
-				}
-				break
-			}
-
-			if attempt < 3 {
-				if w.Metrics != nil {
-					w.Metrics.SubmitRetries.Inc()
-				}
-				retryDelay := time.Duration(attempt) * 5 * time.Second
-				log.Printf("[Worker %d] Submit failed for batch %d (attempt %d/3): %v, retrying in %s",
-					w.ID, batch.ID, attempt, err, retryDelay)
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(retryDelay):
-				}
-			} else {
-				if w.Metrics != nil {
-					w.Metrics.SubmitDuration.WithLabelValues("error", BoolLabel(hasLOC)).Observe(submitDuration)
-					w.Metrics.SubmitFailures.Inc()
-				}
-				if w.recordError() {
-					log.Printf("[Worker %d] Submit failed for batch %d after 3 attempts: %v (entering backoff)",
-						w.ID, batch.ID, err)
-				}
-			}
-		}
-
+		submitted, canceled := w.submit(ctx, batch.ID, tried, checked, locRecords)
+		w.Tracker.Remove(batch.Domains...)
 		if !submitted {
-			log.Printf("[Worker %d] WARNING: Lost results for batch %d (%d LOC records)",
-				w.ID, batch.ID, len(locRecords))
+			w.spoolResults(SpooledResult{BatchID: batch.ID, DomainsChecked: tried, Checked: checked, LOCRecords: locRecords})
+		}
+		if canceled {
+			return
 		}
 
 		// Record batch-level metrics
 		if w.Metrics != nil {
 			w.Metrics.DomainDuration.WithLabelValues(BoolLabel(hasLOC)).Observe(batchDuration)
-			w.Metrics.DomainsProcessed.Add(float64(len(batch.Domains)))
+			w.Metrics.DomainsProcessed.Add(float64(tried))
 			w.Metrics.LOCRecordsFoundTotal.Add(float64(len(locRecords)))
 		}
 	}
 }
 
-// processBatch scans all FQDNs in the batch for LOC records.
-func (w *Worker) processBatch(ctx context.Context, fqdns []string) []api.LOCRecord {
-	log.Printf("[Worker %d] Processing batch of %d FQDNs", w.ID, len(fqdns))
+// submit sends a batch's results, retrying up to SubmitMaxAttempts times in
+// all with exponential backoff. canceled is true if ctx ended while waiting
+// to retry.
+func (w *Worker) submit(ctx context.Context, batchID int64, domainsChecked int, checked []string, locRecords []api.LOCRecord) (submitted, canceled bool) {
+	hasLOC := BoolLabel(len(locRecords) > 0)
+	maxAttempts := max(w.Config.SubmitMaxAttempts, 1)
+	wait := w.wait
+	if wait == nil {
+		wait = sleepCtx
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Results are still submitted after shutdown begins, so only ctx
+		// cuts this wait short
+		if !w.awaitBreaker(ctx, nil) {
+			return false, true
+		}
+
+		submitStart := time.Now()
+		err := w.Coordinator.SubmitBatch(ctx, batchID, domainsChecked, checked, locRecords)
+		submitDuration := time.Since(submitStart).Seconds()
+		w.recordBreaker(err)
+
+		if err == nil {
+			if prev := w.resetErrors(); prev > 0 {
+				w.logger().Info("Connection recovered", "errors", prev)
+			}
+			w.logger().Info("Submitted batch", "batch_id", batchID,
+				"fqdns", domainsChecked, "loc_records", len(locRecords))
+			if w.Metrics != nil {
+				w.Metrics.SubmitDuration.WithLabelValues("success", hasLOC).Observe(submitDuration)
+			}
+			return true, false
+		}
+
+		if attempt >= maxAttempts {
+			if w.Metrics != nil {
+				w.Metrics.SubmitDuration.WithLabelValues("error", hasLOC).Observe(submitDuration)
+				w.Metrics.SubmitFailures.Inc()
+			}
+			if w.recordError() {
+				w.logger().Error("Submit failed, entering backoff", "batch_id", batchID,
+					"attempts", attempt, "error", err)
+			}
+			return false, false
+		}
+
+		if w.Metrics != nil {
+			w.Metrics.SubmitRetries.Inc()
+		}
+		retryDelay := w.submitDelay(attempt)
+		w.logger().Warn("Submit failed, retrying", "batch_id", batchID,
+			"attempt", attempt, "error", err, "retry_in", retryDelay.String())
+		if !wait(ctx, retryDelay) {
+			return false, true
+		}
+	}
+}
+
+// awaitBreaker blocks until the circuit breaker lets a coordinator call
+// through, returning false if ctx ends or shutdownCh closes first.
+func (w *Worker) awaitBreaker(ctx context.Context, shutdownCh <-chan struct{}) bool {
+	for {
+		ok, wait := w.Breaker.Allow()
+		if ok {
+			return true
+		}
+		select {
+		case <-shutdownCh:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// recordBreaker reports a coordinator call's outcome to the circuit breaker.
+func (w *Worker) recordBreaker(err error) {
+	if err != nil {
+		w.Breaker.Failure()
+	} else {
+		w.Breaker.Success()
+	}
+}
+
+// spoolResults saves results that couldn't be submitted to SpoolDir, to be
+// resent later, or logs their loss if there's no spool.
+func (w *Worker) spoolResults(res SpooledResult) {
+	if w.Config.SpoolDir == "" {
+		w.logger().Warn("Lost results for batch",
+			"batch_id", res.BatchID, "loc_records", len(res.LOCRecords))
+		return
+	}
+	if err := (&Spool{Dir: w.Config.SpoolDir}).Save(res); err != nil {
+		w.logger().Error("Lost results for batch, spooling failed",
+			"batch_id", res.BatchID, "loc_records", len(res.LOCRecords), "error", err)
+		return
+	}
+	w.logger().Warn("Spooled results for batch", "batch_id", res.BatchID,
+		"loc_records", len(res.LOCRecords), "dir", w.Config.SpoolDir)
+}
+
+// returnBatch gives an unprocessed batch back to the coordinator.
+func (w *Worker) returnBatch(ctx context.Context, batchID int64) {
+	if err := w.Coordinator.ReturnBatch(ctx, batchID); err != nil {
+		w.logger().Warn("Failed to return batch, it will be reaped", "batch_id", batchID, "error", err)
+		return
+	}
+	w.logger().Info("Returned batch unprocessed", "batch_id", batchID)
+}
+
+// scanBatch expands a batch's domains and scans them, within
+// MaxBatchDuration if set. It returns the LOC records found, how many FQDNs
+// were actually tried, which is fewer if time ran out, and the FQDNs
+// conclusively checked.
+func (w *Worker) scanBatch(ctx context.Context, domains []string) ([]api.LOCRecord, int, []string) {
+	scanCtx := ctx
+	if w.Config.MaxBatchDuration > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(ctx, w.Config.MaxBatchDuration)
+		defer cancel()
+	}
+
+	fqdns := w.expandDomains(scanCtx, domains)
+	locRecords, tried, checked := w.processBatch(scanCtx, fqdns)
+	if tried < len(fqdns) && ctx.Err() == nil {
+		w.logger().Warn("Batch took too long, submitting partial results",
+			"max_batch_duration", w.Config.MaxBatchDuration.String(), "fqdns", len(fqdns), "tried", tried)
+	}
+	return locRecords, tried, checked
+}
+
+// expandDomains returns the batch's domains followed by the subdomains
+// enumerated for each, when enumeration is enabled. A domain whose
+// enumeration fails is still scanned itself.
+func (w *Worker) expandDomains(ctx context.Context, domains []string) []string {
+	if w.Config.Enumerator == nil {
+		return domains
+	}
+
+	seen := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		seen[strings.ToLower(strings.TrimSuffix(d, "."))] = true
+	}
+	fqdns := slices.Clone(domains)
+	for _, d := range domains {
+		subs, err := w.Config.Enumerator.Enumerate(ctx, d)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			w.logger().Warn("Subdomain enumeration failed", "domain", d, "error", err)
+			continue
+		}
+		for _, s := range subs {
+			if !seen[s] {
+				seen[s] = true
+				fqdns = append(fqdns, s)
+			}
+		}
+	}
+	if len(fqdns) > len(domains) {
+		w.logger().Info("Expanded batch with subdomains", "domains", len(domains), "fqdns", len(fqdns))
+	}
+	return fqdns
+}
+
+// processBatch scans all FQDNs in the batch for LOC records, returning them
+// and, of the FQDNs, how many were tried before ctx ended and which were
+// conclusively checked (see checkedFQDNs).
+func (w *Worker) processBatch(ctx context.Context, fqdns []string) ([]api.LOCRecord, int, []string) {
+	w.logger().Info("Processing batch", "fqdns", len(fqdns))
 
 	// Scan all FQDNs for LOC records
 	dnsStart := time.Now()
@@ -237,9 +461,57 @@ func (w *Worker) processBatch(ctx context.Context, fqdns []string) []api.LOCReco
 	// Record DNS metrics
 	if w.Metrics != nil {
 		w.Metrics.DNSDuration.WithLabelValues(BucketCount(len(fqdns))).Observe(dnsDuration)
+		w.Metrics.recordDNSStatuses(locResults)
+	}
+
+	locRecords := w.collectLOCRecords(locResults)
+
+	// Record LOC records found distribution
+	if w.Metrics != nil {
+		w.Metrics.LOCRecordsFound.Observe(float64(len(locRecords)))
+	}
+
+	return locRecords, countTried(ctx, locResults), checkedFQDNs(locResults, locRecords)
+}
+
+// checkedFQDNs returns the FQDNs whose lookups settled whether they have a
+// LOC record: answered NOERROR or NXDOMAIN, with any LOC answer among
+// records. Failed, timed out and cut short lookups, other statuses such as
+// SERVFAIL, and LOC answers that couldn't be parsed are left out, so the
+// coordinator doesn't take them as having no LOC record.
+func checkedFQDNs(results []LOCResult, records []api.LOCRecord) []string {
+	parsed := make(map[string]bool, len(records))
+	for _, rec := range records {
+		parsed[rec.FQDN] = true
+	}
+	checked := make([]string, 0, len(results))
+	for _, r := range results {
+		if !r.definitive() || (r.HasLOC && !parsed[r.FQDN]) {
+			continue
+		}
+		checked = append(checked, r.FQDN)
+	}
+	return checked
+}
+
+// countTried counts the lookups that weren't cut short by ctx ending.
+// Failures for other reasons still count: the FQDN was tried.
+func countTried(ctx context.Context, results []LOCResult) int {
+	tried := len(results)
+	if ctx.Err() == nil {
+		return tried
 	}
+	for _, r := range results {
+		if errors.Is(r.Error, context.DeadlineExceeded) || errors.Is(r.Error, context.Canceled) {
+			tried--
+		}
+	}
+	return tried
+}
 
-	// Collect LOC records
+// collectLOCRecords parses the LOC answers among lookup results, counting and
+// keeping any that can't be parsed.
+func (w *Worker) collectLOCRecords(locResults []LOCResult) []api.LOCRecord {
 	var locRecords []api.LOCRecord
 	for _, locResult := range locResults {
 		if locResult.Error != nil {
@@ -250,20 +522,23 @@ func (w *Worker) processBatch(ctx context.Context, fqdns []string) []api.LOCReco
 		}
 
 		// Parse the LOC record
-		locRecord, err := ParseLOCRecordLenient(locResult.FQDN, locResult.RawRecord)
+		locRecord, err := loc.ParseLOCRecordLenient(locResult.FQDN, locResult.RawRecord)
 		if err != nil {
-			log.Printf("[Worker %d] Failed to parse LOC for %s: %v", w.ID, locResult.FQDN, err)
+			w.logger().Warn("Failed to parse LOC record", "fqdn", locResult.FQDN, "error", err)
+			if w.Metrics != nil {
+				w.Metrics.LOCParseFailures.Inc()
+				w.Metrics.RecentParseFailures.Add(ParseFailure{
+					FQDN:      locResult.FQDN,
+					RawRecord: locResult.RawRecord,
+					Error:     err.Error(),
+					At:        time.Now(),
+				})
+			}
 			continue
 		}
 
 		locRecords = append(locRecords, *locRecord)
-		log.Printf("[Worker %d] Found LOC record: %s -> %s", w.ID, locResult.FQDN, locResult.RawRecord)
+		w.logger().Info("Found LOC record", "fqdn", locResult.FQDN, "record", locResult.RawRecord)
 	}
-
-	// Record LOC records found distribution
-	if w.Metrics != nil {
-		w.Metrics.LOCRecordsFound.Observe(float64(len(locRecords)))
-	}
-
 	return locRecords
 }
@@ -0,0 +1,561 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zmap/zdns/v2/src/zdns"
+
+	"github.com/locplace/scanner/pkg/api"
+)
+
+func TestWorker_EmptyQueueDelay(t *testing.T) {
+	w := &Worker{Config: WorkerConfig{
+		EmptyQueueDelay: 30 * time.Second,
+		MaxBackoff:      5 * time.Minute,
+	}}
+
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		wantBase   time.Duration
+	}{
+		{"no advice uses configured delay", 0, 30 * time.Second},
+		{"coordinator advice is honored", 10 * time.Second, 10 * time.Second},
+		{"advice is capped at max backoff", time.Hour, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := w.emptyQueueDelay(tt.retryAfter)
+				if got < tt.wantBase/2 || got > tt.wantBase*3/2 {
+					t.Fatalf("emptyQueueDelay(%s) = %s, want within [%s, %s]",
+						tt.retryAfter, got, tt.wantBase/2, tt.wantBase*3/2)
+				}
+			}
+		})
+	}
+}
+
+func TestWorker_ReturnsBatchOnShutdown(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	var returned api.ReturnBatchRequest
+	var submitted bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/scanner/jobs":
+			// Shutdown begins while the claim is in flight
+			close(shutdownCh)
+			_ = json.NewEncoder(w).Encode(api.GetBatchResponse{BatchID: 42, Domains: []string{"example.com"}})
+		case "/api/scanner/return":
+			_ = json.NewDecoder(r.Body).Decode(&returned)
+			_ = json.NewEncoder(w).Encode(api.ReturnBatchResponse{OK: true})
+		case "/api/scanner/results":
+			submitted = true
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	coord := NewCoordinatorClient(srv.URL, "token")
+	w := NewWorker(1, WorkerConfig{}, coord, nil, nil, shutdownCh, nil)
+	w.Run(context.Background())
+
+	if returned.BatchID != 42 {
+		t.Errorf("returned batch_id = %d, want 42", returned.BatchID)
+	}
+	if returned.SessionID != coord.SessionID {
+		t.Errorf("returned session_id = %q, want %q", returned.SessionID, coord.SessionID)
+	}
+	if submitted {
+		t.Error("batch was scanned and submitted after shutdown")
+	}
+}
+
+func TestWorker_CollectLOCRecords_CountsParseFailures(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics(reg)
+	w := &Worker{Metrics: metrics}
+
+	records := w.collectLOCRecords([]LOCResult{
+		{FQDN: "good.example.", HasLOC: true, RawRecord: "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"},
+		{FQDN: "bad.example.", HasLOC: true, RawRecord: "not a LOC record"},
+		{FQDN: "none.example."},
+	})
+
+	if len(records) != 1 || records[0].FQDN != "good.example." {
+		t.Errorf("records = %+v, want only good.example.", records)
+	}
+	if got := counterValue(t, reg, "scanner_loc_parse_failures_total"); got != 1 {
+		t.Errorf("LOCParseFailures = %v, want 1", got)
+	}
+	recent := metrics.RecentParseFailures.Recent()
+	if len(recent) != 1 || recent[0].FQDN != "bad.example." || recent[0].RawRecord != "not a LOC record" {
+		t.Errorf("recent failures = %+v, want the bad.example. record", recent)
+	}
+}
+
+// counterValue reads an unlabeled counter from reg by name.
+func counterValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name && len(mf.GetMetric()) == 1 {
+			return mf.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("counter %s not found", name)
+	return 0
+}
+
+// labeledCounterValues reads every series of a counter vector from reg,
+// keyed by the value of label.
+func labeledCounterValues(t *testing.T, reg *prometheus.Registry, name, label string) map[string]float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == label {
+					values[l.GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestWorker_TracksBatchDomains(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	tracker := NewDomainTracker()
+	domains := []string{"a.example.com", "b.example.com"}
+	var duringSubmit []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/scanner/jobs":
+			_ = json.NewEncoder(w).Encode(api.GetBatchResponse{BatchID: 7, Domains: domains})
+		case "/api/scanner/results":
+			// Still scanning as far as heartbeats are concerned until submitted
+			duringSubmit = tracker.List()
+			close(shutdownCh)
+			_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dns := NewDNSScanner(DNSConfig{Workers: 2}, nil)
+	dns.query = func(context.Context, string) (locAnswer, error) { return locAnswer{}, nil }
+	w := NewWorker(1, DefaultWorkerConfig(), NewCoordinatorClient(srv.URL, "token"), dns, tracker, shutdownCh, nil)
+	w.Run(context.Background())
+
+	if !slices.Equal(duringSubmit, domains) {
+		t.Errorf("tracked while processing = %v, want %v", duringSubmit, domains)
+	}
+	if got := tracker.List(); len(got) != 0 {
+		t.Errorf("tracked after completion = %v, want none", got)
+	}
+}
+
+func TestWorker_EnumeratesSubdomains(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	var submitted api.SubmitBatchRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/scanner/jobs":
+			_ = json.NewEncoder(w).Encode(api.GetBatchResponse{BatchID: 7, Domains: []string{"example.com"}})
+		case "/api/scanner/results":
+			_ = json.NewDecoder(r.Body).Decode(&submitted)
+			close(shutdownCh)
+			_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var queried []string
+	dns := NewDNSScanner(DNSConfig{Workers: 2}, nil)
+	dns.query = func(_ context.Context, name string) (locAnswer, error) {
+		mu.Lock()
+		queried = append(queried, name)
+		mu.Unlock()
+		return locAnswer{}, nil
+	}
+	config := DefaultWorkerConfig()
+	config.Enumerator = fakeEnumerator{"example.com": {"www.example.com", "mail.example.com", "example.com"}}
+	w := NewWorker(1, config, NewCoordinatorClient(srv.URL, "token"), dns, nil, shutdownCh, nil)
+	w.Run(context.Background())
+
+	slices.Sort(queried)
+	if want := []string{"example.com", "mail.example.com", "www.example.com"}; !slices.Equal(queried, want) {
+		t.Errorf("scanned %v, want %v", queried, want)
+	}
+	if submitted.DomainsChecked != 3 {
+		t.Errorf("domains_checked = %d, want 3", submitted.DomainsChecked)
+	}
+}
+
+func TestCheckedFQDNs(t *testing.T) {
+	results := []LOCResult{
+		{FQDN: "noerror.example.com", Status: "NOERROR"},
+		{FQDN: "nxdomain.example.com", Status: "NXDOMAIN"},
+		{FQDN: "loc.example.com", Status: "NOERROR", HasLOC: true, RawRecord: "52 22 23.000 N 4 53 32.000 E"},
+		{FQDN: "unparseable.example.com", Status: "NOERROR", HasLOC: true, RawRecord: "garbage"},
+		{FQDN: "servfail.example.com", Status: "SERVFAIL"},
+		{FQDN: "refused.example.com", Status: "REFUSED"},
+		{FQDN: "timeout.example.com", Status: "TIMEOUT", Error: errors.New("i/o timeout")},
+		{FQDN: "error.example.com", Status: "ERROR", Error: errors.New("no resolvers")},
+		{FQDN: "canceled.example.com", Error: context.Canceled},
+	}
+	records := []api.LOCRecord{{FQDN: "loc.example.com"}}
+
+	want := []string{"noerror.example.com", "nxdomain.example.com", "loc.example.com"}
+	if got := checkedFQDNs(results, records); !slices.Equal(got, want) {
+		t.Errorf("checkedFQDNs = %v, want %v", got, want)
+	}
+}
+
+func TestWorker_LookupFailuresNotChecked(t *testing.T) {
+	shutdownCh := make(chan struct{})
+	var submitted api.SubmitBatchRequest
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/scanner/jobs":
+			_ = json.NewEncoder(w).Encode(api.GetBatchResponse{BatchID: 4, Domains: []string{"gone.example.com", "flaky.example.com", "broken.example.com"}})
+		case "/api/scanner/results":
+			_ = json.NewDecoder(r.Body).Decode(&submitted)
+			close(shutdownCh)
+			_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dns := NewDNSScanner(DNSConfig{Workers: 3}, nil)
+	dns.query = func(_ context.Context, name string) (locAnswer, error) {
+		switch name {
+		case "flaky.example.com":
+			return locAnswer{Status: zdns.StatusServFail}, nil
+		case "broken.example.com":
+			return locAnswer{Status: zdns.StatusError}, errors.New("read udp: i/o timeout")
+		}
+		return locAnswer{Status: zdns.StatusNXDomain}, nil
+	}
+	w := NewWorker(1, DefaultWorkerConfig(), NewCoordinatorClient(srv.URL, "token"), dns, NewDomainTracker(), shutdownCh, nil)
+	w.Run(context.Background())
+
+	if submitted.DomainsChecked != 3 {
+		t.Errorf("domains_checked = %d, want all 3 tried", submitted.DomainsChecked)
+	}
+	// Only the NXDOMAIN answer says the name has no LOC record
+	if want := []string{"gone.example.com"}; !slices.Equal(submitted.Checked, want) {
+		t.Errorf("checked = %v, want %v", submitted.Checked, want)
+	}
+}
+
+func TestWorker_SubmitDelay(t *testing.T) {
+	w := &Worker{Config: WorkerConfig{SubmitBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 10 * time.Second},  // capped
+		{70, 10 * time.Second}, // shift overflow
+	}
+	for _, tt := range tests {
+		if got := w.submitDelay(tt.attempt); got != tt.want {
+			t.Errorf("submitDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestWorker_Submit_Retries(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxAttempts   int
+		failures      int32 // Submissions rejected before one succeeds
+		cancelOnWait  bool
+		wantCalls     int32
+		wantWaits     []time.Duration
+		wantSubmitted bool
+		wantCanceled  bool
+	}{
+		{"first try", 3, 0, false, 1, nil, true, false},
+		{"recovers", 4, 2, false, 3, []time.Duration{time.Second, 2 * time.Second}, true, false},
+		{"gives up", 4, 100, false, 4, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, false, false},
+		{"at least once", 0, 100, false, 1, nil, false, false},
+		{"canceled while waiting", 3, 100, true, 1, []time.Duration{time.Second}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(api.SubmitBatchResponse{})
+			}))
+			defer srv.Close()
+
+			cfg := DefaultWorkerConfig()
+			cfg.SubmitMaxAttempts = tt.maxAttempts
+			cfg.SubmitBackoff = time.Second
+			w := NewWorker(1, cfg, NewCoordinatorClient(srv.URL, "token"), nil, nil, nil, nil)
+			var waits []time.Duration
+			w.wait = func(_ context.Context, d time.Duration) bool {
+				waits = append(waits, d)
+				return !tt.cancelOnWait
+			}
+
+			submitted, canceled := w.submit(context.Background(), 7, 1, []string{"a.example.com"}, nil)
+			if submitted != tt.wantSubmitted || canceled != tt.wantCanceled {
+				t.Errorf("submit = (%v, %v), want (%v, %v)", submitted, canceled, tt.wantSubmitted, tt.wantCanceled)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("coordinator saw %d submissions, want %d", got, tt.wantCalls)
+			}
+			if !slices.Equal(waits, tt.wantWaits) {
+				t.Errorf("waits = %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestSleepCtx_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sleepCtx(ctx, time.Hour) {
+		t.Error("sleepCtx returned true for a canceled context")
+	}
+}
+
+// fakeCoordinator hands out queued batches and records what workers send
+// back. Once the queue runs dry it closes shutdownCh, so Run returns.
+type fakeCoordinator struct {
+	mu         sync.Mutex
+	batches    []*Batch
+	getErrs    []error // Returned by the first GetBatch calls
+	submitErrs []error // Returned by the first SubmitBatch calls
+	shutdownCh chan struct{}
+	closeOnce  sync.Once
+
+	submitted []api.SubmitBatchRequest
+	returned  []int64
+}
+
+var _ Coordinator = (*fakeCoordinator)(nil)
+
+func newFakeCoordinator(batches ...*Batch) *fakeCoordinator {
+	return &fakeCoordinator{batches: batches, shutdownCh: make(chan struct{})}
+}
+
+func (c *fakeCoordinator) GetBatch(context.Context) (*Batch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.getErrs) > 0 {
+		err := c.getErrs[0]
+		c.getErrs = c.getErrs[1:]
+		return nil, err
+	}
+	if len(c.batches) == 0 {
+		c.closeOnce.Do(func() { close(c.shutdownCh) })
+		return nil, nil
+	}
+	b := c.batches[0]
+	c.batches = c.batches[1:]
+	return b, nil
+}
+
+func (c *fakeCoordinator) SubmitBatch(_ context.Context, batchID int64, domainsChecked int, checked []string, locRecords []api.LOCRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.submitErrs) > 0 {
+		err := c.submitErrs[0]
+		c.submitErrs = c.submitErrs[1:]
+		return err
+	}
+	c.submitted = append(c.submitted, api.SubmitBatchRequest{BatchID: batchID, DomainsChecked: domainsChecked, Checked: checked, LOCRecords: locRecords})
+	return nil
+}
+
+func (c *fakeCoordinator) Heartbeat(context.Context, []string) error { return nil }
+
+func (c *fakeCoordinator) ReturnBatch(_ context.Context, batchID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.returned = append(c.returned, batchID)
+	return nil
+}
+
+// fakeDNS returns a DNSScanner answering from a table of LOC records;
+// names not in it have none.
+func fakeDNS(records map[string]string) *DNSScanner {
+	dns := NewDNSScanner(DNSConfig{Workers: 2}, nil)
+	dns.query = func(_ context.Context, name string) (locAnswer, error) {
+		return locAnswer{Status: zdns.StatusNoError, LOC: records[name]}, nil
+	}
+	return dns
+}
+
+func TestWorker_Run_ClaimScanSubmit(t *testing.T) {
+	const raw = "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"
+	coord := newFakeCoordinator(
+		&Batch{ID: 1, Domains: []string{"a.example.com", "loc.example.com"}},
+		&Batch{ID: 2, Domains: []string{"b.example.com"}},
+	)
+	reg := prometheus.NewRegistry()
+	tracker := NewDomainTracker()
+
+	w := NewWorker(1, DefaultWorkerConfig(), coord, fakeDNS(map[string]string{"loc.example.com": raw}),
+		tracker, coord.shutdownCh, NewMetrics(reg))
+	w.Run(context.Background())
+
+	if len(coord.submitted) != 2 {
+		t.Fatalf("submitted %d batches, want 2: %+v", len(coord.submitted), coord.submitted)
+	}
+	first, second := coord.submitted[0], coord.submitted[1]
+	if first.BatchID != 1 || first.DomainsChecked != 2 || len(first.LOCRecords) != 1 {
+		t.Errorf("first submission = %+v, want batch 1 with 2 domains and 1 record", first)
+	} else if rec := first.LOCRecords[0]; rec.FQDN != "loc.example.com" || rec.RawRecord != raw {
+		t.Errorf("record = %+v, want loc.example.com's", rec)
+	}
+	if second.BatchID != 2 || second.DomainsChecked != 1 || len(second.LOCRecords) != 0 {
+		t.Errorf("second submission = %+v, want batch 2 with 1 domain and no records", second)
+	}
+	if len(coord.returned) != 0 {
+		t.Errorf("returned batches %v, want none", coord.returned)
+	}
+	if got := tracker.List(); len(got) != 0 {
+		t.Errorf("still tracking %v after submitting", got)
+	}
+	if got := counterValue(t, reg, "scanner_fqdns_processed_total"); got != 3 {
+		t.Errorf("fqdns processed = %v, want 3", got)
+	}
+	if got := counterValue(t, reg, "scanner_loc_records_found_total"); got != 1 {
+		t.Errorf("LOC records found = %v, want 1", got)
+	}
+}
+
+func TestWorker_Run_RecoversFromCoordinatorErrors(t *testing.T) {
+	coord := newFakeCoordinator(&Batch{ID: 9, Domains: []string{"a.example.com"}})
+	coord.getErrs = []error{errors.New("connection refused"), errors.New("connection refused")}
+	coord.submitErrs = []error{errors.New("503 Service Unavailable")}
+
+	cfg := DefaultWorkerConfig()
+	cfg.RetryDelay = time.Millisecond
+	cfg.SubmitMaxAttempts = 2
+	w := NewWorker(1, cfg, coord, fakeDNS(nil), NewDomainTracker(), coord.shutdownCh, nil)
+	w.wait = func(context.Context, time.Duration) bool { return true }
+	w.Run(context.Background())
+
+	if len(coord.submitted) != 1 || coord.submitted[0].BatchID != 9 {
+		t.Errorf("submitted %+v, want batch 9 once", coord.submitted)
+	}
+	if w.consecutiveErrors != 0 {
+		t.Errorf("consecutiveErrors = %d after recovering, want 0", w.consecutiveErrors)
+	}
+}
+
+func TestWorker_Run_MaxBatchDuration(t *testing.T) {
+	const raw = "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"
+	coord := newFakeCoordinator(&Batch{ID: 3, Domains: []string{
+		"fast.example.com", "loc.example.com", "slow-1.example.com", "slow-2.example.com",
+	}})
+
+	// slow-* names never answer; they hang until the batch deadline
+	dns := NewDNSScanner(DNSConfig{Workers: 4}, nil)
+	dns.query = func(ctx context.Context, name string) (locAnswer, error) {
+		if strings.HasPrefix(name, "slow-") {
+			<-ctx.Done()
+			return locAnswer{}, ctx.Err()
+		}
+		if name == "loc.example.com" {
+			return locAnswer{Status: zdns.StatusNoError, LOC: raw}, nil
+		}
+		return locAnswer{Status: zdns.StatusNoError}, nil
+	}
+
+	cfg := DefaultWorkerConfig()
+	cfg.MaxBatchDuration = 50 * time.Millisecond
+	w := NewWorker(1, cfg, coord, dns, NewDomainTracker(), coord.shutdownCh, nil)
+
+	start := time.Now()
+	w.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Run took %s, want it cut short by MaxBatchDuration", elapsed)
+	}
+
+	if len(coord.submitted) != 1 {
+		t.Fatalf("submitted %+v, want the one batch", coord.submitted)
+	}
+	got := coord.submitted[0]
+	if got.BatchID != 3 || got.DomainsChecked != 2 {
+		t.Errorf("submitted batch %d with %d domains checked, want batch 3 with 2", got.BatchID, got.DomainsChecked)
+	}
+	// Only the names looked up are reported, so the coordinator leaves
+	// the slow ones' records alone
+	slices.Sort(got.Checked)
+	if want := []string{"fast.example.com", "loc.example.com"}; !slices.Equal(got.Checked, want) {
+		t.Errorf("checked = %v, want %v", got.Checked, want)
+	}
+	if len(got.LOCRecords) != 1 || got.LOCRecords[0].FQDN != "loc.example.com" {
+		t.Errorf("LOC records = %+v, want loc.example.com's", got.LOCRecords)
+	}
+}
+
+func TestCountTried(t *testing.T) {
+	results := []LOCResult{
+		{FQDN: "a.example.com"},
+		{FQDN: "b.example.com", Error: errors.New("SERVFAIL")},
+		{FQDN: "c.example.com", Error: context.DeadlineExceeded},
+		{FQDN: "d.example.com", Error: context.Canceled},
+	}
+	if got := countTried(context.Background(), results); got != 4 {
+		t.Errorf("countTried with a live context = %d, want all 4", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := countTried(ctx, results); got != 2 {
+		t.Errorf("countTried after the deadline = %d, want 2 (failed lookups still count)", got)
+	}
+}
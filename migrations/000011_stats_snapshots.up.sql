@@ -0,0 +1,10 @@
+-- Migration 011: Periodic stats snapshots for charting discovery growth over time
+CREATE TABLE stats_snapshots (
+    id                  BIGSERIAL PRIMARY KEY,
+    captured_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    total_loc_records   INT NOT NULL,
+    domains_with_loc    INT NOT NULL,
+    active_scanners     INT NOT NULL
+);
+
+CREATE INDEX idx_stats_snapshots_captured ON stats_snapshots(captured_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_loc_records_file;
+ALTER TABLE loc_records DROP COLUMN IF EXISTS file_id;
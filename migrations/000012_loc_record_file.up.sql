@@ -0,0 +1,6 @@
+-- Migration 012: Track which domain file each LOC record was discovered from
+-- Enables per-file yield reporting. NULL for records found before this migration
+-- and for ones found by manual scans, which aren't read from a file.
+ALTER TABLE loc_records ADD COLUMN file_id INT REFERENCES domain_files(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_loc_records_file ON loc_records(file_id) WHERE file_id IS NOT NULL;
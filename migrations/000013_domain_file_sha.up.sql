@@ -0,0 +1,3 @@
+-- Migration 013: Track the upstream blob SHA of each domain file
+-- Re-discovery compares SHAs so files whose content changed upstream are re-queued.
+ALTER TABLE domain_files ADD COLUMN sha TEXT;
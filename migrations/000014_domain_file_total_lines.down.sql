@@ -0,0 +1 @@
+ALTER TABLE domain_files DROP COLUMN IF EXISTS total_lines;
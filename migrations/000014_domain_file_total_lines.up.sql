@@ -0,0 +1,4 @@
+-- Migration 014: Record total line count when a file finishes feeding
+-- Lets the feeder detect when a later run of the same file reads far fewer lines
+-- (truncated download or upstream content change).
+ALTER TABLE domain_files ADD COLUMN total_lines BIGINT;
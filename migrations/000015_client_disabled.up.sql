@@ -0,0 +1,3 @@
+-- Migration 015: Allow suspending scanner clients without deleting them
+-- Disabled clients keep their history but are rejected by scanner auth.
+ALTER TABLE scanner_clients ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_batches_pending;
+CREATE INDEX idx_batches_pending ON scan_batches(id) WHERE status = 'pending';
+
+ALTER TABLE scan_batches DROP COLUMN IF EXISTS priority;
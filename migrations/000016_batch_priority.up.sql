@@ -0,0 +1,5 @@
+-- Migration 016: Batch priority so manual scans are claimed before the feeder backlog
+ALTER TABLE scan_batches ADD COLUMN priority INT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_batches_pending;
+CREATE INDEX idx_batches_pending ON scan_batches(priority DESC, id) WHERE status = 'pending';
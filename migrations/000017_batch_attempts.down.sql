@@ -0,0 +1,7 @@
+UPDATE scan_batches SET status = 'pending' WHERE status = 'quarantined';
+
+ALTER TABLE scan_batches DROP CONSTRAINT valid_batch_status;
+ALTER TABLE scan_batches ADD CONSTRAINT valid_batch_status
+    CHECK (status IN ('pending', 'in_flight'));
+
+ALTER TABLE scan_batches DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,8 @@
+-- Migration 017: Count claim attempts per batch and quarantine poison batches
+-- A batch that keeps getting reset (e.g. it crashes scanners) is moved to
+-- 'quarantined' after too many attempts instead of cycling back to 'pending'.
+ALTER TABLE scan_batches ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+
+ALTER TABLE scan_batches DROP CONSTRAINT valid_batch_status;
+ALTER TABLE scan_batches ADD CONSTRAINT valid_batch_status
+    CHECK (status IN ('pending', 'in_flight', 'quarantined'));
@@ -0,0 +1,8 @@
+-- Migration 018: Denylist of domains that are never queued or stored
+-- A pattern is either an exact FQDN ("parked.example.com") or a suffix
+-- wildcard ("*.example.com") matching every subdomain of example.com.
+CREATE TABLE domain_denylist (
+    pattern     TEXT PRIMARY KEY,
+    reason      TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Migration 019: Track the decompressed byte offset matching processed_lines
+-- Lets the feeder resume a file from the nearest xz block with an HTTP Range
+-- request instead of downloading and skipping everything already fed.
+-- NULL means unknown; the feeder then falls back to a full download.
+ALTER TABLE domain_files ADD COLUMN processed_bytes BIGINT;
@@ -0,0 +1,5 @@
+-- Migration 020: Count the domains fed into batches per file
+-- Accumulated as batches are created, so it stays accurate across resumes.
+-- A large file that feeds nothing usually means a broken download or
+-- decompression rather than a genuinely empty file.
+ALTER TABLE domain_files ADD COLUMN lines_fed BIGINT NOT NULL DEFAULT 0;
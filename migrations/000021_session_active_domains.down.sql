@@ -0,0 +1 @@
+ALTER TABLE scanner_sessions DROP COLUMN IF EXISTS active_domains;
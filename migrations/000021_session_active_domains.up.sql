@@ -0,0 +1,3 @@
+-- Migration 021: Domains each scanner session is working on
+-- Replaced on every heartbeat, so operators can see live per-session progress.
+ALTER TABLE scanner_sessions ADD COLUMN active_domains TEXT[] NOT NULL DEFAULT '{}';
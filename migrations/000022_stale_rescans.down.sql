@@ -0,0 +1,9 @@
+-- Delete any rescan batches first (FK constraint)
+DELETE FROM scan_batches WHERE file_id = (
+    SELECT id FROM domain_files WHERE filename = '__stale_rescans__'
+);
+DELETE FROM domain_files WHERE filename = '__stale_rescans__';
+
+DROP INDEX IF EXISTS idx_loc_records_last_seen;
+ALTER TABLE loc_records DROP COLUMN IF EXISTS missing_since;
+ALTER TABLE loc_records DROP COLUMN IF EXISTS rescan_queued_at;
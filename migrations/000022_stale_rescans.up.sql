@@ -0,0 +1,12 @@
+-- Migration 022: Periodic re-verification of stored LOC records
+-- Records not seen for a while are re-queued as batches under a pseudo file.
+-- rescan_queued_at stops a record being re-queued while its rescan is pending;
+-- missing_since is set when a rescan finds no LOC record for the FQDN.
+ALTER TABLE loc_records ADD COLUMN rescan_queued_at TIMESTAMPTZ;
+ALTER TABLE loc_records ADD COLUMN missing_since TIMESTAMPTZ;
+
+CREATE INDEX idx_loc_records_last_seen ON loc_records(last_seen_at);
+
+-- Marked complete so the feeder ignores it, like __manual_submissions__
+INSERT INTO domain_files (filename, url, size_bytes, status, feeding_complete)
+VALUES ('__stale_rescans__', '', 0, 'complete', true);
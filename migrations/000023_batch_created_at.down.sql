@@ -0,0 +1 @@
+ALTER TABLE scan_batches DROP COLUMN IF EXISTS created_at;
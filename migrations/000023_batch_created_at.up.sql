@@ -0,0 +1,4 @@
+-- Migration 023: Record when each batch was queued
+-- Lets operators see how long the oldest pending batch has been waiting.
+-- Existing batches get the migration time, so their ages start from here.
+ALTER TABLE scan_batches ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,14 @@
+-- Migration 024: Remember recent result submissions
+-- A scanner retrying a submission whose response was lost sends the same
+-- idempotency key; the stored response is replayed instead of processing the
+-- results (and counting their metrics) again. Written in the same transaction
+-- that completes the batch, and deleted by the reaper after a day.
+CREATE TABLE submission_keys (
+    client_id   UUID NOT NULL REFERENCES scanner_clients(id) ON DELETE CASCADE,
+    key         TEXT NOT NULL,
+    accepted    INT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (client_id, key)
+);
+
+CREATE INDEX idx_submission_keys_created ON submission_keys(created_at);
@@ -3,6 +3,10 @@ package api
 
 import "time"
 
+// IdempotencyKeyHeader carries a key identifying a result submission across
+// retries, so the coordinator processes it only once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 // --- Admin API Types ---
 
 // RegisterClientRequest is the request body for POST /api/admin/clients.
@@ -17,6 +21,12 @@ type RegisterClientResponse struct {
 	Token string `json:"token"`
 }
 
+// RotateClientTokenResponse is the response for POST /api/admin/clients/{id}/rotate-token.
+type RotateClientTokenResponse struct {
+	ID    string `json:"id"`
+	Token string `json:"token"`
+}
+
 // ClientInfo represents a scanner client in the list response.
 type ClientInfo struct {
 	ID            string     `json:"id"`
@@ -25,6 +35,17 @@ type ClientInfo struct {
 	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
 	ActiveBatches int        `json:"active_batches"`
 	IsAlive       bool       `json:"is_alive"`
+	Disabled      bool       `json:"disabled"`
+	// Sessions are the client's live scanner instances
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// SessionInfo describes one running scanner instance.
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	ActiveDomains []string  `json:"active_domains"`
 }
 
 // ListClientsResponse is the response for GET /api/admin/clients.
@@ -42,6 +63,11 @@ type ResetScanResponse struct {
 	FilesReset int `json:"files_reset"`
 }
 
+// FeederStateResponse is the response for POST /api/admin/feeder/pause and /resume.
+type FeederStateResponse struct {
+	Paused bool `json:"paused"`
+}
+
 // ManualScanRequest is the request body for POST /api/admin/manual-scan.
 type ManualScanRequest struct {
 	Domains []string `json:"domains"`
@@ -49,7 +75,61 @@ type ManualScanRequest struct {
 
 // ManualScanResponse is the response for POST /api/admin/manual-scan.
 type ManualScanResponse struct {
-	DomainsQueued int `json:"domains_queued"`
+	DomainsQueued  int `json:"domains_queued"`
+	BatchesCreated int `json:"batches_created"`
+}
+
+// FileCoverage summarizes the outcome of scanning a single domain file.
+type FileCoverage struct {
+	ID               int        `json:"id"`
+	Filename         string     `json:"filename"`
+	Status           string     `json:"status"`
+	SizeBytes        *int64     `json:"size_bytes,omitempty"`
+	DomainsFed       int64      `json:"domains_fed"` // Domains put into batches, excluding skipped lines
+	BatchesCreated   int        `json:"batches_created"`
+	BatchesCompleted int        `json:"batches_completed"`
+	LOCRecords       int        `json:"loc_records"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// CoverageReportResponse is the response for GET /api/admin/coverage.
+type CoverageReportResponse struct {
+	Files []FileCoverage `json:"files"`
+}
+
+// FileYield is a domain file's coverage with its LOC record yield.
+type FileYield struct {
+	FileCoverage
+	LOCPerMillion float64 `json:"loc_per_million"` // LOC records per million domains fed
+}
+
+// ListFilesResponse is the response for GET /api/admin/files.
+// The totals cover the listed files.
+type ListFilesResponse struct {
+	Files         []FileYield `json:"files"`
+	DomainsFed    int64       `json:"domains_fed"`
+	LOCRecords    int         `json:"loc_records"`
+	LOCPerMillion float64     `json:"loc_per_million"`
+}
+
+// FailedBatch is a quarantined batch in the dead-letter listing.
+type FailedBatch struct {
+	BatchID   int64    `json:"batch_id"`
+	FileID    int      `json:"file_id"`
+	Filename  string   `json:"filename"`
+	LineStart int64    `json:"line_start"`
+	LineEnd   int64    `json:"line_end"`
+	Attempts  int      `json:"attempts"`
+	Domains   []string `json:"domains"`
+}
+
+// ListFailedBatchesResponse is the response for GET /api/admin/batches/failed.
+type ListFailedBatchesResponse struct {
+	Batches []FailedBatch `json:"batches"`
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
 }
 
 // --- Scanner API Types ---
@@ -57,6 +137,15 @@ type ManualScanResponse struct {
 // GetBatchRequest is the request body for POST /api/scanner/jobs.
 type GetBatchRequest struct {
 	SessionID string `json:"session_id"`
+	// BatchCount is how many batches to claim (default 1, capped by the server).
+	// When greater than 1, batches are returned in GetBatchResponse.Batches.
+	BatchCount int `json:"batch_count,omitempty"`
+}
+
+// BatchAssignment is a single claimed batch in a multi-batch response.
+type BatchAssignment struct {
+	BatchID int64    `json:"batch_id"`
+	Domains []string `json:"domains"`
 }
 
 // GetBatchResponse is the response for POST /api/scanner/jobs.
@@ -64,11 +153,35 @@ type GetBatchRequest struct {
 type GetBatchResponse struct {
 	BatchID int64    `json:"batch_id,omitempty"`
 	Domains []string `json:"domains"`
+	// RetryAfterSeconds is set when no batch is available and advises how long
+	// the scanner should wait before asking again.
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+	// Batches holds the claimed batches when more than one was requested.
+	Batches []BatchAssignment `json:"batches,omitempty"`
+}
+
+// ReadinessResponse is the response for GET /readyz.
+type ReadinessResponse struct {
+	Status string            `json:"status"` // "ok" or "unavailable"
+	Checks map[string]string `json:"checks"` // check name -> "ok" or failure reason
+}
+
+// ReturnBatchRequest is the request body for POST /api/scanner/return.
+type ReturnBatchRequest struct {
+	SessionID string `json:"session_id"`
+	BatchID   int64  `json:"batch_id"`
+}
+
+// ReturnBatchResponse is the response for POST /api/scanner/return.
+type ReturnBatchResponse struct {
+	OK bool `json:"ok"`
 }
 
 // HeartbeatRequest is the request body for POST /api/scanner/heartbeat.
 type HeartbeatRequest struct {
 	SessionID string `json:"session_id"`
+	// ActiveDomains are the domains the session is scanning right now
+	ActiveDomains []string `json:"active_domains,omitempty"`
 }
 
 // HeartbeatResponse is the response for POST /api/scanner/heartbeat.
@@ -93,6 +206,13 @@ type SubmitBatchRequest struct {
 	BatchID        int64       `json:"batch_id"`
 	DomainsChecked int         `json:"domains_checked"`
 	LOCRecords     []LOCRecord `json:"loc_records"`
+	// Checked lists the FQDNs whose lookups settled whether they have a LOC
+	// record: answered NOERROR or NXDOMAIN, with any LOC answer in
+	// LOCRecords. Only batch domains listed here without a record are
+	// marked missing; ones left out (failed lookups, SERVFAIL, unparseable
+	// LOC answers, or names not scanned before the batch ran out of time)
+	// are left alone. Older scanners omit it, and then nothing is marked.
+	Checked []string `json:"checked,omitempty"`
 }
 
 // SubmitBatchResponse is the response for POST /api/scanner/results.
@@ -100,6 +220,20 @@ type SubmitBatchResponse struct {
 	Accepted int `json:"accepted"`
 }
 
+// ScannerConfigResponse is the response for GET /api/scanner/config: the
+// settings the coordinator recommends to scanners, which fetch it
+// periodically. Zero values leave the scanner's own setting in place.
+type ScannerConfigResponse struct {
+	// BatchCount is how many batches to claim per jobs request.
+	BatchCount int `json:"batch_count,omitempty"`
+	// EmptyQueueDelaySeconds is how long to wait after finding the queue
+	// empty when the jobs response advises no retry_after_seconds.
+	EmptyQueueDelaySeconds int `json:"empty_queue_delay_seconds,omitempty"`
+	// MaxConcurrentLookups caps each scanner's DNS queries in flight. It
+	// can only lower a cap the scanner sets itself.
+	MaxConcurrentLookups int `json:"max_concurrent_lookups,omitempty"`
+}
+
 // --- Public API Types ---
 
 // PublicLOCRecord represents a LOC record in the public API.
@@ -117,6 +251,33 @@ type PublicLOCRecord struct {
 	LastSeenAt  time.Time `json:"last_seen_at"`
 }
 
+// PatchLOCRecordRequest is the request body for PATCH /api/admin/records/{fqdn}.
+// Only the fields that are set are changed.
+type PatchLOCRecordRequest struct {
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	AltitudeM *float64 `json:"altitude_m,omitempty"`
+}
+
+// DenylistEntry is a denylisted domain pattern.
+type DenylistEntry struct {
+	Pattern   string    `json:"pattern"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddDenylistEntryRequest is the request body for POST /api/admin/denylist.
+// Pattern is an exact domain or a "*." suffix wildcard.
+type AddDenylistEntryRequest struct {
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ListDenylistResponse is the response for GET /api/admin/denylist.
+type ListDenylistResponse struct {
+	Entries []DenylistEntry `json:"entries"`
+}
+
 // AggregatedLocation represents multiple LOC records at the same coordinates.
 // Used for GeoJSON export to avoid supercluster issues with identical coordinates.
 type AggregatedLocation struct {
@@ -139,6 +300,40 @@ type ListRecordsResponse struct {
 	Offset  int               `json:"offset"`
 }
 
+// NearbyLOCRecord is a LOC record with its distance from a query point.
+type NearbyLOCRecord struct {
+	PublicLOCRecord
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// ListNearbyRecordsResponse is the response for GET /api/public/records/near.
+type ListNearbyRecordsResponse struct {
+	Records  []NearbyLOCRecord `json:"records"`
+	Lat      float64           `json:"lat"`
+	Lon      float64           `json:"lon"`
+	RadiusKm float64           `json:"radius_km"`
+	Limit    int               `json:"limit"`
+}
+
+// RootDomainSummary aggregates the LOC records under one root domain.
+// The centroid is the geographic mean of the records' positions.
+type RootDomainSummary struct {
+	RootDomain  string    `json:"root_domain"`
+	FQDNCount   int       `json:"fqdn_count"`
+	CentroidLat float64   `json:"centroid_lat"`
+	CentroidLon float64   `json:"centroid_lon"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// ListRootDomainsResponse is the response for GET /api/public/domains.
+type ListRootDomainsResponse struct {
+	Domains []RootDomainSummary `json:"domains"`
+	Total   int                 `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+}
+
 // DomainFileStats holds statistics for domain file processing.
 type DomainFileStats struct {
 	Total      int `json:"total"`
@@ -149,8 +344,29 @@ type DomainFileStats struct {
 
 // BatchQueueStats holds statistics for the batch queue.
 type BatchQueueStats struct {
-	Pending  int `json:"pending"`
-	InFlight int `json:"in_flight"`
+	Pending     int `json:"pending"`
+	InFlight    int `json:"in_flight"`
+	Quarantined int `json:"quarantined"`
+}
+
+// FileQueueStats is one domain file's share of the batch queue.
+type FileQueueStats struct {
+	FileID                   int     `json:"file_id"`
+	Filename                 string  `json:"filename"`
+	Pending                  int     `json:"pending"`
+	InFlight                 int     `json:"in_flight"`
+	OldestPendingAgeSeconds  float64 `json:"oldest_pending_age_seconds"`
+	OldestInFlightAgeSeconds float64 `json:"oldest_in_flight_age_seconds"`
+}
+
+// BatchQueueStatsResponse is the response for GET /api/admin/batches/stats.
+// Ages are zero when there are no batches in that state.
+type BatchQueueStatsResponse struct {
+	Pending                  int              `json:"pending"`
+	InFlight                 int              `json:"in_flight"`
+	OldestPendingAgeSeconds  float64          `json:"oldest_pending_age_seconds"`
+	OldestInFlightAgeSeconds float64          `json:"oldest_in_flight_age_seconds"`
+	Files                    []FileQueueStats `json:"files"`
 }
 
 // CurrentFileProgress holds progress info for the currently processing file.
@@ -168,6 +384,9 @@ type StatsResponse struct {
 	TotalLOCRecords          int `json:"total_loc_records"`
 	UniqueRootDomainsWithLOC int `json:"unique_root_domains_with_loc"`
 	UniqueLocations          int `json:"unique_locations"`
+	// MissingLOCRecords counts records whose FQDN no longer returned a LOC
+	// record when last scanned; they are pruned after a grace period
+	MissingLOCRecords int `json:"missing_loc_records"`
 
 	// Scanner stats
 	ActiveScanners int `json:"active_scanners"`
@@ -176,6 +395,23 @@ type StatsResponse struct {
 	DomainFiles DomainFileStats      `json:"domain_files"`
 	BatchQueue  BatchQueueStats      `json:"batch_queue"`
 	CurrentFile *CurrentFileProgress `json:"current_file,omitempty"`
+
+	// FeederPaused is true while an operator has paused batch production
+	FeederPaused bool `json:"feeder_paused"`
+}
+
+// StatsSnapshot is a point-in-time capture of public stats.
+type StatsSnapshot struct {
+	CapturedAt      time.Time `json:"captured_at"`
+	TotalLOCRecords int       `json:"total_loc_records"`
+	DomainsWithLOC  int       `json:"domains_with_loc"`
+	ActiveScanners  int       `json:"active_scanners"`
+}
+
+// StatsHistoryResponse is the response for GET /api/public/stats/history.
+type StatsHistoryResponse struct {
+	Since     time.Time       `json:"since"`
+	Snapshots []StatsSnapshot `json:"snapshots"`
 }
 
 // ErrorResponse is a standard error response.
@@ -1,5 +1,7 @@
-// Package scanner provides the DNS LOC record scanner implementation.
-package scanner
+// Package loc parses DNS LOC record text into coordinates. It is shared by
+// the scanner, which parses lookup results, and the coordinator, which
+// re-parses submitted records to check them.
+package loc
 
 import (
 	"fmt"